@@ -0,0 +1,193 @@
+package geoip_test
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"github.com/rs/zerolog"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// 基准测试的数据规模，如 go test -bench . -run ^$ -geoip.blocks 100000
+var benchBlocks = flag.Int("geoip.blocks", 10000, "基准测试生成的 IPv4 地址段数量")
+
+// quiet 基准测试期间关闭加载日志，避免输出混入测试结果
+func quiet(b *testing.B) {
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	b.Cleanup(func() { zerolog.SetGlobalLevel(level) })
+}
+
+type backend struct {
+	name string
+	geo  geoip.Geoip2
+}
+
+// backends 将同一份生成的数据加载到每个 Geoip2 实现
+func backends(b *testing.B) ([]backend, geoiptest.Dataset) {
+	b.Helper()
+	quiet(b)
+	dataset := geoiptest.Generate(*benchBlocks, 1)
+
+	dir := b.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "geoip2.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	editions, err := dataset.WriteCSV(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	loader := geoip.NewGeoLite2Loader(db)
+	loader.SetIPVersions(geoip.IPv4AndIPv6)
+	if err := loader.Local(editions.ASN, editions.City, editions.Country); err != nil {
+		b.Fatal(err)
+	}
+
+	return []backend{
+		{"Geolite2", geoip.NewGeolite2(db)},
+		{"Fake", geoiptest.NewFake(dataset)},
+	}, dataset
+}
+
+// benchmarkLookup 对每个实现逐个查询随机 IP，未命中的 IP 不视为错误
+func benchmarkLookup(b *testing.B, lookup func(geo geoip.Geoip2, ip net.IP) error) {
+	all, dataset := backends(b)
+	ips := dataset.SampleIPs(1024, 2)
+
+	for _, backend := range all {
+		b.Run(backend.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := lookup(backend.geo, ips[i%len(ips)]); err != nil && !errors.Is(err, sql.ErrNoRows) {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAsnBlock(b *testing.B) {
+	benchmarkLookup(b, func(geo geoip.Geoip2, ip net.IP) error {
+		_, err := geo.AsnBlock(ip)
+		return err
+	})
+}
+
+func BenchmarkCityBlock(b *testing.B) {
+	benchmarkLookup(b, func(geo geoip.Geoip2, ip net.IP) error {
+		_, err := geo.CityBlock(ip)
+		return err
+	})
+}
+
+func BenchmarkCountryBlock(b *testing.B) {
+	benchmarkLookup(b, func(geo geoip.Geoip2, ip net.IP) error {
+		_, err := geo.CountryBlock(ip)
+		return err
+	})
+}
+
+// BenchmarkBulk 每次操作依次查询 1000 个 IP 的 ASN、城市及国家信息，分别测试串行与并行
+func BenchmarkBulk(b *testing.B) {
+	all, dataset := backends(b)
+	ips := dataset.SampleIPs(1000, 3)
+
+	lookup := func(b *testing.B, geo geoip.Geoip2, ip net.IP) {
+		if _, err := geo.AsnBlock(ip); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			b.Error(err)
+		}
+		if _, err := geo.CityBlock(ip); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			b.Error(err)
+		}
+		if _, err := geo.CountryBlock(ip); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			b.Error(err)
+		}
+	}
+
+	for _, backend := range all {
+		b.Run(backend.name+"/Serial", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, ip := range ips {
+					lookup(b, backend.geo, ip)
+				}
+			}
+			b.ReportMetric(float64(b.N*len(ips))/b.Elapsed().Seconds(), "ips/s")
+		})
+		b.Run(backend.name+"/Parallel", func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					for _, ip := range ips {
+						lookup(b, backend.geo, ip)
+					}
+				}
+			})
+			b.ReportMetric(float64(b.N*len(ips))/b.Elapsed().Seconds(), "ips/s")
+		})
+	}
+}
+
+// BenchmarkLoader 每次操作将生成的 CSV 完整加载到新的数据库，rows/s 为每秒写入的行数
+func BenchmarkLoader(b *testing.B) {
+	quiet(b)
+	dataset := geoiptest.Generate(*benchBlocks, 1)
+	dir := b.TempDir()
+	editions, err := dataset.WriteCSV(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var rows int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		db, err := sql.Open("sqlite3", filepath.Join(b.TempDir(), "geoip2.db"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		loader := geoip.NewGeoLite2Loader(db)
+		loader.SetIPVersions(geoip.IPv4AndIPv6)
+		loader.SetProgress(func(progress geoip.Progress) {
+			if progress.Done && progress.Stage == geoip.StageLoad {
+				rows += progress.Rows
+			}
+		})
+		b.StartTimer()
+
+		if err := loader.Local(editions.ASN, editions.City, editions.Country); err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		db.Close()
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(rows)/b.Elapsed().Seconds(), "rows/s")
+}
+
+// BenchmarkLookupMany 每次操作批量查询与 BenchmarkBulk 相同的 1000 个 IP
+func BenchmarkLookupMany(b *testing.B) {
+	all, dataset := backends(b)
+	ips := dataset.SampleIPs(1000, 3)
+
+	for _, backend := range all {
+		b.Run(backend.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := backend.geo.LookupMany(ips, geoip.LookupOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*len(ips))/b.Elapsed().Seconds(), "ips/s")
+		})
+	}
+}
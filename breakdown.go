@@ -0,0 +1,384 @@
+package geoip
+
+import (
+	"errors"
+	"math/big"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Breakdown 地址范围内 GeoLite2 地址段的分解结果
+type Breakdown struct {
+	StartIP   net.IP   `json:"start_ip"`
+	EndIP     net.IP   `json:"end_ip"`
+	Addresses *big.Int `json:"addresses"`
+	// Ranges 按地址顺序首尾相接覆盖整个范围，在 ASN、城市、国家任一地址段的边界处分段
+	Ranges []BreakdownRange `json:"ranges"`
+	// Countries 各国家的地址数，按地址数从多到少排序，国家取国家地址段的地域，没有时取城市地址段的地域
+	Countries []AddressCount `json:"countries"`
+	// ASNs 各 ASN 的地址数，按地址数从多到少排序
+	ASNs []AddressCount `json:"asns"`
+}
+
+// BreakdownRange 分解结果中的一段地址，地址段已裁剪到查询范围，某类地址段不存在时对应字段为 nil
+type BreakdownRange struct {
+	StartIP   net.IP        `json:"start_ip"`
+	EndIP     net.IP        `json:"end_ip"`
+	Addresses *big.Int      `json:"addresses"`
+	ASN       *ASNBlock     `json:"asn,omitempty"`
+	City      *CityBlock    `json:"city,omitempty"`
+	Country   *CountryBlock `json:"country,omitempty"`
+}
+
+// Gap 该段地址没有任何 GeoLite2 数据
+func (r *BreakdownRange) Gap() bool {
+	return r.ASN == nil && r.City == nil && r.Country == nil
+}
+
+// AddressCount 按国家或 ASN 统计的地址数
+type AddressCount struct {
+	// Key 国家 ISO 代码或 ASN 编号
+	Key string `json:"key"`
+	// Name 国家名称或 ASN 组织
+	Name      string   `json:"name"`
+	Addresses *big.Int `json:"addresses"`
+}
+
+// Gaps 返回没有任何 GeoLite2 数据的地址段
+func (breakdown *Breakdown) Gaps() []BreakdownRange {
+	var gaps []BreakdownRange
+	for _, r := range breakdown.Ranges {
+		if r.Gap() {
+			gaps = append(gaps, r)
+		}
+	}
+	return gaps
+}
+
+// ParseIPRange 解析 CIDR、单个 IP 或以 - 连接的起止地址（如 1.0.0.0-1.0.0.255），返回起止地址。
+// IPv4 地址返回 4 字节，起止地址的协议必须相同
+func ParseIPRange(value string) (start, end net.IP, err error) {
+	value = strings.TrimSpace(value)
+	if from, to, ok := strings.Cut(value, "-"); ok {
+		first, err := netip.ParseAddr(strings.TrimSpace(from))
+		if err != nil {
+			return nil, nil, errors.New("无效的起始地址：" + from)
+		}
+		last, err := netip.ParseAddr(strings.TrimSpace(to))
+		if err != nil {
+			return nil, nil, errors.New("无效的结束地址：" + to)
+		}
+		first, last = first.Unmap(), last.Unmap()
+		if first.Is4() != last.Is4() {
+			return nil, nil, errors.New("起止地址的协议不同：" + value)
+		}
+		if last.Less(first) {
+			return nil, nil, errors.New("起始地址大于结束地址：" + value)
+		}
+		return first.AsSlice(), last.AsSlice(), nil
+	}
+
+	ipNet, err := parseNetwork(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix, ok := netipPrefix(ipNet)
+	if !ok {
+		return nil, nil, errors.New("无效的地址段：" + value)
+	}
+	return prefix.Addr().AsSlice(), lastAddr(prefix).AsSlice(), nil
+}
+
+// netipPrefix 转换为 netip.Prefix，IPv4 映射的 IPv6 地址段按 IPv4 处理
+func netipPrefix(ipNet *net.IPNet) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(ipNet.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits == 0 {
+		return netip.Prefix{}, false
+	}
+	if addr.Is4In6() {
+		addr = addr.Unmap()
+		if bits == 128 {
+			ones -= 96
+		}
+	}
+	prefix, err := addr.Prefix(ones)
+	return prefix, err == nil
+}
+
+// lastAddr 地址段的最后一个地址
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().As16()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += 96
+	}
+	for i := bits; i < 128; i++ {
+		bytes[i/8] |= 1 << (7 - i%8)
+	}
+	addr := netip.AddrFrom16(bytes)
+	if prefix.Addr().Is4() {
+		return addr.Unmap()
+	}
+	return addr
+}
+
+// addressCount 起止地址之间（含两端）的地址数
+func addressCount(first, last netip.Addr) *big.Int {
+	a, b := first.As16(), last.As16()
+	count := new(big.Int).SetBytes(b[:])
+	count.Sub(count, new(big.Int).SetBytes(a[:]))
+	return count.Add(count, big.NewInt(1))
+}
+
+// span 裁剪到查询范围的地址段，index 为地址段在输入中的下标
+type span struct {
+	first, last netip.Addr
+	index       int
+}
+
+// clipSpans 解析地址段并裁剪到 [first, last]，忽略不相交的地址段，按起始地址排序
+func clipSpans(networks []string, first, last netip.Addr) ([]span, error) {
+	var spans []span
+	for i, network := range networks {
+		ipNet, err := parseNetwork(network)
+		if err != nil {
+			return nil, err
+		}
+		prefix, ok := netipPrefix(ipNet)
+		if !ok {
+			return nil, errors.New("无效的地址段：" + network)
+		}
+		s := span{prefix.Addr(), lastAddr(prefix), i}
+		if s.first.Is4() != first.Is4() || s.last.Less(first) || last.Less(s.first) {
+			continue
+		}
+		if s.first.Less(first) {
+			s.first = first
+		}
+		if last.Less(s.last) {
+			s.last = last
+		}
+		spans = append(spans, s)
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].first.Less(spans[j].first) })
+	return spans, nil
+}
+
+// spanCursor 按地址顺序查找包含地址的 span
+type spanCursor struct {
+	spans []span
+	next  int
+}
+
+// find 返回包含 addr 的地址段下标，没有时返回 -1。addr 必须递增
+func (cursor *spanCursor) find(addr netip.Addr) int {
+	for cursor.next < len(cursor.spans) && cursor.spans[cursor.next].last.Less(addr) {
+		cursor.next++
+	}
+	if cursor.next < len(cursor.spans) && !addr.Less(cursor.spans[cursor.next].first) {
+		return cursor.spans[cursor.next].index
+	}
+	return -1
+}
+
+// NewBreakdown 以 start 至 end 范围内的地址段生成分解结果，忽略与范围不相交的地址段，用于自定义 Geoip2 实现。
+// 同类地址段之间不应重叠
+func NewBreakdown(start, end net.IP, asns []ASNBlock, cities []CityBlock, countries []CountryBlock) (*Breakdown, error) {
+	first, ok := netip.AddrFromSlice(start)
+	if !ok {
+		return nil, errors.New("无效的起始地址：" + start.String())
+	}
+	last, ok := netip.AddrFromSlice(end)
+	if !ok {
+		return nil, errors.New("无效的结束地址：" + end.String())
+	}
+	first, last = first.Unmap(), last.Unmap()
+	if first.Is4() != last.Is4() || last.Less(first) {
+		return nil, errors.New("无效的地址范围：" + start.String() + "-" + end.String())
+	}
+
+	networks := make([][]string, 3)
+	for _, block := range asns {
+		networks[0] = append(networks[0], block.Network)
+	}
+	for _, block := range cities {
+		networks[1] = append(networks[1], block.Network)
+	}
+	for _, block := range countries {
+		networks[2] = append(networks[2], block.Network)
+	}
+	cursors := make([]spanCursor, len(networks))
+	bounds := []netip.Addr{first}
+	for i := range networks {
+		spans, err := clipSpans(networks[i], first, last)
+		if err != nil {
+			return nil, err
+		}
+		cursors[i].spans = spans
+		for _, s := range spans {
+			bounds = append(bounds, s.first)
+			if s.last.Less(last) {
+				bounds = append(bounds, s.last.Next())
+			}
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i].Less(bounds[j]) })
+
+	breakdown := &Breakdown{StartIP: first.AsSlice(), EndIP: last.AsSlice(), Addresses: addressCount(first, last)}
+	countryCounts := make(map[string]*AddressCount)
+	asnCounts := make(map[string]*AddressCount)
+	for i, bound := range bounds {
+		if i > 0 && bound == bounds[i-1] {
+			continue
+		}
+		rangeEnd := last
+		for j := i + 1; j < len(bounds); j++ {
+			if bounds[j] != bound {
+				rangeEnd = bounds[j].Prev()
+				break
+			}
+		}
+		r := BreakdownRange{StartIP: bound.AsSlice(), EndIP: rangeEnd.AsSlice(), Addresses: addressCount(bound, rangeEnd)}
+		if index := cursors[0].find(bound); index >= 0 {
+			block := asns[index]
+			r.ASN = &block
+			addCount(asnCounts, strconv.Itoa(block.AutonomousSystemNumber), block.AutonomousSystemOrganization,
+				r.Addresses)
+		}
+		if index := cursors[1].find(bound); index >= 0 {
+			block := cities[index]
+			r.City = &block
+		}
+		if index := cursors[2].find(bound); index >= 0 {
+			block := countries[index]
+			r.Country = &block
+		}
+		if r.Country != nil && r.Country.Location() != nil {
+			location := r.Country.Location()
+			addCount(countryCounts, location.CountryISOCode, location.CountryName, r.Addresses)
+		} else if r.City != nil && r.City.Location() != nil {
+			location := r.City.Location()
+			addCount(countryCounts, location.CountryISOCode, location.CountryName, r.Addresses)
+		}
+		breakdown.Ranges = append(breakdown.Ranges, r)
+	}
+	breakdown.Countries = sortCounts(countryCounts)
+	breakdown.ASNs = sortCounts(asnCounts)
+
+	return breakdown, nil
+}
+
+func addCount(counts map[string]*AddressCount, key, name string, addresses *big.Int) {
+	if key == "" {
+		return
+	}
+	c, ok := counts[key]
+	if !ok {
+		c = &AddressCount{Key: key, Name: name, Addresses: new(big.Int)}
+		counts[key] = c
+	}
+	c.Addresses.Add(c.Addresses, addresses)
+}
+
+// sortCounts 按地址数从多到少排序，地址数相同时按 Key 排序
+func sortCounts(counts map[string]*AddressCount) []AddressCount {
+	sorted := make([]AddressCount, 0, len(counts))
+	for _, c := range counts {
+		sorted = append(sorted, *c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if c := sorted[i].Addresses.Cmp(sorted[j].Addresses); c != 0 {
+			return c > 0
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// rangeOverlaps 按起始地址顺序读取与 [start, end] 相交的地址段，查询见 overlapQuery，每行回调一次 fn，
+// 回调时 payload 中为该地址段的数据，table 与 query 见 asnRangeQuery，table 不存在时没有回调
+func (geo Geolite2) rangeOverlaps(table, query string, start, end interface{}, payload []interface{}, fn func()) error {
+	exists, err := geo.tableExists(table)
+	if err != nil || !exists {
+		return err
+	}
+	rows, err := geo.db.Query(overlapQuery(table, query), start, start, end, start)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var first, last interface{}
+	dest := append([]interface{}{&first, &last}, payload...)
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		fn()
+	}
+	return rows.Err()
+}
+
+// Breakdown 查询与 network 相交的全部 ASN、城市及国家地址段并裁剪到 network 范围内，
+// network 为 CIDR、单个 IP 或起止地址，见 ParseIPRange。只使用 GeoLite2 数据，不受覆盖地址段及 ASN 来源影响，
+// 地址不经过 Normalize。language 为空时与 CityBlock、CountryBlock 相同，取数据库中的第一个语言
+func (geo Geolite2) Breakdown(language, network string) (*Breakdown, error) {
+	start, end, err := ParseIPRange(network)
+	if err != nil {
+		return nil, err
+	}
+	version, first, last := "IPv6", interface{}(IP2Bytes(start)), interface{}(IP2Bytes(end))
+	if start.To4() != nil {
+		version, first, last = "IPv4", IP2Int(start), IP2Int(end)
+	}
+
+	var asns []ASNBlock
+	var asn ASNBlock
+	table, query, payload := asnRangeQuery(version, &asn)
+	if err := geo.rangeOverlaps(table, query, first, last, payload, func() {
+		asns = append(asns, asn)
+	}); err != nil {
+		return nil, err
+	}
+
+	var cities []CityBlock
+	var city CityBlock
+	table, query, payload = cityRangeQuery(version, &city)
+	if err := geo.rangeOverlaps(table, query, first, last, payload, func() {
+		cities = append(cities, city)
+	}); err != nil {
+		return nil, err
+	}
+	matchedCities := make([]*CityBlock, len(cities))
+	for i := range cities {
+		matchedCities[i] = &cities[i]
+	}
+	if err := geo.resolveCityBlocks(matchedCities, language); err != nil {
+		return nil, err
+	}
+
+	var countries []CountryBlock
+	var country CountryBlock
+	table, query, payload = countryRangeQuery(version, &country)
+	if err := geo.rangeOverlaps(table, query, first, last, payload, func() {
+		countries = append(countries, country)
+	}); err != nil {
+		return nil, err
+	}
+	matchedCountries := make([]*CountryBlock, len(countries))
+	for i := range countries {
+		matchedCountries[i] = &countries[i]
+	}
+	if err := geo.resolveCountryBlocks(matchedCountries, language); err != nil {
+		return nil, err
+	}
+
+	return NewBreakdown(start, end, asns, cities, countries)
+}
@@ -0,0 +1,128 @@
+package geoip_test
+
+import (
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIPRange(t *testing.T) {
+	for value, want := range map[string][2]string{
+		"14.0.0.0/16":                {"14.0.0.0", "14.0.255.255"},
+		"14.0.1.2/16":                {"14.0.0.0", "14.0.255.255"},
+		"8.8.8.8":                    {"8.8.8.8", "8.8.8.8"},
+		" 1.0.0.1 - ::ffff:1.0.0.9 ": {"1.0.0.1", "1.0.0.9"},
+		"2003::/19":                  {"2003::", "2003:1fff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		"::ffff:5.0.0.0/112":         {"5.0.0.0", "5.0.255.255"},
+		"2001:4860::1-2001:4860::ff": {"2001:4860::1", "2001:4860::ff"},
+		"0.0.0.0/0":                  {"0.0.0.0", "255.255.255.255"},
+	} {
+		start, end, err := geoip.ParseIPRange(value)
+		if err != nil || !start.Equal(net.ParseIP(want[0])) || !end.Equal(net.ParseIP(want[1])) {
+			t.Errorf("%q: got %s-%s %v, want %s-%s", value, start, end, err, want[0], want[1])
+		}
+		if start.To4() != nil && len(start) != net.IPv4len {
+			t.Errorf("%q: IPv4 start should be 4 bytes, got %d", value, len(start))
+		}
+	}
+	for _, value := range []string{"", "foo", "1.0.0.9-1.0.0.1", "1.0.0.1-::1", "1.0.0.1-", "1.0.0.0/33"} {
+		if _, _, err := geoip.ParseIPRange(value); err == nil {
+			t.Errorf("%q should fail", value)
+		}
+	}
+}
+
+func TestGeolite2_Breakdown(t *testing.T) {
+	dataset := geoiptest.Default()
+	db := loadDataset(t, dataset)
+	geo := geoip.NewGeolite2(db)
+	fake := geoiptest.NewFake(dataset)
+
+	breakdown, err := geo.Breakdown("en", "8.8.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breakdown.Ranges) != 3 || breakdown.Addresses.Int64() != 65536 {
+		t.Fatalf("unexpected ranges %+v", breakdown.Ranges)
+	}
+	data := breakdown.Ranges[1]
+	if !data.StartIP.Equal(net.ParseIP("8.8.8.0")) || !data.EndIP.Equal(net.ParseIP("8.8.8.255")) ||
+		data.ASN == nil || data.ASN.AutonomousSystemNumber != 15169 || data.City == nil || data.Country == nil ||
+		data.Country.Location().CountryISOCode != "US" || data.Gap() {
+		t.Errorf("unexpected range %+v", data)
+	}
+	gaps := breakdown.Gaps()
+	if len(gaps) != 2 || !gaps[0].EndIP.Equal(net.ParseIP("8.8.7.255")) || gaps[0].Addresses.Int64() != 2048 ||
+		!gaps[1].StartIP.Equal(net.ParseIP("8.8.9.0")) {
+		t.Errorf("unexpected gaps %+v", gaps)
+	}
+	if !reflect.DeepEqual(breakdown.Countries, []geoip.AddressCount{{"US", "United States", big.NewInt(256)}}) ||
+		!reflect.DeepEqual(breakdown.ASNs, []geoip.AddressCount{{"15169", "GOOGLE", big.NewInt(256)}}) {
+		t.Errorf("unexpected counts %+v %+v", breakdown.Countries, breakdown.ASNs)
+	}
+
+	// 城市地址段在 14.0.128.0 处分段，ASN 与国家地址段跨越两段；查询范围只覆盖两段各一部分
+	breakdown, err = geo.Breakdown("en", "14.0.127.0-14.0.128.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breakdown.Ranges) != 2 || breakdown.Ranges[0].Addresses.Int64() != 256 ||
+		breakdown.Ranges[1].Addresses.Int64() != 10 || breakdown.Ranges[0].City.Network != "14.0.0.0/17" ||
+		breakdown.Ranges[1].City.Network != "14.0.128.0/17" || breakdown.Ranges[1].ASN.Network != "14.0.0.0/16" {
+		t.Errorf("unexpected ranges %+v", breakdown.Ranges)
+	}
+	if len(breakdown.Countries) != 1 || breakdown.Countries[0].Addresses.Int64() != 266 || len(breakdown.Gaps()) != 0 {
+		t.Errorf("unexpected countries %+v", breakdown.Countries)
+	}
+
+	// 没有地域的匿名代理不计入国家统计
+	breakdown, err = geo.Breakdown("", "185.220.100.0/22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breakdown.Ranges) != 1 || breakdown.Ranges[0].Country.RegisteredCountry() == nil ||
+		len(breakdown.Countries) != 0 || len(breakdown.ASNs) != 1 || breakdown.ASNs[0].Addresses.Int64() != 1024 {
+		t.Errorf("unexpected breakdown %+v", breakdown)
+	}
+
+	// IPv6 地址数超出 uint64
+	breakdown, err = geo.Breakdown("en", "2003::/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := new(big.Int).Lsh(big.NewInt(1), 109)
+	if len(breakdown.Ranges) != 2 || !breakdown.Ranges[1].Gap() || len(breakdown.Countries) != 1 ||
+		breakdown.Countries[0].Key != "DE" || breakdown.Countries[0].Addresses.Cmp(want) != 0 {
+		t.Errorf("unexpected breakdown %+v", breakdown)
+	}
+
+	for _, network := range []string{"8.8.0.0/16", "14.0.0.0/8", "27.0.0.9", "185.220.100.0-185.220.101.10",
+		"196.201.0.0/15", "0.0.0.0/0", "2001:4860::/31", "2003::/16", "::/0", "10.0.0.0/8"} {
+		for _, language := range []string{"", "zh-CN", "xx"} {
+			got, err := geo.Breakdown(language, network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := fake.Breakdown(language, network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s %s: sqlite %+v, fake %+v", network, language, got, want)
+			}
+		}
+	}
+	// 只读取与查询范围相交的地址段，start_ip 索引的查找两端都有边界
+	first, last := geoip.IP2Bytes(net.ParseIP("2003::")), geoip.IP2Bytes(net.ParseIP("2003:ffff::"))
+	if plan := geoip.QueryPlan(t, db, geoip.ASNRangeQuery("IPv6"), first, first, last, first); !strings.Contains(plan,
+		"SEARCH GeoLite2ASNBlocksIPv6 USING INDEX GeoLite2ASNBlocksIPv6Start (start_ip>? AND start_ip<?)") {
+		t.Errorf("breakdown should bound the start_ip index on both sides: %s", plan)
+	}
+	if _, err := geo.Breakdown("en", "1.0.0.9-1.0.0.1"); err == nil {
+		t.Error("invalid range should fail")
+	}
+}
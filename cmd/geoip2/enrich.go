@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sechelper/geoip2/enrich"
+	"os"
+)
+
+func enrichCommand(args []string) error {
+	flags := flag.NewFlagSet("enrich", flag.ExitOnError)
+	db := flags.String("db", "geoip2.db", "GeoLite2 SQLite 数据库")
+	format := flags.String("format", "combined", "日志格式：combined、common、json、ndjson、csv")
+	ipField := flags.String("ip-field", "", "JSON 与 CSV 中 IP 所在的字段，默认 JSON 为 remote_addr，CSV 为 ip")
+	fields := flags.String("fields", "country,asn,as_org", "追加的字段，以逗号分隔")
+	prefix := flags.String("prefix", "geo_", "追加字段名的前缀")
+	language := flags.String("language", "", "地域名称使用的语言，如 zh-CN")
+	batchSize := flags.Int("batch", 8192, "每次查询的日志行数")
+	workers := flags.Int("workers", 0, "查询的并行数，默认为 CPU 核数")
+	stats := flags.Bool("stats", false, "处理结束后在标准错误输出统计")
+	flags.Parse(args)
+
+	options := enrich.Options{IPField: *ipField, Prefix: *prefix, Language: *language, BatchSize: *batchSize,
+		Workers: *workers}
+	var err error
+	if options.Format, err = enrich.ParseFormat(*format); err != nil {
+		return err
+	}
+	if options.Fields, err = enrich.ParseFields(*fields); err != nil {
+		return err
+	}
+
+	geo, closeDB, err := open(*db)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	enricher, err := enrich.New(geo, options)
+	if err != nil {
+		return err
+	}
+	result, err := enricher.Enrich(os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if *stats {
+		fmt.Fprintf(os.Stderr, "lines=%d matched=%d unparsed=%d\n", result.Lines, result.Matched, result.Unparsed)
+	}
+	return nil
+}
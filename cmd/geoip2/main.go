@@ -0,0 +1,73 @@
+// Command geoip2 基于已加载的 GeoLite2 SQLite 数据库处理日志
+//
+//	geoip2 enrich -db geoip2.db -format combined < access.log > enriched.log
+//	geoip2 report -db geoip2.db -format json -output html < access.json > report.html
+//	geoip2 tag -db geoip2.db -format aws ip-ranges.json
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	geoip "github.com/sechelper/geoip2"
+	"os"
+)
+
+var commands = map[string]func(args []string) error{
+	"enrich":  enrichCommand,
+	"overlay": overlayCommand,
+	"report":  reportCommand,
+	"rir":     rirCommand,
+	"route":   routeCommand,
+	"tag":     tagCommand,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法：geoip2 <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "command：")
+	fmt.Fprintln(os.Stderr, "  enrich   为 stdin 中的访问日志追加地域及 ASN 字段，写入 stdout")
+	fmt.Fprintln(os.Stderr, "  overlay  从 YAML 或 CSV 文件加载覆盖地址段，替换数据库中已有的覆盖地址段")
+	fmt.Fprintln(os.Stderr, "  report   统计 stdin 中的 IP 列表或访问日志，按国家、ASN、组织等汇总后写入 stdout")
+	fmt.Fprintln(os.Stderr, "  rir      导入 RIR delegated 统计文件，替换数据库中相应注册机构的地址段")
+	fmt.Fprintln(os.Stderr, "  route    导入 MRT TABLE_DUMP_V2 格式的 BGP RIB 文件，替换数据库中的路由前缀及起源 AS")
+	fmt.Fprintln(os.Stderr, "  tag      导入云服务商地址段、Tor 出口节点或 IP/CIDR 列表，替换数据库中同名标签的地址段")
+}
+
+func main() {
+	// 标准输出用于写出处理结果，日志改写到标准错误
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := command(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// open 打开已由 GeoLite2Loader 加载的数据库
+func open(path string) (geoip.Geoip2, func(), error) {
+	db, err := openReadOnly(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return geoip.NewGeolite2(db), func() { db.Close() }, nil
+}
+
+// openReadOnly 以只读方式打开数据库。go-sqlite3 只解析 file: 开头的 DSN 中的参数，
+// 否则 mode=ro 会被忽略
+func openReadOnly(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return sql.Open("sqlite3", "file:"+path+"?mode=ro")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	geoip "github.com/sechelper/geoip2"
+	"os"
+)
+
+func overlayCommand(args []string) error {
+	flags := flag.NewFlagSet("overlay", flag.ExitOnError)
+	db := flags.String("db", "geoip2.db", "GeoLite2 SQLite 数据库")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法：geoip2 overlay [flags] <overlay.yaml|overlay.csv>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("需要一个覆盖文件")
+	}
+
+	conn, err := sql.Open("sqlite3", *db)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	n, err := geoip.NewOverlayLoader(conn).LoadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已加载 %d 个覆盖地址段\n", n)
+	return nil
+}
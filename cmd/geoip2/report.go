@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"github.com/sechelper/geoip2/enrich"
+	"github.com/sechelper/geoip2/report"
+	"os"
+)
+
+func reportCommand(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	db := flags.String("db", "geoip2.db", "GeoLite2 SQLite 数据库")
+	format := flags.String("format", "combined", "输入格式：combined、common、json、ndjson、csv，IP 列表使用 combined")
+	ipField := flags.String("ip-field", "", "JSON 与 CSV 中 IP 所在的字段，默认 JSON 为 remote_addr，CSV 为 ip")
+	output := flags.String("output", "text", "输出格式：text、json、csv、html")
+	top := flags.Int("top", 10, "国家、ASN 及组织表保留的行数")
+	language := flags.String("language", "", "国家名称使用的语言，如 zh-CN")
+	workers := flags.Int("workers", 0, "查询的并行数，默认为 CPU 核数")
+	flags.Parse(args)
+
+	options := report.Options{IPField: *ipField, Top: *top, Language: *language, Workers: *workers}
+	var err error
+	if options.Format, err = enrich.ParseFormat(*format); err != nil {
+		return err
+	}
+	out, err := report.ParseOutput(*output)
+	if err != nil {
+		return err
+	}
+
+	geo, closeDB, err := open(*db)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	r, err := report.Build(geo, os.Stdin, options)
+	if err != nil {
+		return err
+	}
+	return r.Write(os.Stdout, out)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	geoip "github.com/sechelper/geoip2"
+	"os"
+)
+
+func rirCommand(args []string) error {
+	flags := flag.NewFlagSet("rir", flag.ExitOnError)
+	db := flags.String("db", "geoip2.db", "GeoLite2 SQLite 数据库")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法：geoip2 rir [flags] <delegated-*-extended-latest>...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("需要至少一个 delegated 文件")
+	}
+
+	conn, err := sql.Open("sqlite3", *db)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	n, err := geoip.NewRIRLoader(conn).LoadFile(flags.Args()...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已加载 %d 个 RIR 地址段\n", n)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	geoip "github.com/sechelper/geoip2"
+	"os"
+)
+
+func tagCommand(args []string) error {
+	flags := flag.NewFlagSet("tag", flag.ExitOnError)
+	db := flags.String("db", "geoip2.db", "GeoLite2 SQLite 数据库")
+	format := flags.String("format", "list", "标签文件格式：aws、gcp、azure、tor、list")
+	name := flags.String("name", "", "标签名，默认 aws、gcp、azure、tor-exit，list 格式必须指定")
+	remove := flags.Bool("delete", false, "删除 -name 指定标签的全部地址段")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法：geoip2 tag [flags] <file>")
+		fmt.Fprintln(os.Stderr, "      geoip2 tag -delete -name <name>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	conn, err := sql.Open("sqlite3", *db)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	loader := geoip.NewTagLoader(conn)
+
+	if *remove {
+		if *name == "" {
+			flags.Usage()
+			return errors.New("需要指定标签名")
+		}
+		return loader.Delete(*name)
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("需要一个标签文件")
+	}
+	tagFormat, err := geoip.ParseTagFormat(*format)
+	if err != nil {
+		return err
+	}
+	n, err := loader.Import(tagFormat, *name, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已加载 %d 个标签地址段\n", n)
+	return nil
+}
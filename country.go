@@ -0,0 +1,99 @@
+package geoip
+
+import (
+	"strconv"
+)
+
+// countryRef 地址段中待解析的注册国家或代表国家，country 指向地址段的对应字段
+type countryRef struct {
+	geonameID string
+	country   **Country
+}
+
+func (block *CityBlock) countryRefs() []countryRef {
+	return []countryRef{{block.RegisteredCountryGeonameID, &block.registeredCountry},
+		{block.RepresentedCountryGeonameID, &block.representedCountry}}
+}
+
+func (block *CountryBlock) countryRefs() []countryRef {
+	return []countryRef{{block.RegisteredCountryGeonameID, &block.registeredCountry},
+		{block.RepresentedCountryGeonameID, &block.representedCountry}}
+}
+
+// resolveCountries 按 geoname_id 批量查询注册国家与代表国家，language 为空时每个国家取第一条记录，
+// 与单个 IP 查询的地域信息一致
+func (geo Geolite2) resolveCountries(refs []countryRef, language string) error {
+	ids := make([]int64, len(refs))
+	for i, ref := range refs {
+		ids[i], _ = strconv.ParseInt(ref.geonameID, 10, 64)
+	}
+	locations, err := geo.countryLocationRows(geonameIDs(ids), language)
+	if err != nil {
+		return err
+	}
+
+	for i, ref := range refs {
+		if location, ok := locations[ids[i]]; ok {
+			*ref.country = &Country{CountryLocation: *location}
+		}
+	}
+	return nil
+}
+
+// cityLocationColumns 以 l 为别名 LEFT JOIN GeoLite2CityLocations 时的地域列，未关联时 geoname_id 为 0、其余为空字符串
+const cityLocationColumns = "IFNULL(l.geoname_id, 0), IFNULL(l.locale_code, ''), IFNULL(l.continent_code, ''), " +
+	"IFNULL(l.continent_name, ''), IFNULL(l.country_iso_code, ''), IFNULL(l.country_name, ''), " +
+	"IFNULL(l.subdivision_1_iso_code, ''), IFNULL(l.subdivision_1_name, ''), IFNULL(l.subdivision_2_iso_code, ''), " +
+	"IFNULL(l.subdivision_2_name, ''), IFNULL(l.city_name, ''), IFNULL(l.metro_code, ''), IFNULL(l.time_zone, ''), " +
+	"IFNULL(l.is_in_european_union, '')"
+
+// countryLocationColumns 以 l 为别名 LEFT JOIN GeoLite2CountryLocations 时的地域列
+const countryLocationColumns = "IFNULL(l.geoname_id, 0), IFNULL(l.locale_code, ''), IFNULL(l.continent_code, ''), " +
+	"IFNULL(l.continent_name, ''), IFNULL(l.country_iso_code, ''), IFNULL(l.country_name, ''), " +
+	"IFNULL(l.is_in_european_union, '')"
+
+// countryJoins 以 rc、pc 为别名关联注册国家与代表国家的 LEFT JOIN 子句，
+// table 为地址段表，locale 为语言条件右侧的表达式，如 ? 或地域表的 locale_code
+func countryJoins(table, locale string) string {
+	return " LEFT JOIN GeoLite2CountryLocations rc ON rc.geoname_id = " + table + ".registered_country_geoname_id" +
+		" AND rc.locale_code = " + locale +
+		" LEFT JOIN GeoLite2CountryLocations pc ON pc.geoname_id = " + table + ".represented_country_geoname_id" +
+		" AND pc.locale_code = " + locale
+}
+
+// countryColumns countryJoins 对应的 SELECT 列，以 countryScan 读取
+const countryColumns = "IFNULL(rc.geoname_id, 0), IFNULL(rc.locale_code, ''), IFNULL(rc.continent_code, ''), " +
+	"IFNULL(rc.continent_name, ''), IFNULL(rc.country_iso_code, ''), IFNULL(rc.country_name, ''), " +
+	"IFNULL(rc.is_in_european_union, ''), " +
+	"IFNULL(pc.geoname_id, 0), IFNULL(pc.locale_code, ''), IFNULL(pc.continent_code, ''), " +
+	"IFNULL(pc.continent_name, ''), IFNULL(pc.country_iso_code, ''), IFNULL(pc.country_name, ''), " +
+	"IFNULL(pc.is_in_european_union, '')"
+
+// coordinateColumns 以 c 为别名的城市地址段的经纬度与精度半径列，以 CityBlock.coordinateDest 读取。
+// 缺失的经纬度为空字符串，CAST 后为 0，因此另外读取经纬度是否均为数值
+const coordinateColumns = "typeof(c.latitude) = 'real' AND typeof(c.longitude) = 'real', " +
+	"CAST(c.latitude AS REAL), CAST(c.longitude AS REAL), CAST(c.accuracy_radius AS INTEGER)"
+
+// countryScan 读取 countryColumns，未关联到国家时 GeonameID 为 0
+type countryScan struct {
+	registered, represented CountryLocation
+}
+
+func (scan *countryScan) dest() []interface{} {
+	var dest []interface{}
+	for _, l := range []*CountryLocation{&scan.registered, &scan.represented} {
+		dest = append(dest, &l.GeonameID, &l.LocaleCode, &l.ContinentCode, &l.ContinentName, &l.CountryISOCode,
+			&l.CountryName, &l.IsInEuropeanUnion)
+	}
+	return dest
+}
+
+func (scan *countryScan) countries() (registered, represented *Country) {
+	if scan.registered.GeonameID != 0 {
+		registered = &Country{CountryLocation: scan.registered}
+	}
+	if scan.represented.GeonameID != 0 {
+		represented = &Country{CountryLocation: scan.represented}
+	}
+	return registered, represented
+}
@@ -0,0 +1,121 @@
+package geoip_test
+
+import (
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestGeolite2_Countries(t *testing.T) {
+	dataset := geoiptest.Default()
+	geo := geoip.NewGeolite2(loadDataset(t, dataset))
+	fake := geoiptest.NewFake(dataset)
+
+	city, err := geo.CityBlock(net.ParseIP("27.0.0.9"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered, represented := city.RegisteredCountry(), city.RepresentedCountry()
+	if registered == nil || registered.CountryISOCode != "JP" || registered.Type != "" {
+		t.Errorf("unexpected registered country %+v", registered)
+	}
+	if represented == nil || represented.CountryISOCode != "US" || represented.CountryName != "United States" ||
+		represented.IsInEuropeanUnion != "0" || represented.Type != "" ||
+		represented.LocaleCode != city.Location().LocaleCode {
+		t.Errorf("unexpected represented country %+v", represented)
+	}
+	country, err := geo.CountryBlock(net.ParseIP("5.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if country.RegisteredCountry() == nil || country.RegisteredCountry().IsInEuropeanUnion != "1" ||
+		country.RepresentedCountry() != nil {
+		t.Errorf("unexpected countries %+v %+v", country.RegisteredCountry(), country.RepresentedCountry())
+	}
+
+	// 185.220.100.0/22 没有 geoname_id 及经纬度，196.201.0.0/16 只有国家地址段
+	for _, s := range []string{"1.0.0.1", "5.0.0.1", "8.8.8.8", "14.0.200.1", "27.0.0.9", "185.220.100.7",
+		"196.201.1.1", "2001:4860::1", "2003::1"} {
+		ip := net.ParseIP(s)
+		got, gotErr := geo.CityBlock(ip)
+		want, wantErr := fake.CityBlock(ip)
+		if !reflect.DeepEqual(got, want) || !errors.Is(gotErr, wantErr) {
+			t.Errorf("%s: sqlite %+v %v, fake %+v %v", s, got, gotErr, want, wantErr)
+		}
+		gotCountry, gotErr := geo.CountryBlock(ip)
+		wantCountry, wantErr := fake.CountryBlock(ip)
+		if !reflect.DeepEqual(gotCountry, wantCountry) || gotErr != nil || wantErr != nil {
+			t.Errorf("%s: sqlite %+v %v, fake %+v %v", s, gotCountry, gotErr, wantCountry, wantErr)
+		}
+	}
+
+	for _, language := range []string{"en", "zh-CN", "xx"} {
+		got, err := geo.BlocksByCountryCode(language, "JP")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := fake.BlocksByCountryCode(language, "JP")
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: sqlite %+v, fake %+v", language, got, want)
+		}
+		cities, err := geo.BlocksByCityCode(language, "JP", "13")
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantCities, _ := fake.BlocksByCityCode(language, "JP", "13")
+		if !reflect.DeepEqual(cities, wantCities) {
+			t.Errorf("%s: sqlite %+v, fake %+v", language, cities, wantCities)
+		}
+		nearby, err := geo.BlocksNear(language, 35.6893, 139.6899, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantNearby, _ := fake.BlocksNear(language, 35.6893, 139.6899, 50)
+		if !reflect.DeepEqual(nearby, wantNearby) {
+			t.Errorf("%s: sqlite %+v, fake %+v", language, nearby, wantNearby)
+		}
+	}
+	blocks, err := geo.BlocksByCountryCode("zh-CN", "JP")
+	if err != nil || len(blocks) != 1 || blocks[0].RepresentedCountry() == nil ||
+		blocks[0].RepresentedCountry().LocaleCode != "zh-CN" {
+		t.Errorf("unexpected blocks %+v %v", blocks, err)
+	}
+
+	for _, filter := range []*geoip.Filter{
+		geoip.NewFilter("en").RepresentedCountry("US"),
+		geoip.NewFilter("en").RegisteredCountry("CN", "DE"),
+		geoip.NewFilter("en").RegisteredCountry("US").Country("US"),
+		geoip.NewFilter("xx").RegisteredCountry("JP"),
+	} {
+		got, err := geo.BlocksByFilter(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := fake.BlocksByFilter(filter)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sqlite %+v, fake %+v", got, want)
+		}
+	}
+	composite, err := geo.BlocksByFilter(geoip.NewFilter("en").RepresentedCountry("US"))
+	if err != nil || len(composite) != 1 || composite[0].CityBlock.Network != "27.0.0.0/22" {
+		t.Errorf("unexpected composite blocks %+v %v", composite, err)
+	}
+
+	ips := []net.IP{net.ParseIP("27.0.0.9"), net.ParseIP("5.0.0.1"), net.ParseIP("2003::1")}
+	for _, language := range []string{"", "ja", "xx"} {
+		results, err := geo.LookupMany(ips, geoip.LookupOptions{Language: language})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := fake.LookupMany(ips, geoip.LookupOptions{Language: language})
+		for i := range results {
+			if !reflect.DeepEqual(results[i].City, want[i].City) ||
+				!reflect.DeepEqual(results[i].Country, want[i].Country) {
+				t.Errorf("%s %s: sqlite %+v, fake %+v", language, ips[i], results[i], want[i])
+			}
+		}
+	}
+}
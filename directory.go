@@ -0,0 +1,307 @@
+package geoip
+
+import (
+	"database/sql"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DirectorySort 组织目录排序字段
+type DirectorySort int
+
+const (
+	SortByNumber DirectorySort = iota
+	SortByName
+	SortByPrefixes
+	// SortByAddresses 按 IPv4 地址总数排序，相同时按 IPv6 地址总数
+	SortByAddresses
+)
+
+// DirectoryQuery 组织目录查询条件
+type DirectoryQuery struct {
+	// Search 按组织名称搜索，默认为不区分大小写的子串匹配
+	Search string `json:"search"`
+	// Fuzzy 为 true 时按模糊匹配搜索，忽略大小写与标点，Search 中的字符按顺序出现即匹配，结果按匹配度排序
+	Fuzzy bool `json:"fuzzy"`
+	// SortBy 排序字段，Fuzzy 搜索时作为匹配度相同时的次要排序
+	SortBy DirectorySort `json:"sort_by"`
+	// Descending 是否倒序
+	Descending bool `json:"descending"`
+	// Offset 排序后跳过的条目数，不能小于 0
+	Offset int `json:"offset"`
+	// Limit 返回的条目数，0 表示不限制
+	Limit int `json:"limit"`
+}
+
+// OrganizationEntry 组织目录条目
+type OrganizationEntry struct {
+	Organization
+	// Prefixes IPv4 与 IPv6 地址段数量
+	Prefixes int `json:"prefixes"`
+	// IPv4Addresses IPv4 地址总数
+	IPv4Addresses int64 `json:"ipv4_addresses"`
+	// IPv6Addresses IPv6 地址总数，超出 int64
+	IPv6Addresses *big.Int `json:"ipv6_addresses"`
+	// Countries 地址段所在国家的 ISO 编码
+	Countries []string `json:"countries"`
+
+	score int
+}
+
+// directoryBatchSize 按 ASN 编号查询国家时每条语句的参数个数上限
+const directoryBatchSize = 500
+
+// OrganizationDirectory 查询组织目录，返回每个 ASN 的地址段数量、IPv4 与 IPv6 地址总数及所在国家。
+// 先汇总、排序并分页，只为返回的条目查询所在国家
+func (geo Geolite2) OrganizationDirectory(query DirectoryQuery) ([]OrganizationEntry, error) {
+	if query.Offset < 0 {
+		return nil, errors.New("Offset 不能小于 0：" + strconv.Itoa(query.Offset))
+	}
+	var where string
+	var args []interface{}
+	if query.Search != "" && !query.Fuzzy {
+		where = " WHERE autonomous_system_organization LIKE ? ESCAPE '\\'"
+		args = append(args, "%"+escapeLike(query.Search)+"%")
+	}
+
+	var entries []OrganizationEntry
+	var index = make(map[int]int)
+	entry := func(number int, name string) *OrganizationEntry {
+		i, ok := index[number]
+		if !ok {
+			i = len(entries)
+			index[number] = i
+			entries = append(entries, OrganizationEntry{Organization: Organization{AutonomousSystemNumber: number,
+				AutonomousSystemOrganization: name}, IPv6Addresses: new(big.Int)})
+		}
+		return &entries[i]
+	}
+
+	// IPv4 地址数为起止地址之差的和；IPv6 地址以 BLOB 存储，按前缀长度分组计数后累加
+	if err := geo.directoryRows("IPv4", "SELECT autonomous_system_number, autonomous_system_organization, COUNT(*), "+
+		"SUM(end_ip - start_ip + 1) FROM GeoLite2ASNBlocksIPv4"+where+" GROUP BY autonomous_system_number", args,
+		func(rows *sql.Rows) error {
+			var number, prefixes int
+			var name string
+			var addresses int64
+			if err := rows.Scan(&number, &name, &prefixes, &addresses); err != nil {
+				return err
+			}
+			e := entry(number, name)
+			e.Prefixes += prefixes
+			e.IPv4Addresses += addresses
+			return nil
+		}); err != nil {
+		return nil, err
+	}
+	if err := geo.directoryRows("IPv6", "SELECT autonomous_system_number, autonomous_system_organization, "+
+		"CAST(substr(network, instr(network, '/') + 1) AS INTEGER), COUNT(*) FROM GeoLite2ASNBlocksIPv6"+where+
+		" GROUP BY 1, 3", args, func(rows *sql.Rows) error {
+		var number, bits, prefixes int
+		var name string
+		if err := rows.Scan(&number, &name, &bits, &prefixes); err != nil {
+			return err
+		}
+		e := entry(number, name)
+		e.Prefixes += prefixes
+		e.IPv6Addresses.Add(e.IPv6Addresses, new(big.Int).Lsh(big.NewInt(int64(prefixes)), uint(128-bits)))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if query.Search != "" && query.Fuzzy {
+		matched := entries[:0]
+		for _, e := range entries {
+			if e.score = fuzzyScore(e.AutonomousSystemOrganization, query.Search); e.score >= 0 {
+				matched = append(matched, e)
+			}
+		}
+		entries = matched
+	}
+
+	sortDirectory(entries, query)
+	entries = pageDirectory(entries, query)
+
+	if err := geo.directoryCountries(entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// directoryRows 在 version 的 ASN 地址段表上执行 query 并逐行回调 scan，表不存在时没有回调
+func (geo Geolite2) directoryRows(version, query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	exists, err := geo.tableExists("GeoLite2ASNBlocks" + version)
+	if err != nil || !exists {
+		return err
+	}
+	rows, err := geo.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// pageDirectory 按 Offset 与 Limit 截取排序后的条目
+func pageDirectory(entries []OrganizationEntry, query DirectoryQuery) []OrganizationEntry {
+	if query.Offset >= len(entries) {
+		return nil
+	}
+	entries = entries[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(entries) {
+		entries = entries[:query.Limit]
+	}
+	return entries
+}
+
+// directoryCountryQuery 返回 n 个 ASN 编号的地址段与 version 国家地址段的交叠查询，
+// ASN 地址段按 autonomous_system_number 索引取出，国家地址段以 overlapJoin 按 start_ip 索引范围查找
+func directoryCountryQuery(version string, n int) string {
+	return "SELECT DISTINCT a.autonomous_system_number, l.country_iso_code FROM GeoLite2ASNBlocks" + version + " a " +
+		"JOIN GeoLite2CountryBlocks" + version + " c ON " + overlapJoin("GeoLite2CountryBlocks"+version, "c", "a") +
+		" JOIN GeoLite2CountryLocations l ON c.geoname_id = l.geoname_id " +
+		"WHERE a.autonomous_system_number IN (?" + strings.Repeat(", ?", n-1) + ") AND l.country_iso_code != ''"
+}
+
+// directoryCountries 将条目的 ASN 地址段与国家地址段按范围交叠关联，填充 Countries
+func (geo Geolite2) directoryCountries(entries []OrganizationEntry) error {
+	index := make(map[int]int, len(entries))
+	for i := range entries {
+		index[entries[i].AutonomousSystemNumber] = i
+	}
+
+versions:
+	for _, version := range []string{"IPv4", "IPv6"} {
+		for _, table := range []string{"GeoLite2ASNBlocks", "GeoLite2CountryBlocks"} {
+			exists, err := geo.tableExists(table + version)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				continue versions
+			}
+		}
+		for start := 0; start < len(entries); start += directoryBatchSize {
+			end := start + directoryBatchSize
+			if end > len(entries) {
+				end = len(entries)
+			}
+			args := make([]interface{}, 0, end-start)
+			for _, entry := range entries[start:end] {
+				args = append(args, entry.AutonomousSystemNumber)
+			}
+			if err := geo.directoryCountryRows(directoryCountryQuery(version, end-start), args, entries, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range entries {
+		sort.Strings(entries[i].Countries)
+	}
+	return nil
+}
+
+func (geo Geolite2) directoryCountryRows(query string, args []interface{}, entries []OrganizationEntry, index map[int]int) error {
+	rows, err := geo.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var number int
+		var country string
+		if err := rows.Scan(&number, &country); err != nil {
+			return err
+		}
+		if i, ok := index[number]; ok && !containsString(entries[i].Countries, country) {
+			entries[i].Countries = append(entries[i].Countries, country)
+		}
+	}
+	return rows.Err()
+}
+
+func sortDirectory(entries []OrganizationEntry, query DirectoryQuery) {
+	less := func(a, b OrganizationEntry) bool {
+		switch query.SortBy {
+		case SortByName:
+			if a.AutonomousSystemOrganization != b.AutonomousSystemOrganization {
+				return a.AutonomousSystemOrganization < b.AutonomousSystemOrganization
+			}
+		case SortByPrefixes:
+			if a.Prefixes != b.Prefixes {
+				return a.Prefixes < b.Prefixes
+			}
+		case SortByAddresses:
+			if a.IPv4Addresses != b.IPv4Addresses {
+				return a.IPv4Addresses < b.IPv4Addresses
+			}
+			if c := a.IPv6Addresses.Cmp(b.IPv6Addresses); c != 0 {
+				return c < 0
+			}
+		}
+		return a.AutonomousSystemNumber < b.AutonomousSystemNumber
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if query.Fuzzy && entries[i].score != entries[j].score {
+			return entries[i].score > entries[j].score
+		}
+		if query.Descending {
+			return less(entries[j], entries[i])
+		}
+		return less(entries[i], entries[j])
+	})
+}
+
+// fuzzyScore 计算模糊匹配得分，不匹配时返回 -1。连续匹配与单词开头匹配得分更高
+func fuzzyScore(name, search string) int {
+	target := []rune(strings.ToLower(name))
+	var pattern []rune
+	for _, r := range strings.ToLower(search) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			pattern = append(pattern, r)
+		}
+	}
+	if len(pattern) == 0 {
+		return 0
+	}
+
+	score, last, p := 0, -2, 0
+	for i := 0; i < len(target) && p < len(pattern); i++ {
+		if target[i] != pattern[p] {
+			continue
+		}
+		score++
+		if last == i-1 {
+			score += 2
+		}
+		if i == 0 || !(unicode.IsLetter(target[i-1]) || unicode.IsDigit(target[i-1])) {
+			score += 3
+		}
+		last = i
+		p++
+	}
+	if p < len(pattern) {
+		return -1
+	}
+
+	return score
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
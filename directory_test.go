@@ -0,0 +1,79 @@
+package geoip_test
+
+import (
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGeolite2_OrganizationDirectory(t *testing.T) {
+	geo := newGeolite2(t, geoiptest.Default())
+
+	entries, err := geo.OrganizationDirectory(geoip.DirectoryQuery{SortBy: geoip.SortByAddresses, Descending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 7 {
+		t.Fatalf("expected 7 entries, got %d", len(entries))
+	}
+	// IPv4 地址数相同时按 IPv6 地址数排序，只有 IPv6 地址段的 AS 6939 排在最后
+	if entries[0].AutonomousSystemNumber != 3320 || entries[5].AutonomousSystemNumber != 13335 ||
+		entries[5].IPv4Addresses != 256 || entries[6].AutonomousSystemNumber != 6939 {
+		t.Errorf("unexpected order %+v", entries)
+	}
+	// IPv6 地址数超出 int64
+	if entries[0].Prefixes != 2 || entries[0].IPv4Addresses != 65536 ||
+		entries[0].IPv6Addresses.Cmp(new(big.Int).Lsh(big.NewInt(1), 109)) != 0 ||
+		!reflect.DeepEqual(entries[0].Countries, []string{"DE"}) {
+		t.Errorf("unexpected first entry %+v", entries[0])
+	}
+	if entries[6].IPv4Addresses != 0 || entries[6].IPv6Addresses.BitLen() != 97 || entries[6].Countries != nil {
+		t.Errorf("unexpected IPv6 only entry %+v", entries[6])
+	}
+
+	entries, err = geo.OrganizationDirectory(geoip.DirectoryQuery{Search: "telekom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].AutonomousSystemNumber != 3320 || entries[0].Countries[0] != "DE" {
+		t.Errorf("unexpected substring search result %+v", entries)
+	}
+
+	entries, err = geo.OrganizationDirectory(geoip.DirectoryQuery{Search: "chinanet bb", Fuzzy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].AutonomousSystemNumber != 4134 {
+		t.Errorf("unexpected fuzzy search result %+v", entries)
+	}
+
+	// 排序后分页，只有返回的条目带有国家
+	entries, err = geo.OrganizationDirectory(geoip.DirectoryQuery{SortBy: geoip.SortByName, Offset: 5, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].AutonomousSystemNumber != 6939 ||
+		!reflect.DeepEqual(entries[1].Countries, []string{"JP"}) {
+		t.Errorf("unexpected page %+v", entries)
+	}
+
+	for _, g := range []geoip.Geoip2{geo, geoiptest.NewFake(geoiptest.Default())} {
+		if _, err := g.OrganizationDirectory(geoip.DirectoryQuery{Offset: -1}); err == nil {
+			t.Errorf("%T: negative offset should fail", g)
+		}
+	}
+}
+
+func TestGeolite2_OrganizationDirectoryQueryPlan(t *testing.T) {
+	db := loadDataset(t, geoiptest.Default())
+
+	// 组织目录只为返回的 ASN 取出地址段，国家地址段按 start_ip 索引范围关联
+	if plan := geoip.QueryPlan(t, db, geoip.DirectoryCountryQuery("IPv4", 2), 15169, 3320); !strings.Contains(plan,
+		"GeoLite2ASNBlocksIPv4Number") || !strings.Contains(plan,
+		"SEARCH c USING INDEX GeoLite2CountryBlocksIPv4Start (start_ip>? AND start_ip<?)") {
+		t.Errorf("directory countries should use the number and start_ip indexes: %s", plan)
+	}
+}
@@ -0,0 +1,345 @@
+package geoip
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Downloader 支持失败重试、断点续传与条件请求的下载器
+type Downloader struct {
+	Client *http.Client
+	// Retries 失败后的最大重试次数
+	Retries int
+	// Backoff 首次重试前的等待时间，之后每次翻倍
+	Backoff time.Duration
+	// MaxBackoff 重试等待时间上限
+	MaxBackoff time.Duration
+	// IdleTimeout 读取响应体时等待数据的最长时间，超时后中断本次请求并从断点重试，为 0 时不限制
+	IdleTimeout time.Duration
+}
+
+// DownloadResult 下载结果
+type DownloadResult struct {
+	// Path 文件保存路径
+	Path string
+	// SHA256 文件的 sha256，下载时流式计算
+	SHA256 string
+	// Size 文件大小
+	Size int64
+	// NotModified 为 true 时服务器返回 304，本地文件已是最新，没有重新下载
+	NotModified bool
+}
+
+// downloadMeta 保存在 destination.meta 中的条件请求信息
+type downloadMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+}
+
+// errRetryable 可以重试的下载错误
+type errRetryable struct {
+	err error
+}
+
+func (e errRetryable) Error() string {
+	return e.err.Error()
+}
+
+func (e errRetryable) Unwrap() error {
+	return e.err
+}
+
+// NewDownloader 创建下载器，默认读取 HTTP_PROXY/HTTPS_PROXY 环境变量中的代理
+func NewDownloader() *Downloader {
+	return &Downloader{
+		Client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				TLSHandshakeTimeout:   30 * time.Second,
+				ResponseHeaderTimeout: 60 * time.Second,
+				IdleConnTimeout:       90 * time.Second,
+			},
+		},
+		Retries:     5,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+		IdleTimeout: time.Minute,
+	}
+}
+
+// SetProxy 设置下载使用的代理，如 http://127.0.0.1:7890、socks5://127.0.0.1:1080
+func (d *Downloader) SetProxy(proxy string) error {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return err
+	}
+	transport, ok := d.Client.Transport.(*http.Transport)
+	if !ok {
+		return errors.New("当前 http.Client 不支持设置代理")
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return nil
+}
+
+// Fetch 下载 url 到 destination。未下载完成的内容保存在 destination.part 中，重试或再次调用时从断点继续；
+// destination 已存在时发送条件请求，服务器返回 304 则不再下载
+func (d *Downloader) Fetch(ctx context.Context, url string, destination string) (*DownloadResult, error) {
+	return d.FetchWithProgress(ctx, url, destination, nil)
+}
+
+// FetchWithProgress 与 Fetch 相同，每次写入文件后以已下载字节数（包含断点前的部分）和总字节数回调 fn，总字节数未知时为 0
+func (d *Downloader) FetchWithProgress(ctx context.Context, url string, destination string,
+	fn func(written, total int64)) (*DownloadResult, error) {
+	backoff := d.Backoff
+	for attempt := 0; ; attempt++ {
+		result, err := d.fetch(ctx, url, destination, fn)
+		var retryable errRetryable
+		if err == nil || !errors.As(err, &retryable) || attempt >= d.Retries {
+			return result, err
+		}
+
+		log.Debug().Err(err).Msg(fmt.Sprintf("下载失败，%s 后第 %d 次重试 %s", backoff, attempt+1, url))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; d.MaxBackoff > 0 && backoff > d.MaxBackoff {
+			backoff = d.MaxBackoff
+		}
+	}
+}
+
+func (d *Downloader) fetch(ctx context.Context, url string, destination string,
+	fn func(written, total int64)) (*DownloadResult, error) {
+	// 读取响应体超时时取消本次请求，不影响调用方的 ctx
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	request, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := readDownloadMeta(destination)
+	if _, err := os.Stat(destination); err == nil && meta.URL == url {
+		if meta.ETag != "" {
+			request.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			request.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	// 断点续传，If-Range 保证服务器文件变化时返回完整内容
+	part := destination + ".part"
+	partMeta := readDownloadMeta(part)
+	var offset int64
+	if info, err := os.Stat(part); err == nil && info.Size() > 0 && partMeta.URL == url &&
+		(partMeta.ETag != "" || partMeta.LastModified != "") {
+		offset = info.Size()
+		request.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		if partMeta.ETag != "" {
+			request.Header.Set("If-Range", partMeta.ETag)
+		} else {
+			request.Header.Set("If-Range", partMeta.LastModified)
+		}
+	}
+
+	response, err := d.Client.Do(request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, errRetryable{err}
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotModified:
+		sum, size, err := hashFile(destination)
+		if err != nil {
+			return nil, err
+		}
+		return &DownloadResult{Path: destination, SHA256: sum, Size: size, NotModified: true}, nil
+	case response.StatusCode == http.StatusPartialContent && offset > 0:
+	case response.StatusCode == http.StatusOK:
+		offset = 0
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		os.Remove(part)
+		return nil, errRetryable{errors.New("下载失败，断点位置无效：" + response.Status)}
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return nil, errRetryable{errors.New("下载失败，状态码：" + strconv.Itoa(response.StatusCode))}
+	default:
+		return nil, errors.New("下载失败，状态码：" + strconv.Itoa(response.StatusCode))
+	}
+
+	meta = downloadMeta{URL: url, ETag: response.Header.Get("ETag"), LastModified: response.Header.Get("Last-Modified")}
+	if err := writeDownloadMeta(part, meta); err != nil {
+		return nil, err
+	}
+
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(part, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if offset > 0 {
+		if err := hashPrefix(hasher, part, offset); err != nil {
+			return nil, err
+		}
+	}
+
+	var writer io.Writer = io.MultiWriter(file, hasher)
+	if fn != nil {
+		var total int64
+		if response.ContentLength >= 0 {
+			total = offset + response.ContentLength
+		}
+		writer = &progressWriter{writer: writer, written: offset, total: total, fn: fn}
+	}
+
+	var body io.Reader = response.Body
+	var idle *idleReader
+	if d.IdleTimeout > 0 {
+		idle = newIdleReader(response.Body, d.IdleTimeout, cancel)
+		defer idle.stop()
+		body = idle
+	}
+	size, err := io.Copy(writer, body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if idle != nil && idle.timedOut.Load() {
+			err = fmt.Errorf("%s 内没有收到数据", d.IdleTimeout)
+		}
+		return nil, errRetryable{errors.New("文件保存失败，错误信息：" + err.Error())}
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(part, destination); err != nil {
+		return nil, err
+	}
+	os.Remove(part + ".meta")
+	if err := writeDownloadMeta(destination, meta); err != nil {
+		return nil, err
+	}
+
+	return &DownloadResult{Path: destination, SHA256: hex.EncodeToString(hasher.Sum(nil)), Size: offset + size}, nil
+}
+
+// idleReader 每次读到数据后重置计时器，timeout 内没有读到数据时调用 cancel 中断请求
+type idleReader struct {
+	reader   io.Reader
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func newIdleReader(reader io.Reader, timeout time.Duration, cancel func()) *idleReader {
+	idle := &idleReader{reader: reader, timeout: timeout}
+	idle.timer = time.AfterFunc(timeout, func() {
+		idle.timedOut.Store(true)
+		cancel()
+	})
+	return idle
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *idleReader) stop() {
+	r.timer.Stop()
+}
+
+// progressWriter 写入时回调下载进度
+type progressWriter struct {
+	writer  io.Writer
+	written int64
+	total   int64
+	fn      func(written, total int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	w.fn(w.written, w.total)
+	return n, err
+}
+
+// hashPrefix 计算断点续传时已下载部分的 sha256
+func hashPrefix(hasher hash.Hash, path string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.CopyN(hasher, file, size)
+	return err
+}
+
+// hashFile 流式计算文件的 sha256
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+func readDownloadMeta(path string) downloadMeta {
+	var meta downloadMeta
+	if content, err := os.ReadFile(path + ".meta"); err == nil {
+		_ = json.Unmarshal(content, &meta)
+	}
+	return meta
+}
+
+func writeDownloadMeta(path string, meta downloadMeta) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+".meta", content, 0644)
+}
@@ -0,0 +1,121 @@
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloader_Fetch(t *testing.T) {
+	content := bytes.Repeat([]byte("GeoLite2"), 4096)
+	sum := sha256.Sum256(content)
+	modified := time.Date(2023, 8, 15, 0, 0, 0, 0, time.UTC)
+
+	var failures, requests int32 = 2, 0
+	var lastRange atomic.Value
+	lastRange.Store("")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		lastRange.Store(r.Header.Get("Range"))
+		w.Header().Set("ETag", `"20230815"`)
+		http.ServeContent(w, r, "GeoLite2-City-CSV.zip", modified, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	downloader.Backoff = time.Millisecond
+	destination := filepath.Join(t.TempDir(), "GeoLite2-City-CSV.zip")
+
+	// 前两次返回 503，重试后下载成功
+	result, err := downloader.Fetch(context.Background(), server.URL, destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SHA256 != hex.EncodeToString(sum[:]) || result.NotModified || atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("unexpected result %+v after %d requests", result, atomic.LoadInt32(&requests))
+	}
+
+	// 文件未修改时服务器返回 304
+	result, err = downloader.Fetch(context.Background(), server.URL, destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.NotModified || result.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected not modified, got %+v", result)
+	}
+
+	// 从断点继续下载
+	os.Remove(destination)
+	os.Rename(destination+".meta", destination+".part.meta")
+	if err := os.WriteFile(destination+".part", content[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = downloader.Fetch(context.Background(), server.URL, destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastRange.Load() != "bytes=1000-" || result.SHA256 != hex.EncodeToString(sum[:]) ||
+		result.Size != int64(len(content)) {
+		t.Errorf("unexpected resume result %+v with range %q", result, lastRange.Load())
+	}
+	if _, err := os.Stat(destination + ".part"); !os.IsNotExist(err) {
+		t.Error("partial file should be removed after download")
+	}
+}
+
+func TestDownloader_IdleTimeout(t *testing.T) {
+	content := bytes.Repeat([]byte("GeoLite2"), 4096)
+	sum := sha256.Sum256(content)
+	modified := time.Date(2023, 8, 15, 0, 0, 0, 0, time.UTC)
+
+	var requests int32
+	var lastRange atomic.Value
+	lastRange.Store("")
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"20230815"`)
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// 发送部分内容后停止响应
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:1000])
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		lastRange.Store(r.Header.Get("Range"))
+		http.ServeContent(w, r, "GeoLite2-City-CSV.zip", modified, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	downloader := NewDownloader()
+	downloader.Backoff = time.Millisecond
+	downloader.IdleTimeout = 50 * time.Millisecond
+	destination := filepath.Join(t.TempDir(), "GeoLite2-City-CSV.zip")
+
+	result, err := downloader.Fetch(context.Background(), server.URL, destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SHA256 != hex.EncodeToString(sum[:]) || atomic.LoadInt32(&requests) != 2 ||
+		lastRange.Load() != "bytes=1000-" {
+		t.Errorf("unexpected result %+v after %d requests, range %q", result, atomic.LoadInt32(&requests),
+			lastRange.Load())
+	}
+}
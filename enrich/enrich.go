@@ -0,0 +1,378 @@
+// Package enrich 为访问日志追加地域及 ASN 字段，支持 Apache/nginx combined、common 日志，
+// nginx JSON 日志及任意 NDJSON、CSV，按批调用 Geoip2.LookupMany 查询
+package enrich
+
+import (
+	"errors"
+	"fmt"
+	geoip "github.com/sechelper/geoip2"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Format 日志格式
+type Format string
+
+const (
+	// Combined Apache/nginx combined 及 common 日志，IP 为每行第一个字段，追加的字段以 key="value" 写在行尾
+	Combined Format = "combined"
+	// JSON 每行一个 JSON 对象，如 nginx escape=json 日志及 NDJSON，追加的字段写入对象末尾
+	JSON Format = "json"
+	// CSV 首行为表头的 CSV，追加的字段作为新列
+	CSV Format = "csv"
+)
+
+// ParseFormat 解析格式名称，common 等同 combined，ndjson、nginx 等同 json
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "combined", "common":
+		return Combined, nil
+	case "json", "ndjson", "nginx":
+		return JSON, nil
+	case "csv":
+		return CSV, nil
+	}
+	return "", errors.New("不支持的日志格式：" + name)
+}
+
+// Field 追加的字段
+type Field string
+
+const (
+	FieldCountry           Field = "country"
+	FieldCountryName       Field = "country_name"
+	FieldContinent         Field = "continent"
+	FieldEU                Field = "eu"
+	FieldCity              Field = "city"
+	FieldSubdivision       Field = "subdivision"
+	FieldLatitude          Field = "latitude"
+	FieldLongitude         Field = "longitude"
+	FieldASN               Field = "asn"
+	FieldOrganization      Field = "as_org"
+	FieldAnonymousProxy    Field = "anonymous_proxy"
+	FieldSatelliteProvider Field = "satellite_provider"
+	// FieldReserved 特殊用途地址的类别，如 private、loopback
+	FieldReserved Field = "reserved"
+	// FieldTags 包含 IP 的标签名，多个标签以逗号分隔，如 aws,tor-exit
+	FieldTags Field = "tags"
+)
+
+var fields = []Field{FieldCountry, FieldCountryName, FieldContinent, FieldEU, FieldCity, FieldSubdivision,
+	FieldLatitude, FieldLongitude, FieldASN, FieldOrganization, FieldAnonymousProxy, FieldSatelliteProvider,
+	FieldReserved, FieldTags}
+
+// DefaultFields 未指定字段时追加的字段
+var DefaultFields = []Field{FieldCountry, FieldASN, FieldOrganization}
+
+// ParseFields 解析以逗号分隔的字段名称
+func ParseFields(names string) ([]Field, error) {
+	var parsed []Field
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var ok bool
+		for _, field := range fields {
+			if string(field) == name {
+				parsed = append(parsed, field)
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, errors.New("不支持的字段：" + name)
+		}
+	}
+	return parsed, nil
+}
+
+// lookupFields 返回查询 fields 需要的数据
+func lookupFields(fields []Field) geoip.LookupField {
+	var lookup geoip.LookupField
+	for _, field := range fields {
+		switch field {
+		case FieldASN, FieldOrganization:
+			lookup |= geoip.LookupASN
+		case FieldCity, FieldSubdivision, FieldLatitude, FieldLongitude:
+			lookup |= geoip.LookupCity
+		case FieldCountry, FieldCountryName, FieldContinent, FieldEU, FieldAnonymousProxy, FieldSatelliteProvider:
+			lookup |= geoip.LookupCountry
+		case FieldTags:
+			lookup |= geoip.LookupTags
+		}
+	}
+	if lookup&^geoip.LookupTags == 0 {
+		// 只追加 reserved 时仍需一次查询判断地址类别
+		lookup |= geoip.LookupCountry
+	}
+	return lookup
+}
+
+// Options 日志处理选项
+type Options struct {
+	Format Format
+	// IPField JSON 与 CSV 中 IP 所在的字段，默认 JSON 为 remote_addr，CSV 为 ip
+	IPField string
+	// Fields 追加的字段，默认为 DefaultFields
+	Fields []Field
+	// Prefix 追加字段名的前缀，默认为 geo_
+	Prefix string
+	// Language 地域名称使用的语言，为空时使用数据库中的第一个语言
+	Language string
+	// BatchSize 每次查询的日志行数，默认为 8192
+	BatchSize int
+	// Workers 查询的并行数，见 geoip.LookupOptions
+	Workers int
+}
+
+// Stats 处理结果统计
+type Stats struct {
+	// Lines 处理的日志行数，不含 CSV 表头
+	Lines int64 `json:"lines"`
+	// Matched 查询到数据的行数
+	Matched int64 `json:"matched"`
+	// Unparsed 未能解析出 IP 的行数，这些行原样输出
+	Unparsed int64 `json:"unparsed"`
+}
+
+// Enricher 按 Options 为日志追加字段
+type Enricher struct {
+	geo     geoip.Geoip2
+	options Options
+	lookup  geoip.LookupOptions
+}
+
+func (options Options) withDefaults() Options {
+	if options.Format == "" {
+		options.Format = Combined
+	}
+	if options.IPField == "" {
+		switch options.Format {
+		case JSON:
+			options.IPField = "remote_addr"
+		case CSV:
+			options.IPField = "ip"
+		}
+	}
+	if len(options.Fields) == 0 {
+		options.Fields = DefaultFields
+	}
+	if options.Prefix == "" {
+		options.Prefix = "geo_"
+	}
+	if options.BatchSize < 1 {
+		options.BatchSize = 8192
+	}
+	return options
+}
+
+// New 创建 Enricher，Options 中的零值使用默认值
+func New(geo geoip.Geoip2, options Options) (*Enricher, error) {
+	options = options.withDefaults()
+	if _, err := ParseFormat(string(options.Format)); err != nil {
+		return nil, err
+	}
+
+	return &Enricher{geo: geo, options: options, lookup: geoip.LookupOptions{Fields: lookupFields(options.Fields),
+		Language: options.Language, Workers: options.Workers}}, nil
+}
+
+// Enrich 从 r 读取日志，追加字段后写入 w，返回处理统计
+func (enricher *Enricher) Enrich(r io.Reader, w io.Writer) (Stats, error) {
+	switch enricher.options.Format {
+	case JSON:
+		return enricher.lines(r, w, jsonIP(enricher.options.IPField), enricher.appendJSON)
+	case CSV:
+		return enricher.csv(r, w)
+	}
+	return enricher.lines(r, w, combinedIP, enricher.appendCombined)
+}
+
+// batch 按 BatchSize 分批读取记录，每批调用一次 LookupMany 后依次写出，保持输入顺序
+func batch[T any](enricher *Enricher, stats *Stats, read func() (T, net.IP, error),
+	write func(T, *geoip.LookupResult) error) error {
+	items := make([]T, 0, enricher.options.BatchSize)
+	ips := make([]net.IP, 0, enricher.options.BatchSize)
+
+	flush := func() error {
+		if len(items) == 0 {
+			return nil
+		}
+		var lookup []net.IP
+		for _, ip := range ips {
+			if ip != nil {
+				lookup = append(lookup, ip)
+			}
+		}
+		results, err := enricher.geo.LookupMany(lookup, enricher.lookup)
+		if err != nil {
+			return err
+		}
+
+		for i, item := range items {
+			var result *geoip.LookupResult
+			if ips[i] != nil {
+				result = &results[0]
+				results = results[1:]
+				if result.ASN != nil || result.City != nil || result.Country != nil {
+					stats.Matched++
+				}
+			} else {
+				stats.Unparsed++
+			}
+			if err := write(item, result); err != nil {
+				return err
+			}
+		}
+		items, ips = items[:0], ips[:0]
+		return nil
+	}
+
+	for {
+		item, ip, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		stats.Lines++
+		items, ips = append(items, item), append(ips, ip)
+		if len(items) >= enricher.options.BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// value 返回 field 的值，没有数据时返回 nil
+func value(field Field, result *geoip.LookupResult) interface{} {
+	if result == nil {
+		return nil
+	}
+
+	var country *geoip.CountryLocation
+	if result.Country != nil && result.Country.Location() != nil {
+		country = result.Country.Location()
+	} else if result.City != nil && result.City.Location() != nil {
+		city := result.City.Location()
+		country = &geoip.CountryLocation{ContinentCode: city.ContinentCode, CountryISOCode: city.CountryISOCode,
+			CountryName: city.CountryName, IsInEuropeanUnion: city.IsInEuropeanUnion}
+	}
+
+	switch field {
+	case FieldCountry, FieldCountryName, FieldContinent, FieldEU:
+		if country == nil {
+			return nil
+		}
+		switch field {
+		case FieldCountry:
+			return country.CountryISOCode
+		case FieldCountryName:
+			return country.CountryName
+		case FieldContinent:
+			return country.ContinentCode
+		}
+		return country.IsInEuropeanUnion == "1"
+	case FieldCity, FieldSubdivision:
+		if result.City == nil || result.City.Location() == nil {
+			return nil
+		}
+		if field == FieldCity {
+			return result.City.Location().CityName
+		}
+		return result.City.Location().Subdivision1ISOCode
+	case FieldLatitude, FieldLongitude:
+		if result.City == nil || !result.City.HasCoordinates() {
+			return nil
+		}
+		if field == FieldLatitude {
+			return result.City.Latitude
+		}
+		return result.City.Longitude
+	case FieldASN:
+		if result.ASN == nil {
+			return nil
+		}
+		return result.ASN.AutonomousSystemNumber
+	case FieldOrganization:
+		if result.ASN == nil {
+			return nil
+		}
+		return result.ASN.AutonomousSystemOrganization
+	case FieldAnonymousProxy:
+		if result.Country != nil {
+			return result.Country.IsAnonymousProxy == "1"
+		}
+		if result.City != nil {
+			return result.City.IsAnonymousProxy == 1
+		}
+	case FieldSatelliteProvider:
+		if result.Country != nil {
+			return result.Country.IsSatelliteProvider == "1"
+		}
+		if result.City != nil {
+			return result.City.IsSatelliteProvider == 1
+		}
+	case FieldReserved:
+		var reserved *geoip.ReservedError
+		if errors.As(result.Err, &reserved) {
+			return string(reserved.Reserved.Kind)
+		}
+	case FieldTags:
+		var names []string
+		for _, tag := range result.Tags {
+			if !contains(names, tag.Name) {
+				names = append(names, tag.Name)
+			}
+		}
+		if len(names) > 0 {
+			return strings.Join(names, ",")
+		}
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// text 返回值的文本形式，nil 为空字符串
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// ParseIP 解析日志中的客户端地址，支持 X-Forwarded-For 形式的地址列表（取第一个）及带端口的地址
+func ParseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
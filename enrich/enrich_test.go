@@ -0,0 +1,109 @@
+package enrich_test
+
+import (
+	"bytes"
+	"github.com/sechelper/geoip2/enrich"
+	"github.com/sechelper/geoip2/geoiptest"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, options enrich.Options, input string) (string, enrich.Stats) {
+	t.Helper()
+	enricher, err := enrich.New(geoiptest.NewFake(geoiptest.Default()), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(bytes.Buffer)
+	stats, err := enricher.Enrich(strings.NewReader(input), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), stats
+}
+
+func TestEnrich_Combined(t *testing.T) {
+	input := `8.8.8.8 - - [10/Oct/2023:13:55:36 +0000] "GET / HTTP/1.1" 200 2326 "-" "curl/8.0"
+10.0.0.1 - frank [10/Oct/2023:13:55:37 +0000] "GET /a HTTP/1.1" 404 0
+
+2001:4860:4860::8888 - - [10/Oct/2023:13:55:38 +0000] "GET /b HTTP/1.1" 200 12`
+	want := `8.8.8.8 - - [10/Oct/2023:13:55:36 +0000] "GET / HTTP/1.1" 200 2326 "-" "curl/8.0" geo_country="US" geo_asn="15169" geo_reserved=""
+10.0.0.1 - frank [10/Oct/2023:13:55:37 +0000] "GET /a HTTP/1.1" 404 0 geo_country="" geo_asn="" geo_reserved="private"
+
+2001:4860:4860::8888 - - [10/Oct/2023:13:55:38 +0000] "GET /b HTTP/1.1" 200 12 geo_country="US" geo_asn="15169" geo_reserved=""
+`
+
+	got, stats := run(t, enrich.Options{Fields: []enrich.Field{enrich.FieldCountry, enrich.FieldASN,
+		enrich.FieldReserved}, BatchSize: 2}, input)
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if stats != (enrich.Stats{Lines: 4, Matched: 2, Unparsed: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestEnrich_JSON(t *testing.T) {
+	input := `{"remote_addr":"5.0.1.2","status":200}
+{"remote_addr":"9.9.9.9, 8.8.8.8"}
+{"status":500}
+{ }
+not json
+`
+	want := `{"remote_addr":"5.0.1.2","status":200,"ip.country":"DE","ip.eu":true,"ip.as_org":"Deutsche Telekom AG"}
+{"remote_addr":"9.9.9.9, 8.8.8.8","ip.country":null,"ip.eu":null,"ip.as_org":null}
+{"status":500}
+{ }
+not json
+`
+
+	got, stats := run(t, enrich.Options{Format: enrich.JSON, Prefix: "ip.", Fields: []enrich.Field{enrich.FieldCountry,
+		enrich.FieldEU, enrich.FieldOrganization}}, input)
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if stats != (enrich.Stats{Lines: 5, Matched: 1, Unparsed: 3}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	got, _ = run(t, enrich.Options{Format: enrich.JSON, IPField: "client", Fields: []enrich.Field{enrich.FieldCity}},
+		`{}`+"\n"+`{"client":"[2003::1]:443"}`)
+	if want := "{}\n{\"client\":\"[2003::1]:443\",\"geo_city\":\"Frankfurt am Main\"}\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestEnrich_CSV(t *testing.T) {
+	input := "time,client_ip\n2023-10-10,27.0.0.9\n2023-10-11,\"14.0.200.1:8080\"\n2023-10-12\n"
+	want := "time,client_ip,geo_country,geo_city,geo_latitude\n" +
+		"2023-10-10,27.0.0.9,JP,Tokyo,35.6893\n" +
+		"2023-10-11,14.0.200.1:8080,CN,Beijing,39.9075\n" +
+		"2023-10-12,,,\n"
+
+	got, _ := run(t, enrich.Options{Format: enrich.CSV, IPField: "client_ip", Fields: []enrich.Field{
+		enrich.FieldCountry, enrich.FieldCity, enrich.FieldLatitude}}, input)
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	enricher, err := enrich.New(geoiptest.NewFake(geoiptest.Default()), enrich.Options{Format: enrich.CSV})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enricher.Enrich(strings.NewReader(input), new(bytes.Buffer)); err == nil {
+		t.Error("missing ip column should fail")
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := enrich.ParseFields("country, asn,as_org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 3 || fields[2] != enrich.FieldOrganization {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if _, err := enrich.ParseFields("country,planet"); err == nil {
+		t.Error("unknown field should fail")
+	}
+}
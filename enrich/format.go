@@ -0,0 +1,207 @@
+package enrich
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"io"
+	"net"
+	"strconv"
+)
+
+// lines 逐行处理 combined 与 JSON 日志，未能解析出 IP 的行原样输出
+func (enricher *Enricher) lines(r io.Reader, w io.Writer, parse func(line []byte) net.IP,
+	appendFields func(line []byte, result *geoip.LookupResult) []byte) (Stats, error) {
+	var stats Stats
+	writer := bufio.NewWriterSize(w, 64*1024)
+
+	err := batch(enricher, &stats, lineReader(r, parse), func(line []byte, result *geoip.LookupResult) error {
+		if result != nil {
+			line = appendFields(line, result)
+		}
+		line = append(line, '\n')
+		_, err := writer.Write(line)
+		return err
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	return stats, writer.Flush()
+}
+
+// lineReader 逐行读取，返回去掉换行符的行及 parse 解析出的 IP，读完时返回 io.EOF
+func lineReader(r io.Reader, parse func(line []byte) net.IP) func() ([]byte, net.IP, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	return func() ([]byte, net.IP, error) {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 {
+			if err == nil {
+				err = io.EOF
+			}
+			return nil, nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		return line, parse(line), nil
+	}
+}
+
+// combinedIP 返回 combined 日志行的第一个字段
+func combinedIP(line []byte) net.IP {
+	line = bytes.TrimLeft(line, " \t")
+	if i := bytes.IndexAny(line, " \t"); i >= 0 {
+		line = line[:i]
+	}
+	return ParseIP(string(line))
+}
+
+// appendCombined 以 key="value" 形式在行尾追加字段，没有数据的字段值为空字符串
+func (enricher *Enricher) appendCombined(line []byte, result *geoip.LookupResult) []byte {
+	for _, field := range enricher.options.Fields {
+		line = append(line, ' ')
+		line = append(line, enricher.options.Prefix...)
+		line = append(line, field...)
+		line = append(line, '=')
+		line = strconv.AppendQuote(line, text(value(field, result)))
+	}
+	return line
+}
+
+// jsonIP 返回解析 JSON 对象中 ipField 字段的函数，不是 JSON 对象或没有该字段时解析结果为 nil
+func jsonIP(ipField string) func(line []byte) net.IP {
+	return func(line []byte) net.IP {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(line, &object); err != nil {
+			return nil
+		}
+		var s string
+		if err := json.Unmarshal(object[ipField], &s); err != nil {
+			return nil
+		}
+		return ParseIP(s)
+	}
+}
+
+// appendJSON 将字段插入到对象结尾的 } 之前，没有数据的字段值为 null。只有解析出 IP 的行会调用，line 一定是 JSON 对象
+func (enricher *Enricher) appendJSON(line []byte, result *geoip.LookupResult) []byte {
+	line = bytes.TrimRight(line, " \t")
+	object := bytes.TrimRight(line[:len(line)-1], " \t")
+	empty := object[len(object)-1] == '{'
+
+	buf := make([]byte, 0, len(line)+32*len(enricher.options.Fields))
+	buf = append(buf, object...)
+	for _, field := range enricher.options.Fields {
+		if !empty {
+			buf = append(buf, ',')
+		}
+		empty = false
+		key, _ := json.Marshal(enricher.options.Prefix + string(field))
+		buf = append(buf, key...)
+		buf = append(buf, ':')
+		v, _ := json.Marshal(value(field, result))
+		buf = append(buf, v...)
+	}
+	return append(buf, '}')
+}
+
+// csv 处理首行为表头的 CSV，追加的字段作为新列，列数不一致的行同样追加
+func (enricher *Enricher) csv(r io.Reader, w io.Writer) (Stats, error) {
+	var stats Stats
+	writer := csv.NewWriter(w)
+
+	header, read, err := csvReader(r, enricher.options.IPField)
+	if err == io.EOF {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	for _, field := range enricher.options.Fields {
+		header = append(header, enricher.options.Prefix+string(field))
+	}
+	if err := writer.Write(header); err != nil {
+		return stats, err
+	}
+
+	err = batch(enricher, &stats, read, func(record []string, result *geoip.LookupResult) error {
+		for _, field := range enricher.options.Fields {
+			record = append(record, text(value(field, result)))
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	writer.Flush()
+	return stats, writer.Error()
+}
+
+// csvReader 读取表头并定位 ipField 所在的列，返回表头及逐行读取记录的函数，空输入返回 io.EOF
+func csvReader(r io.Reader, ipField string) ([]string, func() ([]string, net.IP, error), error) {
+	reader := csv.NewReader(bufio.NewReaderSize(r, 64*1024))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	column := -1
+	for i, name := range header {
+		if name == ipField {
+			column = i
+			break
+		}
+	}
+	if column < 0 {
+		return nil, nil, errors.New("CSV 表头中没有 IP 字段：" + ipField)
+	}
+
+	return header, func() ([]string, net.IP, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, nil, err
+		}
+		if column >= len(record) {
+			return record, nil, nil
+		}
+		return record, ParseIP(record[column]), nil
+	}, nil
+}
+
+// Scan 按 format 读取日志，对每行回调解析出的 IP，未能解析出 IP 的行回调 nil，ipField 为空时使用默认字段。
+// 用于只需要 IP 的统计，不查询数据库
+func Scan(r io.Reader, format Format, ipField string, fn func(ip net.IP)) error {
+	options := Options{Format: format, IPField: ipField}.withDefaults()
+	switch options.Format {
+	case JSON:
+		return scan(lineReader(r, jsonIP(options.IPField)), fn)
+	case CSV:
+		_, read, err := csvReader(r, options.IPField)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return scan(read, fn)
+	}
+	return scan(lineReader(r, combinedIP), fn)
+}
+
+func scan[T any](read func() (T, net.IP, error), fn func(ip net.IP)) error {
+	for {
+		_, ip, err := read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(ip)
+	}
+}
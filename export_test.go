@@ -0,0 +1,58 @@
+package geoip
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// 供 geoip_test 包检查查询计划使用
+var (
+	CompositeQuery        = compositeQuery
+	CountryJoins          = countryJoins
+	DirectoryCountryQuery = directoryCountryQuery
+	CountRows             = countRows
+	QueryPlan             = queryPlan
+	TagSweepQuery         = tagSweepQuery
+)
+
+// ASNRangeQuery 返回 Breakdown 按地址范围读取 ASN 地址段的查询
+func ASNRangeQuery(version string) string {
+	var block ASNBlock
+	table, query, _ := asnRangeQuery(version, &block)
+	return overlapQuery(table, query)
+}
+
+// CityRangeQuery 返回 LookupMany 按地址范围读取城市地址段的查询
+func CityRangeQuery(version string) string {
+	var block CityBlock
+	table, query, _ := cityRangeQuery(version, &block)
+	return overlapQuery(table, query)
+}
+
+func countRows(t *testing.T, db *sql.DB, table string) int {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// queryPlan 返回 EXPLAIN QUERY PLAN 各行的说明
+func queryPlan(t *testing.T, db *sql.DB, query string, args ...interface{}) string {
+	rows, err := db.Query("EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, detail)
+	}
+	return strings.Join(plan, "\n")
+}
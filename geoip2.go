@@ -9,20 +9,80 @@ type Geoip2 interface {
 	AsnBlock(ip net.IP) (*ASNBlock, error)
 	//BlocksByAsnNumber 查询某组织拥有的 ASNBlock，返回 ASNBlock 数组
 	BlocksByAsnNumber(int64) ([]ASNBlock, error)
+	//RangeBlocksByAsnNumber 按页逐条回调某组织拥有的 ASNBlock，fn 返回 false 时停止
+	RangeBlocksByAsnNumber(number int64, page Page, fn func(ASNBlock) bool) error
 	//BlocksByAsnName 查询某组织拥有的 ASNBlock，返回 ASNBlock 数组
 	BlocksByAsnName(string) ([]ASNBlock, error)
+	//RangeBlocksByAsnName 按页逐条回调某组织拥有的 ASNBlock，fn 返回 false 时停止
+	RangeBlocksByAsnName(name string, page Page, fn func(ASNBlock) bool) error
 	//Organizations 查询全部ASN组织，返回 Organization 数组
 	Organizations() ([]Organization, error)
+	//RangeOrganizations 按页逐条回调ASN组织，游标为 ASN 编号，fn 返回 false 时停止
+	RangeOrganizations(page Page, fn func(Organization) bool) error
+	//OrganizationDirectory 查询组织目录，支持按名称子串或模糊搜索及排序，返回 OrganizationEntry 数组
+	OrganizationDirectory(DirectoryQuery) ([]OrganizationEntry, error)
 
 	//CityBlock 查询IP信息，返回 CityBlocks
 	CityBlock(net.IP) (*CityBlock, error)
 	//BlocksByCityCode 查询城市级某地域IP地址段，返回 CityBlock 数组
 	BlocksByCityCode(language, countryCode, cityCode string) ([]CityBlock, error)
+	//RangeBlocksByCityCode 按页逐条回调城市级某地域IP地址段，fn 返回 false 时停止
+	RangeBlocksByCityCode(language, countryCode, cityCode string, page Page, fn func(CityBlock) bool) error
+	//BlocksNear 查询距离经纬度 radius 公里以内的城市地址段，返回按距离排序的 NearbyBlock 数组
+	BlocksNear(language string, latitude, longitude, radius float64) ([]NearbyBlock, error)
+	//BlocksInBox 查询经纬度矩形范围内的城市地址段，返回 NearbyBlock 数组
+	BlocksInBox(language string, minLatitude, minLongitude, maxLatitude, maxLongitude float64) ([]NearbyBlock, error)
+	//Distance 计算两个IP所在位置之间的距离，单位公里
+	Distance(a, b net.IP) (float64, error)
+	//ReverseGeocode 查询距离经纬度最近的城市，返回 ReverseLocation
+	ReverseGeocode(language string, latitude, longitude float64) (*ReverseLocation, error)
 
 	//CountryBlock 查询IP信息，返回 CountryBlock
 	CountryBlock(net.IP) (*CountryBlock, error)
 	//BlocksByCountryCode 查询国家级某地域IP地址段，返回 CountryBlock 数组
 	BlocksByCountryCode(string, string) ([]CountryBlock, error)
+	//RangeBlocksByCountryCode 按页逐条回调国家级某地域IP地址段，fn 返回 false 时停止
+	RangeBlocksByCountryCode(language, code string, page Page, fn func(CountryBlock) bool) error
 	//BlocksByContinentCode 查询洲级某地域IP地址段，返回 CountryBlock 数组
 	BlocksByContinentCode(string, string) ([]CountryBlock, error)
+	//RangeBlocksByContinentCode 按页逐条回调洲级某地域IP地址段，fn 返回 false 时停止
+	RangeBlocksByContinentCode(language, code string, page Page, fn func(CountryBlock) bool) error
+
+	//BlocksByFilter 按 ASN 与地域组合条件查询，返回 CompositeBlock 数组
+	BlocksByFilter(*Filter) ([]CompositeBlock, error)
+	//RangeBlocksByFilter 按页逐条回调组合条件查询结果，游标为起始IP整数，fn 返回 false 时停止
+	RangeBlocksByFilter(filter *Filter, page Page, fn func(CompositeBlock) bool) error
+
+	//LookupMany 批量查询IP的 ASN、城市及国家信息，返回与输入顺序一致的 LookupResult 数组
+	LookupMany(ips []net.IP, options LookupOptions) ([]LookupResult, error)
+	//Breakdown 分解 CIDR 或地址范围内的 ASN、城市及国家地址段，统计各国家、ASN 的地址数，返回 Breakdown
+	Breakdown(language, network string) (*Breakdown, error)
+
+	//Overlay 查询包含IP且前缀最长的覆盖地址段，返回 Overlay
+	Overlay(ip net.IP) (*Overlay, error)
+	//Overlays 查询全部覆盖地址段，返回 Overlay 数组
+	Overlays() ([]Overlay, error)
+
+	//Tags 查询包含IP的全部标签地址段，返回 Tag 数组
+	Tags(ip net.IP) ([]Tag, error)
+	//TagNames 查询全部标签名
+	TagNames() ([]string, error)
+	//BlocksByTag 查询某标签的全部地址段，返回 Tag 数组
+	BlocksByTag(name string) ([]Tag, error)
+	//RangeBlocksByTag 按页逐条回调某标签的地址段，fn 返回 false 时停止
+	RangeBlocksByTag(name string, page Page, fn func(Tag) bool) error
+
+	//RIRBlock 查询IP在 RIR delegated 统计文件中的地址段，返回 RIRBlock
+	RIRBlock(ip net.IP) (*RIRBlock, error)
+	//BlocksByRIRCountryCode 查询登记在某国家的 RIR 地址段，返回 RIRBlock 数组
+	BlocksByRIRCountryCode(language, code string) ([]RIRBlock, error)
+	//RangeBlocksByRIRCountryCode 按页逐条回调登记在某国家的 RIR 地址段，fn 返回 false 时停止
+	RangeBlocksByRIRCountryCode(language, code string, page Page, fn func(RIRBlock) bool) error
+	//CompareRegistration 比较IP的 RIR 登记国家与 GeoLite2 注册国家，返回 Registration
+	CompareRegistration(ip net.IP) (*Registration, error)
+
+	//Route 查询包含IP的最长前缀 BGP 路由，返回 Route
+	Route(ip net.IP) (*Route, error)
+	//MOASRoutes 查询由多个 AS 发起的前缀，返回 Route 数组
+	MOASRoutes() ([]Route, error)
 }
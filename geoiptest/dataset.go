@@ -0,0 +1,134 @@
+// Package geoiptest 提供用于测试的 Geoip2 内存实现及 GeoLite2 CSV 测试数据生成器，
+// 两者使用同一份 Dataset，测试无需下载真实的 MaxMind 数据
+package geoiptest
+
+// Location 地域，CityName 与 Subdivision1ISOCode 为空时为国家级地域
+type Location struct {
+	GeonameID           int64
+	ContinentCode       string
+	ContinentName       string
+	CountryISOCode      string
+	CountryName         string
+	Subdivision1ISOCode string
+	Subdivision1Name    string
+	Subdivision2ISOCode string
+	Subdivision2Name    string
+	CityName            string
+	MetroCode           string
+	TimeZone            string
+	EuropeanUnion       bool
+}
+
+// ASNBlock ASN 地址段
+type ASNBlock struct {
+	Network      string
+	Number       int
+	Organization string
+}
+
+// Block 城市或国家地址段，国家地址段忽略 PostalCode、Latitude、Longitude 与 AccuracyRadius
+type Block struct {
+	Network                     string
+	GeonameID                   int64
+	RegisteredCountryGeonameID  int64
+	RepresentedCountryGeonameID int64
+	AnonymousProxy              bool
+	SatelliteProvider           bool
+	PostalCode                  string
+	Latitude                    float64
+	Longitude                   float64
+	AccuracyRadius              int
+}
+
+// Dataset 测试数据，地址段按 CSV 中的顺序排列，IPv4 与 IPv6 可以混合
+type Dataset struct {
+	// Date 发布日期，用于压缩包及目录名，如 20231010
+	Date      string
+	Languages []string
+	Locations []Location
+
+	ASNBlocks     []ASNBlock
+	CityBlocks    []Block
+	CountryBlocks []Block
+}
+
+// Default 返回一份小型但结构真实的测试数据：ASN 与城市地址段粒度不同，包含匿名代理、卫星网络、
+// 无地域的地址段、代表国家（驻日美军网络）、IPv6 地址段及只有 IPv6 地址段的 ASN，地域使用真实的 geoname_id
+func Default() Dataset {
+	return Dataset{
+		Date:      "20231010",
+		Languages: []string{"de", "en", "es", "fr", "ja", "pt-BR", "ru", "zh-CN"},
+		Locations: []Location{
+			{GeonameID: 2077456, ContinentCode: "OC", ContinentName: "Oceania", CountryISOCode: "AU",
+				CountryName: "Australia", TimeZone: "Australia/Sydney"},
+			{GeonameID: 6252001, ContinentCode: "NA", ContinentName: "North America", CountryISOCode: "US",
+				CountryName: "United States", TimeZone: "America/Chicago"},
+			{GeonameID: 5375480, ContinentCode: "NA", ContinentName: "North America", CountryISOCode: "US",
+				CountryName: "United States", Subdivision1ISOCode: "CA", Subdivision1Name: "California",
+				Subdivision2ISOCode: "", Subdivision2Name: "", CityName: "Mountain View", MetroCode: "807",
+				TimeZone: "America/Los_Angeles"},
+			{GeonameID: 2921044, ContinentCode: "EU", ContinentName: "Europe", CountryISOCode: "DE",
+				CountryName: "Germany", TimeZone: "Europe/Berlin", EuropeanUnion: true},
+			{GeonameID: 2925533, ContinentCode: "EU", ContinentName: "Europe", CountryISOCode: "DE",
+				CountryName: "Germany", Subdivision1ISOCode: "HE", Subdivision1Name: "Hesse",
+				CityName: "Frankfurt am Main", TimeZone: "Europe/Berlin", EuropeanUnion: true},
+			{GeonameID: 1814991, ContinentCode: "AS", ContinentName: "Asia", CountryISOCode: "CN",
+				CountryName: "China", TimeZone: "Asia/Shanghai"},
+			{GeonameID: 1809858, ContinentCode: "AS", ContinentName: "Asia", CountryISOCode: "CN",
+				CountryName: "China", Subdivision1ISOCode: "GD", Subdivision1Name: "Guangdong",
+				CityName: "Guangzhou", TimeZone: "Asia/Shanghai"},
+			{GeonameID: 1816670, ContinentCode: "AS", ContinentName: "Asia", CountryISOCode: "CN",
+				CountryName: "China", Subdivision1ISOCode: "BJ", Subdivision1Name: "Beijing",
+				CityName: "Beijing", TimeZone: "Asia/Shanghai"},
+			{GeonameID: 1861060, ContinentCode: "AS", ContinentName: "Asia", CountryISOCode: "JP",
+				CountryName: "Japan", TimeZone: "Asia/Tokyo"},
+			{GeonameID: 1850147, ContinentCode: "AS", ContinentName: "Asia", CountryISOCode: "JP",
+				CountryName: "Japan", Subdivision1ISOCode: "13", Subdivision1Name: "Tokyo",
+				CityName: "Tokyo", TimeZone: "Asia/Tokyo"},
+		},
+		ASNBlocks: []ASNBlock{
+			{"1.0.0.0/24", 13335, "CLOUDFLARENET"},
+			{"5.0.0.0/16", 3320, "Deutsche Telekom AG"},
+			{"8.8.8.0/24", 15169, "GOOGLE"},
+			{"14.0.0.0/16", 4134, "CHINANET-BACKBONE"},
+			{"27.0.0.0/22", 2516, "KDDI CORPORATION"},
+			{"185.220.100.0/22", 205100, "F3 Netze e.V."},
+			{"2001:4860::/32", 15169, "GOOGLE"},
+			{"2003::/19", 3320, "Deutsche Telekom AG"},
+			{"2001:470::/32", 6939, "Hurricane Electric LLC"},
+		},
+		CityBlocks: []Block{
+			{Network: "1.0.0.0/24", GeonameID: 2077456, RegisteredCountryGeonameID: 2077456,
+				Latitude: -33.4940, Longitude: 143.2104, AccuracyRadius: 1000},
+			{Network: "5.0.0.0/16", GeonameID: 2925533, RegisteredCountryGeonameID: 2921044, PostalCode: "60311",
+				Latitude: 50.1155, Longitude: 8.6842, AccuracyRadius: 20},
+			{Network: "8.8.8.0/24", GeonameID: 5375480, RegisteredCountryGeonameID: 6252001, PostalCode: "94043",
+				Latitude: 37.4056, Longitude: -122.0775, AccuracyRadius: 1000},
+			{Network: "14.0.0.0/17", GeonameID: 1809858, RegisteredCountryGeonameID: 1814991,
+				Latitude: 23.1167, Longitude: 113.2500, AccuracyRadius: 50},
+			{Network: "14.0.128.0/17", GeonameID: 1816670, RegisteredCountryGeonameID: 1814991,
+				Latitude: 39.9075, Longitude: 116.3972, AccuracyRadius: 50},
+			{Network: "27.0.0.0/22", GeonameID: 1850147, RegisteredCountryGeonameID: 1861060,
+				RepresentedCountryGeonameID: 6252001, PostalCode: "100-0001",
+				Latitude: 35.6893, Longitude: 139.6899, AccuracyRadius: 20},
+			{Network: "185.220.100.0/22", RegisteredCountryGeonameID: 2921044, AnonymousProxy: true},
+			{Network: "196.201.0.0/16", SatelliteProvider: true},
+			{Network: "2001:4860::/32", GeonameID: 5375480, RegisteredCountryGeonameID: 6252001, PostalCode: "94043",
+				Latitude: 37.4056, Longitude: -122.0775, AccuracyRadius: 1000},
+			{Network: "2003::/19", GeonameID: 2925533, RegisteredCountryGeonameID: 2921044, PostalCode: "60311",
+				Latitude: 50.1155, Longitude: 8.6842, AccuracyRadius: 100},
+		},
+		CountryBlocks: []Block{
+			{Network: "1.0.0.0/24", GeonameID: 2077456, RegisteredCountryGeonameID: 2077456},
+			{Network: "5.0.0.0/16", GeonameID: 2921044, RegisteredCountryGeonameID: 2921044},
+			{Network: "8.8.8.0/24", GeonameID: 6252001, RegisteredCountryGeonameID: 6252001},
+			{Network: "14.0.0.0/16", GeonameID: 1814991, RegisteredCountryGeonameID: 1814991},
+			{Network: "27.0.0.0/22", GeonameID: 1861060, RegisteredCountryGeonameID: 1861060,
+				RepresentedCountryGeonameID: 6252001},
+			{Network: "185.220.100.0/22", RegisteredCountryGeonameID: 2921044, AnonymousProxy: true},
+			{Network: "196.201.0.0/16", SatelliteProvider: true},
+			{Network: "2001:4860::/32", GeonameID: 6252001, RegisteredCountryGeonameID: 6252001},
+			{Network: "2003::/19", GeonameID: 2921044, RegisteredCountryGeonameID: 2921044},
+		},
+	}
+}
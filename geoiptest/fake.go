@@ -0,0 +1,1210 @@
+package geoiptest
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Fake 基于 Dataset 的 Geoip2 内存实现，查询语义与 SQLite 实现一致：
+// 多地址段查询及距离查询先 IPv4 后 IPv6，ID 为地址段在所属 CSV 中的序号（从 1 开始），IPv6 地址段加上 geoip.IPv6IDOffset。
+// 未找到时返回 sql.ErrNoRows。单个 IP 查询的地域使用 Dataset 的第一个语言
+type Fake struct {
+	dataset     Dataset
+	asnRows     []row
+	cityRows    []row
+	countryRows []row
+	locations   map[int64]Location
+	overlays    []geoip.Overlay
+	tags        []tagRow
+	tagID       int64
+	rirRows     []rirRow
+	rirID       int64
+	routes      []routeRow
+	routeID     int64
+	asnSource   geoip.ASNSource
+}
+
+// routeRow 预先解析前缀的 Route，ids 为各起源 AS 在 SQLite 中的行 ID
+type routeRow struct {
+	route   geoip.Route
+	network *net.IPNet
+	ids     []int64
+}
+
+// rirRow 预先解析地址段的 RIRBlock
+type rirRow struct {
+	block   geoip.RIRBlock
+	network *net.IPNet
+}
+
+// tagRow 预先解析地址段的 Tag
+type tagRow struct {
+	tag     geoip.Tag
+	network *net.IPNet
+}
+
+var _ geoip.Geoip2 = (*Fake)(nil)
+
+// NewFake 创建 Geoip2 内存实现
+func NewFake(dataset Dataset) *Fake {
+	networks := make([]string, len(dataset.ASNBlocks))
+	for i, block := range dataset.ASNBlocks {
+		networks[i] = block.Network
+	}
+	locations := make(map[int64]Location, len(dataset.Locations))
+	for _, location := range dataset.Locations {
+		if _, ok := locations[location.GeonameID]; !ok {
+			locations[location.GeonameID] = location
+		}
+	}
+	return &Fake{dataset: dataset, asnRows: parseRows(networks), cityRows: blockRows(dataset.CityBlocks),
+		countryRows: blockRows(dataset.CountryBlocks), locations: locations}
+}
+
+// row 解析后的地址段，first、last 为 16 字节的起止地址
+type row struct {
+	id          int64
+	network     *net.IPNet
+	first, last net.IP
+}
+
+// ipv4 是否为 IPv4 地址段
+func (r row) ipv4() bool {
+	return r.id < geoip.IPv6IDOffset
+}
+
+// overlaps 判断两个同一版本的地址段是否交叠
+func (r row) overlaps(other row) bool {
+	return r.ipv4() == other.ipv4() && bytes.Compare(r.first, other.last) <= 0 && bytes.Compare(other.first, r.last) <= 0
+}
+
+func parseRows(networks []string) []row {
+	rows := make([]row, 0, len(networks))
+	var id4, id6 int64
+	for _, network := range networks {
+		start, end, err := geoip.ParseIPRange(network)
+		if err != nil {
+			continue
+		}
+		_, ipNet, _ := net.ParseCIDR(network)
+		r := row{network: ipNet, first: start.To16(), last: end.To16()}
+		if start.To4() != nil {
+			id4++
+			r.id = id4
+		} else {
+			id6++
+			r.id = id6 + geoip.IPv6IDOffset
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// byID 返回按 ID 排序的行下标，即先 IPv4 后 IPv6，各自按 CSV 中的顺序
+func byID(rows []row) []int {
+	index := make([]int, len(rows))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool { return rows[index[i]].id < rows[index[j]].id })
+	return index
+}
+
+func blockRows(blocks []Block) []row {
+	networks := make([]string, len(blocks))
+	for i, block := range blocks {
+		networks[i] = block.Network
+	}
+	return parseRows(networks)
+}
+
+func (fake *Fake) location(geonameID int64) (Location, bool) {
+	location, ok := fake.locations[geonameID]
+	return location, ok
+}
+
+// isCountry 国家级地域，只有国家级地域出现在 GeoLite2CountryLocations 中
+func isCountry(location Location) bool {
+	return location.CityName == "" && location.Subdivision1ISOCode == ""
+}
+
+// checkIP 与 SQLite 实现相同，先经过 geoip.Normalize
+func checkIP(ip net.IP) (net.IP, error) {
+	ip, err := geoip.Normalize(ip)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() == nil && len(ip) != net.IPv6len {
+		return nil, errors.New("无效的 IP 地址：" + ip.String())
+	}
+	return ip, nil
+}
+
+// language 单个 IP 查询使用的语言
+func (fake *Fake) language() string {
+	if len(fake.dataset.Languages) == 0 {
+		return ""
+	}
+	return fake.dataset.Languages[0]
+}
+
+func (fake *Fake) hasLanguage(language string) bool {
+	for _, l := range fake.dataset.Languages {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+func asnBlock(block ASNBlock, id int64) geoip.ASNBlock {
+	return geoip.ASNBlock{ID: id, Network: block.Network, Organization: geoip.Organization{
+		AutonomousSystemNumber: block.Number, AutonomousSystemOrganization: block.Organization}}
+}
+
+func cityBlock(block Block, id int64) geoip.CityBlock {
+	city := geoip.CityBlock{ID: id, Network: block.Network, GeonameID: block.GeonameID,
+		RegisteredCountryGeonameID: optional(block.RegisteredCountryGeonameID), RepresentedCountryGeonameID: optional(block.RepresentedCountryGeonameID),
+		IsAnonymousProxy: boolInt(block.AnonymousProxy), IsSatelliteProvider: boolInt(block.SatelliteProvider),
+		PostalCode: block.PostalCode, AccuracyRadius: block.AccuracyRadius}
+	if hasCoordinates(block) {
+		city.SetCoordinates(block.Latitude, block.Longitude)
+	}
+	return city
+}
+
+func countryBlock(block Block, id int64) geoip.CountryBlock {
+	return geoip.CountryBlock{ID: id, Network: block.Network, GeonameID: block.GeonameID,
+		RegisteredCountryGeonameID: optional(block.RegisteredCountryGeonameID), RepresentedCountryGeonameID: optional(block.RepresentedCountryGeonameID),
+		IsAnonymousProxy: flag(block.AnonymousProxy), IsSatelliteProvider: flag(block.SatelliteProvider)}
+}
+
+func cityLocation(location Location, language string) geoip.CityLocation {
+	return geoip.CityLocation{GeonameID: location.GeonameID, LocaleCode: language, ContinentCode: location.ContinentCode,
+		ContinentName: location.ContinentName, CountryISOCode: location.CountryISOCode, CountryName: location.CountryName,
+		Subdivision1ISOCode: location.Subdivision1ISOCode, Subdivision1Name: location.Subdivision1Name,
+		Subdivision2ISOCode: location.Subdivision2ISOCode, Subdivision2Name: location.Subdivision2Name,
+		CityName: location.CityName, MetroCode: location.MetroCode, TimeZone: location.TimeZone,
+		IsInEuropeanUnion: flag(location.EuropeanUnion)}
+}
+
+func countryLocation(location Location, language string) geoip.CountryLocation {
+	return geoip.CountryLocation{GeonameID: location.GeonameID, LocaleCode: language, ContinentCode: location.ContinentCode,
+		ContinentName: location.ContinentName, CountryISOCode: location.CountryISOCode, CountryName: location.CountryName,
+		IsInEuropeanUnion: flag(location.EuropeanUnion)}
+}
+
+// countries 地址段的注册国家与代表国家，只有国家级地域出现在 GeoLite2CountryLocations 中
+func (fake *Fake) countries(block Block, language string) (registered, represented *geoip.Country) {
+	if !fake.hasLanguage(language) {
+		return nil, nil
+	}
+	if location, ok := fake.location(block.RegisteredCountryGeonameID); ok && isCountry(location) {
+		registered = &geoip.Country{CountryLocation: countryLocation(location, language)}
+	}
+	if location, ok := fake.location(block.RepresentedCountryGeonameID); ok && isCountry(location) {
+		represented = &geoip.Country{CountryLocation: countryLocation(location, language)}
+	}
+	return registered, represented
+}
+
+// withLanguage 以 language 替换单个 IP 查询得到的国家的语言，数据库中没有该语言时返回 nil
+func (fake *Fake) withLanguage(country *geoip.Country, language string) *geoip.Country {
+	if country == nil || !fake.hasLanguage(language) {
+		return nil
+	}
+	c := *country
+	c.LocaleCode = language
+	return &c
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// paginate 按 Page 逐条回调，items 已按游标 key 升序排列
+func paginate[T any](items []T, key func(T) int64, page geoip.Page, fn func(T) bool) {
+	skip := page.Offset
+	count := 0
+	for _, item := range items {
+		if page.After != 0 && key(item) <= page.After {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if page.Limit > 0 && count >= page.Limit {
+			return
+		}
+		count++
+		if !fn(item) {
+			return
+		}
+	}
+}
+
+func (fake *Fake) AsnBlock(ip net.IP) (*geoip.ASNBlock, error) {
+	if overlay := geoip.MatchOverlay(fake.overlays, ip); overlay != nil && overlay.HasASN() {
+		return overlay.ASNBlock(), nil
+	}
+	ip, err := checkIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	if fake.asnSource == geoip.ASNSourceBGP {
+		r := fake.matchRoute(ip)
+		if r == nil {
+			return nil, sql.ErrNoRows
+		}
+		origins := append([]geoip.RouteOrigin(nil), r.route.Origins...)
+		sortOrigins(origins)
+		number := origins[0].AutonomousSystemNumber
+		return &geoip.ASNBlock{Network: r.route.Network, Organization: geoip.Organization{
+			AutonomousSystemNumber: number, AutonomousSystemOrganization: fake.organizationName(number)}}, nil
+	}
+	for i, r := range fake.asnRows {
+		if r.network.Contains(ip) {
+			block := asnBlock(fake.dataset.ASNBlocks[i], 0)
+			return &block, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (fake *Fake) BlocksByAsnNumber(number int64) ([]geoip.ASNBlock, error) {
+	var blocks []geoip.ASNBlock
+	err := fake.RangeBlocksByAsnNumber(number, geoip.Page{}, func(block geoip.ASNBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	})
+	return blocks, err
+}
+
+func (fake *Fake) RangeBlocksByAsnNumber(number int64, page geoip.Page, fn func(geoip.ASNBlock) bool) error {
+	if fake.asnSource == geoip.ASNSourceBGP {
+		var blocks []geoip.ASNBlock
+		for _, r := range fake.routes {
+			for i, origin := range r.route.Origins {
+				if int64(origin.AutonomousSystemNumber) == number {
+					blocks = append(blocks, geoip.ASNBlock{ID: r.ids[i], Network: r.route.Network,
+						Organization: geoip.Organization{AutonomousSystemNumber: origin.AutonomousSystemNumber,
+							AutonomousSystemOrganization: fake.organizationName(origin.AutonomousSystemNumber)}})
+				}
+			}
+		}
+		sort.Slice(blocks, func(i, j int) bool { return blocks[i].ID < blocks[j].ID })
+		paginate(blocks, func(block geoip.ASNBlock) int64 { return block.ID }, page, fn)
+		return nil
+	}
+	return fake.rangeASNBlocks(func(block ASNBlock) bool { return int64(block.Number) == number }, page, fn)
+}
+
+func (fake *Fake) BlocksByAsnName(name string) ([]geoip.ASNBlock, error) {
+	var blocks []geoip.ASNBlock
+	err := fake.RangeBlocksByAsnName(name, geoip.Page{}, func(block geoip.ASNBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	})
+	return blocks, err
+}
+
+func (fake *Fake) RangeBlocksByAsnName(name string, page geoip.Page, fn func(geoip.ASNBlock) bool) error {
+	return fake.rangeASNBlocks(func(block ASNBlock) bool { return block.Organization == name }, page, fn)
+}
+
+func (fake *Fake) rangeASNBlocks(match func(ASNBlock) bool, page geoip.Page, fn func(geoip.ASNBlock) bool) error {
+	var blocks []geoip.ASNBlock
+	for _, i := range byID(fake.asnRows) {
+		r := fake.asnRows[i]
+		if match(fake.dataset.ASNBlocks[i]) {
+			blocks = append(blocks, asnBlock(fake.dataset.ASNBlocks[i], r.id))
+		}
+	}
+	paginate(blocks, func(block geoip.ASNBlock) int64 { return block.ID }, page, fn)
+	return nil
+}
+
+// organizations 按 ASN 编号排序的组织
+func (fake *Fake) organizations() []geoip.Organization {
+	seen := make(map[int]bool)
+	var orgs []geoip.Organization
+	for _, i := range byID(fake.asnRows) {
+		block := fake.dataset.ASNBlocks[i]
+		if seen[block.Number] {
+			continue
+		}
+		seen[block.Number] = true
+		orgs = append(orgs, geoip.Organization{AutonomousSystemNumber: block.Number,
+			AutonomousSystemOrganization: block.Organization})
+	}
+	sort.Slice(orgs, func(i, j int) bool {
+		return orgs[i].AutonomousSystemNumber < orgs[j].AutonomousSystemNumber
+	})
+	return orgs
+}
+
+func (fake *Fake) Organizations() ([]geoip.Organization, error) {
+	var orgs []geoip.Organization
+	err := fake.RangeOrganizations(geoip.Page{}, func(org geoip.Organization) bool {
+		orgs = append(orgs, org)
+		return true
+	})
+	return orgs, err
+}
+
+func (fake *Fake) RangeOrganizations(page geoip.Page, fn func(geoip.Organization) bool) error {
+	paginate(fake.organizations(), func(org geoip.Organization) int64 {
+		return int64(org.AutonomousSystemNumber)
+	}, page, fn)
+	return nil
+}
+
+// OrganizationDirectory 与 SQLite 实现相同，Fuzzy 搜索只判断字符是否按顺序出现，不按匹配度排序
+func (fake *Fake) OrganizationDirectory(query geoip.DirectoryQuery) ([]geoip.OrganizationEntry, error) {
+	if query.Offset < 0 {
+		return nil, errors.New("Offset 不能小于 0：" + strconv.Itoa(query.Offset))
+	}
+	var entries []geoip.OrganizationEntry
+	index := make(map[int]int)
+	for _, i := range byID(fake.asnRows) {
+		r := fake.asnRows[i]
+		block := fake.dataset.ASNBlocks[i]
+		if !matchOrganization(block.Organization, query) {
+			continue
+		}
+		n, ok := index[block.Number]
+		if !ok {
+			n = len(entries)
+			index[block.Number] = n
+			entries = append(entries, geoip.OrganizationEntry{Organization: geoip.Organization{
+				AutonomousSystemNumber: block.Number, AutonomousSystemOrganization: block.Organization},
+				IPv6Addresses: new(big.Int)})
+		}
+		entries[n].Prefixes++
+		if r.ipv4() {
+			entries[n].IPv4Addresses += int64(geoip.IP2Int(r.last)) - int64(geoip.IP2Int(r.first)) + 1
+		} else {
+			ones, bits := r.network.Mask.Size()
+			entries[n].IPv6Addresses.Add(entries[n].IPv6Addresses, new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)))
+		}
+
+		for j, c := range fake.countryRows {
+			if !r.overlaps(c) {
+				continue
+			}
+			location, ok := fake.location(fake.dataset.CountryBlocks[j].GeonameID)
+			if !ok || location.CountryISOCode == "" {
+				continue
+			}
+			entries[n].Countries = appendUnique(entries[n].Countries, location.CountryISOCode)
+		}
+	}
+
+	for i := range entries {
+		sort.Strings(entries[i].Countries)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if query.Descending {
+			i, j = j, i
+		}
+		a, b := entries[i], entries[j]
+		switch query.SortBy {
+		case geoip.SortByName:
+			if a.AutonomousSystemOrganization != b.AutonomousSystemOrganization {
+				return a.AutonomousSystemOrganization < b.AutonomousSystemOrganization
+			}
+		case geoip.SortByPrefixes:
+			if a.Prefixes != b.Prefixes {
+				return a.Prefixes < b.Prefixes
+			}
+		case geoip.SortByAddresses:
+			if a.IPv4Addresses != b.IPv4Addresses {
+				return a.IPv4Addresses < b.IPv4Addresses
+			}
+			if c := a.IPv6Addresses.Cmp(b.IPv6Addresses); c != 0 {
+				return c < 0
+			}
+		}
+		return a.AutonomousSystemNumber < b.AutonomousSystemNumber
+	})
+
+	if query.Offset >= len(entries) {
+		return nil, nil
+	}
+	entries = entries[query.Offset:]
+	if query.Limit > 0 && query.Limit < len(entries) {
+		entries = entries[:query.Limit]
+	}
+	return entries, nil
+}
+
+func matchOrganization(name string, query geoip.DirectoryQuery) bool {
+	if query.Search == "" {
+		return true
+	}
+	target := strings.ToLower(name)
+	if !query.Fuzzy {
+		return strings.Contains(target, strings.ToLower(query.Search))
+	}
+	for _, r := range strings.ToLower(query.Search) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			continue
+		}
+		i := strings.IndexRune(target, r)
+		if i < 0 {
+			return false
+		}
+		target = target[i+len(string(r)):]
+	}
+	return true
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func (fake *Fake) CityBlock(ip net.IP) (*geoip.CityBlock, error) {
+	if overlay := geoip.MatchOverlay(fake.overlays, ip); overlay != nil && overlay.HasLocation() {
+		var l *geoip.CityLocation
+		if location, ok := fake.location(overlay.GeonameID); ok {
+			cl := cityLocation(location, fake.language())
+			l = &cl
+		}
+		return overlay.CityBlock(l), nil
+	}
+	ip, err := checkIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range fake.cityRows {
+		if !r.network.Contains(ip) {
+			continue
+		}
+		block := cityBlock(fake.dataset.CityBlocks[i], 0)
+		if location, ok := fake.location(block.GeonameID); ok {
+			l := cityLocation(location, fake.language())
+			block.SetLocation(&l)
+		}
+		block.SetCountries(fake.countries(fake.dataset.CityBlocks[i], fake.language()))
+		return &block, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (fake *Fake) BlocksByCityCode(language, countryCode, cityCode string) ([]geoip.CityBlock, error) {
+	var blocks []geoip.CityBlock
+	err := fake.RangeBlocksByCityCode(language, countryCode, cityCode, geoip.Page{}, func(block geoip.CityBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	})
+	return blocks, err
+}
+
+func (fake *Fake) RangeBlocksByCityCode(language, countryCode, cityCode string, page geoip.Page, fn func(geoip.CityBlock) bool) error {
+	if !fake.hasLanguage(language) {
+		return nil
+	}
+	var blocks []geoip.CityBlock
+	for _, i := range byID(fake.cityRows) {
+		r := fake.cityRows[i]
+		location, ok := fake.location(fake.dataset.CityBlocks[i].GeonameID)
+		if !ok || location.CountryISOCode != countryCode || location.Subdivision1ISOCode != cityCode {
+			continue
+		}
+		block := cityBlock(fake.dataset.CityBlocks[i], r.id)
+		l := cityLocation(location, language)
+		block.SetLocation(&l)
+		block.SetCountries(fake.countries(fake.dataset.CityBlocks[i], language))
+		blocks = append(blocks, block)
+	}
+	paginate(blocks, func(block geoip.CityBlock) int64 { return block.ID }, page, fn)
+	return nil
+}
+
+// nearby 有经纬度的城市地址段，按 ID 排序
+func (fake *Fake) nearby(language string, match func(latitude, longitude float64) bool) []geoip.NearbyBlock {
+	var blocks []geoip.NearbyBlock
+	for _, i := range byID(fake.cityRows) {
+		block := fake.dataset.CityBlocks[i]
+		if !hasCoordinates(block) || !match(block.Latitude, block.Longitude) {
+			continue
+		}
+		nearby := geoip.NearbyBlock{CityBlock: cityBlock(block, fake.cityRows[i].id)}
+		nearby.CityBlock.SetCountries(fake.countries(block, language))
+		if location, ok := fake.location(block.GeonameID); ok && fake.hasLanguage(language) {
+			nearby.Location = cityLocation(location, language)
+		}
+		blocks = append(blocks, nearby)
+	}
+	return blocks
+}
+
+func (fake *Fake) BlocksNear(language string, latitude, longitude, radius float64) ([]geoip.NearbyBlock, error) {
+	if radius <= 0 {
+		return nil, errors.New("查询半径必须大于 0")
+	}
+	blocks := fake.nearby(language, func(lat, lon float64) bool {
+		return geoip.Haversine(latitude, longitude, lat, lon) <= radius
+	})
+	for i := range blocks {
+		blocks[i].Distance = geoip.Haversine(latitude, longitude, blocks[i].CityBlock.Latitude, blocks[i].CityBlock.Longitude)
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].Distance < blocks[j].Distance
+	})
+	return blocks, nil
+}
+
+func (fake *Fake) BlocksInBox(language string, minLatitude, minLongitude, maxLatitude, maxLongitude float64) ([]geoip.NearbyBlock, error) {
+	if minLatitude > maxLatitude || minLongitude > maxLongitude {
+		return nil, errors.New("经纬度范围错误，最小值大于最大值")
+	}
+	blocks := fake.nearby(language, func(lat, lon float64) bool {
+		return lat >= minLatitude && lat <= maxLatitude && lon >= minLongitude && lon <= maxLongitude
+	})
+	latitude, longitude := (minLatitude+maxLatitude)/2, (minLongitude+maxLongitude)/2
+	for i := range blocks {
+		blocks[i].Distance = geoip.Haversine(latitude, longitude, blocks[i].CityBlock.Latitude, blocks[i].CityBlock.Longitude)
+	}
+	return blocks, nil
+}
+
+func (fake *Fake) Distance(a, b net.IP) (float64, error) {
+	blockA, err := fake.CityBlock(a)
+	if err != nil {
+		return 0, err
+	}
+	blockB, err := fake.CityBlock(b)
+	if err != nil {
+		return 0, err
+	}
+	if !blockA.HasCoordinates() {
+		return 0, errors.New("地址段没有经纬度：" + a.String())
+	}
+	if !blockB.HasCoordinates() {
+		return 0, errors.New("地址段没有经纬度：" + b.String())
+	}
+	return geoip.Haversine(blockA.Latitude, blockA.Longitude, blockB.Latitude, blockB.Longitude), nil
+}
+
+func (fake *Fake) ReverseGeocode(language string, latitude, longitude float64) (*geoip.ReverseLocation, error) {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil, errors.New("经纬度超出范围")
+	}
+	if !fake.hasLanguage(language) {
+		return nil, sql.ErrNoRows
+	}
+
+	// 城市坐标为该城市精度半径最小的地址段的坐标，半径相同时按 ID 取第一个（先 IPv4），没有半径的地址段排在最后
+	best := make(map[int64]Block)
+	var order []int64
+	for _, i := range byID(fake.cityRows) {
+		block := fake.dataset.CityBlocks[i]
+		if block.GeonameID == 0 || !hasCoordinates(block) {
+			continue
+		}
+		current, ok := best[block.GeonameID]
+		if !ok {
+			order = append(order, block.GeonameID)
+		}
+		if !ok || block.AccuracyRadius != 0 && (current.AccuracyRadius == 0 || block.AccuracyRadius < current.AccuracyRadius) {
+			best[block.GeonameID] = block
+		}
+	}
+
+	var nearest *geoip.ReverseLocation
+	for _, geonameID := range order {
+		location, ok := fake.location(geonameID)
+		if !ok || location.CityName == "" {
+			continue
+		}
+		block := best[geonameID]
+		reverse := geoip.ReverseLocation{Location: cityLocation(location, language),
+			Latitude: block.Latitude, Longitude: block.Longitude}
+		reverse.Distance = geoip.Haversine(latitude, longitude, reverse.Latitude, reverse.Longitude)
+		if nearest == nil || reverse.Distance < nearest.Distance {
+			nearest = &reverse
+		}
+	}
+	if nearest == nil {
+		return nil, sql.ErrNoRows
+	}
+	return nearest, nil
+}
+
+func (fake *Fake) CountryBlock(ip net.IP) (*geoip.CountryBlock, error) {
+	if overlay := geoip.MatchOverlay(fake.overlays, ip); overlay != nil && overlay.HasLocation() {
+		var l *geoip.CountryLocation
+		if location, ok := fake.location(overlay.GeonameID); ok && isCountry(location) {
+			cl := countryLocation(location, fake.language())
+			l = &cl
+		}
+		return overlay.CountryBlock(l), nil
+	}
+	ip, err := checkIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range fake.countryRows {
+		if !r.network.Contains(ip) {
+			continue
+		}
+		block := countryBlock(fake.dataset.CountryBlocks[i], 0)
+		if location, ok := fake.location(block.GeonameID); ok {
+			l := countryLocation(location, fake.language())
+			block.SetLocation(&l)
+		}
+		block.SetCountries(fake.countries(fake.dataset.CountryBlocks[i], fake.language()))
+		return &block, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (fake *Fake) BlocksByCountryCode(language, code string) ([]geoip.CountryBlock, error) {
+	var blocks []geoip.CountryBlock
+	err := fake.RangeBlocksByCountryCode(language, code, geoip.Page{}, func(block geoip.CountryBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	})
+	return blocks, err
+}
+
+func (fake *Fake) RangeBlocksByCountryCode(language, code string, page geoip.Page, fn func(geoip.CountryBlock) bool) error {
+	return fake.rangeCountryBlocks(language, func(location Location) bool {
+		return location.CountryISOCode == code
+	}, page, fn)
+}
+
+func (fake *Fake) BlocksByContinentCode(language, code string) ([]geoip.CountryBlock, error) {
+	var blocks []geoip.CountryBlock
+	err := fake.RangeBlocksByContinentCode(language, code, geoip.Page{}, func(block geoip.CountryBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	})
+	return blocks, err
+}
+
+func (fake *Fake) RangeBlocksByContinentCode(language, code string, page geoip.Page, fn func(geoip.CountryBlock) bool) error {
+	return fake.rangeCountryBlocks(language, func(location Location) bool {
+		return location.ContinentCode == code
+	}, page, fn)
+}
+
+func (fake *Fake) rangeCountryBlocks(language string, match func(Location) bool, page geoip.Page,
+	fn func(geoip.CountryBlock) bool) error {
+	if !fake.hasLanguage(language) {
+		return nil
+	}
+	var blocks []geoip.CountryBlock
+	for _, i := range byID(fake.countryRows) {
+		r := fake.countryRows[i]
+		location, ok := fake.location(fake.dataset.CountryBlocks[i].GeonameID)
+		if !ok || !match(location) {
+			continue
+		}
+		block := countryBlock(fake.dataset.CountryBlocks[i], r.id)
+		l := countryLocation(location, language)
+		block.SetLocation(&l)
+		block.SetCountries(fake.countries(fake.dataset.CountryBlocks[i], language))
+		blocks = append(blocks, block)
+	}
+	paginate(blocks, func(block geoip.CountryBlock) int64 { return block.ID }, page, fn)
+	return nil
+}
+
+func (fake *Fake) BlocksByFilter(filter *geoip.Filter) ([]geoip.CompositeBlock, error) {
+	var blocks []geoip.CompositeBlock
+	err := fake.RangeBlocksByFilter(filter, geoip.Page{}, func(block geoip.CompositeBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	})
+	return blocks, err
+}
+
+func (fake *Fake) RangeBlocksByFilter(filter *geoip.Filter, page geoip.Page, fn func(geoip.CompositeBlock) bool) error {
+	var blocks []geoip.CompositeBlock
+	for i, a := range fake.asnRows {
+		for j, c := range fake.cityRows {
+			if !a.overlaps(c) {
+				continue
+			}
+			start, end := a.first, a.last
+			if bytes.Compare(c.first, start) > 0 {
+				start = c.first
+			}
+			if bytes.Compare(c.last, end) < 0 {
+				end = c.last
+			}
+			if a.ipv4() {
+				start, end = start.To4(), end.To4()
+			}
+			block := geoip.CompositeBlock{StartIP: start, EndIP: end,
+				ASNBlock: asnBlock(fake.dataset.ASNBlocks[i], a.id), CityBlock: cityBlock(fake.dataset.CityBlocks[j], c.id)}
+			if location, ok := fake.location(block.CityBlock.GeonameID); ok && fake.hasLanguage(filter.Language()) {
+				block.Location = cityLocation(location, filter.Language())
+			}
+			block.CityBlock.SetCountries(fake.countries(fake.dataset.CityBlocks[j], filter.Language()))
+			if filter.Match(block) {
+				blocks = append(blocks, block)
+			}
+		}
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return startLess(blocks[i].StartIP, blocks[j].StartIP)
+	})
+	if page.After != 0 {
+		return errors.New("BlocksByFilter 以 AfterIP 作为游标")
+	}
+	if page.AfterIP != nil {
+		i := sort.Search(len(blocks), func(i int) bool { return startLess(page.AfterIP, blocks[i].StartIP) })
+		blocks = blocks[i:]
+	}
+	paginate(blocks, func(geoip.CompositeBlock) int64 { return 0 }, page, fn)
+	return nil
+}
+
+// startLess 按起始地址排序：先 IPv4 后 IPv6，各自按地址大小
+func startLess(a, b net.IP) bool {
+	if (a.To4() != nil) != (b.To4() != nil) {
+		return a.To4() != nil
+	}
+	return bytes.Compare(a.To16(), b.To16()) < 0
+}
+
+// LookupMany 逐个查询，忽略 Workers 与 BatchSize
+func (fake *Fake) LookupMany(ips []net.IP, options geoip.LookupOptions) ([]geoip.LookupResult, error) {
+	if options.Fields == 0 {
+		options.Fields = geoip.LookupAll
+	}
+	language := fake.language()
+	if options.Language != "" {
+		language = options.Language
+	}
+
+	results := make([]geoip.LookupResult, len(ips))
+	for i, ip := range ips {
+		results[i].IP = ip
+		results[i].Overlay = geoip.MatchOverlay(fake.overlays, ip)
+		if _, err := checkIP(ip); err != nil {
+			results[i].Err = err
+		}
+		if options.Fields&geoip.LookupASN != 0 {
+			results[i].ASN, _ = fake.AsnBlock(ip)
+		}
+		if options.Fields&geoip.LookupCity != 0 {
+			if block, err := fake.CityBlock(ip); err == nil {
+				if location := block.Location(); location != nil && location.LocaleCode != "" {
+					block.SetLocation(nil)
+					if fake.hasLanguage(language) {
+						location.LocaleCode = language
+						block.SetLocation(location)
+					}
+				}
+				block.SetCountries(fake.withLanguage(block.RegisteredCountry(), language),
+					fake.withLanguage(block.RepresentedCountry(), language))
+				results[i].City = block
+			}
+		}
+		if options.Fields&geoip.LookupCountry != 0 {
+			if block, err := fake.CountryBlock(ip); err == nil {
+				if location := block.Location(); location != nil && location.LocaleCode != "" {
+					block.SetLocation(nil)
+					if fake.hasLanguage(language) {
+						location.LocaleCode = language
+						block.SetLocation(location)
+					}
+				}
+				block.SetCountries(fake.withLanguage(block.RegisteredCountry(), language),
+					fake.withLanguage(block.RepresentedCountry(), language))
+				results[i].Country = block
+			}
+		}
+		// 覆盖数据提供了任一查询字段时不再报告错误
+		if results[i].ASN != nil || results[i].City != nil || results[i].Country != nil {
+			results[i].Err = nil
+		}
+		if options.Fields&geoip.LookupTags != 0 {
+			results[i].Tags, _ = fake.Tags(ip)
+		}
+	}
+	return results, nil
+}
+
+// Breakdown 将全部地址段交给 geoip.NewBreakdown 裁剪，ID 与单个 IP 查询相同为 0
+func (fake *Fake) Breakdown(language, network string) (*geoip.Breakdown, error) {
+	start, end, err := geoip.ParseIPRange(network)
+	if err != nil {
+		return nil, err
+	}
+	if language == "" {
+		language = fake.language()
+	}
+
+	asns := make([]geoip.ASNBlock, len(fake.dataset.ASNBlocks))
+	for i, block := range fake.dataset.ASNBlocks {
+		asns[i] = asnBlock(block, 0)
+	}
+	cities := make([]geoip.CityBlock, len(fake.dataset.CityBlocks))
+	for i, b := range fake.dataset.CityBlocks {
+		cities[i] = cityBlock(b, 0)
+		if location, ok := fake.location(b.GeonameID); ok && fake.hasLanguage(language) {
+			l := cityLocation(location, language)
+			cities[i].SetLocation(&l)
+		}
+		cities[i].SetCountries(fake.countries(b, language))
+	}
+	countries := make([]geoip.CountryBlock, len(fake.dataset.CountryBlocks))
+	for i, b := range fake.dataset.CountryBlocks {
+		countries[i] = countryBlock(b, 0)
+		if location, ok := fake.location(b.GeonameID); ok && isCountry(location) && fake.hasLanguage(language) {
+			l := countryLocation(location, language)
+			countries[i].SetLocation(&l)
+		}
+		countries[i].SetCountries(fake.countries(b, language))
+	}
+	return geoip.NewBreakdown(start, end, asns, cities, countries)
+}
+
+// SetOverlays 与 OverlayLoader.Load 相同替换全部覆盖地址段，ID 按顺序从 1 开始，Network 应为规范的 CIDR
+func (fake *Fake) SetOverlays(overlays []geoip.Overlay) {
+	fake.overlays = make([]geoip.Overlay, len(overlays))
+	for i, overlay := range overlays {
+		overlay.ID = int64(i + 1)
+		fake.overlays[i] = overlay
+	}
+}
+
+func (fake *Fake) Overlay(ip net.IP) (*geoip.Overlay, error) {
+	if ip.To4() == nil && len(ip) != net.IPv6len {
+		return nil, errors.New("无效的 IP 地址：" + ip.String())
+	}
+	if overlay := geoip.MatchOverlay(fake.overlays, ip); overlay != nil {
+		o := *overlay
+		return &o, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (fake *Fake) Overlays() ([]geoip.Overlay, error) {
+	return append([]geoip.Overlay(nil), fake.overlays...), nil
+}
+
+// SetTags 与 TagLoader.Load 相同替换标签 name 的全部地址段，ID 在多次调用之间递增，Network 应为规范的 CIDR
+func (fake *Fake) SetTags(name string, tags []geoip.Tag) {
+	rows := fake.tags[:0]
+	for _, r := range fake.tags {
+		if r.tag.Name != name {
+			rows = append(rows, r)
+		}
+	}
+	for _, tag := range tags {
+		fake.tagID++
+		tag.ID, tag.Name = fake.tagID, name
+		_, network, _ := net.ParseCIDR(tag.Network)
+		rows = append(rows, tagRow{tag: tag, network: network})
+	}
+	fake.tags = rows
+}
+
+// Tags 与 SQLite 实现相同按起始地址、前缀长度、标签名排序
+func (fake *Fake) Tags(ip net.IP) ([]geoip.Tag, error) {
+	if ip.To4() == nil && len(ip) != net.IPv6len {
+		return nil, errors.New("无效的 IP 地址：" + ip.String())
+	}
+	var rows []tagRow
+	for _, r := range fake.tags {
+		if r.network != nil && r.network.Contains(ip) {
+			rows = append(rows, r)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if c := bytes.Compare(rows[i].network.IP, rows[j].network.IP); c != 0 {
+			return c < 0
+		}
+		a, _ := rows[i].network.Mask.Size()
+		b, _ := rows[j].network.Mask.Size()
+		if a != b {
+			return a < b
+		}
+		if rows[i].tag.Name != rows[j].tag.Name {
+			return rows[i].tag.Name < rows[j].tag.Name
+		}
+		return rows[i].tag.ID < rows[j].tag.ID
+	})
+
+	var tags []geoip.Tag
+	for _, r := range rows {
+		tags = append(tags, r.tag)
+	}
+	return tags, nil
+}
+
+func (fake *Fake) TagNames() ([]string, error) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, r := range fake.tags {
+		if !seen[r.tag.Name] {
+			seen[r.tag.Name] = true
+			names = append(names, r.tag.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (fake *Fake) BlocksByTag(name string) ([]geoip.Tag, error) {
+	var tags []geoip.Tag
+	if err := fake.RangeBlocksByTag(name, geoip.Page{}, func(tag geoip.Tag) bool {
+		tags = append(tags, tag)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (fake *Fake) RangeBlocksByTag(name string, page geoip.Page, fn func(geoip.Tag) bool) error {
+	var tags []geoip.Tag
+	for _, r := range fake.tags {
+		if r.tag.Name == name {
+			tags = append(tags, r.tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+	paginate(tags, func(tag geoip.Tag) int64 { return tag.ID }, page, fn)
+	return nil
+}
+
+// SetRIRBlocks 与 RIRLoader.Load 相同替换 blocks 中出现的注册机构的全部地址段，ID 在多次调用之间递增
+func (fake *Fake) SetRIRBlocks(blocks []geoip.RIRBlock) {
+	registries := make(map[string]bool)
+	for _, block := range blocks {
+		registries[block.Registry] = true
+	}
+	rows := fake.rirRows[:0]
+	for _, r := range fake.rirRows {
+		if !registries[r.block.Registry] {
+			rows = append(rows, r)
+		}
+	}
+	for _, block := range blocks {
+		fake.rirID++
+		block.ID = fake.rirID
+		block.SetLocation(nil)
+		_, network, _ := net.ParseCIDR(block.Network)
+		rows = append(rows, rirRow{block: block, network: network})
+	}
+	fake.rirRows = rows
+}
+
+// countryByCode 国家代码对应的国家级地域，language 不在数据集中时返回 nil
+func (fake *Fake) countryByCode(code, language string) *geoip.CountryLocation {
+	if code == "" || !fake.hasLanguage(language) {
+		return nil
+	}
+	for _, location := range fake.dataset.Locations {
+		if isCountry(location) && location.CountryISOCode == code {
+			l := countryLocation(location, language)
+			return &l
+		}
+	}
+	return nil
+}
+
+func (fake *Fake) RIRBlock(ip net.IP) (*geoip.RIRBlock, error) {
+	ip, err := checkIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	var match *geoip.RIRBlock
+	bits := -1
+	for i, r := range fake.rirRows {
+		if r.network == nil || !r.network.Contains(ip) {
+			continue
+		}
+		// 前缀相同时取 ID 较大的一个
+		if ones, _ := r.network.Mask.Size(); ones >= bits {
+			match, bits = &fake.rirRows[i].block, ones
+		}
+	}
+	if match == nil {
+		return nil, sql.ErrNoRows
+	}
+	block := *match
+	block.SetLocation(fake.countryByCode(block.CountryISOCode, fake.language()))
+	return &block, nil
+}
+
+func (fake *Fake) BlocksByRIRCountryCode(language, code string) ([]geoip.RIRBlock, error) {
+	var blocks []geoip.RIRBlock
+	err := fake.RangeBlocksByRIRCountryCode(language, code, geoip.Page{}, func(block geoip.RIRBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	})
+	return blocks, err
+}
+
+func (fake *Fake) RangeBlocksByRIRCountryCode(language, code string, page geoip.Page, fn func(geoip.RIRBlock) bool) error {
+	var blocks []geoip.RIRBlock
+	for _, r := range fake.rirRows {
+		if r.block.CountryISOCode == code {
+			block := r.block
+			block.SetLocation(fake.countryByCode(code, language))
+			blocks = append(blocks, block)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].ID < blocks[j].ID })
+	paginate(blocks, func(block geoip.RIRBlock) int64 { return block.ID }, page, fn)
+	return nil
+}
+
+func (fake *Fake) CompareRegistration(ip net.IP) (*geoip.Registration, error) {
+	var registration geoip.Registration
+	rir, err := fake.RIRBlock(ip)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	registration.RIR = rir
+
+	// 只比较数据集中的国家地址段，不经过覆盖地址段
+	normalized, err := checkIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range fake.countryRows {
+		if !r.network.Contains(normalized) {
+			continue
+		}
+		registration.RegisteredCountryGeonameID = optional(fake.dataset.CountryBlocks[i].RegisteredCountryGeonameID)
+		if location, ok := fake.location(fake.dataset.CountryBlocks[i].RegisteredCountryGeonameID); ok &&
+			isCountry(location) {
+			registration.RegisteredCountryISOCode = location.CountryISOCode
+		}
+		break
+	}
+
+	if registration.RIR == nil && registration.RegisteredCountryGeonameID == "" {
+		return nil, sql.ErrNoRows
+	}
+	registration.Match = registration.RIR != nil && registration.RegisteredCountryISOCode != "" &&
+		registration.RIR.CountryISOCode == registration.RegisteredCountryISOCode
+	return &registration, nil
+}
+
+// SetRoutes 与 RouteLoader.Load 相同替换全部路由，ID 在多次调用之间递增
+func (fake *Fake) SetRoutes(routes []geoip.Route) {
+	fake.routes = nil
+	for _, route := range routes {
+		_, network, _ := net.ParseCIDR(route.Network)
+		r := routeRow{route: route, network: network}
+		for range route.Origins {
+			fake.routeID++
+			r.ids = append(r.ids, fake.routeID)
+		}
+		fake.routes = append(fake.routes, r)
+	}
+}
+
+// SetASNSource 与 Geolite2.WithASNSource 相同设置 ASN 数据来源
+func (fake *Fake) SetASNSource(source geoip.ASNSource) {
+	fake.asnSource = source
+}
+
+// matchRoute 包含 ip 的最长前缀路由，ip 应已经过 checkIP
+func (fake *Fake) matchRoute(ip net.IP) *routeRow {
+	var match *routeRow
+	bits := -1
+	for i, r := range fake.routes {
+		if r.network == nil || len(r.route.Origins) == 0 || !r.network.Contains(ip) {
+			continue
+		}
+		if ones, _ := r.network.Mask.Size(); ones > bits {
+			match, bits = &fake.routes[i], ones
+		}
+	}
+	return match
+}
+
+// organizationName 与 SQLite 实现相同，取数据集中第一个 IPv4 地址段的组织名称，没有时取 IPv6 地址段
+func (fake *Fake) organizationName(number int) string {
+	for _, ipv4 := range []bool{true, false} {
+		for i, block := range fake.dataset.ASNBlocks {
+			if block.Number == number && (fake.asnRows[i].network.IP.To4() != nil) == ipv4 {
+				return block.Organization
+			}
+		}
+	}
+	return ""
+}
+
+func (fake *Fake) Route(ip net.IP) (*geoip.Route, error) {
+	ip, err := checkIP(ip)
+	if err != nil {
+		return nil, err
+	}
+	r := fake.matchRoute(ip)
+	if r == nil {
+		return nil, sql.ErrNoRows
+	}
+	route := r.route
+	route.Origins = append([]geoip.RouteOrigin(nil), route.Origins...)
+	sortOrigins(route.Origins)
+	return &route, nil
+}
+
+func (fake *Fake) MOASRoutes() ([]geoip.Route, error) {
+	var rows []routeRow
+	for _, r := range fake.routes {
+		if r.route.MOAS && r.network != nil {
+			rows = append(rows, r)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i].network, rows[j].network
+		if (a.IP.To4() != nil) != (b.IP.To4() != nil) {
+			return a.IP.To4() != nil
+		}
+		if c := bytes.Compare(a.IP, b.IP); c != 0 {
+			return c < 0
+		}
+		x, _ := a.Mask.Size()
+		y, _ := b.Mask.Size()
+		return x < y
+	})
+
+	var routes []geoip.Route
+	for _, r := range rows {
+		route := r.route
+		route.Origins = append([]geoip.RouteOrigin(nil), route.Origins...)
+		sortOrigins(route.Origins)
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func sortOrigins(origins []geoip.RouteOrigin) {
+	sort.SliceStable(origins, func(i, j int) bool {
+		if origins[i].Peers != origins[j].Peers {
+			return origins[i].Peers > origins[j].Peers
+		}
+		return origins[i].AutonomousSystemNumber < origins[j].AutonomousSystemNumber
+	})
+}
@@ -0,0 +1,243 @@
+package geoiptest
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 与 MaxMind 发布的 CSV 版本一致的 edition_id
+const (
+	EditionASN     = "GeoLite2-ASN-CSV"
+	EditionCity    = "GeoLite2-City-CSV"
+	EditionCountry = "GeoLite2-Country-CSV"
+)
+
+// Editions 生成的 CSV 目录
+type Editions struct {
+	ASN     string
+	City    string
+	Country string
+}
+
+// files 生成各版本的 CSV 文件，键为 edition_id，值为文件名到内容的映射
+func (dataset Dataset) files() map[string]map[string][]byte {
+	asn4, asn6 := [][]string{}, [][]string{}
+	for _, block := range dataset.ASNBlocks {
+		row := []string{block.Network, strconv.Itoa(block.Number), block.Organization}
+		if isIPv4(block.Network) {
+			asn4 = append(asn4, row)
+		} else {
+			asn6 = append(asn6, row)
+		}
+	}
+
+	city4, city6 := [][]string{}, [][]string{}
+	for _, block := range dataset.CityBlocks {
+		row := append(blockRow(block), block.PostalCode, coordinate(block.Latitude, block),
+			coordinate(block.Longitude, block), optional(int64(block.AccuracyRadius)))
+		if isIPv4(block.Network) {
+			city4 = append(city4, row)
+		} else {
+			city6 = append(city6, row)
+		}
+	}
+
+	country4, country6 := [][]string{}, [][]string{}
+	for _, block := range dataset.CountryBlocks {
+		if isIPv4(block.Network) {
+			country4 = append(country4, blockRow(block))
+		} else {
+			country6 = append(country6, blockRow(block))
+		}
+	}
+
+	asnHeader := []string{"network", "autonomous_system_number", "autonomous_system_organization"}
+	countryHeader := []string{"network", "geoname_id", "registered_country_geoname_id",
+		"represented_country_geoname_id", "is_anonymous_proxy", "is_satellite_provider"}
+	cityHeader := append(append([]string(nil), countryHeader...), "postal_code", "latitude", "longitude", "accuracy_radius")
+
+	files := map[string]map[string][]byte{
+		EditionASN: {
+			"GeoLite2-ASN-Blocks-IPv4.csv": csvContent(asnHeader, asn4),
+			"GeoLite2-ASN-Blocks-IPv6.csv": csvContent(asnHeader, asn6),
+		},
+		EditionCity: {
+			"GeoLite2-City-Blocks-IPv4.csv": csvContent(cityHeader, city4),
+			"GeoLite2-City-Blocks-IPv6.csv": csvContent(cityHeader, city6),
+		},
+		EditionCountry: {
+			"GeoLite2-Country-Blocks-IPv4.csv": csvContent(countryHeader, country4),
+			"GeoLite2-Country-Blocks-IPv6.csv": csvContent(countryHeader, country6),
+		},
+	}
+
+	for _, language := range dataset.Languages {
+		var cities, countries [][]string
+		for _, location := range dataset.Locations {
+			cities = append(cities, []string{strconv.FormatInt(location.GeonameID, 10), language,
+				location.ContinentCode, location.ContinentName, location.CountryISOCode, location.CountryName,
+				location.Subdivision1ISOCode, location.Subdivision1Name, location.Subdivision2ISOCode,
+				location.Subdivision2Name, location.CityName, location.MetroCode, location.TimeZone,
+				flag(location.EuropeanUnion)})
+			if isCountry(location) {
+				countries = append(countries, []string{strconv.FormatInt(location.GeonameID, 10), language,
+					location.ContinentCode, location.ContinentName, location.CountryISOCode, location.CountryName,
+					flag(location.EuropeanUnion)})
+			}
+		}
+		files[EditionCity]["GeoLite2-City-Locations-"+language+".csv"] = csvContent([]string{"geoname_id",
+			"locale_code", "continent_code", "continent_name", "country_iso_code", "country_name",
+			"subdivision_1_iso_code", "subdivision_1_name", "subdivision_2_iso_code", "subdivision_2_name",
+			"city_name", "metro_code", "time_zone", "is_in_european_union"}, cities)
+		files[EditionCountry]["GeoLite2-Country-Locations-"+language+".csv"] = csvContent([]string{"geoname_id",
+			"locale_code", "continent_code", "continent_name", "country_iso_code", "country_name",
+			"is_in_european_union"}, countries)
+	}
+
+	return files
+}
+
+// directory 解压后的目录名，与 MaxMind 压缩包一致，如 GeoLite2-ASN-CSV_20231010
+func (dataset Dataset) directory(editionID string) string {
+	return editionID + "_" + dataset.Date
+}
+
+// WriteCSV 在 dir 下按 MaxMind 的目录结构生成三个版本的 CSV 文件，返回各版本的目录，可直接用于 GeoLite2Loader.Local
+func (dataset Dataset) WriteCSV(dir string) (Editions, error) {
+	var editions Editions
+	for editionID, files := range dataset.files() {
+		path := filepath.Join(dir, dataset.directory(editionID))
+		if err := os.MkdirAll(path, os.ModePerm); err != nil {
+			return editions, err
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(path, name), content, 0644); err != nil {
+				return editions, err
+			}
+		}
+		switch editionID {
+		case EditionASN:
+			editions.ASN = path
+		case EditionCity:
+			editions.City = path
+		case EditionCountry:
+			editions.Country = path
+		}
+	}
+	return editions, nil
+}
+
+// Archive 一个版本的 zip 压缩包及其 sha256 文件内容
+type Archive struct {
+	// Name 压缩包文件名，如 GeoLite2-ASN-CSV_20231010.zip
+	Name    string
+	Content []byte
+	// SHA256 与 MaxMind 的 .zip.sha256 文件格式一致：sha256、两个空格、文件名
+	SHA256 string
+}
+
+// Archives 生成三个版本的 zip 压缩包，键为 edition_id
+func (dataset Dataset) Archives() (map[string]Archive, error) {
+	archives := make(map[string]Archive)
+	for editionID, files := range dataset.files() {
+		var buffer bytes.Buffer
+		writer := zip.NewWriter(&buffer)
+		directory := dataset.directory(editionID)
+		if _, err := writer.Create(directory + "/"); err != nil {
+			return nil, err
+		}
+		for name, content := range files {
+			file, err := writer.Create(directory + "/" + name)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := file.Write(content); err != nil {
+				return nil, err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(buffer.Bytes())
+		name := directory + ".zip"
+		archives[editionID] = Archive{Name: name, Content: buffer.Bytes(),
+			SHA256: hex.EncodeToString(sum[:]) + "  " + name + "\n"}
+	}
+	return archives, nil
+}
+
+// WriteArchives 在 dir 下生成三个版本的 zip 压缩包及 .zip.sha256 文件，返回 edition_id 到压缩包路径的映射
+func (dataset Dataset) WriteArchives(dir string) (map[string]string, error) {
+	archives, err := dataset.Archives()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]string)
+	for editionID, archive := range archives {
+		path := filepath.Join(dir, archive.Name)
+		if err := os.WriteFile(path, archive.Content, 0644); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path+".sha256", []byte(archive.SHA256), 0644); err != nil {
+			return nil, err
+		}
+		paths[editionID] = path
+	}
+	return paths, nil
+}
+
+func blockRow(block Block) []string {
+	return []string{block.Network, optional(block.GeonameID), optional(block.RegisteredCountryGeonameID),
+		optional(block.RepresentedCountryGeonameID), flag(block.AnonymousProxy), flag(block.SatelliteProvider)}
+}
+
+// coordinate 没有地域的地址段经纬度为空
+func coordinate(value float64, block Block) string {
+	if !hasCoordinates(block) {
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', 4, 64)
+}
+
+// hasCoordinates 既没有地域也没有精度半径的地址段（如匿名代理）在 CSV 中没有经纬度
+func hasCoordinates(block Block) bool {
+	return block.GeonameID != 0 || block.AccuracyRadius != 0
+}
+
+// optional GeoLite2 CSV 中缺失的数值为空字符串
+func optional(value int64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+func flag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func isIPv4(network string) bool {
+	ip, _, err := net.ParseCIDR(network)
+	return err == nil && ip.To4() != nil
+}
+
+func csvContent(header []string, rows [][]string) []byte {
+	var b strings.Builder
+	writer := csv.NewWriter(&b)
+	writer.Write(header)
+	writer.WriteAll(rows)
+	return []byte(b.String())
+}
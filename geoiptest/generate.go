@@ -0,0 +1,89 @@
+package geoiptest
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+)
+
+// Generate 以 Default 的地域为模板生成 blocks 个 IPv4 /24 地址段及 blocks/4 个 IPv6 /48 地址段，
+// 每个地址段同时出现在 ASN、城市及国家数据中，用于基准测试及较大规模的加载测试。相同的 seed 生成相同的数据
+func Generate(blocks int, seed int64) Dataset {
+	base := Default()
+	random := rand.New(rand.NewSource(seed))
+
+	countries := make(map[string]int64)
+	for _, location := range base.Locations {
+		if isCountry(location) {
+			countries[location.CountryISOCode] = location.GeonameID
+		}
+	}
+	var templates []Block
+	for _, block := range base.CityBlocks {
+		if block.GeonameID != 0 && block.AccuracyRadius != 0 {
+			templates = append(templates, block)
+		}
+	}
+	country := make(map[int64]int64)
+	for _, location := range base.Locations {
+		country[location.GeonameID] = countries[location.CountryISOCode]
+	}
+
+	organizations := blocks/10 + 1
+	dataset := Dataset{Date: base.Date, Languages: base.Languages, Locations: base.Locations}
+	add := func(network string, i int) {
+		template := templates[random.Intn(len(templates))]
+		number := 64512 + i%organizations
+		dataset.ASNBlocks = append(dataset.ASNBlocks, ASNBlock{Network: network, Number: number,
+			Organization: fmt.Sprintf("AS%d Synthetic Networks", number)})
+
+		city := template
+		city.Network = network
+		city.Latitude += random.Float64() - 0.5
+		city.Longitude += random.Float64() - 0.5
+		city.AnonymousProxy = random.Intn(100) == 0
+		dataset.CityBlocks = append(dataset.CityBlocks, city)
+
+		dataset.CountryBlocks = append(dataset.CountryBlocks, Block{Network: network,
+			GeonameID: country[template.GeonameID], RegisteredCountryGeonameID: template.RegisteredCountryGeonameID,
+			AnonymousProxy: city.AnonymousProxy})
+	}
+
+	// IPv4 地址段之间保留间隔，使一部分查询落在数据之外
+	for i := 0; i < blocks; i++ {
+		n := uint32(1<<24) + uint32(i)*512
+		add(fmt.Sprintf("%d.%d.%d.0/24", byte(n>>24), byte(n>>16), byte(n>>8)), i)
+	}
+	for i := 0; i < blocks/4; i++ {
+		add(fmt.Sprintf("2a00:%x:%x::/48", (i>>16)+1, i&0xffff), i)
+	}
+
+	return dataset
+}
+
+// SampleIPs 返回 n 个随机 IP，其中约 90% 位于 dataset 的城市地址段内，其余为随机地址，相同的 seed 返回相同的 IP
+func (dataset Dataset) SampleIPs(n int, seed int64) []net.IP {
+	random := rand.New(rand.NewSource(seed))
+	var networks []*net.IPNet
+	for _, block := range dataset.CityBlocks {
+		if _, network, err := net.ParseCIDR(block.Network); err == nil {
+			networks = append(networks, network)
+		}
+	}
+
+	ips := make([]net.IP, n)
+	for i := range ips {
+		if len(networks) == 0 || random.Intn(10) == 0 {
+			ips[i] = net.IPv4(byte(random.Intn(224)), byte(random.Intn(256)), byte(random.Intn(256)),
+				byte(random.Intn(256))).To4()
+			continue
+		}
+		network := networks[random.Intn(len(networks))]
+		ip := make(net.IP, len(network.IP))
+		for j := range ip {
+			ip[j] = network.IP[j] | (byte(random.Intn(256)) &^ network.Mask[j])
+		}
+		ips[i] = ip
+	}
+	return ips
+}
@@ -0,0 +1,67 @@
+package geoiptest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Server 模拟 MaxMind 下载接口的测试服务器，按 edition_id 与 suffix 返回 zip 压缩包或 .zip.sha256 文件，
+// 支持 Range 与条件请求
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	archives map[string]Archive
+	modTime  time.Time
+	requests map[string]int
+}
+
+// NewServer 使用 dataset 生成的压缩包启动测试服务器，使用完成后需要调用 Close
+func NewServer(dataset Dataset) (*Server, error) {
+	archives, err := dataset.Archives()
+	if err != nil {
+		return nil, err
+	}
+
+	server := &Server{archives: archives, modTime: time.Now().UTC().Truncate(time.Second),
+		requests: make(map[string]int)}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	return server, nil
+}
+
+// DownloadURL 返回可用于 GeoLite2Loader.SetDownloadURL 的下载地址格式
+func (server *Server) DownloadURL() string {
+	return server.URL + "/app/geoip_download?edition_id=%s&suffix=%s"
+}
+
+// Requests 返回 edition_id 与 suffix 对应的请求次数，suffix 如 zip、zip.sha256
+func (server *Server) Requests(editionID, suffix string) int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.requests[editionID+"."+suffix]
+}
+
+func (server *Server) serve(w http.ResponseWriter, r *http.Request) {
+	editionID, suffix := r.URL.Query().Get("edition_id"), r.URL.Query().Get("suffix")
+
+	server.mu.Lock()
+	server.requests[editionID+"."+suffix]++
+	archive, ok := server.archives[editionID]
+	server.mu.Unlock()
+	if !ok {
+		http.Error(w, "Invalid product ID or subscription expired", http.StatusUnauthorized)
+		return
+	}
+
+	switch suffix {
+	case "zip":
+		http.ServeContent(w, r, archive.Name, server.modTime, bytes.NewReader(archive.Content))
+	case "zip.sha256":
+		http.ServeContent(w, r, archive.Name+".sha256", server.modTime, bytes.NewReader([]byte(archive.SHA256)))
+	default:
+		http.Error(w, "Invalid suffix", http.StatusBadRequest)
+	}
+}
@@ -1,18 +1,18 @@
 package geoip
 
 import (
-	"crypto/sha256"
+	"context"
 	"database/sql"
-	"encoding/csv"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"github.com/sechelper/geoip2/utils"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 )
 
 var tmpDir = os.TempDir()
@@ -25,93 +25,179 @@ const (
 	cityLocationsFilePrefix     = "GeoLite2-City-Locations"
 	countryIPv4BlocksFilePrefix = "GeoLite2-Country-Blocks-IPv4"
 	countryLocationsFilePrefix  = "GeoLite2-Country-Locations"
+
+	asnBlocksIPv6FilePrefix     = "GeoLite2-ASN-Blocks-IPv6"
+	cityBlocksIPv6FilePrefix    = "GeoLite2-City-Blocks-IPv6"
+	countryIPv6BlocksFilePrefix = "GeoLite2-Country-Blocks-IPv6"
 )
 
+// Languages GeoLite2 提供的全部语言，加载器默认加载全部语言
 var Languages = []string{"de", "en", "es", "fr", "ja", "pt-BR", "ru", "zh-CN"}
 
+// Edition GeoLite2 版本，可按位组合
+type Edition int
+
+const (
+	EditionASN Edition = 1 << iota
+	EditionCity
+	EditionCountry
+
+	EditionAll = EditionASN | EditionCity | EditionCountry
+)
+
+// IPVersion 加载的地址段协议，可按位组合
+type IPVersion int
+
+const (
+	IPv4 IPVersion = 1 << iota
+	IPv6
+
+	IPv4AndIPv6 = IPv4 | IPv6
+)
+
 type GeoLite2Loader struct {
-	db *sql.DB
+	db          *sql.DB
+	remote      *Downloader
+	url         string
+	dir         string
+	concurrency int
+	progress    ProgressFunc
+	editions    Edition
+	versions    IPVersion
+	languages   []string
 }
 
 func NewGeoLite2Loader(db *sql.DB) *GeoLite2Loader {
 	return &GeoLite2Loader{
-		db: db,
+		db:          db,
+		remote:      NewDownloader(),
+		url:         downloadUrl,
+		dir:         tmpDir,
+		concurrency: runtime.NumCPU(),
+		editions:    EditionAll,
+		versions:    IPv4,
+		languages:   append([]string(nil), Languages...),
 	}
 }
 
-func (loader *GeoLite2Loader) loading(asn, city, country string) error {
+// SetEditions 设置加载的版本，默认为 EditionAll。未选择的版本在 Local 中对应的路径可以为空，Remote 中不会下载
+func (loader *GeoLite2Loader) SetEditions(editions Edition) {
+	loader.editions = editions
+}
 
-	log.Debug().Msg("开始加载 [ASNBlocksIPv4] " + filepath.Join(asn, asnBlocksIPv4FilePrefix+".csv"))
-	if err := loader.loadASNBlocksIPv4Csv(filepath.Join(asn, asnBlocksIPv4FilePrefix+".csv"),
-		asnBlocksIPv4Sql); err != nil {
-		return err
-	}
+// SetIPVersions 设置加载的地址段协议，默认只加载 IPv4
+func (loader *GeoLite2Loader) SetIPVersions(versions IPVersion) {
+	loader.versions = versions
+}
 
-	log.Debug().Msg("开始加载 [CityBlocksIPv4] " + filepath.Join(city, cityBlocksIPv4FilePrefix+".csv"))
-	if err := loader.loadCityBlocksIPv4Csv(filepath.Join(city, cityBlocksIPv4FilePrefix+".csv"),
-		cityBlocksIPv4Sql); err != nil {
-		return err
-	}
+// SetLanguages 设置加载的地域语言，默认为 Languages 中的全部语言
+func (loader *GeoLite2Loader) SetLanguages(languages ...string) {
+	loader.languages = append([]string(nil), languages...)
+}
 
-	for _, language := range Languages {
-		log.Debug().Msg("开始加载 [CityLocations-" + language + "] " + filepath.Join(city, cityLocationsFilePrefix+"-"+language+".csv"))
-		if err := loader.loadCityLocationsCsv(filepath.Join(city, cityLocationsFilePrefix+"-"+language+".csv"),
-			cityLocationsSql); err != nil {
-			return err
+// SetDownloader 设置 Remote 使用的下载器，可用于配置代理、重试次数及自定义 http.Client
+func (loader *GeoLite2Loader) SetDownloader(downloader *Downloader) {
+	loader.remote = downloader
+}
+
+// SetDownloadURL 设置下载地址，format 中依次包含 edition_id 与 suffix 两个 %s，可用于镜像站点或测试服务器
+func (loader *GeoLite2Loader) SetDownloadURL(format string) {
+	loader.url = format
+}
+
+// SetDownloadDir 设置压缩包的下载及解压目录，默认为系统临时目录
+func (loader *GeoLite2Loader) SetDownloadDir(dir string) {
+	loader.dir = dir
+}
+
+// tables 根据加载选项返回需要加载的 CSV 文件
+func (loader *GeoLite2Loader) tables(asn, city, country string) []csvTable {
+	var tables []csvTable
+
+	if loader.editions&EditionASN != 0 {
+		if loader.versions&IPv4 != 0 {
+			tables = append(tables, csvTable{name: "ASNBlocksIPv4", path: filepath.Join(asn, asnBlocksIPv4FilePrefix+".csv"),
+				sql: asnBlocksIPv4Sql, columns: asnBlocksColumns(IPv4), convert: convertBlock})
+		}
+		if loader.versions&IPv6 != 0 {
+			tables = append(tables, csvTable{name: "ASNBlocksIPv6", path: filepath.Join(asn, asnBlocksIPv6FilePrefix+".csv"),
+				sql: asnBlocksIPv6Sql, columns: asnBlocksColumns(IPv6), convert: convertBlock6})
 		}
 	}
 
-	log.Debug().Msg("开始加载 [CountryBlocksIPv4] " + filepath.Join(country, countryIPv4BlocksFilePrefix+".csv"))
-	if err := loader.loadCountryBlocksIPv4Csv(filepath.Join(country, countryIPv4BlocksFilePrefix+".csv"),
-		countryBlocksIPv4Sql); err != nil {
-		return err
+	if loader.editions&EditionCity != 0 {
+		if loader.versions&IPv4 != 0 {
+			tables = append(tables, csvTable{name: "CityBlocksIPv4", path: filepath.Join(city, cityBlocksIPv4FilePrefix+".csv"),
+				sql: cityBlocksIPv4Sql, columns: cityBlocksColumns(IPv4), convert: convertBlock})
+		}
+		if loader.versions&IPv6 != 0 {
+			tables = append(tables, csvTable{name: "CityBlocksIPv6", path: filepath.Join(city, cityBlocksIPv6FilePrefix+".csv"),
+				sql: cityBlocksIPv6Sql, columns: cityBlocksColumns(IPv6), convert: convertBlock6})
+		}
+		for _, language := range loader.languages {
+			tables = append(tables, csvTable{name: "CityLocations-" + language,
+				path: filepath.Join(city, cityLocationsFilePrefix+"-"+language+".csv"),
+				sql:  cityLocationsSql, columns: cityLocationsColumns, convert: convertLocation})
+		}
 	}
 
-	for _, language := range Languages {
-		log.Debug().Msg("开始加载 [CountryLocations-" + language + "] " + filepath.Join(country, countryLocationsFilePrefix+"-"+language+".csv"))
-		if err := loader.loadCountryLocationsCsv(filepath.Join(country, countryLocationsFilePrefix+"-"+language+".csv"),
-			countryLocationsSql); err != nil {
-			return err
+	if loader.editions&EditionCountry != 0 {
+		if loader.versions&IPv4 != 0 {
+			tables = append(tables, csvTable{name: "CountryBlocksIPv4",
+				path: filepath.Join(country, countryIPv4BlocksFilePrefix+".csv"),
+				sql:  countryBlocksIPv4Sql, columns: countryBlocksColumns(IPv4), convert: convertBlock})
+		}
+		if loader.versions&IPv6 != 0 {
+			tables = append(tables, csvTable{name: "CountryBlocksIPv6",
+				path: filepath.Join(country, countryIPv6BlocksFilePrefix+".csv"),
+				sql:  countryBlocksIPv6Sql, columns: countryBlocksColumns(IPv6), convert: convertBlock6})
+		}
+		for _, language := range loader.languages {
+			tables = append(tables, csvTable{name: "CountryLocations-" + language,
+				path: filepath.Join(country, countryLocationsFilePrefix+"-"+language+".csv"),
+				sql:  countryLocationsSql, columns: countryLocationsColumns, convert: convertLocation})
 		}
 	}
-	log.Debug().Msg("geolite2 数据加载完成")
-	return nil
-}
 
-func (loader *GeoLite2Loader) Local(asnPath, cityPath, countryPath string) error {
-	return loader.loading(asnPath, cityPath, countryPath)
+	return tables
 }
 
-// destination 下载文件绝对路径
-func (loader *GeoLite2Loader) download(url string, destination string) error {
-	file, err := os.Create(destination)
-	if err != nil {
-		return err
+func (loader *GeoLite2Loader) loading(asn, city, country string) error {
+	tables := loader.tables(asn, city, country)
+	if len(tables) == 0 {
+		return errors.New("没有需要加载的数据，请检查加载的版本及地址段协议")
 	}
-	defer file.Close()
 
-	response, err := http.Get(url)
-	if err != nil {
+	// 先写入暂存表，全部成功后在一个事务中替换正式表，失败时正式表保持不变，再次加载从断点继续
+	if err := loader.load(tables); err != nil {
 		return err
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		return errors.New("下载失败，状态码：" + string(rune(response.StatusCode)))
-	}
-
-	_, err = io.Copy(file, response.Body)
-	if err != nil {
-		return errors.New("文件保存失败，错误信息：" + err.Error())
+	if err := loader.swap(tables); err != nil {
+		return err
 	}
 
+	log.Debug().Msg("geolite2 数据加载完成")
 	return nil
 }
 
+func (loader *GeoLite2Loader) Local(asnPath, cityPath, countryPath string) error {
+	return loader.loading(asnPath, cityPath, countryPath)
+}
+
+// editionSuffix CSV 版本以 zip 发布，mmdb 二进制版本以 tar.gz 发布
+func editionSuffix(editionID string) string {
+	if strings.HasSuffix(editionID, "-CSV") {
+		return "zip"
+	}
+	return "tar.gz"
+}
+
 func (loader *GeoLite2Loader) downloader(editionID string) (string, error) {
-	destination := filepath.Join(tmpDir, fmt.Sprintf("%s.%s", editionID, "zip.sha256"))
-	log.Debug().Msg("开始下载 [" + editionID + "] " + fmt.Sprintf(downloadUrl, editionID, "zip.sha256"))
-	if err := loader.download(fmt.Sprintf(downloadUrl, editionID, "zip.sha256"), destination); err != nil {
+	ctx := context.Background()
+	suffix := editionSuffix(editionID)
+	destination := filepath.Join(loader.dir, fmt.Sprintf("%s.%s", editionID, suffix+".sha256"))
+	log.Debug().Msg("开始下载 [" + editionID + "] " + fmt.Sprintf(loader.url, editionID, suffix+".sha256"))
+	if _, err := loader.remote.Fetch(ctx, fmt.Sprintf(loader.url, editionID, suffix+".sha256"), destination); err != nil {
 		return "", err
 	}
 
@@ -119,289 +205,402 @@ func (loader *GeoLite2Loader) downloader(editionID string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	realHash := string(content[:64])
-	filename := string(content[66 : len(content)-1])
-	destination = filepath.Join(tmpDir, filename)
-
-	log.Debug().Msg("开始下载 [" + editionID + "] " + fmt.Sprintf(downloadUrl, editionID, "zip"))
-	if err := loader.download(fmt.Sprintf(downloadUrl, editionID, "zip"), destination); err != nil {
-		return "", err
+	fields := strings.Fields(string(content))
+	if len(fields) != 2 || len(fields[0]) != 64 || filepath.Base(fields[1]) != fields[1] ||
+		!strings.HasSuffix(fields[1], "."+suffix) {
+		return "", errors.New("sha256 文件格式错误：" + destination)
+	}
+	realHash, filename := fields[0], fields[1]
+	destination = filepath.Join(loader.dir, filename)
+	extracted := filepath.Join(loader.dir, utils.TrimArchiveSuffix(filename))
+
+	// 本地压缩包与服务器 sha256 一致时说明版本未更新，无需重新下载
+	if hashStr, _, err := hashFile(destination); err == nil && hashStr == realHash {
+		if _, err := os.Stat(extracted); err == nil {
+			log.Debug().Msg("[" + editionID + "] 未更新，使用本地文件 " + extracted)
+			loader.report(Progress{Stage: StageDownload, Edition: editionID, File: destination, Done: true})
+			return extracted, nil
+		}
+	} else {
+		log.Debug().Msg("开始下载 [" + editionID + "] " + fmt.Sprintf(loader.url, editionID, suffix))
+		start := time.Now()
+		result, err := loader.remote.FetchWithProgress(ctx, fmt.Sprintf(loader.url, editionID, suffix), destination,
+			func(written, total int64) {
+				loader.report(Progress{Stage: StageDownload, Edition: editionID, File: destination,
+					Bytes: written, TotalBytes: total, ETA: estimate(start, written, total)})
+			})
+		if err != nil {
+			return "", err
+		}
+		if realHash != result.SHA256 {
+			os.Remove(destination)
+			os.Remove(destination + ".meta")
+			return "", errors.New(fmt.Sprintf("sha256 不匹配，本地：%s，实际：%s", result.SHA256, realHash))
+		}
 	}
 
-	content, err = os.ReadFile(destination)
-	if err != nil {
+	if err := utils.Extract(destination, loader.dir); err != nil {
 		return "", err
 	}
-	hash := sha256.Sum256(content)
-	hashStr := hex.EncodeToString(hash[:])
-
-	if realHash != hashStr {
-		return "", errors.New(fmt.Sprintf("sha256 不匹配，本地：%s，实际：%s", hashStr, realHash))
+	if info, err := os.Stat(destination); err == nil {
+		loader.report(Progress{Stage: StageDownload, Edition: editionID, File: destination,
+			Bytes: info.Size(), TotalBytes: info.Size(), Done: true})
 	}
 
-	if err := utils.Unzip(destination, tmpDir); err != nil {
-		return "", err
-	}
+	return extracted, nil
+}
 
-	return filepath.Join(tmpDir, filename[:len(filename)-4]), nil
+// Download 下载并解压任意 GeoLite2 版本，CSV 版本（如 GeoLite2-City-CSV）为 zip，
+// mmdb 版本（如 GeoLite2-City）为 tar.gz，返回解压后的目录
+func (loader *GeoLite2Loader) Download(editionID string) (string, error) {
+	return loader.downloader(editionID)
 }
 
 func (loader *GeoLite2Loader) Remote(asnEditionID, cityEditionID, countryEditionID string) error {
-	asnPath, err := loader.downloader(asnEditionID)
-	if err != nil {
-		return err
-	}
-	cityPath, err := loader.downloader(cityEditionID)
-	if err != nil {
-		return err
+	var paths [3]string
+	var errs [3]error
+	var wg sync.WaitGroup
+	for i, edition := range []Edition{EditionASN, EditionCity, EditionCountry} {
+		if loader.editions&edition == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, editionID string) {
+			defer wg.Done()
+			paths[i], errs[i] = loader.downloader(editionID)
+		}(i, []string{asnEditionID, cityEditionID, countryEditionID}[i])
 	}
-	countryPath, err := loader.downloader(countryEditionID)
-	if err != nil {
-		return err
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
 
-	return loader.loading(asnPath, cityPath, countryPath)
+	return loader.loading(paths[0], paths[1], paths[2])
 }
 
+// Update 从 MaxMind 更新 GeoLite2 CSV 数据，版本未变化时使用本地文件。与 Remote 相同，新数据先写入暂存表，
+// 全部加载完成后在一个事务中替换正式表，覆盖地址段、标签等用户数据不受影响
 func (loader *GeoLite2Loader) Update() error {
-	return nil
+	return loader.Remote("GeoLite2-ASN-CSV", "GeoLite2-City-CSV", "GeoLite2-Country-CSV")
 }
 
-func (loader *GeoLite2Loader) loadASNBlocksIPv4Csv(csvPath string, sql GeoipSql) error {
-
-	if _, err := loader.db.Exec(sql.CreateTable); err != nil {
-		return err
-	}
-
-	file, err := os.Open(csvPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1
-
-	rows, err := reader.ReadAll()
-	if err != nil {
-		return err
-	}
-
-	tx, err := loader.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	stmt, err := tx.Prepare(sql.Insert)
-	if err != nil {
+// CreateSpatialIndex 根据城市地址段的经纬度创建 R*Tree 空间索引，用于按距离及范围查询与逆地理编码，
+// 加载时会自动创建，早于该功能加载的数据库可以手动调用
+func (loader *GeoLite2Loader) CreateSpatialIndex() error {
+	if err := createSpatialIndex(loader.db); err != nil {
 		return err
 	}
+	schemaChanged()
+	return nil
+}
 
-	for x := 1; x < len(rows); x++ {
-		start, end, err := IPRange(rows[x][0])
+// createSpatialIndex 为已加载的各版本城市地址段分别创建空间索引，城市位置的空间索引合并两个版本，
+// 精度半径相同时先取 IPv4 地址段的坐标
+func createSpatialIndex(db interface {
+	execer
+	queryRower
+}) error {
+	var blocks []string
+	for _, version := range []string{"IPv4", "IPv6"} {
+		exists, err := tableExists(db, "GeoLite2CityBlocks"+version)
 		if err != nil {
 			return err
 		}
-		if _, err = stmt.Exec(rows[x][0], start, end, rows[x][1], rows[x][2]); err != nil {
+		if !exists {
+			continue
+		}
+		rtree := cityBlocksIPv4RtreeSql
+		if version == "IPv6" {
+			rtree = cityBlocksIPv6RtreeSql
+		}
+		if err := rebuildSpatialIndex(db, rtree); err != nil {
 			return err
 		}
+		blocks = append(blocks, "SELECT "+versionID("id", version)+", geoname_id, latitude, longitude, accuracy_radius "+
+			"FROM GeoLite2CityBlocks"+version)
 	}
-
-	if err = tx.Commit(); err != nil {
-		return err
+	if len(blocks) == 0 {
+		return nil
 	}
-
-	return nil
+	locations := cityLocationsRtreeSql
+	locations.Insert = fmt.Sprintf(locations.Insert, strings.Join(blocks, " UNION ALL "))
+	return rebuildSpatialIndex(db, locations)
 }
 
-func (loader *GeoLite2Loader) loadCityBlocksIPv4Csv(csvPath string, sql GeoipSql) error {
-
-	if _, err := loader.db.Exec(sql.CreateTable); err != nil {
-		return err
-	}
-
-	file, err := os.Open(csvPath)
-	if err != nil {
+// rebuildSpatialIndex 创建空间索引表并重新写入全部数据
+func rebuildSpatialIndex(db execer, sql GeoipSql) error {
+	if _, err := db.Exec(sql.CreateTable); err != nil {
 		return err
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1
-
-	rows, err := reader.ReadAll()
-	if err != nil {
+	if _, err := db.Exec("DELETE FROM " + sql.Table); err != nil {
 		return err
 	}
-
-	tx, err := loader.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	stmt, err := tx.Prepare(sql.Insert)
-	if err != nil {
-		return err
-	}
-
-	for x := 1; x < len(rows); x++ {
-		start, end, err := IPRange(rows[x][0])
-		if err != nil {
-			return err
-		}
-		if _, err = stmt.Exec(rows[x][0], start, end, rows[x][1], rows[x][2], rows[x][3],
-			rows[x][4], rows[x][5], rows[x][6], rows[x][7], rows[x][8], rows[x][9]); err != nil {
-			return err
-		}
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
-	return nil
+	_, err := db.Exec(sql.Insert)
+	return err
 }
 
-func (loader *GeoLite2Loader) loadCityLocationsCsv(csvPath string, sql GeoipSql) error {
-
+func (loader *GeoLite2Loader) createDownloadRecord(sql GeoipSql) error {
 	if _, err := loader.db.Exec(sql.CreateTable); err != nil {
 		return err
 	}
+	return nil
+}
 
-	file, err := os.Open(csvPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+// csvBatchSize 解析 goroutine 每次发送给写入 goroutine 的行数
+const csvBatchSize = 1000
+
+// csvTable 一个待加载的 CSV 文件
+type csvTable struct {
+	// name 用于日志及进度显示
+	name string
+	path string
+	sql  GeoipSql
+	// columns 需要读取的列，按表头名称匹配
+	columns []csvColumn
+	// convert 将按 columns 顺序排列的一行转换为 sql.Insert 的参数
+	convert func(record []string) ([]interface{}, error)
+}
 
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1
+// csvBatch 解析完成的一批数据，offset 为已读取的字节数
+type csvBatch struct {
+	rows   [][]interface{}
+	offset int64
+	err    error
+}
 
-	rows, err := reader.ReadAll()
+// convertBlock 地址段 CSV 第一列为 network，插入时在其后追加起止IP
+func convertBlock(record []string) ([]interface{}, error) {
+	start, end, err := IPRange(record[0])
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	tx, err := loader.db.Begin()
-	if err != nil {
-		return err
+	args := []interface{}{record[0], start, end}
+	for _, field := range record[1:] {
+		args = append(args, field)
 	}
+	return args, nil
+}
 
-	stmt, err := tx.Prepare(sql.Insert)
+// convertBlock6 IPv6 地址段的起止地址以 16 字节 BLOB 存储
+func convertBlock6(record []string) ([]interface{}, error) {
+	start, end, err := IPRange6(record[0])
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	for x := 1; x < len(rows); x++ {
-		if _, err = stmt.Exec(rows[x][0], rows[x][1], rows[x][2], rows[x][3],
-			rows[x][4], rows[x][5], rows[x][6], rows[x][7], rows[x][8], rows[x][9], rows[x][10], rows[x][11],
-			rows[x][12], rows[x][13]); err != nil {
-			return err
-		}
-	}
-
-	if err = tx.Commit(); err != nil {
-		return err
+	args := []interface{}{record[0], start, end}
+	for _, field := range record[1:] {
+		args = append(args, field)
 	}
-
-	return nil
+	return args, nil
 }
 
-func (loader *GeoLite2Loader) loadCountryBlocksIPv4Csv(csvPath string, sql GeoipSql) error {
-
-	if _, err := loader.db.Exec(sql.CreateTable); err != nil {
-		return err
+// convertLocation 地域 CSV 按列顺序插入
+func convertLocation(record []string) ([]interface{}, error) {
+	args := make([]interface{}, len(record))
+	for i, field := range record {
+		args[i] = field
 	}
+	return args, nil
+}
 
-	file, err := os.Open(csvPath)
-	if err != nil {
-		return err
+// SetConcurrency 设置并行解析 CSV 的 goroutine 数，默认为 CPU 核数，数据库写入始终只有一个 goroutine
+func (loader *GeoLite2Loader) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
 	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1
+	loader.concurrency = n
+}
 
-	rows, err := reader.ReadAll()
-	if err != nil {
-		return err
-	}
+// SetProgress 设置下载及加载进度回调，可以配合 ProgressChannel 使用
+func (loader *GeoLite2Loader) SetProgress(fn ProgressFunc) {
+	loader.progress = fn
+}
 
-	tx, err := loader.db.Begin()
-	if err != nil {
-		return err
+func (loader *GeoLite2Loader) report(progress Progress) {
+	if loader.progress != nil {
+		loader.progress(progress)
 	}
+}
 
-	stmt, err := tx.Prepare(sql.Insert)
+// load 并行解析 tables 中的 CSV 文件，按顺序由当前 goroutine 写入暂存表，已完成的文件直接跳过
+func (loader *GeoLite2Loader) load(tables []csvTable) error {
+	points, err := loader.checkpoints(tables)
 	if err != nil {
 		return err
 	}
 
-	for x := 1; x < len(rows); x++ {
-		start, end, err := IPRange(rows[x][0])
-		if err != nil {
-			return err
+	done := make(chan struct{})
+	defer close(done)
+
+	batches := make([]chan csvBatch, len(tables))
+	for i := range batches {
+		batches[i] = make(chan csvBatch, 4)
+	}
+
+	// 按顺序启动解析，保证写入 goroutine 等待的文件总是已经开始解析
+	go func() {
+		slots := make(chan struct{}, loader.concurrency)
+		for i, table := range tables {
+			point := points[table.path]
+			if point.done {
+				close(batches[i])
+				continue
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(table csvTable, skip int64, batches chan<- csvBatch) {
+				defer func() { <-slots }()
+				parseCsv(table, skip, batches, done)
+			}(table, point.rows, batches[i])
+		}
+	}()
+
+	for i, table := range tables {
+		point := points[table.path]
+		if point.done {
+			log.Debug().Msg("[" + table.name + "] 已加载，跳过 " + table.path)
+			loader.report(Progress{Stage: StageLoad, Table: table.name, File: table.path, Rows: point.rows, Done: true})
+			continue
 		}
-		if _, err = stmt.Exec(rows[x][0], start, end, rows[x][1], rows[x][2], rows[x][3],
-			rows[x][4], rows[x][5]); err != nil {
+		log.Debug().Msg("开始加载 [" + table.name + "] " + table.path)
+		if err := loader.write(table, point.rows, batches[i]); err != nil {
 			return err
 		}
 	}
 
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-
 	return nil
 }
 
-func (loader *GeoLite2Loader) loadCountryLocationsCsv(csvPath string, sql GeoipSql) error {
+// parseCsv 逐行解析并校验 CSV，跳过前 skip 行已写入的数据，按批发送给写入 goroutine，发送完成或出错后关闭 batches
+func parseCsv(table csvTable, skip int64, batches chan<- csvBatch, done <-chan struct{}) {
+	defer close(batches)
 
-	if _, err := loader.db.Exec(sql.CreateTable); err != nil {
-		return err
+	send := func(batch csvBatch) bool {
+		select {
+		case batches <- batch:
+			return true
+		case <-done:
+			return false
+		}
 	}
 
-	file, err := os.Open(csvPath)
+	var batch csvBatch
+	var rowErr error
+	err := readCsv(table, func(args []interface{}, offset int64) bool {
+		batch.offset = offset
+		if skip > 0 {
+			skip--
+			return true
+		}
+		batch.rows = append(batch.rows, args)
+		if len(batch.rows) < csvBatchSize {
+			return true
+		}
+		if !send(batch) {
+			return false
+		}
+		batch = csvBatch{}
+		return true
+	}, func(err *RowError) bool {
+		rowErr = err
+		return false
+	})
+	if err == nil {
+		err = rowErr
+	}
 	if err != nil {
-		return err
+		send(csvBatch{err: err})
+		return
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1
+	send(batch)
+}
 
-	rows, err := reader.ReadAll()
-	if err != nil {
+// write 将 table 的数据写入暂存表，每 checkpointRows 行提交一次事务并记录断点，rows 为断点处已写入的行数
+func (loader *GeoLite2Loader) write(table csvTable, rows int64, batches <-chan csvBatch) (err error) {
+	staging := table.sql.staging()
+	if _, err := loader.db.Exec(staging.CreateTable); err != nil {
 		return err
 	}
 
-	tx, err := loader.db.Begin()
-	if err != nil {
-		return err
+	var total int64
+	if info, err := os.Stat(table.path); err == nil {
+		total = info.Size()
 	}
 
-	stmt, err := tx.Prepare(sql.Insert)
-	if err != nil {
+	var tx *sql.Tx
+	var stmt *sql.Stmt
+	begin := func() error {
+		if tx, err = loader.db.Begin(); err != nil {
+			return err
+		}
+		stmt, err = tx.Prepare(staging.Insert)
 		return err
 	}
-
-	for x := 1; x < len(rows); x++ {
-		if _, err = stmt.Exec(rows[x][0], rows[x][1], rows[x][2], rows[x][3],
-			rows[x][4], rows[x][5], rows[x][6]); err != nil {
+	commit := func(done bool) error {
+		if err := saveCheckpoint(tx, table, rows, done); err != nil {
 			return err
 		}
+		stmt.Close()
+		stmt = nil
+		return tx.Commit()
 	}
+	defer func() {
+		if stmt != nil {
+			stmt.Close()
+		}
+		if err != nil && tx != nil {
+			tx.Rollback()
+		}
+	}()
 
-	if err = tx.Commit(); err != nil {
+	if err = begin(); err != nil {
 		return err
 	}
 
-	return nil
-}
+	start := time.Now()
+	progress := Progress{Stage: StageLoad, Table: table.name, File: table.path, TotalBytes: total, Rows: rows}
+	var uncommitted int64
+	for batch := range batches {
+		if batch.err != nil {
+			return batch.err
+		}
+		for _, args := range batch.rows {
+			if _, err = stmt.Exec(args...); err != nil {
+				return err
+			}
+		}
+		rows += int64(len(batch.rows))
+		uncommitted += int64(len(batch.rows))
+		if uncommitted >= checkpointRows {
+			if err = commit(false); err != nil {
+				return err
+			}
+			if err = begin(); err != nil {
+				return err
+			}
+			uncommitted = 0
+		}
 
-func (loader *GeoLite2Loader) createDownloadRecord(sql GeoipSql) error {
-	if _, err := loader.db.Exec(sql.CreateTable); err != nil {
+		progress.Rows = rows
+		progress.Bytes = batch.offset
+		progress.ETA = estimate(start, progress.Bytes, progress.TotalBytes)
+		loader.report(progress)
+	}
+
+	if err = commit(true); err != nil {
 		return err
 	}
+
+	progress.Done = true
+	progress.ETA = 0
+	loader.report(progress)
+
 	return nil
 }
@@ -2,20 +2,108 @@ package geoip
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
 )
 
 type Geolite2 struct {
-	db *sql.DB
+	db        *sql.DB
+	asnSource ASNSource
+	tables    *tableCache
 }
 
+// NewGeolite2 以 db 创建 Geoip2，各表是否存在在第一次用到时查询并缓存，见 tableCache
 func NewGeolite2(db *sql.DB) Geoip2 {
-	return Geolite2{db: db}
+	return Geolite2{db: db, tables: new(tableCache)}
+}
+
+// tableExists 判断表是否存在，见 tableCache
+func (geo Geolite2) tableExists(table string) (bool, error) {
+	if geo.tables == nil {
+		return tableExists(geo.db, table)
+	}
+	return geo.tables.exists(geo.db, table)
+}
+
+// blockKey 返回 IP 所在地址段表的协议后缀及查询参数，IPv4 以整数比较，IPv6 以 16 字节 BLOB 比较。
+// 查询前先经过 Normalize，特殊用途地址返回 *ReservedError，6to4、Teredo 与 NAT64 地址按嵌入的 IPv4 查询
+func blockKey(ip net.IP) (string, interface{}, error) {
+	ip, err := Normalize(ip)
+	if err != nil {
+		return "", nil, err
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return "IPv4", IP2Int(ip4), nil
+	}
+	if len(ip) == net.IPv6len {
+		return "IPv6", IP2Bytes(ip), nil
+	}
+	return "", nil, errors.New("无效的 IP 地址：" + ip.String())
+}
+
+// versionUnion 对 IPv4 与 IPv6 地址段表分别生成查询，以 UNION ALL 合并为先 IPv4 后 IPv6 的子查询，
+// 每个版本使用同样的参数。tables 为查询所需的表名，见 versionTable，缺少其中任一张表的版本被跳过，
+// 两个版本都被跳过时返回空字符串
+func (geo Geolite2) versionUnion(tables []string, query func(version string) string, args ...interface{}) (string, []interface{}, error) {
+	var queries []string
+	var unionArgs []interface{}
+versions:
+	for _, version := range []string{"IPv4", "IPv6"} {
+		for _, table := range tables {
+			exists, err := geo.tableExists(versionTable(table, version))
+			if err != nil {
+				return "", nil, err
+			}
+			if !exists {
+				continue versions
+			}
+		}
+		queries = append(queries, query(version))
+		unionArgs = append(unionArgs, args...)
+	}
+	if len(queries) == 0 {
+		return "", nil, nil
+	}
+	return "SELECT * FROM (" + strings.Join(queries, " UNION ALL ") + ") WHERE 1=1", unionArgs, nil
+}
+
+// versionTable 返回 version 的表名，table 为表名前缀，含 %s 时以 version 替换，如 GeoLite2CityBlocks%sRtree
+func versionTable(table, version string) string {
+	if strings.Contains(table, "%s") {
+		return fmt.Sprintf(table, version)
+	}
+	return table + version
+}
+
+// versionID 返回名为 id 的地址段 ID 列，IPv6 地址段加上 IPv6IDOffset
+func versionID(column, version string) string {
+	if version == "IPv6" {
+		return column + " + " + strconv.FormatInt(IPv6IDOffset, 10) + " AS id"
+	}
+	return column + " AS id"
 }
 
 func (geo Geolite2) AsnBlock(ip net.IP) (*ASNBlock, error) {
+	overlay, err := geo.overlay(ip)
+	if err != nil {
+		return nil, err
+	}
+	if overlay != nil && overlay.HasASN() {
+		return overlay.ASNBlock(), nil
+	}
+
+	version, key, err := blockKey(ip)
+	if err != nil {
+		return nil, err
+	}
+	if geo.asnSource == ASNSourceBGP {
+		return geo.bgpASNBlock(version, key, nil)
+	}
 	row := geo.db.QueryRow("SELECT network, autonomous_system_number, autonomous_system_organization "+
-		"FROM GeoLite2ASNBlocksIPv4 WHERE ? BETWEEN start_ip AND end_ip", IP2Int(ip))
+		"FROM GeoLite2ASNBlocks"+version+" WHERE ? BETWEEN start_ip AND end_ip", key)
 
 	var blocks = new(ASNBlock)
 	if err := row.Scan(&blocks.Network, &blocks.AutonomousSystemNumber,
@@ -27,102 +115,150 @@ func (geo Geolite2) AsnBlock(ip net.IP) (*ASNBlock, error) {
 }
 
 func (geo Geolite2) BlocksByAsnNumber(number int64) ([]ASNBlock, error) {
-	rows, err := geo.db.Query("SELECT network, autonomous_system_number, autonomous_system_organization "+
-		"FROM GeoLite2ASNBlocksIPv4 WHERE autonomous_system_number=?", number)
-	if err != nil {
+	var blocks []ASNBlock
+	if err := geo.RangeBlocksByAsnNumber(number, Page{}, func(block ASNBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	}); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var blocks []ASNBlock
-	for rows.Next() {
-		var block ASNBlock
-		if err := rows.Scan(&block.Network, &block.AutonomousSystemNumber,
-			&block.AutonomousSystemOrganization); err != nil {
-			return nil, err
-		}
-		blocks = append(blocks, block)
+	return blocks, nil
+}
+
+func (geo Geolite2) RangeBlocksByAsnNumber(number int64, page Page, fn func(ASNBlock) bool) error {
+	if geo.asnSource == ASNSourceBGP {
+		return geo.rangeBGPBlocks(number, page, fn)
 	}
+	return geo.rangeASNBlocks("autonomous_system_number=?", number, page, fn)
+}
 
-	if err := rows.Err(); err != nil {
+func (geo Geolite2) BlocksByAsnName(name string) ([]ASNBlock, error) {
+	var blocks []ASNBlock
+	if err := geo.RangeBlocksByAsnName(name, Page{}, func(block ASNBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	}); err != nil {
 		return nil, err
 	}
 
 	return blocks, nil
 }
 
-func (geo Geolite2) BlocksByAsnName(name string) ([]ASNBlock, error) {
-	rows, err := geo.db.Query("SELECT network, autonomous_system_number, autonomous_system_organization "+
-		"FROM GeoLite2ASNBlocksIPv4 WHERE autonomous_system_organization=?", name)
+func (geo Geolite2) RangeBlocksByAsnName(name string, page Page, fn func(ASNBlock) bool) error {
+	return geo.rangeASNBlocks("autonomous_system_organization=?", name, page, fn)
+}
+
+func (geo Geolite2) rangeASNBlocks(where string, arg interface{}, page Page, fn func(ASNBlock) bool) error {
+	query, args, err := geo.versionUnion([]string{"GeoLite2ASNBlocks"}, func(version string) string {
+		return "SELECT " + versionID("id", version) + ", network, autonomous_system_number, " +
+			"autonomous_system_organization FROM GeoLite2ASNBlocks" + version + " WHERE " + where
+	}, arg)
+	if err != nil || query == "" {
+		return err
+	}
+	cursor, args := page.cursor("id", args...)
+	limit, args := page.limit("id", args...)
+	rows, err := geo.db.Query(query+cursor+limit, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var blocks []ASNBlock
-
 	for rows.Next() {
 		var block ASNBlock
-		if err := rows.Scan(&block.Network, &block.AutonomousSystemNumber,
+		if err := rows.Scan(&block.ID, &block.Network, &block.AutonomousSystemNumber,
 			&block.AutonomousSystemOrganization); err != nil {
-			return nil, err
+			return err
+		}
+		if !fn(block) {
+			break
 		}
-		blocks = append(blocks, block)
 	}
 
-	if err := rows.Err(); err != nil {
+	return rows.Err()
+}
+
+func (geo Geolite2) Organizations() ([]Organization, error) {
+	var orgs []Organization
+	if err := geo.RangeOrganizations(Page{}, func(org Organization) bool {
+		orgs = append(orgs, org)
+		return true
+	}); err != nil {
 		return nil, err
 	}
 
-	return blocks, nil
+	return orgs, nil
 }
 
-func (geo Geolite2) Organizations() ([]Organization, error) {
-	rows, err := geo.db.Query("SELECT autonomous_system_number, autonomous_system_organization " +
-		"FROM GeoLite2ASNBlocksIPv4 GROUP BY autonomous_system_number;")
+func (geo Geolite2) RangeOrganizations(page Page, fn func(Organization) bool) error {
+	query, args, err := geo.versionUnion([]string{"GeoLite2ASNBlocks"}, func(version string) string {
+		return "SELECT autonomous_system_number, autonomous_system_organization FROM GeoLite2ASNBlocks" + version
+	})
+	if err != nil || query == "" {
+		return err
+	}
+	cursor, args := page.cursor("CAST(autonomous_system_number AS INTEGER)", args...)
+	limit, args := page.limit("CAST(autonomous_system_number AS INTEGER)", args...)
+	rows, err := geo.db.Query(query+cursor+" GROUP BY autonomous_system_number"+limit, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var orgs []Organization
-
 	for rows.Next() {
 		var org Organization
 		if err := rows.Scan(&org.AutonomousSystemNumber,
 			&org.AutonomousSystemOrganization); err != nil {
-			return nil, err
+			return err
+		}
+		if !fn(org) {
+			break
 		}
-		orgs = append(orgs, org)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
 	}
 
-	return orgs, nil
+	return rows.Err()
 }
 
 func (geo Geolite2) CityBlock(ip net.IP) (*CityBlock, error) {
-	row := geo.db.QueryRow("SELECT GeoLite2CityBlocksIPv4.network,GeoLite2CityBlocksIPv4.geoname_id,GeoLite2CityBlocksIPv4.registered_country_geoname_id,GeoLite2CityBlocksIPv4."+
-		"represented_country_geoname_id,GeoLite2CityBlocksIPv4.is_anonymous_proxy,GeoLite2CityBlocksIPv4.is_satellite_provider,GeoLite2CityBlocksIPv4.postal_code,GeoLite2CityBlocksIPv4.latitude,GeoLite2CityBlocksIPv4.longitude,"+
-		"GeoLite2CityBlocksIPv4.accuracy_radius,GeoLite2CityLocations.geoname_id,GeoLite2CityLocations.locale_code,GeoLite2CityLocations.continent_code,GeoLite2CityLocations.continent_name,"+
-		"GeoLite2CityLocations.country_iso_code,GeoLite2CityLocations.country_name,GeoLite2CityLocations.subdivision_1_iso_code,GeoLite2CityLocations.subdivision_1_name,"+
-		"GeoLite2CityLocations.subdivision_2_iso_code,GeoLite2CityLocations.subdivision_2_name,GeoLite2CityLocations.city_name,GeoLite2CityLocations.metro_code,GeoLite2CityLocations.time_zone,"+
-		"GeoLite2CityLocations.is_in_european_union FROM GeoLite2CityBlocksIPv4 "+
-		"LEFT JOIN GeoLite2CityLocations ON GeoLite2CityBlocksIPv4.geoname_id = GeoLite2CityLocations.geoname_id"+
-		" WHERE ? BETWEEN start_ip AND end_ip ",
-		IP2Int(ip))
+	overlay, err := geo.overlay(ip)
+	if err != nil {
+		return nil, err
+	}
+	if overlay != nil && overlay.HasLocation() {
+		location, err := geo.overlayCityLocation(overlay, "")
+		if err != nil {
+			return nil, err
+		}
+		return overlay.CityBlock(location), nil
+	}
+
+	version, key, err := blockKey(ip)
+	if err != nil {
+		return nil, err
+	}
+	row := geo.db.QueryRow("SELECT c.network, CAST(c.geoname_id AS INTEGER), c.registered_country_geoname_id, "+
+		"c.represented_country_geoname_id, CAST(c.is_anonymous_proxy AS INTEGER), "+
+		"CAST(c.is_satellite_provider AS INTEGER), c.postal_code, "+coordinateColumns+", "+
+		cityLocationColumns+" FROM GeoLite2CityBlocks"+version+" c "+
+		"LEFT JOIN GeoLite2CityLocations l ON c.geoname_id = l.geoname_id WHERE ? BETWEEN c.start_ip AND c.end_ip", key)
 
 	var block = new(CityBlock)
-	block.location = new(CityLocation)
-	if err := row.Scan(&block.Network, &block.GeonameID, &block.RegisteredCountryGeonameID,
-		&block.RepresentedCountryGeonameID, &block.IsAnonymousProxy, &block.IsSatelliteProvider, &block.PostalCode,
-		&block.Latitude, &block.Longitude, &block.AccuracyRadius, &block.location.GeonameID, &block.location.LocaleCode,
-		&block.location.ContinentCode, &block.location.ContinentName, &block.location.CountryISOCode,
-		&block.location.CountryName, &block.location.Subdivision1ISOCode, &block.location.Subdivision1Name,
-		&block.location.Subdivision2ISOCode, &block.location.Subdivision2Name, &block.location.CityName,
-		&block.location.MetroCode, &block.location.TimeZone, &block.location.IsInEuropeanUnion); err != nil {
+	var location CityLocation
+	if err := row.Scan(append(append([]interface{}{&block.Network, &block.GeonameID, &block.RegisteredCountryGeonameID,
+		&block.RepresentedCountryGeonameID, &block.IsAnonymousProxy, &block.IsSatelliteProvider, &block.PostalCode},
+		block.coordinateDest()...), &location.GeonameID, &location.LocaleCode,
+		&location.ContinentCode, &location.ContinentName, &location.CountryISOCode,
+		&location.CountryName, &location.Subdivision1ISOCode, &location.Subdivision1Name,
+		&location.Subdivision2ISOCode, &location.Subdivision2Name, &location.CityName,
+		&location.MetroCode, &location.TimeZone, &location.IsInEuropeanUnion)...); err != nil {
+		return nil, err
+	}
+	// 没有地域的地址段（如只有注册国家的匿名代理）location 为 nil
+	if location.GeonameID != 0 {
+		block.location = &location
+	}
+	if err := geo.resolveCountries(block.countryRefs(), location.LocaleCode); err != nil {
 		return nil, err
 	}
 
@@ -130,63 +266,98 @@ func (geo Geolite2) CityBlock(ip net.IP) (*CityBlock, error) {
 }
 
 func (geo Geolite2) BlocksByCityCode(language, countryCode, cityCode string) ([]CityBlock, error) {
-	rows, err := geo.db.Query("SELECT GeoLite2CityBlocksIPv4.network,GeoLite2CityBlocksIPv4.geoname_id,GeoLite2CityBlocksIPv4.registered_country_geoname_id,GeoLite2CityBlocksIPv4."+
-		"represented_country_geoname_id,GeoLite2CityBlocksIPv4.is_anonymous_proxy,GeoLite2CityBlocksIPv4.is_satellite_provider,GeoLite2CityBlocksIPv4.postal_code,GeoLite2CityBlocksIPv4.latitude,GeoLite2CityBlocksIPv4.longitude,"+
-		"GeoLite2CityBlocksIPv4.accuracy_radius,GeoLite2CityLocations.geoname_id,GeoLite2CityLocations.locale_code,GeoLite2CityLocations.continent_code,GeoLite2CityLocations.continent_name,"+
-		"GeoLite2CityLocations.country_iso_code,GeoLite2CityLocations.country_name,GeoLite2CityLocations.subdivision_1_iso_code,GeoLite2CityLocations.subdivision_1_name,"+
-		"GeoLite2CityLocations.subdivision_2_iso_code,GeoLite2CityLocations.subdivision_2_name,GeoLite2CityLocations.city_name,GeoLite2CityLocations.metro_code,GeoLite2CityLocations.time_zone,"+
-		"GeoLite2CityLocations.is_in_european_union FROM GeoLite2CityBlocksIPv4 "+
-		"LEFT JOIN GeoLite2CityLocations ON GeoLite2CityBlocksIPv4.geoname_id = GeoLite2CityLocations.geoname_id"+
-		" WHERE locale_code=? and country_iso_code=? and subdivision_1_iso_code=?", language, countryCode, cityCode)
-	if err != nil { //
+	var blocks []CityBlock
+	if err := geo.RangeBlocksByCityCode(language, countryCode, cityCode, Page{}, func(block CityBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	}); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var blocks []CityBlock
+	return blocks, nil
+}
+
+func (geo Geolite2) RangeBlocksByCityCode(language, countryCode, cityCode string, page Page, fn func(CityBlock) bool) error {
+	query, args, err := geo.versionUnion([]string{"GeoLite2CityBlocks"}, func(version string) string {
+		return "SELECT " + versionID("c.id", version) + ",c.network,CAST(c.geoname_id AS INTEGER),c.registered_country_geoname_id," +
+			"c.represented_country_geoname_id,CAST(c.is_anonymous_proxy AS INTEGER),CAST(c.is_satellite_provider AS INTEGER),c.postal_code," +
+			coordinateColumns + ",l.geoname_id,l.locale_code,l.continent_code,l.continent_name," +
+			"l.country_iso_code,l.country_name,l.subdivision_1_iso_code,l.subdivision_1_name," +
+			"l.subdivision_2_iso_code,l.subdivision_2_name,l.city_name,l.metro_code,l.time_zone," +
+			"l.is_in_european_union," + countryColumns + " FROM GeoLite2CityBlocks" + version + " c " +
+			"LEFT JOIN GeoLite2CityLocations l ON c.geoname_id = l.geoname_id" +
+			countryJoins("c", "l.locale_code") +
+			" WHERE l.locale_code=? and l.country_iso_code=? and l.subdivision_1_iso_code=?"
+	}, language, countryCode, cityCode)
+	if err != nil || query == "" {
+		return err
+	}
+	cursor, args := page.cursor("id", args...)
+	limit, args := page.limit("id", args...)
+	rows, err := geo.db.Query(query+cursor+limit, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var block CityBlock
+		var countries countryScan
 		block.location = new(CityLocation)
-		if err := rows.Scan(&block.Network, &block.GeonameID, &block.RegisteredCountryGeonameID,
-			&block.RepresentedCountryGeonameID, &block.IsAnonymousProxy, &block.IsSatelliteProvider, &block.PostalCode,
-			&block.Latitude, &block.Longitude, &block.AccuracyRadius, &block.location.GeonameID, &block.location.LocaleCode,
-			&block.location.ContinentCode, &block.location.ContinentName, &block.location.CountryISOCode,
-			&block.location.CountryName, &block.location.Subdivision1ISOCode, &block.location.Subdivision1Name,
-			&block.location.Subdivision2ISOCode, &block.location.Subdivision2Name, &block.location.CityName,
-			&block.location.MetroCode, &block.location.TimeZone, &block.location.IsInEuropeanUnion); err != nil {
-			return nil, err
+		if err := rows.Scan(append(append(append([]interface{}{&block.ID, &block.Network, &block.GeonameID,
+			&block.RegisteredCountryGeonameID, &block.RepresentedCountryGeonameID, &block.IsAnonymousProxy,
+			&block.IsSatelliteProvider, &block.PostalCode}, block.coordinateDest()...),
+			&block.location.GeonameID, &block.location.LocaleCode, &block.location.ContinentCode,
+			&block.location.ContinentName, &block.location.CountryISOCode, &block.location.CountryName,
+			&block.location.Subdivision1ISOCode, &block.location.Subdivision1Name, &block.location.Subdivision2ISOCode,
+			&block.location.Subdivision2Name, &block.location.CityName, &block.location.MetroCode,
+			&block.location.TimeZone, &block.location.IsInEuropeanUnion), countries.dest()...)...); err != nil {
+			return err
+		}
+		block.SetCountries(countries.countries())
+		if !fn(block) {
+			break
 		}
-		blocks = append(blocks, block)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
 	}
 
-	return blocks, nil
+	return rows.Err()
 }
 
 func (geo Geolite2) CountryBlock(ip net.IP) (*CountryBlock, error) {
-	row := geo.db.QueryRow("SELECT GeoLite2CountryBlocksIPv4.network,"+
-		"GeoLite2CountryBlocksIPv4.geoname_id,GeoLite2CountryBlocksIPv4.registered_country_geoname_id,"+
-		"GeoLite2CountryBlocksIPv4.represented_country_geoname_id,GeoLite2CountryBlocksIPv4.is_anonymous_proxy,"+
-		"GeoLite2CountryBlocksIPv4.is_satellite_provider,"+
-		"GeoLite2CountryLocations.geoname_id,GeoLite2CountryLocations.locale_code,GeoLite2CountryLocations.continent_code,"+
-		"GeoLite2CountryLocations.continent_name,GeoLite2CountryLocations.country_iso_code,"+
-		"GeoLite2CountryLocations.country_name,GeoLite2CountryLocations.is_in_european_union "+
-		"FROM GeoLite2CountryBlocksIPv4 "+
-		"LEFT JOIN GeoLite2CountryLocations ON GeoLite2CountryBlocksIPv4.geoname_id = GeoLite2CountryLocations.geoname_id "+
-		"WHERE  ? BETWEEN start_ip AND end_ip",
-		IP2Int(ip))
+	overlay, err := geo.overlay(ip)
+	if err != nil {
+		return nil, err
+	}
+	if overlay != nil && overlay.HasLocation() {
+		location, err := geo.overlayCountryLocation(overlay, "")
+		if err != nil {
+			return nil, err
+		}
+		return overlay.CountryBlock(location), nil
+	}
+
+	version, key, err := blockKey(ip)
+	if err != nil {
+		return nil, err
+	}
+	row := geo.db.QueryRow("SELECT c.network, CAST(c.geoname_id AS INTEGER), c.registered_country_geoname_id, "+
+		"c.represented_country_geoname_id, c.is_anonymous_proxy, c.is_satellite_provider, "+countryLocationColumns+
+		" FROM GeoLite2CountryBlocks"+version+" c "+
+		"LEFT JOIN GeoLite2CountryLocations l ON c.geoname_id = l.geoname_id WHERE ? BETWEEN c.start_ip AND c.end_ip", key)
 
 	var block = new(CountryBlock)
-	block.location = new(CountryLocation)
+	var location CountryLocation
 	if err := row.Scan(&block.Network, &block.GeonameID, &block.RegisteredCountryGeonameID,
 		&block.RepresentedCountryGeonameID, &block.IsAnonymousProxy, &block.IsSatelliteProvider,
-		&block.location.GeonameID, &block.location.LocaleCode, &block.location.ContinentCode,
-		&block.location.ContinentName, &block.location.CountryISOCode, &block.location.ContinentName,
-		&block.location.IsInEuropeanUnion); err != nil {
+		&location.GeonameID, &location.LocaleCode, &location.ContinentCode,
+		&location.ContinentName, &location.CountryISOCode, &location.CountryName,
+		&location.IsInEuropeanUnion); err != nil {
+		return nil, err
+	}
+	if location.GeonameID != 0 {
+		block.location = &location
+	}
+	if err := geo.resolveCountries(block.countryRefs(), location.LocaleCode); err != nil {
 		return nil, err
 	}
 
@@ -194,77 +365,74 @@ func (geo Geolite2) CountryBlock(ip net.IP) (*CountryBlock, error) {
 }
 
 func (geo Geolite2) BlocksByCountryCode(language, code string) ([]CountryBlock, error) {
-	rows, err := geo.db.Query("SELECT GeoLite2CountryBlocksIPv4.network,"+
-		"GeoLite2CountryBlocksIPv4.geoname_id,GeoLite2CountryBlocksIPv4.registered_country_geoname_id,"+
-		"GeoLite2CountryBlocksIPv4.represented_country_geoname_id,GeoLite2CountryBlocksIPv4.is_anonymous_proxy,"+
-		"GeoLite2CountryBlocksIPv4.is_satellite_provider,"+
-		"GeoLite2CountryLocations.geoname_id,GeoLite2CountryLocations.locale_code,GeoLite2CountryLocations.continent_code,"+
-		"GeoLite2CountryLocations.continent_name,GeoLite2CountryLocations.country_iso_code,"+
-		"GeoLite2CountryLocations.country_name,GeoLite2CountryLocations.is_in_european_union "+
-		"FROM GeoLite2CountryBlocksIPv4 "+
-		"LEFT JOIN GeoLite2CountryLocations ON GeoLite2CountryBlocksIPv4.geoname_id = GeoLite2CountryLocations.geoname_id "+
-		"WHERE GeoLite2CountryLocations.locale_code=? and country_iso_code=?", language, code)
-	if err != nil {
+	var blocks []CountryBlock
+	if err := geo.RangeBlocksByCountryCode(language, code, Page{}, func(block CountryBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	}); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var blocks []CountryBlock
+	return blocks, nil
+}
 
-	for rows.Next() {
-		var block = new(CountryBlock)
-		block.location = new(CountryLocation)
-		if err := rows.Scan(&block.Network, &block.GeonameID, &block.RegisteredCountryGeonameID,
-			&block.RepresentedCountryGeonameID, &block.IsAnonymousProxy, &block.IsSatelliteProvider,
-			&block.location.GeonameID, &block.location.LocaleCode, &block.location.ContinentCode,
-			&block.location.ContinentName, &block.location.CountryISOCode, &block.location.ContinentName,
-			&block.location.IsInEuropeanUnion); err != nil {
-			return nil, err
-		}
-		blocks = append(blocks, *block)
-	}
+func (geo Geolite2) RangeBlocksByCountryCode(language, code string, page Page, fn func(CountryBlock) bool) error {
+	return geo.rangeCountryBlocks("l.locale_code=? and l.country_iso_code=?", language, code, page, fn)
+}
 
-	if err := rows.Err(); err != nil {
+func (geo Geolite2) BlocksByContinentCode(language, code string) ([]CountryBlock, error) {
+	var blocks []CountryBlock
+	if err := geo.RangeBlocksByContinentCode(language, code, Page{}, func(block CountryBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	}); err != nil {
 		return nil, err
 	}
 
 	return blocks, nil
 }
 
-func (geo Geolite2) BlocksByContinentCode(language, code string) ([]CountryBlock, error) {
-	rows, err := geo.db.Query("SELECT GeoLite2CountryBlocksIPv4.network,"+
-		"GeoLite2CountryBlocksIPv4.geoname_id,GeoLite2CountryBlocksIPv4.registered_country_geoname_id,"+
-		"GeoLite2CountryBlocksIPv4.represented_country_geoname_id,GeoLite2CountryBlocksIPv4.is_anonymous_proxy,"+
-		"GeoLite2CountryBlocksIPv4.is_satellite_provider,"+
-		"GeoLite2CountryLocations.geoname_id,GeoLite2CountryLocations.locale_code,GeoLite2CountryLocations.continent_code,"+
-		"GeoLite2CountryLocations.continent_name,GeoLite2CountryLocations.country_iso_code,"+
-		"GeoLite2CountryLocations.country_name,GeoLite2CountryLocations.is_in_european_union "+
-		"FROM GeoLite2CountryBlocksIPv4 "+
-		"LEFT JOIN GeoLite2CountryLocations ON GeoLite2CountryBlocksIPv4.geoname_id = GeoLite2CountryLocations.geoname_id "+
-		"WHERE GeoLite2CountryLocations.locale_code=? and continent_code=?", language, code)
+func (geo Geolite2) RangeBlocksByContinentCode(language, code string, page Page, fn func(CountryBlock) bool) error {
+	return geo.rangeCountryBlocks("l.locale_code=? and l.continent_code=?", language, code, page, fn)
+}
+
+func (geo Geolite2) rangeCountryBlocks(where, language, code string, page Page, fn func(CountryBlock) bool) error {
+	query, args, err := geo.versionUnion([]string{"GeoLite2CountryBlocks"}, func(version string) string {
+		return "SELECT " + versionID("c.id", version) + ",c.network,CAST(c.geoname_id AS INTEGER)," +
+			"c.registered_country_geoname_id,c.represented_country_geoname_id,c.is_anonymous_proxy,c.is_satellite_provider," +
+			"l.geoname_id,l.locale_code,l.continent_code,l.continent_name,l.country_iso_code,l.country_name," +
+			"l.is_in_european_union," + countryColumns + " FROM GeoLite2CountryBlocks" + version + " c " +
+			"LEFT JOIN GeoLite2CountryLocations l ON c.geoname_id = l.geoname_id" +
+			countryJoins("c", "l.locale_code") +
+			" WHERE " + where
+	}, language, code)
+	if err != nil || query == "" {
+		return err
+	}
+	cursor, args := page.cursor("id", args...)
+	limit, args := page.limit("id", args...)
+	rows, err := geo.db.Query(query+cursor+limit, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var blocks []CountryBlock
-
 	for rows.Next() {
 		var block = new(CountryBlock)
+		var countries countryScan
 		block.location = new(CountryLocation)
-		if err := rows.Scan(&block.Network, &block.GeonameID, &block.RegisteredCountryGeonameID,
-			&block.RepresentedCountryGeonameID, &block.IsAnonymousProxy, &block.IsSatelliteProvider,
-			&block.location.GeonameID, &block.location.LocaleCode, &block.location.ContinentCode,
-			&block.location.ContinentName, &block.location.CountryISOCode, &block.location.ContinentName,
-			&block.location.IsInEuropeanUnion); err != nil {
-			return nil, err
+		if err := rows.Scan(append([]interface{}{&block.ID, &block.Network, &block.GeonameID,
+			&block.RegisteredCountryGeonameID, &block.RepresentedCountryGeonameID, &block.IsAnonymousProxy,
+			&block.IsSatelliteProvider, &block.location.GeonameID, &block.location.LocaleCode,
+			&block.location.ContinentCode, &block.location.ContinentName, &block.location.CountryISOCode,
+			&block.location.CountryName, &block.location.IsInEuropeanUnion}, countries.dest()...)...); err != nil {
+			return err
+		}
+		block.SetCountries(countries.countries())
+		if !fn(*block) {
+			break
 		}
-		blocks = append(blocks, *block)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
 	}
 
-	return blocks, nil
+	return rows.Err()
 }
@@ -1,121 +1,294 @@
-package geoip
+package geoip_test
 
 import (
 	"database/sql"
-	"fmt"
-	"github.com/rs/zerolog"
-	"log"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"math"
 	"net"
-	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
-var loader *GeoLite2Loader
-var geo Geoip2
-
-func init() {
-	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+// newGeolite2 将 dataset 生成的 CSV 加载到临时数据库
+func newGeolite2(t *testing.T, dataset geoiptest.Dataset) geoip.Geoip2 {
+	return geoip.NewGeolite2(loadDataset(t, dataset))
+}
 
-	// Open a database connection
-	db, err := sql.Open("sqlite3", "geoip2-test.db")
+// loadDataset 将 dataset 的 IPv4 及 IPv6 数据加载到临时数据库
+func loadDataset(t *testing.T, dataset geoiptest.Dataset) *sql.DB {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "geoip2.db"))
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
+	t.Cleanup(func() { db.Close() })
 
-	loader = NewGeoLite2Loader(db)
-
-	_, err = os.Stat("geoip2-test.db")
+	editions, err := dataset.WriteCSV(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := geoip.NewGeoLite2Loader(db)
+	loader.SetIPVersions(geoip.IPv4AndIPv6)
+	if err := loader.Local(editions.ASN, editions.City, editions.Country); err != nil {
+		t.Fatal(err)
+	}
 
-	geo = NewGeolite2(db)
-}
-func TestGeoLite2Loader_Local(t *testing.T) {
-	//if err := loader.Local("/Users/kun/Downloads/GeoLite2-ASN-CSV_20230815",
-	//	"/Users/kun/Downloads/GeoLite2-City-CSV_20230815",
-	//	"/Users/kun/Downloads/GeoLite2-Country-CSV_20230815"); err != nil {
-	//	log.Fatal(err)
-	//}
+	return db
 }
 
-func TestGeoLite2Loader_Remote(t *testing.T) {
-	//err := loader.Remote("GeoLite2-ASN-CSV", "GeoLite2-City-CSV", "GeoLite2-Country-CSV")
-	//if err != nil {
-	//	log.Fatal(err)
-	//}
-}
+func TestGeoLite2Loader_Local(t *testing.T) {
+	geo := newGeolite2(t, geoiptest.Default())
 
-func TestGeolite2_AsnBlock(t *testing.T) {
-	block, err := geo.AsnBlock(net.ParseIP("59.110.190.34"))
+	block, err := geo.AsnBlock(net.ParseIP("2001:4860:4860::8888"))
 	if err != nil {
-		return
+		t.Fatal(err)
+	}
+	if block.AutonomousSystemNumber != 15169 {
+		t.Errorf("unexpected block %+v", block)
 	}
-	fmt.Println(block)
 }
 
-func TestGeolite2_BlocksByAsnNumber(t *testing.T) {
-	blocks, err := geo.BlocksByAsnNumber(38803)
+func TestGeoLite2Loader_Remote(t *testing.T) {
+	server, err := geoiptest.NewServer(geoiptest.Default())
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
-	fmt.Println(blocks)
-}
+	defer server.Close()
 
-func TestGeolite2_BlocksByAsnName(t *testing.T) {
-	blocks, err := geo.BlocksByAsnName("Wirefreebroadband Pty Ltd")
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "geoip2.db"))
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
-	fmt.Println(blocks)
-}
+	defer db.Close()
 
-func TestGeolite2_Organizations(t *testing.T) {
-	orgs, err := geo.Organizations()
-	if err != nil {
-		log.Fatal(err)
+	loader := geoip.NewGeoLite2Loader(db)
+	loader.SetDownloadURL(server.DownloadURL())
+	loader.SetDownloadDir(dir)
+	for i := 0; i < 2; i++ {
+		if err := loader.Remote(geoiptest.EditionASN, geoiptest.EditionCity, geoiptest.EditionCountry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := server.Requests(geoiptest.EditionCity, "zip"); n != 1 {
+		t.Errorf("unchanged archive should be downloaded once, got %d requests", n)
 	}
-	fmt.Println(orgs)
-}
 
-func TestGeolite2_CityBlock(t *testing.T) {
-	block, err := geo.CityBlock(net.ParseIP("59.110.190.34"))
+	block, err := geoip.NewGeolite2(db).CityBlock(net.ParseIP("14.0.200.1"))
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
+	}
+	if block.Location().CityName != "Beijing" {
+		t.Errorf("unexpected location %+v", block.Location())
 	}
-	fmt.Println(*block.location)
 }
 
-func TestGeolite2_CountryBlock(t *testing.T) {
-	block, err := geo.CountryBlock(net.ParseIP("59.110.190.34"))
-	if err != nil {
-		log.Fatal(err)
+// TestGeolite2_Fake 同一份数据分别加载到 SQLite 与内存实现，两者的查询结果应当一致
+func TestGeolite2_Fake(t *testing.T) {
+	dataset := geoiptest.Default()
+	geo := newGeolite2(t, dataset)
+	fake := geoiptest.NewFake(dataset)
+
+	compare := func(name string, query func(geoip.Geoip2) (interface{}, error)) {
+		t.Helper()
+		want, err := query(fake)
+		if err != nil {
+			t.Fatalf("%s: fake: %v", name, err)
+		}
+		got, err := query(geo)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", name, got, want)
+		}
 	}
-	fmt.Println(*block.location)
-}
 
-func TestGeolite2_BlocksByCityCode(t *testing.T) {
-	blocks, err := geo.BlocksByCityCode("zh-CN", "CN", "BJ")
+	for _, ip := range []string{"1.0.0.1", "5.0.1.1", "14.0.0.1", "14.0.200.1", "2003:e0::1", "2001:4860::1"} {
+		ip := net.ParseIP(ip)
+		compare("AsnBlock "+ip.String(), func(geo geoip.Geoip2) (interface{}, error) { return geo.AsnBlock(ip) })
+		compare("CityBlock "+ip.String(), func(geo geoip.Geoip2) (interface{}, error) { return geo.CityBlock(ip) })
+		compare("CountryBlock "+ip.String(), func(geo geoip.Geoip2) (interface{}, error) { return geo.CountryBlock(ip) })
+	}
+	compare("BlocksByAsnNumber", func(geo geoip.Geoip2) (interface{}, error) { return geo.BlocksByAsnNumber(15169) })
+	compare("BlocksByAsnName", func(geo geoip.Geoip2) (interface{}, error) {
+		return geo.BlocksByAsnName("CHINANET-BACKBONE")
+	})
+	compare("Organizations", func(geo geoip.Geoip2) (interface{}, error) { return geo.Organizations() })
+	compare("OrganizationDirectory", func(geo geoip.Geoip2) (interface{}, error) {
+		return geo.OrganizationDirectory(geoip.DirectoryQuery{Search: "net", SortBy: geoip.SortByAddresses, Descending: true})
+	})
+	compare("OrganizationDirectory page", func(geo geoip.Geoip2) (interface{}, error) {
+		return geo.OrganizationDirectory(geoip.DirectoryQuery{SortBy: geoip.SortByPrefixes, Offset: 1, Limit: 3})
+	})
+	compare("BlocksByCityCode", func(geo geoip.Geoip2) (interface{}, error) {
+		return geo.BlocksByCityCode("zh-CN", "CN", "GD")
+	})
+	compare("BlocksByCountryCode", func(geo geoip.Geoip2) (interface{}, error) {
+		return geo.BlocksByCountryCode("en", "JP")
+	})
+	compare("BlocksByContinentCode", func(geo geoip.Geoip2) (interface{}, error) {
+		return geo.BlocksByContinentCode("en", "AS")
+	})
+	compare("BlocksNear", func(geo geoip.Geoip2) (interface{}, error) {
+		return geo.BlocksNear("en", 30, 115, 1500)
+	})
+	compare("BlocksByFilter", func(geo geoip.Geoip2) (interface{}, error) {
+		return geo.BlocksByFilter(geoip.NewFilter("en").Continent("AS", "EU").AccuracyRadius(50))
+	})
+
+	var page []int
+	for _, g := range []geoip.Geoip2{fake, geo} {
+		var numbers []int
+		if err := g.RangeOrganizations(geoip.Page{After: 3320, Limit: 2}, func(org geoip.Organization) bool {
+			numbers = append(numbers, org.AutonomousSystemNumber)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if page != nil && !reflect.DeepEqual(numbers, page) {
+			t.Errorf("RangeOrganizations: got %v, want %v", numbers, page)
+		}
+		page = numbers
+	}
+
+	want, err := fake.ReverseGeocode("en", 35, 139)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := geo.ReverseGeocode("en", 35, 139)
 	if err != nil {
-		log.Fatal(err)
+		t.Fatal(err)
 	}
-	for _, blocks := range blocks {
-		fmt.Println(*blocks.location)
+	// 空间索引以单精度存储坐标
+	if got.Location != want.Location || math.Abs(got.Distance-want.Distance) > 0.01 {
+		t.Errorf("ReverseGeocode: got %+v, want %+v", got, want)
 	}
 }
-func TestGeolite2_BlocksByCountryCode(t *testing.T) {
-	blocks, err := geo.BlocksByCountryCode("zh-CN", "CN")
-	if err != nil {
-		log.Fatal(err)
+
+func TestGeolite2_IPv6Blocks(t *testing.T) {
+	dataset := geoiptest.Default()
+	geo := geoip.NewGeolite2(loadDataset(t, dataset))
+	fake := geoiptest.NewFake(dataset)
+
+	// 多地址段查询先 IPv4 后 IPv6，逐条翻页时游标跨越两个版本
+	for _, g := range []geoip.Geoip2{geo, fake} {
+		collect := func(rangeBlocks func(page geoip.Page, add func(value string, next geoip.Page)) error) []string {
+			var values []string
+			page := geoip.Page{Limit: 1}
+			for {
+				n := len(values)
+				if err := rangeBlocks(page, func(value string, next geoip.Page) {
+					values = append(values, value)
+					page = next
+				}); err != nil {
+					t.Fatal(err)
+				}
+				if len(values) == n {
+					return values
+				}
+			}
+		}
+		for name, c := range map[string]struct {
+			got  []string
+			want []string
+		}{
+			"asn": {collect(func(page geoip.Page, add func(string, geoip.Page)) error {
+				return g.RangeBlocksByAsnNumber(3320, page, func(block geoip.ASNBlock) bool {
+					add(block.Network, geoip.Page{After: block.ID, Limit: 1})
+					return true
+				})
+			}), []string{"5.0.0.0/16", "2003::/19"}},
+			"city": {collect(func(page geoip.Page, add func(string, geoip.Page)) error {
+				return g.RangeBlocksByCityCode("en", "US", "CA", page, func(block geoip.CityBlock) bool {
+					add(block.Network, geoip.Page{After: block.ID, Limit: 1})
+					return true
+				})
+			}), []string{"8.8.8.0/24", "2001:4860::/32"}},
+			"country": {collect(func(page geoip.Page, add func(string, geoip.Page)) error {
+				return g.RangeBlocksByContinentCode("en", "EU", page, func(block geoip.CountryBlock) bool {
+					add(block.Network, geoip.Page{After: block.ID, Limit: 1})
+					return true
+				})
+			}), []string{"5.0.0.0/16", "2003::/19"}},
+			"filter": {collect(func(page geoip.Page, add func(string, geoip.Page)) error {
+				return g.RangeBlocksByFilter(geoip.NewFilter("en").Country("US", "DE"), page,
+					func(block geoip.CompositeBlock) bool {
+						add(block.CityBlock.Network, geoip.Page{AfterIP: block.StartIP, Limit: 1})
+						return true
+					})
+			}), []string{"5.0.0.0/16", "8.8.8.0/24", "2001:4860::/32", "2003::/19"}},
+			// 只有 IPv6 地址段的 AS 6939
+			"organizations": {collect(func(page geoip.Page, add func(string, geoip.Page)) error {
+				return g.RangeOrganizations(page, func(org geoip.Organization) bool {
+					add(org.AutonomousSystemOrganization, geoip.Page{After: int64(org.AutonomousSystemNumber), Limit: 1})
+					return true
+				})
+			})[2:4], []string{"CHINANET-BACKBONE", "Hurricane Electric LLC"}},
+		} {
+			if !reflect.DeepEqual(c.got, c.want) {
+				t.Errorf("%T %s: got %v, want %v", g, name, c.got, c.want)
+			}
+		}
 	}
-	for _, block := range blocks {
-		fmt.Println(block)
+
+	composite, err := geo.BlocksByFilter(geoip.NewFilter("en").Asn(3320))
+	if err != nil || len(composite) != 2 || !composite[1].StartIP.Equal(net.ParseIP("2003::")) ||
+		composite[1].ASNBlock.ID != geoip.IPv6IDOffset+2 || composite[1].CityBlock.ID != geoip.IPv6IDOffset+2 {
+		t.Errorf("unexpected composite blocks %+v %v", composite, err)
 	}
 }
 
-func TestGeolite2_BlocksByContinentCode(t *testing.T) {
-	blocks, err := geo.BlocksByCountryCode("zh-CN", "AS")
-	if err != nil {
-		log.Fatal(err)
+func TestGeolite2_ReverseGeocodeAntimeridian(t *testing.T) {
+	// 城市的地址段分布在 180° 经线两侧，平均经度会落到 0° 附近
+	dataset := geoiptest.Default()
+	dataset.Locations = append(dataset.Locations, geoiptest.Location{GeonameID: 2198148, ContinentCode: "OC",
+		ContinentName: "Oceania", CountryISOCode: "FJ", CountryName: "Fiji", Subdivision1ISOCode: "C",
+		Subdivision1Name: "Central", CityName: "Suva", TimeZone: "Pacific/Fiji"})
+	dataset.CityBlocks = append(dataset.CityBlocks,
+		geoiptest.Block{Network: "103.1.180.0/24", GeonameID: 2198148, Latitude: -16.8, Longitude: 179.95,
+			AccuracyRadius: 5},
+		geoiptest.Block{Network: "103.1.181.0/24", GeonameID: 2198148, Latitude: -16.8, Longitude: -179.95,
+			AccuracyRadius: 100})
+	geo := geoip.NewGeolite2(loadDataset(t, dataset))
+	fake := geoiptest.NewFake(dataset)
+
+	for _, g := range []geoip.Geoip2{geo, fake} {
+		location, err := g.ReverseGeocode("en", -16.8, 179.9)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location.Location.CityName != "Suva" || location.Longitude < 179 || location.Distance > 10 {
+			t.Errorf("%T: unexpected location %+v", g, location)
+		}
 	}
-	for _, block := range blocks {
-		fmt.Println(block)
+}
+
+func TestGeolite2_CityBlockCoordinates(t *testing.T) {
+	// 经纬度为 (0, 0) 且没有精度半径的地址段仍带有经纬度，与缺失经纬度的匿名代理区分
+	dataset := geoiptest.Default()
+	dataset.CityBlocks = append(dataset.CityBlocks,
+		geoiptest.Block{Network: "41.0.0.0/24", GeonameID: 6252001, RegisteredCountryGeonameID: 6252001})
+	geo := geoip.NewGeolite2(loadDataset(t, dataset))
+	fake := geoiptest.NewFake(dataset)
+
+	for _, g := range []geoip.Geoip2{geo, fake} {
+		block, err := g.CityBlock(net.ParseIP("41.0.0.1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !block.HasCoordinates() || block.Latitude != 0 || block.Longitude != 0 || block.AccuracyRadius != 0 {
+			t.Errorf("%T: unexpected block %+v", g, block)
+		}
+		if block, err = g.CityBlock(net.ParseIP("185.220.100.1")); err != nil || block.HasCoordinates() {
+			t.Errorf("%T: unexpected block %+v %v", g, block, err)
+		}
+		results, err := g.LookupMany([]net.IP{net.ParseIP("41.0.0.1"), net.ParseIP("185.220.100.1")},
+			geoip.LookupOptions{Fields: geoip.LookupCity})
+		if err != nil || !results[0].City.HasCoordinates() || results[1].City.HasCoordinates() {
+			t.Errorf("%T: unexpected results %+v %v", g, results, err)
+		}
 	}
 }
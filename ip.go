@@ -1,6 +1,9 @@
 package geoip
 
-import "net"
+import (
+	"errors"
+	"net"
+)
 
 func IPRange(cidr string) (start int, end int, err error) {
 	ip, ipnet, err := net.ParseCIDR(cidr)
@@ -23,3 +26,31 @@ func IP2Int(ip net.IP) uint32 {
 	ip = ip.To4()
 	return (uint32(ip[0]) << 24) | (uint32(ip[1]) << 16) | (uint32(ip[2]) << 8) | uint32(ip[3])
 }
+
+func Int2IP(n uint32) net.IP {
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).To4()
+}
+
+// IPRange6 返回 IPv6 CIDR 的起止地址，16 字节大端序，SQLite 按 BLOB 比较即为地址顺序
+func IPRange6(cidr string) (start []byte, end []byte, err error) {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ip.To4() != nil {
+		return nil, nil, errors.New("不是 IPv6 地址段：" + cidr)
+	}
+
+	start = ip.Mask(ipnet.Mask)
+	end = make([]byte, len(start))
+	for i := range start {
+		end[i] = start[i] | ^ipnet.Mask[i]
+	}
+
+	return start, end, nil
+}
+
+// IP2Bytes 返回 IP 的 16 字节表示，与 IPRange6 的起止地址比较
+func IP2Bytes(ip net.IP) []byte {
+	return ip.To16()
+}
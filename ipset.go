@@ -0,0 +1,326 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// AddressRange 起止地址（含两端），IPv4 地址为 4 字节
+type AddressRange struct {
+	Start net.IP `json:"start"`
+	End   net.IP `json:"end"`
+}
+
+// Networks 将地址范围拆分为最少的 CIDR
+func (r AddressRange) Networks() []*net.IPNet {
+	networks, _ := RangeNetworks(r.Start, r.End)
+	return networks
+}
+
+// addrRange IPSet 内部的地址范围，IPv4 映射的 IPv6 地址已转换为 IPv4
+type addrRange struct {
+	first, last netip.Addr
+}
+
+// IPSet 同时包含 IPv4 与 IPv6 地址的集合，内部以排序、互不重叠且互不相邻的地址范围保存，
+// 因此 Networks 返回的即为最少的 CIDR。零值为空集合，集合运算返回新的集合，不修改参与运算的集合
+//
+//	cn, _ := geoip.IPSetOf(geo.BlocksByCountryCode("en", "CN"))
+//	google, _ := geoip.IPSetOf(geo.BlocksByAsnNumber(15169))
+//	deny := cn.Union(google).Difference(allow)
+type IPSet struct {
+	ranges []addrRange
+}
+
+// IPSetBlock 可以直接构造 IPSet 的查询结果
+type IPSetBlock interface {
+	ASNBlock | CityBlock | CountryBlock | CompositeBlock | NearbyBlock | Tag | RIRBlock | Route | BreakdownRange
+}
+
+// NewIPSet 以 CIDR、单个 IP 或起止地址创建集合，见 ParseIPRange
+func NewIPSet(networks ...string) (*IPSet, error) {
+	set := new(IPSet)
+	for i, network := range networks {
+		start, end, err := ParseIPRange(network)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个地址段：%w", i+1, err)
+		}
+		set.ranges = append(set.ranges, newAddrRange(start, end))
+	}
+	set.normalize()
+	return set, nil
+}
+
+// IPSetOf 以查询结果的地址段创建集合，可以直接包装多地址段查询：
+//
+//	set, err := geoip.IPSetOf(geo.BlocksByCountryCode("en", "JP"))
+//
+// err 不为 nil 时直接返回 err
+func IPSetOf[T IPSetBlock](blocks []T, err error) (*IPSet, error) {
+	if err != nil {
+		return nil, err
+	}
+	set := new(IPSet)
+	for _, block := range blocks {
+		var network string
+		switch b := any(block).(type) {
+		case ASNBlock:
+			network = b.Network
+		case CityBlock:
+			network = b.Network
+		case CountryBlock:
+			network = b.Network
+		case NearbyBlock:
+			network = b.CityBlock.Network
+		case Tag:
+			network = b.Network
+		case RIRBlock:
+			network = b.Network
+		case Route:
+			network = b.Network
+		case CompositeBlock:
+			if err := set.addRange(b.StartIP, b.EndIP); err != nil {
+				return nil, err
+			}
+			continue
+		case BreakdownRange:
+			if err := set.addRange(b.StartIP, b.EndIP); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		start, end, err := ParseIPRange(network)
+		if err != nil {
+			return nil, err
+		}
+		set.ranges = append(set.ranges, newAddrRange(start, end))
+	}
+	set.normalize()
+	return set, nil
+}
+
+func newAddrRange(start, end net.IP) addrRange {
+	first, _ := netip.AddrFromSlice(start)
+	last, _ := netip.AddrFromSlice(end)
+	return addrRange{first.Unmap(), last.Unmap()}
+}
+
+// addRange 追加地址范围，调用方负责 normalize
+func (set *IPSet) addRange(start, end net.IP) error {
+	r := newAddrRange(start, end)
+	if !r.first.IsValid() || !r.last.IsValid() || r.first.Is4() != r.last.Is4() || r.last.Less(r.first) {
+		return errors.New("无效的地址范围：" + start.String() + "-" + end.String())
+	}
+	set.ranges = append(set.ranges, r)
+	return nil
+}
+
+// normalize 排序并合并重叠或相邻的地址范围
+func (set *IPSet) normalize() {
+	sort.Slice(set.ranges, func(i, j int) bool { return set.ranges[i].first.Less(set.ranges[j].first) })
+	merged := set.ranges[:0]
+	for _, r := range set.ranges {
+		if n := len(merged); n > 0 {
+			prev := &merged[n-1]
+			// IPv4 的最后一个地址的 Next 无效，不会与 IPv6 地址合并
+			if next := prev.last.Next(); !prev.last.Less(r.first) || (next.IsValid() && next == r.first) {
+				if prev.last.Less(r.last) {
+					prev.last = r.last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	set.ranges = merged
+}
+
+// Add 加入 CIDR、单个 IP 或起止地址，见 ParseIPRange
+func (set *IPSet) Add(network string) error {
+	start, end, err := ParseIPRange(network)
+	if err != nil {
+		return err
+	}
+	set.ranges = append(set.ranges, newAddrRange(start, end))
+	set.normalize()
+	return nil
+}
+
+// AddRange 加入起止地址之间（含两端）的全部地址
+func (set *IPSet) AddRange(start, end net.IP) error {
+	if err := set.addRange(start, end); err != nil {
+		return err
+	}
+	set.normalize()
+	return nil
+}
+
+// Union 返回两个集合的并集
+func (set *IPSet) Union(other *IPSet) *IPSet {
+	union := &IPSet{ranges: make([]addrRange, 0, len(set.ranges)+len(other.ranges))}
+	union.ranges = append(append(union.ranges, set.ranges...), other.ranges...)
+	union.normalize()
+	return union
+}
+
+// Intersect 返回两个集合的交集
+func (set *IPSet) Intersect(other *IPSet) *IPSet {
+	intersection := new(IPSet)
+	i, j := 0, 0
+	for i < len(set.ranges) && j < len(other.ranges) {
+		a, b := set.ranges[i], other.ranges[j]
+		first, last := a.first, a.last
+		if first.Less(b.first) {
+			first = b.first
+		}
+		if b.last.Less(last) {
+			last = b.last
+		}
+		if !last.Less(first) {
+			intersection.ranges = append(intersection.ranges, addrRange{first, last})
+		}
+		if a.last.Less(b.last) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return intersection
+}
+
+// Difference 返回属于 set 但不属于 other 的地址
+func (set *IPSet) Difference(other *IPSet) *IPSet {
+	difference := new(IPSet)
+	j := 0
+	for _, r := range set.ranges {
+		first := r.first
+		for j < len(other.ranges) && other.ranges[j].last.Less(first) {
+			j++
+		}
+		k := j
+		for ; k < len(other.ranges) && !r.last.Less(other.ranges[k].first); k++ {
+			cut := other.ranges[k]
+			if first.Less(cut.first) {
+				difference.ranges = append(difference.ranges, addrRange{first, cut.first.Prev()})
+			}
+			if !cut.last.Less(r.last) {
+				first = netip.Addr{}
+				break
+			}
+			first = cut.last.Next()
+		}
+		if first.IsValid() {
+			difference.ranges = append(difference.ranges, addrRange{first, r.last})
+		}
+	}
+	return difference
+}
+
+// Contains 判断集合是否包含 ip，IPv4 映射的 IPv6 地址按 IPv4 判断
+func (set *IPSet) Contains(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	i := sort.Search(len(set.ranges), func(i int) bool { return !set.ranges[i].last.Less(addr) })
+	return i < len(set.ranges) && !addr.Less(set.ranges[i].first)
+}
+
+// ContainsSet 判断 other 是否为集合的子集
+func (set *IPSet) ContainsSet(other *IPSet) bool {
+	return other.Difference(set).Empty()
+}
+
+// Overlaps 判断两个集合是否有公共地址
+func (set *IPSet) Overlaps(other *IPSet) bool {
+	return !set.Intersect(other).Empty()
+}
+
+// Equal 判断两个集合是否包含相同的地址
+func (set *IPSet) Equal(other *IPSet) bool {
+	if len(set.ranges) != len(other.ranges) {
+		return false
+	}
+	for i := range set.ranges {
+		if set.ranges[i] != other.ranges[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty 判断集合是否为空
+func (set *IPSet) Empty() bool {
+	return len(set.ranges) == 0
+}
+
+// Size 返回集合的地址数
+func (set *IPSet) Size() *big.Int {
+	size := new(big.Int)
+	for _, r := range set.ranges {
+		size.Add(size, addressCount(r.first, r.last))
+	}
+	return size
+}
+
+// Ranges 返回排序后互不相邻的地址范围，IPv4 在前
+func (set *IPSet) Ranges() []AddressRange {
+	ranges := make([]AddressRange, len(set.ranges))
+	for i, r := range set.ranges {
+		ranges[i] = AddressRange{r.first.AsSlice(), r.last.AsSlice()}
+	}
+	return ranges
+}
+
+// Networks 返回覆盖集合的最少 CIDR，IPv4 在前
+func (set *IPSet) Networks() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, r := range set.ranges {
+		networks = append(networks, rangeNetworks(r.first, r.last)...)
+	}
+	return networks
+}
+
+// String 以逗号分隔的最少 CIDR 表示集合
+func (set *IPSet) String() string {
+	networks := set.Networks()
+	values := make([]string, len(networks))
+	for i, network := range networks {
+		values[i] = network.String()
+	}
+	return strings.Join(values, ",")
+}
+
+// RangeNetworks 将起止地址之间（含两端）的地址拆分为最少的 CIDR
+func RangeNetworks(start, end net.IP) ([]*net.IPNet, error) {
+	r := newAddrRange(start, end)
+	if !r.first.IsValid() || !r.last.IsValid() || r.first.Is4() != r.last.Is4() || r.last.Less(r.first) {
+		return nil, errors.New("无效的地址范围：" + start.String() + "-" + end.String())
+	}
+	return rangeNetworks(r.first, r.last), nil
+}
+
+// rangeNetworks 从 first 开始依次取以其对齐且不超过 last 的最大地址段
+func rangeNetworks(first, last netip.Addr) []*net.IPNet {
+	var networks []*net.IPNet
+	for next := first; next.IsValid() && !last.Less(next); {
+		prefix := netip.PrefixFrom(next, next.BitLen())
+		for bits := next.BitLen() - 1; bits >= 0; bits-- {
+			wider := netip.PrefixFrom(next, bits).Masked()
+			if wider.Addr() != next || last.Less(lastAddr(wider)) {
+				break
+			}
+			prefix = wider
+		}
+		networks = append(networks, &net.IPNet{IP: prefix.Addr().AsSlice(),
+			Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen())})
+		next = lastAddr(prefix).Next()
+	}
+	return networks
+}
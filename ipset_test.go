@@ -0,0 +1,163 @@
+package geoip_test
+
+import (
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"math/big"
+	"net"
+	"testing"
+)
+
+func mustIPSet(t *testing.T, networks ...string) *geoip.IPSet {
+	t.Helper()
+	set, err := geoip.NewIPSet(networks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestRangeNetworks(t *testing.T) {
+	for _, c := range []struct {
+		start, end string
+		want       string
+	}{
+		{"1.0.0.1", "1.0.0.10", "1.0.0.1/32,1.0.0.2/31,1.0.0.4/30,1.0.0.8/31,1.0.0.10/32"},
+		{"0.0.0.0", "255.255.255.255", "0.0.0.0/0"},
+		{"255.255.255.255", "255.255.255.255", "255.255.255.255/32"},
+		{"::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "::/0"},
+		{"2001:db8::", "2001:db8::2", "2001:db8::/127,2001:db8::2/128"},
+		{"::ffff:10.0.0.0", "10.0.1.255", "10.0.0.0/23"},
+	} {
+		networks, err := geoip.RangeNetworks(net.ParseIP(c.start), net.ParseIP(c.end))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		for i, network := range networks {
+			if i > 0 {
+				got += ","
+			}
+			got += network.String()
+		}
+		if got != c.want {
+			t.Errorf("%s-%s: got %s, want %s", c.start, c.end, got, c.want)
+		}
+	}
+	if _, err := geoip.RangeNetworks(net.ParseIP("1.0.0.9"), net.ParseIP("1.0.0.1")); err == nil {
+		t.Error("reversed range should fail")
+	}
+	if _, err := geoip.RangeNetworks(net.ParseIP("1.0.0.1"), net.ParseIP("::1")); err == nil {
+		t.Error("mixed range should fail")
+	}
+}
+
+func TestIPSet(t *testing.T) {
+	// 重叠、相邻的地址段合并为最少的 CIDR，IPv4 在前
+	set := mustIPSet(t, "2001:db8::/33", "10.0.0.128/25", "10.0.0.0/25", "10.0.1.0-10.0.1.255", "2001:db8:8000::/33",
+		"10.0.0.7", "255.255.255.255", "::")
+	if got := set.String(); got != "10.0.0.0/23,255.255.255.255/32,::/128,2001:db8::/32" {
+		t.Errorf("unexpected networks %s", got)
+	}
+	if ranges := set.Ranges(); len(ranges) != 4 || !ranges[0].End.Equal(net.ParseIP("10.0.1.255")) ||
+		len(ranges[0].Start) != net.IPv4len {
+		t.Errorf("unexpected ranges %+v", ranges)
+	}
+	want := new(big.Int).Lsh(big.NewInt(1), 96)
+	want.Add(want, big.NewInt(512+1+1))
+	if set.Size().Cmp(want) != 0 {
+		t.Errorf("unexpected size %s", set.Size())
+	}
+	for ip, want := range map[string]bool{"10.0.1.9": true, "::ffff:10.0.0.1": true, "10.0.2.0": false,
+		"2001:db8:ffff::1": true, "2001:db9::": false, "::1": false, "255.255.255.255": true} {
+		if set.Contains(net.ParseIP(ip)) != want {
+			t.Errorf("%s: want contains %v", ip, want)
+		}
+	}
+	if set.Contains(nil) {
+		t.Error("nil ip should not be contained")
+	}
+
+	a := mustIPSet(t, "10.0.0.0/24", "2001:db8::/32")
+	b := mustIPSet(t, "10.0.0.64/26", "10.0.0.200-10.0.1.10", "2001:db8::/33")
+	for name, c := range map[string]struct {
+		got  *geoip.IPSet
+		want string
+	}{
+		"union":      {a.Union(b), "10.0.0.0/24,10.0.1.0/29,10.0.1.8/31,10.0.1.10/32,2001:db8::/32"},
+		"intersect":  {a.Intersect(b), "10.0.0.64/26,10.0.0.200/29,10.0.0.208/28,10.0.0.224/27,2001:db8::/33"},
+		"difference": {a.Difference(b), "10.0.0.0/26,10.0.0.128/26,10.0.0.192/29,2001:db8:8000::/33"},
+		"reverse":    {b.Difference(a), "10.0.1.0/29,10.0.1.8/31,10.0.1.10/32"},
+		"empty":      {a.Intersect(&geoip.IPSet{}), ""},
+		"whole":      {a.Difference(mustIPSet(t, "0.0.0.0/0", "::/0")), ""},
+		"untouched":  {a.Difference(mustIPSet(t, "11.0.0.0/8")), "10.0.0.0/24,2001:db8::/32"},
+	} {
+		if got := c.got.String(); got != c.want {
+			t.Errorf("%s: got %s, want %s", name, got, c.want)
+		}
+	}
+	if !a.Union(b).ContainsSet(b) || a.ContainsSet(b) || !a.Overlaps(b) || a.Overlaps(mustIPSet(t, "11.0.0.0/8")) {
+		t.Error("unexpected containment")
+	}
+	if !a.Union(b).Difference(b).Equal(a.Difference(b)) || a.Equal(b) || !(&geoip.IPSet{}).Empty() {
+		t.Error("unexpected equality")
+	}
+	// 集合运算不修改参与运算的集合
+	if a.String() != "10.0.0.0/24,2001:db8::/32" {
+		t.Errorf("set modified: %s", a)
+	}
+
+	if err := a.Add("10.0.1.0/24"); err != nil || a.String() != "10.0.0.0/23,2001:db8::/32" {
+		t.Errorf("unexpected add %s %v", a, err)
+	}
+	if err := a.AddRange(net.ParseIP("10.0.2.0"), net.ParseIP("10.0.3.255")); err != nil ||
+		a.String() != "10.0.0.0/22,2001:db8::/32" {
+		t.Errorf("unexpected add %s %v", a, err)
+	}
+	if err := a.AddRange(net.ParseIP("10.0.2.0"), net.ParseIP("::1")); err == nil {
+		t.Error("mixed range should fail")
+	}
+	if _, err := geoip.NewIPSet("10.0.0.0/24", "foo"); err == nil {
+		t.Error("invalid network should fail")
+	}
+}
+
+func TestIPSetOf(t *testing.T) {
+	fake := geoiptest.NewFake(geoiptest.Default())
+
+	cn, err := geoip.IPSetOf(fake.BlocksByCountryCode("en", "CN"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	google, err := geoip.IPSetOf(fake.BlocksByAsnNumber(15169))
+	if err != nil {
+		t.Fatal(err)
+	}
+	asia, err := geoip.IPSetOf(fake.BlocksByContinentCode("en", "AS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 多地址段查询同时包含 IPv4 与 IPv6 地址段
+	if cn.String() != "14.0.0.0/16" || google.String() != "8.8.8.0/24,2001:4860::/32" ||
+		asia.String() != "14.0.0.0/16,27.0.0.0/22" || !asia.ContainsSet(cn) {
+		t.Errorf("unexpected sets %s %s %s", cn, google, asia)
+	}
+
+	// 城市地址段 14.0.0.0/17 与 14.0.128.0/17 合并为一个 CIDR
+	cities, err := geoip.IPSetOf(fake.BlocksByFilter(geoip.NewFilter("en").Country("CN")))
+	if err != nil || !cities.Equal(cn) {
+		t.Errorf("unexpected composite set %s %v", cities, err)
+	}
+	breakdown, err := fake.Breakdown("en", "8.8.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gaps, err := geoip.IPSetOf(breakdown.Gaps(), nil)
+	if err != nil || !gaps.Union(google).Equal(mustIPSet(t, "8.8.0.0/16", "2001:4860::/32")) {
+		t.Errorf("unexpected gaps %s %v", gaps, err)
+	}
+
+	if _, err := geoip.IPSetOf([]geoip.ASNBlock{{Network: "foo"}}, nil); err == nil {
+		t.Error("invalid network should fail")
+	}
+}
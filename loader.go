@@ -1,10 +1,84 @@
 package geoip
 
 import (
+	"database/sql"
 	_ "github.com/mattn/go-sqlite3"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type GeoipSql struct {
+	Table       string
 	CreateTable string
 	Insert      string
+	// Index 替换正式表后创建的索引，暂存表不建索引以免加载时逐行维护
+	Index string
+}
+
+// queryRower *sql.DB 与 *sql.Tx 共有的单行查询方法
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// tableExists 判断表是否存在。标签、RIR、路由及覆盖地址段的表在加载对应数据后才创建，
+// GeoLite2 也可能只加载了部分版本或协议，查询这些表前先检查，不存在时按没有数据处理
+func tableExists(db queryRower, table string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&n)
+	return n > 0, err
+}
+
+// schemaGeneration 本进程内加载器创建或替换表的次数，变化时 tableCache 失效
+var schemaGeneration atomic.Uint64
+
+// schemaChanged 加载器提交了新建或替换的表后调用
+func schemaChanged() {
+	schemaGeneration.Add(1)
+}
+
+// tableCache 缓存 Geolite2 查询前检查表是否存在的结果，本进程内的加载器提交新表后失效；
+// 其他进程加载了新的表时需要重新 NewGeolite2
+type tableCache struct {
+	mu         sync.Mutex
+	generation uint64
+	tables     map[string]bool
+}
+
+// exists 返回缓存的结果，没有缓存时查询 sqlite_master
+func (cache *tableCache) exists(db *sql.DB, table string) (bool, error) {
+	generation := schemaGeneration.Load()
+	cache.mu.Lock()
+	if cache.tables == nil || cache.generation != generation {
+		cache.tables, cache.generation = make(map[string]bool), generation
+	}
+	exists, ok := cache.tables[table]
+	cache.mu.Unlock()
+	if ok {
+		return exists, nil
+	}
+
+	exists, err := tableExists(db, table)
+	if err != nil {
+		return false, err
+	}
+	cache.mu.Lock()
+	// 查询期间有加载器提交时不缓存，下次重新查询
+	if cache.generation == generation {
+		cache.tables[table] = exists
+	}
+	cache.mu.Unlock()
+	return exists, nil
+}
+
+// stagingPrefix 加载过程中使用的暂存表前缀，全部加载完成后替换正式表
+const stagingPrefix = "staging_"
+
+// staging 返回写入暂存表的语句
+func (sql GeoipSql) staging() GeoipSql {
+	return GeoipSql{
+		Table:       stagingPrefix + sql.Table,
+		CreateTable: strings.Replace(sql.CreateTable, sql.Table, stagingPrefix+sql.Table, 1),
+		Insert:      strings.Replace(sql.Insert, sql.Table, stagingPrefix+sql.Table, 1),
+	}
 }
@@ -0,0 +1,189 @@
+package geoip_test
+
+import (
+	"database/sql"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeoLite2Loader_Progress(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "geoip2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ch := make(chan geoip.Progress, 1024)
+	loader := geoip.NewGeoLite2Loader(db)
+	loader.SetConcurrency(2)
+	loader.SetProgress(geoip.ProgressChannel(ch))
+
+	editions, err := geoiptest.Default().WriteCSV(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Local(editions.ASN, editions.City, editions.Country); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+
+	rows := make(map[string]int64)
+	for progress := range ch {
+		if progress.Stage != geoip.StageLoad {
+			t.Errorf("unexpected stage %s", progress.Stage)
+		}
+		if progress.Done {
+			rows[progress.Table] = progress.Rows
+		}
+	}
+	if len(rows) != 3+2*len(geoip.Languages) {
+		t.Errorf("expected progress for every table, got %v", rows)
+	}
+	if rows["CityBlocksIPv4"] != 8 || rows["CountryLocations-zh-CN"] != 5 {
+		t.Errorf("unexpected row counts %v", rows)
+	}
+}
+
+func TestGeoLite2Loader_Selective(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "geoip2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	loader := geoip.NewGeoLite2Loader(db)
+	loader.SetEditions(geoip.EditionCountry)
+	loader.SetIPVersions(geoip.IPv4AndIPv6)
+	loader.SetLanguages("en")
+
+	editions, err := geoiptest.Default().WriteCSV(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Local("", "", editions.Country); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('GeoLite2ASNBlocksIPv4', 'GeoLite2CityBlocksIPv4')").Scan(&n); err != nil || n != 0 {
+		t.Errorf("unselected editions should not be loaded, got %d tables, %v", n, err)
+	}
+	if err := db.QueryRow("SELECT COUNT(DISTINCT locale_code) FROM GeoLite2CountryLocations").Scan(&n); err != nil || n != 1 {
+		t.Errorf("expected 1 language, got %d, %v", n, err)
+	}
+
+	geo := geoip.NewGeolite2(db)
+	block, err := geo.CountryBlock(net.ParseIP("2003:e0::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Network != "2003::/19" || block.Location().CountryISOCode != "DE" {
+		t.Errorf("unexpected block %+v %+v", block, block.Location())
+	}
+	if _, err := geo.CountryBlock(net.ParseIP("1.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未加载的表按没有数据处理，其他错误照常返回
+	results, err := geo.LookupMany([]net.IP{net.ParseIP("1.0.0.1")}, geoip.LookupOptions{})
+	if err != nil || results[0].ASN != nil || results[0].Country == nil {
+		t.Errorf("unexpected results %+v %v", results, err)
+	}
+	if names, err := geo.TagNames(); err != nil || names != nil {
+		t.Errorf("unexpected tag names %v %v", names, err)
+	}
+	db.Close()
+	if _, err := geoip.NewGeolite2(db).TagNames(); err == nil {
+		t.Error("closed database should fail")
+	}
+}
+
+func TestGeoLite2Loader_Idempotent(t *testing.T) {
+	dataset := geoiptest.Default()
+	db := loadDataset(t, dataset)
+	editions, err := dataset.WriteCSV(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := geoip.NewGeoLite2Loader(db).Local(editions.ASN, editions.City, editions.Country); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := geoip.CountRows(t, db, "GeoLite2CityBlocksIPv4"); n != 8 {
+		t.Errorf("reloading should replace rows, got %d", n)
+	}
+	if n := geoip.CountRows(t, db, "GeoLite2CityLocations"); n != 10*len(geoip.Languages) {
+		t.Errorf("reloading should replace locations, got %d", n)
+	}
+	// 没有经纬度的匿名代理与卫星网络地址段不进入空间索引
+	if n := geoip.CountRows(t, db, "GeoLite2CityBlocksIPv4Rtree"); n != 6 {
+		t.Errorf("spatial index should be rebuilt, got %d", n)
+	}
+	if n := geoip.CountRows(t, db, "GeoLite2CityBlocksIPv6Rtree"); n != 2 {
+		t.Errorf("IPv6 spatial index should be rebuilt, got %d", n)
+	}
+	if n := geoip.CountRows(t, db, "sqlite_master WHERE name LIKE 'staging%'"); n != 0 {
+		t.Errorf("staging tables should be renamed, got %d", n)
+	}
+	if n := geoip.CountRows(t, db, "sqlite_master WHERE type = 'index' AND name = 'GeoLite2CityBlocksIPv4Start'"); n != 1 {
+		t.Errorf("block index should be created after swap, got %d", n)
+	}
+	if _, err := geoip.NewGeolite2(db).CityBlock(net.ParseIP("5.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGeoLite2Loader_Rollback(t *testing.T) {
+	dataset := geoiptest.Default()
+	db := loadDataset(t, dataset)
+	geo := geoip.NewGeolite2(db)
+
+	dataset.ASNBlocks = append(dataset.ASNBlocks, geoiptest.ASNBlock{Network: "9.9.9.0/24", Number: 19281,
+		Organization: "QUAD9"})
+	editions, err := dataset.WriteCSV(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	countryBlocks := filepath.Join(editions.Country, "GeoLite2-Country-Blocks-IPv4.csv")
+	content, err := os.ReadFile(countryBlocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(countryBlocks, append(content, "invalid,1,1,,0,0\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := geoip.NewGeoLite2Loader(db).Local(editions.ASN, editions.City, editions.Country); err == nil {
+		t.Fatal("expected error for invalid network")
+	}
+	if n := geoip.CountRows(t, db, "GeoLite2ASNBlocksIPv4"); n != 6 {
+		t.Errorf("failed load should leave live tables intact, got %d", n)
+	}
+	if _, err := geo.AsnBlock(net.ParseIP("9.9.9.9")); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	// 修复文件后重新加载，文件变化使断点失效，从头加载
+	if err := os.WriteFile(countryBlocks, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := geoip.NewGeoLite2Loader(db).Local(editions.ASN, editions.City, editions.Country); err != nil {
+		t.Fatal(err)
+	}
+	block, err := geo.AsnBlock(net.ParseIP("9.9.9.9"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.AutonomousSystemNumber != 19281 {
+		t.Errorf("unexpected block %+v", block)
+	}
+	if n := geoip.CountRows(t, db, "GeoLite2ASNBlocksIPv4"); n != 7 {
+		t.Errorf("expected 7 rows, got %d", n)
+	}
+}
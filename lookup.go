@@ -0,0 +1,572 @@
+package geoip
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"net"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LookupField 批量查询的数据，可按位组合
+type LookupField int
+
+const (
+	LookupASN LookupField = 1 << iota
+	LookupCity
+	LookupCountry
+	// LookupTags 查询包含 IP 的标签地址段，见 Tags
+	LookupTags
+
+	LookupAll = LookupASN | LookupCity | LookupCountry | LookupTags
+)
+
+// LookupOptions 批量查询选项，零值表示使用默认值
+type LookupOptions struct {
+	// Fields 需要查询的数据，默认为 LookupAll
+	Fields LookupField
+	// Language 地域信息使用的语言，为空时与 CityBlock、CountryBlock 相同，取数据库中的第一个语言
+	Language string
+	// Workers 并行查询的 goroutine 数，默认为 CPU 核数
+	Workers int
+	// BatchSize 每次归并查询的地址数，默认为 1024
+	BatchSize int
+}
+
+func (options LookupOptions) withDefaults() LookupOptions {
+	if options.Fields == 0 {
+		options.Fields = LookupAll
+	}
+	if options.Workers < 1 {
+		options.Workers = runtime.NumCPU()
+	}
+	if options.BatchSize < 1 {
+		options.BatchSize = 1024
+	}
+	return options
+}
+
+// LookupResult 单个 IP 的批量查询结果，数据库中没有对应地址段时字段为 nil，
+// Err 为该 IP 的错误（如 *ReservedError、无效的 IP），不影响其他 IP。
+// IP 在覆盖地址段内时 Overlay 为该地址段，覆盖数据提供了任一查询字段时 Err 为 nil。
+// Tags 与 Err 无关，特殊用途地址同样返回标签
+type LookupResult struct {
+	IP      net.IP        `json:"ip"`
+	ASN     *ASNBlock     `json:"asn,omitempty"`
+	City    *CityBlock    `json:"city,omitempty"`
+	Country *CountryBlock `json:"country,omitempty"`
+	Overlay *Overlay      `json:"overlay,omitempty"`
+	Tags    []Tag         `json:"tags,omitempty"`
+	Err     error         `json:"-"`
+}
+
+// lookupKey 去重后的查询地址，value 为 IPv4 整数或 IPv6 16 字节
+type lookupKey struct {
+	version string
+	value   interface{}
+	result  *LookupResult
+}
+
+func compareKey(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case []byte:
+		return bytes.Compare(a, b.([]byte))
+	}
+	return 0
+}
+
+// LookupMany 批量查询 ips，结果与输入顺序一致，与逐个调用 AsnBlock、CityBlock、CountryBlock 的结果相同。
+// 地址去重并排序后按 BatchSize 分批，每批对每张地址段表只执行一次范围查询并与地址归并，
+// 多个批次由 Workers 个 goroutine 并行处理。重复的 IP 共享同一份结果
+func (geo Geolite2) LookupMany(ips []net.IP, options LookupOptions) ([]LookupResult, error) {
+	options = options.withDefaults()
+
+	results := make([]LookupResult, len(ips))
+	unique := make(map[string]*LookupResult)
+	var keys []lookupKey
+	for i, ip := range ips {
+		results[i].IP = ip
+		version, value, err := blockKey(ip)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		// 数据库中的 IPv4 起止地址读取为 int64
+		if n, ok := value.(uint32); ok {
+			value = int64(n)
+		}
+		id := version + string(IP2Bytes(ip))
+		if _, ok := unique[id]; !ok {
+			unique[id] = new(LookupResult)
+			keys = append(keys, lookupKey{version: version, value: value, result: unique[id]})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].version != keys[j].version {
+			return keys[i].version == "IPv4"
+		}
+		return compareKey(keys[i].value, keys[j].value) < 0
+	})
+
+	// 每个批次只包含一种协议的地址
+	var batches [][]lookupKey
+	for start := 0; start < len(keys); {
+		end := start + 1
+		for end < len(keys) && end-start < options.BatchSize && keys[end].version == keys[start].version {
+			end++
+		}
+		batches = append(batches, keys[start:end])
+		start = end
+	}
+
+	jobs := make(chan []lookupKey)
+	errs := make(chan error, options.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < options.Workers && i < len(batches); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range jobs {
+				if err := geo.lookupBatch(batch, options); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	func() {
+		defer close(jobs)
+		for _, batch := range batches {
+			select {
+			case jobs <- batch:
+			case err := <-errs:
+				errs <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+
+	for i, ip := range ips {
+		if results[i].Err != nil {
+			continue
+		}
+		version, _, _ := blockKey(ip)
+		result := unique[version+string(IP2Bytes(ip))]
+		results[i].ASN, results[i].City, results[i].Country = result.ASN, result.City, result.Country
+	}
+
+	if err := geo.applyOverlays(results, options); err != nil {
+		return nil, err
+	}
+	if options.Fields&LookupTags != 0 {
+		if err := geo.lookupTags(results, options.BatchSize); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// applyOverlays 以覆盖地址段替换批量查询结果，覆盖表通常很小，一次读出后逐个匹配
+func (geo Geolite2) applyOverlays(results []LookupResult, options LookupOptions) error {
+	overlays, err := geo.Overlays()
+	if err != nil || len(overlays) == 0 {
+		return err
+	}
+
+	matcher := newOverlayMatcher(overlays)
+	cities := make(map[int64]*CityLocation)
+	countries := make(map[int64]*CountryLocation)
+	for i := range results {
+		overlay := matcher.match(results[i].IP)
+		if overlay == nil {
+			continue
+		}
+		results[i].Overlay = overlay
+
+		supplied := false
+		if options.Fields&LookupASN != 0 && overlay.HasASN() {
+			results[i].ASN = overlay.ASNBlock()
+			supplied = true
+		}
+		if options.Fields&LookupCity != 0 && overlay.HasLocation() {
+			location, ok := cities[overlay.ID]
+			if !ok {
+				if location, err = geo.overlayCityLocation(overlay, options.Language); err != nil {
+					return err
+				}
+				cities[overlay.ID] = location
+			}
+			results[i].City = overlay.CityBlock(location)
+			supplied = true
+		}
+		if options.Fields&LookupCountry != 0 && overlay.HasLocation() {
+			location, ok := countries[overlay.ID]
+			if !ok {
+				if location, err = geo.overlayCountryLocation(overlay, options.Language); err != nil {
+					return err
+				}
+				countries[overlay.ID] = location
+			}
+			results[i].Country = overlay.CountryBlock(location)
+			supplied = true
+		}
+		if supplied {
+			results[i].Err = nil
+		}
+	}
+	return nil
+}
+
+// lookupBatch 查询一批已排序且协议相同的地址
+func (geo Geolite2) lookupBatch(keys []lookupKey, options LookupOptions) error {
+	version := keys[0].version
+
+	if options.Fields&LookupASN != 0 && geo.asnSource == ASNSourceBGP {
+		// 路由前缀相互包含，逐个做最长前缀匹配，同一批中每个 AS 的组织名称只查询一次
+		names := make(map[int]string)
+		for _, key := range keys {
+			block, err := geo.bgpASNBlock(version, key.value, names)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			key.result.ASN = block
+		}
+	} else if options.Fields&LookupASN != 0 {
+		var block ASNBlock
+		table, query, payload := asnRangeQuery(version, &block)
+		if err := geo.mergeRanges(table, query, keys, payload,
+			func(key lookupKey) {
+				b := block
+				key.result.ASN = &b
+			}); err != nil {
+			return err
+		}
+	}
+
+	if options.Fields&LookupCity != 0 {
+		var block CityBlock
+		var matched []*CityBlock
+		table, query, payload := cityRangeQuery(version, &block)
+		if err := geo.mergeRanges(table, query, keys, payload,
+			func(key lookupKey) {
+				b := block
+				key.result.City = &b
+				matched = append(matched, &b)
+			}); err != nil {
+			return err
+		}
+		if err := geo.resolveCityBlocks(matched, options.Language); err != nil {
+			return err
+		}
+	}
+
+	if options.Fields&LookupCountry != 0 {
+		var block CountryBlock
+		var matched []*CountryBlock
+		table, query, payload := countryRangeQuery(version, &block)
+		if err := geo.mergeRanges(table, query, keys, payload,
+			func(key lookupKey) {
+				b := block
+				key.result.Country = &b
+				matched = append(matched, &b)
+			}); err != nil {
+			return err
+		}
+		if err := geo.resolveCountryBlocks(matched, options.Language); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// asnRangeQuery 按地址范围读取 ASN 地址段的表及查询，payload 为查询结果写入 block 的字段，见 mergeRanges
+func asnRangeQuery(version string, block *ASNBlock) (string, string, []interface{}) {
+	table := "GeoLite2ASNBlocks" + version
+	return table, "SELECT start_ip, end_ip, network, autonomous_system_number, autonomous_system_organization " +
+			"FROM " + table,
+		[]interface{}{&block.Network, &block.AutonomousSystemNumber, &block.AutonomousSystemOrganization}
+}
+
+// cityRangeQuery 按地址范围读取城市地址段的查询，见 asnRangeQuery
+func cityRangeQuery(version string, block *CityBlock) (string, string, []interface{}) {
+	table := "GeoLite2CityBlocks" + version
+	return table, "SELECT start_ip, end_ip, network, CAST(geoname_id AS INTEGER), registered_country_geoname_id, " +
+			"represented_country_geoname_id, CAST(is_anonymous_proxy AS INTEGER), " +
+			"CAST(is_satellite_provider AS INTEGER), postal_code, " + coordinateColumns + " FROM " + table + " c",
+		append([]interface{}{&block.Network, &block.GeonameID, &block.RegisteredCountryGeonameID,
+			&block.RepresentedCountryGeonameID, &block.IsAnonymousProxy, &block.IsSatelliteProvider,
+			&block.PostalCode}, block.coordinateDest()...)
+}
+
+// countryRangeQuery 按地址范围读取国家地址段的查询，见 asnRangeQuery
+func countryRangeQuery(version string, block *CountryBlock) (string, string, []interface{}) {
+	table := "GeoLite2CountryBlocks" + version
+	return table, "SELECT start_ip, end_ip, network, CAST(geoname_id AS INTEGER), registered_country_geoname_id, " +
+			"represented_country_geoname_id, is_anonymous_proxy, is_satellite_provider " +
+			"FROM " + table,
+		[]interface{}{&block.Network, &block.GeonameID, &block.RegisteredCountryGeonameID,
+			&block.RepresentedCountryGeonameID, &block.IsAnonymousProxy, &block.IsSatelliteProvider}
+}
+
+// mergeRanges 按起始地址顺序读取覆盖 keys 范围的地址段，与已排序的 keys 归并，
+// 每个落在地址段内的 key 回调一次 fn，回调时 payload 中为该地址段的数据，table 不存在时没有回调
+func (geo Geolite2) mergeRanges(table, query string, keys []lookupKey, payload []interface{}, fn func(lookupKey)) error {
+	exists, err := geo.tableExists(table)
+	if err != nil || !exists {
+		return err
+	}
+	first, last := keys[0].value, keys[len(keys)-1].value
+	rows, err := geo.db.Query(overlapQuery(table, query), first, first, last, first)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var start, end interface{}
+	dest := append([]interface{}{&start, &end}, payload...)
+	k := 0
+	for k < len(keys) && rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for k < len(keys) && compareKey(keys[k].value, start) < 0 {
+			k++
+		}
+		for k < len(keys) && compareKey(keys[k].value, end) <= 0 {
+			fn(keys[k])
+			k++
+		}
+	}
+
+	return rows.Err()
+}
+
+// locationBatchSize 按 geoname_id 查询地域时每条语句的参数个数上限
+const locationBatchSize = 500
+
+// locationRows 按 geoname_id 查询地域，每个 geoname_id 取第一条记录，language 为空时不限语言
+func (geo Geolite2) locationRows(table, columns string, ids []int64, language string,
+	scan func(rows *sql.Rows) error) error {
+	for start := 0; start < len(ids); start += locationBatchSize {
+		end := start + locationBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		args := make([]interface{}, 0, end-start+1)
+		for _, id := range ids[start:end] {
+			args = append(args, id)
+		}
+		where := "geoname_id IN (?" + strings.Repeat(", ?", end-start-1) + ")"
+		if language != "" {
+			where += " AND locale_code = ?"
+			args = append(args, language)
+		}
+
+		rows, err := geo.db.Query("SELECT geoname_id, "+columns+" FROM "+table+" WHERE "+where+" ORDER BY id", args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func geonameIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool)
+	var unique []int64
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func (geo Geolite2) cityLocations(blocks []*CityBlock, language string) error {
+	ids := make([]int64, len(blocks))
+	for i, block := range blocks {
+		ids[i] = block.GeonameID
+	}
+	locations := make(map[int64]*CityLocation)
+	if err := geo.locationRows("GeoLite2CityLocations", "locale_code, continent_code, continent_name, "+
+		"country_iso_code, country_name, subdivision_1_iso_code, subdivision_1_name, subdivision_2_iso_code, "+
+		"subdivision_2_name, city_name, metro_code, time_zone, is_in_european_union", geonameIDs(ids), language,
+		func(rows *sql.Rows) error {
+			var l CityLocation
+			if err := rows.Scan(&l.GeonameID, &l.LocaleCode, &l.ContinentCode, &l.ContinentName, &l.CountryISOCode,
+				&l.CountryName, &l.Subdivision1ISOCode, &l.Subdivision1Name, &l.Subdivision2ISOCode,
+				&l.Subdivision2Name, &l.CityName, &l.MetroCode, &l.TimeZone, &l.IsInEuropeanUnion); err != nil {
+				return err
+			}
+			if _, ok := locations[l.GeonameID]; !ok {
+				locations[l.GeonameID] = &l
+			}
+			return nil
+		}); err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		if location, ok := locations[block.GeonameID]; ok {
+			l := *location
+			block.location = &l
+		}
+	}
+	return nil
+}
+
+// resolveCityBlocks 批量查询城市地址段的地域及注册国家、代表国家
+func (geo Geolite2) resolveCityBlocks(blocks []*CityBlock, language string) error {
+	if err := geo.cityLocations(blocks, language); err != nil {
+		return err
+	}
+	var refs []countryRef
+	for _, block := range blocks {
+		refs = append(refs, block.countryRefs()...)
+	}
+	return geo.resolveCountries(refs, language)
+}
+
+// resolveCountryBlocks 批量查询国家地址段的地域及注册国家、代表国家
+func (geo Geolite2) resolveCountryBlocks(blocks []*CountryBlock, language string) error {
+	if err := geo.countryLocations(blocks, language); err != nil {
+		return err
+	}
+	var refs []countryRef
+	for _, block := range blocks {
+		refs = append(refs, block.countryRefs()...)
+	}
+	return geo.resolveCountries(refs, language)
+}
+
+func (geo Geolite2) countryLocations(blocks []*CountryBlock, language string) error {
+	ids := make([]int64, len(blocks))
+	for i, block := range blocks {
+		ids[i] = block.GeonameID
+	}
+	locations, err := geo.countryLocationRows(geonameIDs(ids), language)
+	if err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		if location, ok := locations[block.GeonameID]; ok {
+			l := *location
+			block.location = &l
+		}
+	}
+	return nil
+}
+
+// countryLocationRows 按 geoname_id 查询国家级地域，每个 geoname_id 取第一条记录
+func (geo Geolite2) countryLocationRows(ids []int64, language string) (map[int64]*CountryLocation, error) {
+	locations := make(map[int64]*CountryLocation)
+	if err := geo.locationRows("GeoLite2CountryLocations", "locale_code, continent_code, continent_name, "+
+		"country_iso_code, country_name, is_in_european_union", ids, language,
+		func(rows *sql.Rows) error {
+			var l CountryLocation
+			if err := rows.Scan(&l.GeonameID, &l.LocaleCode, &l.ContinentCode, &l.ContinentName, &l.CountryISOCode,
+				&l.CountryName, &l.IsInEuropeanUnion); err != nil {
+				return err
+			}
+			if _, ok := locations[l.GeonameID]; !ok {
+				locations[l.GeonameID] = &l
+			}
+			return nil
+		}); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// LookupStream 从 in 读取 IP 并按输入顺序输出查询结果，in 关闭或 ctx 取消后关闭输出。
+// 输入积累到 Workers*BatchSize 个或暂时没有新的输入时调用一次 LookupMany，查询出错时错误写入该批每个结果的 Err
+func LookupStream(ctx context.Context, geo Geoip2, in <-chan net.IP, options LookupOptions) <-chan LookupResult {
+	options = options.withDefaults()
+	out := make(chan LookupResult, options.BatchSize)
+
+	go func() {
+		defer close(out)
+
+		var pending []net.IP
+		flush := func() bool {
+			if len(pending) == 0 {
+				return true
+			}
+			results, err := geo.LookupMany(pending, options)
+			if err != nil {
+				results = make([]LookupResult, len(pending))
+				for i, ip := range pending {
+					results[i] = LookupResult{IP: ip, Err: err}
+				}
+			}
+			pending = pending[:0]
+			for _, result := range results {
+				select {
+				case out <- result:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		for {
+			var ip net.IP
+			var ok bool
+			select {
+			case ip, ok = <-in:
+			case <-ctx.Done():
+				return
+			default:
+				// 暂时没有新的输入，先输出已读取的部分
+				if !flush() {
+					return
+				}
+				select {
+				case ip, ok = <-in:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if !ok {
+				flush()
+				return
+			}
+			if pending = append(pending, ip); len(pending) >= options.Workers*options.BatchSize && !flush() {
+				return
+			}
+		}
+	}()
+
+	return out
+}
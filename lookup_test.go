@@ -0,0 +1,122 @@
+package geoip_test
+
+import (
+	"context"
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lookupIPs() []net.IP {
+	var ips []net.IP
+	for _, s := range []string{"8.8.8.8", "14.0.200.1", "10.0.0.1", "8.8.8.8", "2003::1", "9.9.9.9",
+		"185.220.100.7", "2002:e00:1::1", "196.201.3.4", "2001:4860:4860::8888", "1.0.0.1", "14.0.1.1"} {
+		ips = append(ips, net.ParseIP(s))
+	}
+	return ips
+}
+
+// TestGeolite2_LookupMany 批量查询的结果应与逐个查询及内存实现一致，且按输入顺序返回
+func TestGeolite2_LookupMany(t *testing.T) {
+	dataset := geoiptest.Default()
+	geo := newGeolite2(t, dataset)
+	fake := geoiptest.NewFake(dataset)
+	ips := lookupIPs()
+
+	options := geoip.LookupOptions{Workers: 3, BatchSize: 2}
+	results, err := geo.LookupMany(ips, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(ips) {
+		t.Fatalf("got %d results for %d ips", len(results), len(ips))
+	}
+	want, err := fake.LookupMany(ips, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, result := range results {
+		if !result.IP.Equal(ips[i]) {
+			t.Errorf("result %d is for %s, want %s", i, result.IP, ips[i])
+		}
+		if !reflect.DeepEqual(result, want[i]) {
+			t.Errorf("%s: sqlite %+v, fake %+v", ips[i], result, want[i])
+		}
+		if block, err := geo.AsnBlock(ips[i]); err == nil && !reflect.DeepEqual(block, result.ASN) {
+			t.Errorf("%s: AsnBlock %+v, LookupMany %+v", ips[i], block, result.ASN)
+		}
+		if block, err := geo.CityBlock(ips[i]); err == nil && !reflect.DeepEqual(block, result.City) {
+			t.Errorf("%s: CityBlock %+v, LookupMany %+v", ips[i], block, result.City)
+		}
+	}
+
+	if !errors.Is(results[2].Err, geoip.ErrReserved) {
+		t.Errorf("10.0.0.1: want reserved error, got %v", results[2].Err)
+	}
+	if results[3].ASN != results[0].ASN {
+		t.Error("duplicate ips should share the result")
+	}
+	if results[5].ASN != nil || results[5].City != nil || results[5].Err != nil {
+		t.Errorf("9.9.9.9 is not in the dataset, got %+v", results[5])
+	}
+	if results[7].City == nil || results[7].City.Location().CityName != "Guangzhou" {
+		t.Errorf("6to4 address should resolve to 14.0.0.0/17, got %+v", results[7].City)
+	}
+}
+
+func TestGeolite2_LookupManyOptions(t *testing.T) {
+	geo := newGeolite2(t, geoiptest.Default())
+
+	results, err := geo.LookupMany(lookupIPs(), geoip.LookupOptions{Fields: geoip.LookupCountry, Language: "ja"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.ASN != nil || result.City != nil {
+			t.Errorf("%s: only country should be looked up, got %+v", result.IP, result)
+		}
+	}
+	if location := results[0].Country.Location(); location == nil || location.LocaleCode != "ja" {
+		t.Errorf("unexpected location %+v", location)
+	}
+}
+
+// TestGeolite2_LookupManyQueryPlan 批量查询只读取覆盖本批地址的地址段，start_ip 索引的查找两端都有边界
+func TestGeolite2_LookupManyQueryPlan(t *testing.T) {
+	db := loadDataset(t, geoiptest.Default())
+
+	first, last := geoip.IP2Int(net.ParseIP("8.8.8.8")), geoip.IP2Int(net.ParseIP("14.0.1.1"))
+	plan := geoip.QueryPlan(t, db, geoip.CityRangeQuery("IPv4"), first, first, last, first)
+	if !strings.Contains(plan, "SEARCH c USING INDEX GeoLite2CityBlocksIPv4Start (start_ip>? AND start_ip<?)") {
+		t.Errorf("range merge should bound the start_ip index on both sides: %s", plan)
+	}
+}
+
+func TestLookupStream(t *testing.T) {
+	geo := newGeolite2(t, geoiptest.Default())
+	ips := lookupIPs()
+
+	in := make(chan net.IP)
+	go func() {
+		defer close(in)
+		for _, ip := range ips {
+			in <- ip
+		}
+	}()
+
+	var i int
+	for result := range geoip.LookupStream(context.Background(), geo, in, geoip.LookupOptions{Workers: 2, BatchSize: 3}) {
+		if !result.IP.Equal(ips[i]) {
+			t.Errorf("result %d is for %s, want %s", i, result.IP, ips[i])
+		}
+		i++
+	}
+	if i != len(ips) {
+		t.Errorf("got %d results for %d ips", i, len(ips))
+	}
+}
@@ -1,6 +1,7 @@
 package geoip
 
 type ASNBlock struct {
+	ID      int64  `json:"id"`
 	Network string `json:"network"`
 	Organization
 }
@@ -22,7 +23,10 @@ type CityBlock struct {
 	Latitude                    float64 `json:"latitude"`
 	Longitude                   float64 `json:"longitude"`
 	AccuracyRadius              int     `json:"accuracy_radius"`
+	coordinates                 bool
 	location                    *CityLocation
+	registeredCountry           *Country
+	representedCountry          *Country
 }
 
 type CityLocation struct {
@@ -52,6 +56,8 @@ type CountryBlock struct {
 	IsAnonymousProxy            string `json:"is_anonymous_proxy"`
 	IsSatelliteProvider         string `json:"is_satellite_provider"`
 	location                    *CountryLocation
+	registeredCountry           *Country
+	representedCountry          *Country
 }
 
 type CountryLocation struct {
@@ -64,3 +70,77 @@ type CountryLocation struct {
 	CountryName       string `json:"country_name"`
 	IsInEuropeanUnion string `json:"is_in_european_union"`
 }
+
+// Country 地址段的注册国家或代表国家，由 registered_country_geoname_id、represented_country_geoname_id
+// 关联 GeoLite2CountryLocations 得到，语言与地址段的地域信息相同
+type Country struct {
+	CountryLocation
+	// Type 代表国家的类型，如 military。GeoLite2 CSV 不含该字段，从 GeoLite2 得到的国家总为空，
+	// 自定义 Geoip2 实现可以设置
+	Type string `json:"type,omitempty"`
+}
+
+// Location 返回地址段的地域信息，未关联地域时返回 nil
+func (block *CityBlock) Location() *CityLocation {
+	return block.location
+}
+
+// SetLocation 设置地址段的地域信息，用于自定义 Geoip2 实现
+func (block *CityBlock) SetLocation(location *CityLocation) {
+	block.location = location
+}
+
+// HasCoordinates 地址段是否带有经纬度，经纬度缺失时 Latitude 与 Longitude 为 0
+func (block *CityBlock) HasCoordinates() bool {
+	return block.coordinates
+}
+
+// SetCoordinates 设置地址段的经纬度，用于自定义 Geoip2 实现
+func (block *CityBlock) SetCoordinates(latitude, longitude float64) {
+	block.Latitude, block.Longitude, block.coordinates = latitude, longitude, true
+}
+
+// coordinateDest 读取 coordinateColumns
+func (block *CityBlock) coordinateDest() []interface{} {
+	return []interface{}{&block.coordinates, &block.Latitude, &block.Longitude, &block.AccuracyRadius}
+}
+
+// Location 返回地址段的地域信息，未关联地域时返回 nil
+func (block *CountryBlock) Location() *CountryLocation {
+	return block.location
+}
+
+// SetLocation 设置地址段的地域信息，用于自定义 Geoip2 实现
+func (block *CountryBlock) SetLocation(location *CountryLocation) {
+	block.location = location
+}
+
+// RegisteredCountry 返回 ISP 登记地址段的国家，可能与地域所在国家不同，没有时返回 nil
+func (block *CityBlock) RegisteredCountry() *Country {
+	return block.registeredCountry
+}
+
+// RepresentedCountry 返回地址段代表的国家，如位于德国的美军网络代表美国，没有时返回 nil
+func (block *CityBlock) RepresentedCountry() *Country {
+	return block.representedCountry
+}
+
+// SetCountries 设置地址段的注册国家与代表国家，用于自定义 Geoip2 实现
+func (block *CityBlock) SetCountries(registered, represented *Country) {
+	block.registeredCountry, block.representedCountry = registered, represented
+}
+
+// RegisteredCountry 返回 ISP 登记地址段的国家，可能与地域所在国家不同，没有时返回 nil
+func (block *CountryBlock) RegisteredCountry() *Country {
+	return block.registeredCountry
+}
+
+// RepresentedCountry 返回地址段代表的国家，如位于德国的美军网络代表美国，没有时返回 nil
+func (block *CountryBlock) RepresentedCountry() *Country {
+	return block.representedCountry
+}
+
+// SetCountries 设置地址段的注册国家与代表国家，用于自定义 Geoip2 实现
+func (block *CountryBlock) SetCountries(registered, represented *Country) {
+	block.registeredCountry, block.representedCountry = registered, represented
+}
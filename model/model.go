@@ -0,0 +1,259 @@
+// Package model 是 geoip 查询结果的强类型模型：地址段为 netip.Prefix，标志为 bool，
+// 可能缺失的地域、注册国家、代表国家及经纬度为指针，缺失时为 nil。
+// Reader 以 netip.Addr 查询任意 geoip.Geoip2 实现，原有的 geoip.ASNBlock、CityBlock、CountryBlock
+// 保留不变，与本包类型通过 FromASNBlock、FromCityBlock、FromCountryBlock 及 Legacy 互相转换
+package model
+
+import (
+	"fmt"
+	geoip "github.com/sechelper/geoip2"
+	"net/netip"
+	"strconv"
+)
+
+// ASNBlock ASN 地址段
+type ASNBlock struct {
+	// ID 地址段在数据库中的 ID，单个 IP 查询时为 0
+	ID           int64        `json:"id,omitempty"`
+	Prefix       netip.Prefix `json:"prefix"`
+	Number       uint32       `json:"number"`
+	Organization string       `json:"organization"`
+}
+
+// Subdivision 行政区
+type Subdivision struct {
+	ISOCode string `json:"iso_code"`
+	Name    string `json:"name"`
+}
+
+// Location 地域，国家级地域的 Subdivisions 为 nil、CityName 为空
+type Location struct {
+	GeonameID      int64  `json:"geoname_id"`
+	LocaleCode     string `json:"locale_code"`
+	ContinentCode  string `json:"continent_code"`
+	ContinentName  string `json:"continent_name"`
+	CountryISOCode string `json:"country_iso_code"`
+	CountryName    string `json:"country_name"`
+	// Subdivisions 一级、二级行政区，依次排列，缺失的级别不出现
+	Subdivisions    []Subdivision `json:"subdivisions,omitempty"`
+	CityName        string        `json:"city_name,omitempty"`
+	MetroCode       string        `json:"metro_code,omitempty"`
+	TimeZone        string        `json:"time_zone,omitempty"`
+	InEuropeanUnion bool          `json:"in_european_union"`
+}
+
+// Country 注册国家或代表国家
+type Country struct {
+	GeonameID       int64  `json:"geoname_id"`
+	LocaleCode      string `json:"locale_code"`
+	ContinentCode   string `json:"continent_code"`
+	ContinentName   string `json:"continent_name"`
+	ISOCode         string `json:"iso_code"`
+	Name            string `json:"name"`
+	InEuropeanUnion bool   `json:"in_european_union"`
+	// Type 代表国家的类型，取自 geoip.Country.Type，GeoLite2 数据总为空
+	Type string `json:"type,omitempty"`
+}
+
+// Coordinates 经纬度，AccuracyRadius 为精度半径，单位公里
+type Coordinates struct {
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	AccuracyRadius int     `json:"accuracy_radius"`
+}
+
+// CityBlock 城市地址段
+type CityBlock struct {
+	ID                 int64        `json:"id,omitempty"`
+	Prefix             netip.Prefix `json:"prefix"`
+	Location           *Location    `json:"location,omitempty"`
+	RegisteredCountry  *Country     `json:"registered_country,omitempty"`
+	RepresentedCountry *Country     `json:"represented_country,omitempty"`
+	AnonymousProxy     bool         `json:"anonymous_proxy"`
+	SatelliteProvider  bool         `json:"satellite_provider"`
+	PostalCode         string       `json:"postal_code,omitempty"`
+	Coordinates        *Coordinates `json:"coordinates,omitempty"`
+}
+
+// CountryBlock 国家地址段
+type CountryBlock struct {
+	ID                 int64        `json:"id,omitempty"`
+	Prefix             netip.Prefix `json:"prefix"`
+	Location           *Location    `json:"location,omitempty"`
+	RegisteredCountry  *Country     `json:"registered_country,omitempty"`
+	RepresentedCountry *Country     `json:"represented_country,omitempty"`
+	AnonymousProxy     bool         `json:"anonymous_proxy"`
+	SatelliteProvider  bool         `json:"satellite_provider"`
+}
+
+// parsePrefix 解析地址段，IPv4 映射的 IPv6 地址段按 IPv4 处理
+func parsePrefix(network string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(network)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("无效的地址段 %q：%w", network, err)
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix.Masked(), nil
+}
+
+// parseFlag 解析 GeoLite2 中以 0/1 存储的布尔值，空字符串为 false
+func parseFlag(value string) bool {
+	return value == "1"
+}
+
+// FromASNBlock 转换 geoip.ASNBlock
+func FromASNBlock(block geoip.ASNBlock) (ASNBlock, error) {
+	prefix, err := parsePrefix(block.Network)
+	if err != nil {
+		return ASNBlock{}, err
+	}
+	return ASNBlock{ID: block.ID, Prefix: prefix, Number: uint32(block.AutonomousSystemNumber),
+		Organization: block.AutonomousSystemOrganization}, nil
+}
+
+// Legacy 转换为 geoip.ASNBlock
+func (block ASNBlock) Legacy() geoip.ASNBlock {
+	return geoip.ASNBlock{ID: block.ID, Network: block.Prefix.String(), Organization: geoip.Organization{
+		AutonomousSystemNumber: int(block.Number), AutonomousSystemOrganization: block.Organization}}
+}
+
+func fromCityLocation(location *geoip.CityLocation) *Location {
+	if location == nil {
+		return nil
+	}
+	l := &Location{GeonameID: location.GeonameID, LocaleCode: location.LocaleCode,
+		ContinentCode: location.ContinentCode, ContinentName: location.ContinentName,
+		CountryISOCode: location.CountryISOCode, CountryName: location.CountryName, CityName: location.CityName,
+		MetroCode: location.MetroCode, TimeZone: location.TimeZone,
+		InEuropeanUnion: parseFlag(location.IsInEuropeanUnion)}
+	if location.Subdivision1ISOCode != "" || location.Subdivision1Name != "" {
+		l.Subdivisions = append(l.Subdivisions, Subdivision{location.Subdivision1ISOCode, location.Subdivision1Name})
+	}
+	if location.Subdivision2ISOCode != "" || location.Subdivision2Name != "" {
+		l.Subdivisions = append(l.Subdivisions, Subdivision{location.Subdivision2ISOCode, location.Subdivision2Name})
+	}
+	return l
+}
+
+func fromCountryLocation(location *geoip.CountryLocation) *Location {
+	if location == nil {
+		return nil
+	}
+	return &Location{GeonameID: location.GeonameID, LocaleCode: location.LocaleCode,
+		ContinentCode: location.ContinentCode, ContinentName: location.ContinentName,
+		CountryISOCode: location.CountryISOCode, CountryName: location.CountryName,
+		InEuropeanUnion: parseFlag(location.IsInEuropeanUnion)}
+}
+
+func fromCountry(country *geoip.Country) *Country {
+	if country == nil {
+		return nil
+	}
+	return &Country{GeonameID: country.GeonameID, LocaleCode: country.LocaleCode,
+		ContinentCode: country.ContinentCode, ContinentName: country.ContinentName, ISOCode: country.CountryISOCode,
+		Name: country.CountryName, InEuropeanUnion: parseFlag(country.IsInEuropeanUnion), Type: country.Type}
+}
+
+// FromCityBlock 转换 geoip.CityBlock，没有经纬度时 Coordinates 为 nil
+func FromCityBlock(block *geoip.CityBlock) (CityBlock, error) {
+	prefix, err := parsePrefix(block.Network)
+	if err != nil {
+		return CityBlock{}, err
+	}
+	city := CityBlock{ID: block.ID, Prefix: prefix, Location: fromCityLocation(block.Location()),
+		RegisteredCountry: fromCountry(block.RegisteredCountry()), RepresentedCountry: fromCountry(block.RepresentedCountry()),
+		AnonymousProxy: block.IsAnonymousProxy == 1, SatelliteProvider: block.IsSatelliteProvider == 1,
+		PostalCode: block.PostalCode}
+	if block.HasCoordinates() {
+		city.Coordinates = &Coordinates{Latitude: block.Latitude, Longitude: block.Longitude,
+			AccuracyRadius: block.AccuracyRadius}
+	}
+	return city, nil
+}
+
+// FromCountryBlock 转换 geoip.CountryBlock
+func FromCountryBlock(block *geoip.CountryBlock) (CountryBlock, error) {
+	prefix, err := parsePrefix(block.Network)
+	if err != nil {
+		return CountryBlock{}, err
+	}
+	return CountryBlock{ID: block.ID, Prefix: prefix, Location: fromCountryLocation(block.Location()),
+		RegisteredCountry: fromCountry(block.RegisteredCountry()), RepresentedCountry: fromCountry(block.RepresentedCountry()),
+		AnonymousProxy: parseFlag(block.IsAnonymousProxy), SatelliteProvider: parseFlag(block.IsSatelliteProvider)}, nil
+}
+
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// geonameID 注册国家或代表国家的 geoname_id，缺失时为空字符串
+func geonameID(country *Country) string {
+	if country == nil {
+		return ""
+	}
+	return strconv.FormatInt(country.GeonameID, 10)
+}
+
+func (country *Country) legacy() *geoip.Country {
+	if country == nil {
+		return nil
+	}
+	return &geoip.Country{CountryLocation: geoip.CountryLocation{GeonameID: country.GeonameID,
+		LocaleCode: country.LocaleCode, ContinentCode: country.ContinentCode, ContinentName: country.ContinentName,
+		CountryISOCode: country.ISOCode, CountryName: country.Name, IsInEuropeanUnion: boolFlag(country.InEuropeanUnion)},
+		Type: country.Type}
+}
+
+// Legacy 转换为 geoip.CityBlock
+func (block CityBlock) Legacy() geoip.CityBlock {
+	city := geoip.CityBlock{ID: block.ID, Network: block.Prefix.String(),
+		RegisteredCountryGeonameID: geonameID(block.RegisteredCountry), RepresentedCountryGeonameID: geonameID(block.RepresentedCountry),
+		IsAnonymousProxy: boolInt(block.AnonymousProxy), IsSatelliteProvider: boolInt(block.SatelliteProvider),
+		PostalCode: block.PostalCode}
+	if block.Coordinates != nil {
+		city.SetCoordinates(block.Coordinates.Latitude, block.Coordinates.Longitude)
+		city.AccuracyRadius = block.Coordinates.AccuracyRadius
+	}
+	if l := block.Location; l != nil {
+		city.GeonameID = l.GeonameID
+		location := &geoip.CityLocation{GeonameID: l.GeonameID, LocaleCode: l.LocaleCode, ContinentCode: l.ContinentCode,
+			ContinentName: l.ContinentName, CountryISOCode: l.CountryISOCode, CountryName: l.CountryName,
+			CityName: l.CityName, MetroCode: l.MetroCode, TimeZone: l.TimeZone, IsInEuropeanUnion: boolFlag(l.InEuropeanUnion)}
+		if len(l.Subdivisions) > 0 {
+			location.Subdivision1ISOCode, location.Subdivision1Name = l.Subdivisions[0].ISOCode, l.Subdivisions[0].Name
+		}
+		if len(l.Subdivisions) > 1 {
+			location.Subdivision2ISOCode, location.Subdivision2Name = l.Subdivisions[1].ISOCode, l.Subdivisions[1].Name
+		}
+		city.SetLocation(location)
+	}
+	city.SetCountries(block.RegisteredCountry.legacy(), block.RepresentedCountry.legacy())
+	return city
+}
+
+// Legacy 转换为 geoip.CountryBlock
+func (block CountryBlock) Legacy() geoip.CountryBlock {
+	country := geoip.CountryBlock{ID: block.ID, Network: block.Prefix.String(),
+		RegisteredCountryGeonameID: geonameID(block.RegisteredCountry), RepresentedCountryGeonameID: geonameID(block.RepresentedCountry),
+		IsAnonymousProxy: boolFlag(block.AnonymousProxy), IsSatelliteProvider: boolFlag(block.SatelliteProvider)}
+	if l := block.Location; l != nil {
+		country.GeonameID = l.GeonameID
+		country.SetLocation(&geoip.CountryLocation{GeonameID: l.GeonameID, LocaleCode: l.LocaleCode,
+			ContinentCode: l.ContinentCode, ContinentName: l.ContinentName, CountryISOCode: l.CountryISOCode,
+			CountryName: l.CountryName, IsInEuropeanUnion: boolFlag(l.InEuropeanUnion)})
+	}
+	country.SetCountries(block.RegisteredCountry.legacy(), block.RepresentedCountry.legacy())
+	return country
+}
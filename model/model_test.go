@@ -0,0 +1,124 @@
+package model_test
+
+import (
+	"database/sql"
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"github.com/sechelper/geoip2/model"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	reader := model.NewReader(geoiptest.NewFake(geoiptest.Default()))
+
+	city, err := reader.City(netip.MustParseAddr("27.0.0.9"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if city.Prefix != netip.MustParsePrefix("27.0.0.0/22") || city.Location == nil ||
+		!reflect.DeepEqual(city.Location.Subdivisions, []model.Subdivision{{"13", "Tokyo"}}) ||
+		city.Coordinates == nil || city.Coordinates.AccuracyRadius != 20 || city.AnonymousProxy {
+		t.Errorf("unexpected city %+v", city)
+	}
+	if city.RegisteredCountry == nil || city.RegisteredCountry.ISOCode != "JP" || city.RepresentedCountry == nil ||
+		city.RepresentedCountry.ISOCode != "US" || city.RepresentedCountry.Type != "" {
+		t.Errorf("unexpected countries %+v %+v", city.RegisteredCountry, city.RepresentedCountry)
+	}
+
+	// 只有注册国家、没有地域与经纬度的匿名代理
+	city, err = reader.City(netip.MustParseAddr("185.220.100.7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if city.Location != nil || city.Coordinates != nil || !city.AnonymousProxy || city.RegisteredCountry == nil ||
+		!city.RegisteredCountry.InEuropeanUnion {
+		t.Errorf("unexpected city %+v", city)
+	}
+	country, err := reader.Country(netip.MustParseAddr("196.201.1.1"))
+	if err != nil || country.Location != nil || !country.SatelliteProvider || country.RegisteredCountry != nil {
+		t.Errorf("unexpected country %+v %v", country, err)
+	}
+	country, err = reader.Country(netip.MustParseAddr("2003::1"))
+	if err != nil || country.Prefix != netip.MustParsePrefix("2003::/19") || !country.Location.InEuropeanUnion {
+		t.Errorf("unexpected country %+v %v", country, err)
+	}
+
+	asn, err := reader.ASN(netip.MustParseAddr("::ffff:8.8.8.8"))
+	if err != nil || asn.Prefix != netip.MustParsePrefix("8.8.8.0/24") || asn.Number != 15169 {
+		t.Errorf("unexpected asn %+v %v", asn, err)
+	}
+	if _, err := reader.ASN(netip.MustParseAddr("9.9.9.9")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("want sql.ErrNoRows, got %v", err)
+	}
+	if _, err := reader.City(netip.MustParseAddr("10.0.0.1")); !errors.Is(err, geoip.ErrReserved) {
+		t.Errorf("want reserved error, got %v", err)
+	}
+	if _, err := reader.Country(netip.Addr{}); err == nil {
+		t.Error("invalid addr should fail")
+	}
+
+	addrs := []netip.Addr{netip.MustParseAddr("2001:4860::1"), {}, netip.MustParseAddr("10.0.0.1"),
+		netip.MustParseAddr("185.220.100.7")}
+	results, err := reader.Lookup(addrs, geoip.LookupOptions{Language: "zh-CN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Addr != addrs[0] || results[0].ASN == nil || results[0].City == nil ||
+		results[0].City.Location.LocaleCode != "zh-CN" || results[0].Err != nil {
+		t.Errorf("unexpected result %+v", results[0])
+	}
+	if results[1].Err == nil || !errors.Is(results[2].Err, geoip.ErrReserved) {
+		t.Errorf("unexpected errors %v %v", results[1].Err, results[2].Err)
+	}
+	if results[3].Country == nil || results[3].Country.Location != nil || !results[3].Country.AnonymousProxy ||
+		results[3].Country.RegisteredCountry.LocaleCode != "zh-CN" {
+		t.Errorf("unexpected result %+v", results[3].Country)
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	fake := geoiptest.NewFake(geoiptest.Default())
+	for _, s := range []string{"5.0.0.1", "14.0.200.1", "27.0.0.9", "185.220.100.7", "196.201.1.1", "2001:4860::1"} {
+		ip := net.ParseIP(s)
+		if asn, err := fake.AsnBlock(ip); err == nil {
+			typed, err := model.FromASNBlock(*asn)
+			if err != nil || !reflect.DeepEqual(typed.Legacy(), *asn) {
+				t.Errorf("%s: asn %+v, legacy %+v %v", s, *asn, typed.Legacy(), err)
+			}
+		}
+		if city, err := fake.CityBlock(ip); err == nil {
+			typed, err := model.FromCityBlock(city)
+			if err != nil || !reflect.DeepEqual(typed.Legacy(), *city) {
+				t.Errorf("%s: city %+v, legacy %+v %v", s, *city, typed.Legacy(), err)
+			}
+		}
+		country, err := fake.CountryBlock(ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		typed, err := model.FromCountryBlock(country)
+		if err != nil || !reflect.DeepEqual(typed.Legacy(), *country) {
+			t.Errorf("%s: country %+v, legacy %+v %v", s, *country, typed.Legacy(), err)
+		}
+	}
+
+	// (0, 0) 是有效的经纬度，只有缺失经纬度时 Coordinates 为 nil
+	null := geoip.CityBlock{Network: "41.0.0.0/24"}
+	null.SetCoordinates(0, 0)
+	if typed, err := model.FromCityBlock(&null); err != nil || typed.Coordinates == nil ||
+		!reflect.DeepEqual(typed.Legacy(), null) {
+		t.Errorf("unexpected city %+v %v", typed, err)
+	}
+	if typed, err := model.FromCityBlock(&geoip.CityBlock{Network: "41.0.0.0/24", AccuracyRadius: 50}); err != nil ||
+		typed.Coordinates != nil {
+		t.Errorf("unexpected city %+v %v", typed, err)
+	}
+
+	if _, err := model.FromCityBlock(&geoip.CityBlock{Network: "8.8.8.8"}); err == nil {
+		t.Error("invalid network should fail")
+	}
+}
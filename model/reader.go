@@ -0,0 +1,130 @@
+package model
+
+import (
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"net"
+	"net/netip"
+)
+
+// Reader 以 netip.Addr 查询并返回强类型结果，查询语义与被包装的 geoip.Geoip2 相同，
+// 单个 IP 未找到时返回 sql.ErrNoRows，特殊用途地址返回 *geoip.ReservedError
+//
+//	reader := model.NewReader(geoip.NewGeolite2(db))
+//	city, err := reader.City(netip.MustParseAddr("8.8.8.8"))
+type Reader struct {
+	geo geoip.Geoip2
+}
+
+func NewReader(geo geoip.Geoip2) *Reader {
+	return &Reader{geo: geo}
+}
+
+// Result 单个地址的批量查询结果，见 geoip.LookupResult
+type Result struct {
+	Addr    netip.Addr    `json:"addr"`
+	ASN     *ASNBlock     `json:"asn,omitempty"`
+	City    *CityBlock    `json:"city,omitempty"`
+	Country *CountryBlock `json:"country,omitempty"`
+	Tags    []geoip.Tag   `json:"tags,omitempty"`
+	Err     error         `json:"-"`
+}
+
+// addrIP 转换为 net.IP，IPv4 映射的 IPv6 地址按 IPv4 查询
+func addrIP(addr netip.Addr) (net.IP, error) {
+	if !addr.IsValid() {
+		return nil, errors.New("无效的 IP 地址")
+	}
+	return net.IP(addr.Unmap().AsSlice()), nil
+}
+
+// ASN 查询地址的 ASN 地址段
+func (reader *Reader) ASN(addr netip.Addr) (*ASNBlock, error) {
+	ip, err := addrIP(addr)
+	if err != nil {
+		return nil, err
+	}
+	block, err := reader.geo.AsnBlock(ip)
+	if err != nil {
+		return nil, err
+	}
+	asn, err := FromASNBlock(*block)
+	if err != nil {
+		return nil, err
+	}
+	return &asn, nil
+}
+
+// City 查询地址的城市地址段，地域使用数据库中的第一个语言
+func (reader *Reader) City(addr netip.Addr) (*CityBlock, error) {
+	ip, err := addrIP(addr)
+	if err != nil {
+		return nil, err
+	}
+	block, err := reader.geo.CityBlock(ip)
+	if err != nil {
+		return nil, err
+	}
+	city, err := FromCityBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	return &city, nil
+}
+
+// Country 查询地址的国家地址段，地域使用数据库中的第一个语言
+func (reader *Reader) Country(addr netip.Addr) (*CountryBlock, error) {
+	ip, err := addrIP(addr)
+	if err != nil {
+		return nil, err
+	}
+	block, err := reader.geo.CountryBlock(ip)
+	if err != nil {
+		return nil, err
+	}
+	country, err := FromCountryBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	return &country, nil
+}
+
+// Lookup 批量查询，返回与输入顺序一致的结果，无效的地址只在对应结果的 Err 中报告
+func (reader *Reader) Lookup(addrs []netip.Addr, options geoip.LookupOptions) ([]Result, error) {
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		// 无效的地址以 nil 查询，由 LookupMany 报告错误
+		ips[i], _ = addrIP(addr)
+	}
+	lookups, err := reader.geo.LookupMany(ips, options)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(lookups))
+	for i, lookup := range lookups {
+		results[i] = Result{Addr: addrs[i], Tags: lookup.Tags, Err: lookup.Err}
+		if lookup.ASN != nil {
+			asn, err := FromASNBlock(*lookup.ASN)
+			if err != nil {
+				return nil, err
+			}
+			results[i].ASN = &asn
+		}
+		if lookup.City != nil {
+			city, err := FromCityBlock(lookup.City)
+			if err != nil {
+				return nil, err
+			}
+			results[i].City = &city
+		}
+		if lookup.Country != nil {
+			country, err := FromCountryBlock(lookup.Country)
+			if err != nil {
+				return nil, err
+			}
+			results[i].Country = &country
+		}
+	}
+	return results, nil
+}
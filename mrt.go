@@ -0,0 +1,329 @@
+package geoip
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+)
+
+// MRT（RFC 6396）记录类型及 TABLE_DUMP_V2 子类型，ADDPATH 子类型见 RFC 8050
+const (
+	mrtTableDumpV2 = 13
+
+	mrtPeerIndexTable        = 1
+	mrtRIBIPv4Unicast        = 2
+	mrtRIBIPv6Unicast        = 4
+	mrtRIBIPv4UnicastAddPath = 8
+	mrtRIBIPv6UnicastAddPath = 10
+
+	// mrtMaxRecord 单条记录长度上限，超过时视为文件损坏
+	mrtMaxRecord = 16 << 20
+)
+
+// BGP 路径属性
+const (
+	bgpAttrExtendedLength = 0x10
+	bgpAttrASPath         = 2
+
+	asPathSet      = 1
+	asPathSequence = 2
+)
+
+// routeTable 前缀 → 起源 AS → 观察到该起源的对等体数，可合并多个 RIB 文件
+type routeTable map[netip.Prefix]map[uint32]int
+
+// ParseMRT 解析 MRT TABLE_DUMP_V2 格式的 RIB 文件（RouteViews、RIPE RIS 的 rib.*、bview.*），
+// 返回按地址排序的前缀及其起源 AS。只读取单播 RIB 记录，其他类型的记录跳过
+func ParseMRT(r io.Reader) ([]Route, error) {
+	table := make(routeTable)
+	if err := table.read(r); err != nil {
+		return nil, err
+	}
+	return table.routes(), nil
+}
+
+// ReadMRTFile 读取 RIB 文件，按文件头自动识别 gzip 与 bzip2 压缩
+func ReadMRTFile(path string) ([]Route, error) {
+	table := make(routeTable)
+	if err := table.readFile(path); err != nil {
+		return nil, err
+	}
+	return table.routes(), nil
+}
+
+func (table routeTable) readFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r, err := decompress(file)
+	if err != nil {
+		return fmt.Errorf("%s：%w", path, err)
+	}
+	if err := table.read(r); err != nil {
+		return fmt.Errorf("%s：%w", path, err)
+	}
+	return nil
+}
+
+// decompress 按文件头识别 gzip 与 bzip2 压缩，未压缩时原样返回
+func decompress(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(buffered), nil
+	}
+	return buffered, nil
+}
+
+func (table routeTable) read(r io.Reader) error {
+	var peers []uint32
+	var body []byte
+	header := make([]byte, 12)
+	for record := 1; ; record++ {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("第 %d 条 MRT 记录：%w", record, err)
+		}
+		kind := binary.BigEndian.Uint16(header[4:6])
+		subtype := binary.BigEndian.Uint16(header[6:8])
+		length := binary.BigEndian.Uint32(header[8:12])
+		if length > mrtMaxRecord {
+			return fmt.Errorf("第 %d 条 MRT 记录长度 %d 超过上限", record, length)
+		}
+		if cap(body) < int(length) {
+			body = make([]byte, length)
+		}
+		body = body[:length]
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("第 %d 条 MRT 记录：%w", record, err)
+		}
+		if kind != mrtTableDumpV2 {
+			continue
+		}
+
+		var err error
+		switch subtype {
+		case mrtPeerIndexTable:
+			peers, err = parsePeerIndex(body)
+		case mrtRIBIPv4Unicast, mrtRIBIPv6Unicast, mrtRIBIPv4UnicastAddPath, mrtRIBIPv6UnicastAddPath:
+			err = table.parseRIB(body, subtype == mrtRIBIPv6Unicast || subtype == mrtRIBIPv6UnicastAddPath,
+				subtype == mrtRIBIPv4UnicastAddPath || subtype == mrtRIBIPv6UnicastAddPath, peers)
+		}
+		if err != nil {
+			return fmt.Errorf("第 %d 条 MRT 记录：%w", record, err)
+		}
+	}
+}
+
+// mrtData 按大端序顺序读取记录内容，长度不足时记录错误并返回零值
+type mrtData struct {
+	buf []byte
+	err error
+}
+
+func (data *mrtData) bytes(n int) []byte {
+	if data.err != nil {
+		return nil
+	}
+	if len(data.buf) < n {
+		data.err = errors.New("MRT 记录长度不足")
+		return nil
+	}
+	b := data.buf[:n]
+	data.buf = data.buf[n:]
+	return b
+}
+
+func (data *mrtData) u8() int {
+	if b := data.bytes(1); b != nil {
+		return int(b[0])
+	}
+	return 0
+}
+
+func (data *mrtData) u16() int {
+	if b := data.bytes(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (data *mrtData) u32() uint32 {
+	if b := data.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// parsePeerIndex 解析 PEER_INDEX_TABLE，返回各对等体的 AS，RIB 记录中以序号引用对等体
+func parsePeerIndex(body []byte) ([]uint32, error) {
+	data := &mrtData{buf: body}
+	data.bytes(4)
+	data.bytes(data.u16())
+	count := data.u16()
+	peers := make([]uint32, 0, count)
+	for i := 0; i < count && data.err == nil; i++ {
+		kind := data.u8()
+		data.bytes(4)
+		if kind&1 != 0 {
+			data.bytes(16)
+		} else {
+			data.bytes(4)
+		}
+		if kind&2 != 0 {
+			peers = append(peers, data.u32())
+		} else {
+			peers = append(peers, uint32(data.u16()))
+		}
+	}
+	return peers, data.err
+}
+
+// parseRIB 解析一条前缀的 RIB 记录，每个 RIB 条目为一个对等体观察到的路由
+func (table routeTable) parseRIB(body []byte, ipv6, addPath bool, peers []uint32) error {
+	data := &mrtData{buf: body}
+	data.bytes(4)
+	bits := data.u8()
+	raw := data.bytes((bits + 7) / 8)
+	if data.err != nil {
+		return data.err
+	}
+	var addr [16]byte
+	copy(addr[:], raw)
+	ip := netip.AddrFrom16(addr)
+	if !ipv6 {
+		ip = netip.AddrFrom4([4]byte(addr[:4]))
+	}
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return fmt.Errorf("无效的前缀长度 %d", bits)
+	}
+
+	count := data.u16()
+	for i := 0; i < count && data.err == nil; i++ {
+		peer := data.u16()
+		data.bytes(4)
+		if addPath {
+			data.bytes(4)
+		}
+		attrs := data.bytes(data.u16())
+		if data.err != nil {
+			break
+		}
+		origin, empty, err := originAS(attrs)
+		if err != nil {
+			return err
+		}
+		// AS_PATH 为空时路由由对等体自身发起
+		if empty && peer < len(peers) {
+			origin = peers[peer]
+		}
+		if origin == 0 {
+			continue
+		}
+		if table[prefix] == nil {
+			table[prefix] = make(map[uint32]int)
+		}
+		table[prefix][origin]++
+	}
+	return data.err
+}
+
+// originAS 从路径属性中读取 AS_PATH 的起源 AS。TABLE_DUMP_V2 中的 AS_PATH 总是使用 4 字节 AS。
+// 路径为空或没有 AS_PATH 时 empty 为 true；最后一段为多个成员的 AS_SET 时无法确定起源，返回 0
+func originAS(attrs []byte) (origin uint32, empty bool, err error) {
+	data := &mrtData{buf: attrs}
+	for len(data.buf) > 0 && data.err == nil {
+		flags := data.u8()
+		code := data.u8()
+		var length int
+		if flags&bgpAttrExtendedLength != 0 {
+			length = data.u16()
+		} else {
+			length = data.u8()
+		}
+		value := data.bytes(length)
+		if code == bgpAttrASPath && data.err == nil {
+			return pathOrigin(value)
+		}
+	}
+	return 0, true, data.err
+}
+
+func pathOrigin(value []byte) (origin uint32, empty bool, err error) {
+	data := &mrtData{buf: value}
+	empty = true
+	for len(data.buf) > 0 && data.err == nil {
+		kind := data.u8()
+		count := data.u8()
+		asns := data.bytes(count * 4)
+		// 跳过联盟路径段
+		if data.err != nil || count == 0 || (kind != asPathSet && kind != asPathSequence) {
+			continue
+		}
+		empty = false
+		switch {
+		case kind == asPathSequence:
+			origin = binary.BigEndian.Uint32(asns[len(asns)-4:])
+		case count == 1:
+			origin = binary.BigEndian.Uint32(asns)
+		default:
+			origin = 0
+		}
+	}
+	return origin, empty, data.err
+}
+
+// routes 返回按地址排序的前缀，起源 AS 按对等体数由多到少排序，相同时按 ASN 排序
+func (table routeTable) routes() []Route {
+	prefixes := make([]netip.Prefix, 0, len(table))
+	for prefix := range table {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+			return c < 0
+		}
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+
+	routes := make([]Route, len(prefixes))
+	for i, prefix := range prefixes {
+		route := Route{Network: prefix.String()}
+		for asn, peers := range table[prefix] {
+			route.Origins = append(route.Origins, RouteOrigin{AutonomousSystemNumber: int(asn), Peers: peers})
+		}
+		sortOrigins(route.Origins)
+		route.MOAS = len(route.Origins) > 1
+		routes[i] = route
+	}
+	return routes
+}
+
+func sortOrigins(origins []RouteOrigin) {
+	sort.Slice(origins, func(i, j int) bool {
+		if origins[i].Peers != origins[j].Peers {
+			return origins[i].Peers > origins[j].Peers
+		}
+		return origins[i].AutonomousSystemNumber < origins[j].AutonomousSystemNumber
+	})
+}
@@ -0,0 +1,233 @@
+package geoip_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mrtSegment AS_PATH 路径段，kind 1 为 AS_SET，2 为 AS_SEQUENCE
+type mrtSegment struct {
+	kind byte
+	asns []uint32
+}
+
+func mrtRecord(kind, subtype uint16, body []byte) []byte {
+	record := make([]byte, 12, 12+len(body))
+	binary.BigEndian.PutUint16(record[4:], kind)
+	binary.BigEndian.PutUint16(record[6:], subtype)
+	binary.BigEndian.PutUint32(record[8:], uint32(len(body)))
+	return append(record, body...)
+}
+
+// mrtPeerIndex 第一个对等体使用 IPv4 地址及 4 字节 AS，其余使用 IPv6 地址及 2 字节 AS
+func mrtPeerIndex(asns ...uint32) []byte {
+	body := []byte{10, 0, 0, 1, 0, 4, 't', 'e', 's', 't'}
+	body = binary.BigEndian.AppendUint16(body, uint16(len(asns)))
+	for i, asn := range asns {
+		if i == 0 {
+			body = append(body, 2, 10, 0, 0, 2, 192, 0, 2, 1)
+			body = binary.BigEndian.AppendUint32(body, asn)
+			continue
+		}
+		body = append(body, 1, 10, 0, 0, byte(i+2))
+		body = append(body, net.ParseIP("2001:db8::1")...)
+		body = binary.BigEndian.AppendUint16(body, uint16(asn))
+	}
+	return body
+}
+
+// mrtAttrs ORIGIN 与 AS_PATH 属性，segments 为空时 AS_PATH 为空
+func mrtAttrs(segments ...mrtSegment) []byte {
+	var path []byte
+	for _, segment := range segments {
+		path = append(path, segment.kind, byte(len(segment.asns)))
+		for _, asn := range segment.asns {
+			path = binary.BigEndian.AppendUint32(path, asn)
+		}
+	}
+	attrs := []byte{0x40, 1, 1, 0}
+	attrs = append(attrs, 0x50, 2)
+	attrs = binary.BigEndian.AppendUint16(attrs, uint16(len(path)))
+	return append(attrs, path...)
+}
+
+// mrtRIB 一条前缀的 RIB 记录，entries 依次为各对等体的路径属性
+func mrtRIB(prefix string, addPath bool, entries map[uint16][]byte) []byte {
+	p := netip.MustParsePrefix(prefix)
+	body := []byte{0, 0, 0, 1, byte(p.Bits())}
+	body = append(body, p.Addr().AsSlice()[:(p.Bits()+7)/8]...)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(entries)))
+	for peer := uint16(0); peer < 8; peer++ {
+		attrs, ok := entries[peer]
+		if !ok {
+			continue
+		}
+		body = binary.BigEndian.AppendUint16(body, peer)
+		body = append(body, 0x65, 0x25, 0x00, 0x00)
+		if addPath {
+			body = append(body, 0, 0, 0, 1)
+		}
+		body = binary.BigEndian.AppendUint16(body, uint16(len(attrs)))
+		body = append(body, attrs...)
+	}
+	return body
+}
+
+func mrtDump() []byte {
+	sequence := func(asns ...uint32) mrtSegment { return mrtSegment{2, asns} }
+	set := func(asns ...uint32) mrtSegment { return mrtSegment{1, asns} }
+	var dump []byte
+	for _, record := range [][]byte{
+		mrtRecord(13, 1, mrtPeerIndex(64500, 64501, 64502)),
+		// BGP4MP 记录跳过
+		mrtRecord(16, 4, []byte{1, 2, 3}),
+		mrtRecord(13, 2, mrtRIB("1.0.0.0/24", false, map[uint16][]byte{
+			0: mrtAttrs(sequence(64500, 13335)), 1: mrtAttrs(sequence(64501, 174, 38803))})),
+		mrtRecord(13, 2, mrtRIB("5.0.0.0/16", false, map[uint16][]byte{0: mrtAttrs()})),
+		mrtRecord(13, 2, mrtRIB("8.0.0.0/9", false, map[uint16][]byte{0: mrtAttrs(sequence(64500, 3356))})),
+		mrtRecord(13, 2, mrtRIB("8.8.8.0/24", false, map[uint16][]byte{
+			0: mrtAttrs(sequence(64500, 3356, 15169)), 1: mrtAttrs(sequence(64501, 15169)),
+			2: mrtAttrs(sequence(64502, 6939), sequence(15169))})),
+		mrtRecord(13, 2, mrtRIB("14.0.0.0/16", false, map[uint16][]byte{
+			0: mrtAttrs(sequence(64500, 4134), set(4134, 4809)), 1: mrtAttrs(sequence(64501), set(4134))})),
+		mrtRecord(13, 10, mrtRIB("2001:4860::/32", true, map[uint16][]byte{1: mrtAttrs(sequence(64501, 15169))})),
+	} {
+		dump = append(dump, record...)
+	}
+	return dump
+}
+
+func TestParseMRT(t *testing.T) {
+	routes, err := geoip.ParseMRT(bytes.NewReader(mrtDump()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []geoip.Route{
+		{Network: "1.0.0.0/24", MOAS: true, Origins: []geoip.RouteOrigin{{13335, 1}, {38803, 1}}},
+		{Network: "5.0.0.0/16", Origins: []geoip.RouteOrigin{{64500, 1}}},
+		{Network: "8.0.0.0/9", Origins: []geoip.RouteOrigin{{3356, 1}}},
+		{Network: "8.8.8.0/24", Origins: []geoip.RouteOrigin{{15169, 3}}},
+		{Network: "14.0.0.0/16", Origins: []geoip.RouteOrigin{{4134, 1}}},
+		{Network: "2001:4860::/32", Origins: []geoip.RouteOrigin{{15169, 1}}},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("got %+v", routes)
+	}
+
+	dump := mrtDump()
+	if _, err := geoip.ParseMRT(bytes.NewReader(dump[:len(dump)-3])); err == nil {
+		t.Error("truncated dump should fail")
+	}
+}
+
+func TestGeolite2_Route(t *testing.T) {
+	dataset := geoiptest.Default()
+	db := loadDataset(t, dataset)
+	path := filepath.Join(t.TempDir(), "rib.20231010.0000.gz")
+	buf := new(bytes.Buffer)
+	writer := gzip.NewWriter(buf)
+	writer.Write(mrtDump())
+	writer.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loader := geoip.NewRouteLoader(db)
+	if n, err := loader.LoadFile(path); err != nil || n != 6 {
+		t.Fatalf("loaded %d routes: %v", n, err)
+	}
+	routes, err := geoip.ReadMRTFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := geoiptest.NewFake(dataset)
+	fake.SetRoutes(routes)
+	fake.SetASNSource(geoip.ASNSourceBGP)
+
+	geo := geoip.NewGeolite2(db).(geoip.Geolite2)
+	route, err := geo.Route(net.ParseIP("8.8.8.8"))
+	if err != nil || route.Network != "8.8.8.0/24" || route.Origins[0].Peers != 3 {
+		t.Errorf("unexpected route %+v %v", route, err)
+	}
+	if route, err := geo.Route(net.ParseIP("8.1.1.1")); err != nil || route.Network != "8.0.0.0/9" {
+		t.Errorf("unexpected route %+v %v", route, err)
+	}
+	if _, err := geo.Route(net.ParseIP("9.9.9.9")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("want sql.ErrNoRows, got %v", err)
+	}
+	if _, err := geo.Route(net.ParseIP("10.0.0.1")); !errors.Is(err, geoip.ErrReserved) {
+		t.Errorf("want reserved error, got %v", err)
+	}
+	moas, err := geo.MOASRoutes()
+	if err != nil || len(moas) != 1 || moas[0].Network != "1.0.0.0/24" || len(moas[0].Origins) != 2 {
+		t.Errorf("unexpected moas routes %+v %v", moas, err)
+	}
+
+	// 默认仍使用 GeoLite2 ASN 数据
+	if block, err := geo.AsnBlock(net.ParseIP("8.1.1.1")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GeoLite2 has no 8.1.1.1, got %+v %v", block, err)
+	}
+	bgp := geo.WithASNSource(geoip.ASNSourceBGP)
+	// 起源 AS 的组织名称按 autonomous_system_number 索引查询
+	if plan := geoip.QueryPlan(t, db, "SELECT autonomous_system_organization FROM GeoLite2ASNBlocksIPv4 "+
+		"WHERE autonomous_system_number = ? LIMIT 1", 15169); !strings.Contains(plan, "GeoLite2ASNBlocksIPv4Number") {
+		t.Errorf("organization name should use the number index: %s", plan)
+	}
+	block, err := bgp.AsnBlock(net.ParseIP("8.8.8.8"))
+	if err != nil || block.AutonomousSystemNumber != 15169 || block.AutonomousSystemOrganization != "GOOGLE" {
+		t.Errorf("unexpected block %+v %v", block, err)
+	}
+	blocks, err := bgp.BlocksByAsnNumber(15169)
+	if err != nil || len(blocks) != 2 || blocks[1].Network != "2001:4860::/32" {
+		t.Errorf("unexpected blocks %+v %v", blocks, err)
+	}
+
+	for _, number := range []int64{15169, 13335, 38803, 64500, 1} {
+		got, err := bgp.BlocksByAsnNumber(number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := fake.BlocksByAsnNumber(number)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("AS%d: sqlite %+v, fake %+v", number, got, want)
+		}
+	}
+	ips := []net.IP{net.ParseIP("1.0.0.1"), net.ParseIP("5.0.0.1"), net.ParseIP("8.1.1.1"), net.ParseIP("8.8.8.8"),
+		net.ParseIP("14.0.1.1"), net.ParseIP("2001:4860::8888"), net.ParseIP("2002:808:808::1"),
+		net.ParseIP("9.9.9.9")}
+	for _, ip := range ips {
+		got, gotErr := bgp.AsnBlock(ip)
+		want, wantErr := fake.AsnBlock(ip)
+		if !reflect.DeepEqual(got, want) || !errors.Is(gotErr, wantErr) {
+			t.Errorf("%s: sqlite %+v %v, fake %+v %v", ip, got, gotErr, want, wantErr)
+		}
+		gotRoute, gotErr := bgp.Route(ip)
+		wantRoute, wantErr := fake.Route(ip)
+		if !reflect.DeepEqual(gotRoute, wantRoute) || !errors.Is(gotErr, wantErr) {
+			t.Errorf("%s: sqlite %+v %v, fake %+v %v", ip, gotRoute, gotErr, wantRoute, wantErr)
+		}
+	}
+	if got, _ := fake.MOASRoutes(); !reflect.DeepEqual(got, moas) {
+		t.Errorf("fake moas %+v", got)
+	}
+
+	results, err := bgp.LookupMany(ips, geoip.LookupOptions{Fields: geoip.LookupASN, BatchSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := fake.LookupMany(ips, geoip.LookupOptions{Fields: geoip.LookupASN})
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("sqlite %+v\nfake %+v", results, want)
+	}
+}
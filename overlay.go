@@ -0,0 +1,609 @@
+package geoip
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Overlay 用户维护的覆盖地址段，IP 查询时优先于 GeoLite2 数据。设置了地域字段时城市及国家信息整体取自 Overlay，
+// 设置了 ASN 字段时 ASN 信息整体取自 Overlay，只设置 Label 时仅作为标注，不影响查询结果。
+// 多个 Overlay 包含同一 IP 时取前缀最长的一个。
+// 覆盖只作用于按 IP 查询：AsnBlock、CityBlock、CountryBlock 以及 LookupMany 和基于它的 LookupStream 与报表；
+// BlocksBy*、Range*、OrganizationDirectory 等按条件列出地址段的查询以及 Breakdown 只返回 GeoLite2 数据
+type Overlay struct {
+	ID      int64  `json:"id"`
+	Network string `json:"network"`
+	Label   string `json:"label"`
+
+	// GeonameID 关联 GeoLite2 中的地域，未设置地域名称时使用该地域的名称
+	GeonameID           int64   `json:"geoname_id"`
+	ContinentCode       string  `json:"continent_code"`
+	ContinentName       string  `json:"continent_name"`
+	CountryISOCode      string  `json:"country_iso_code"`
+	CountryName         string  `json:"country_name"`
+	Subdivision1ISOCode string  `json:"subdivision_1_iso_code"`
+	Subdivision1Name    string  `json:"subdivision_1_name"`
+	CityName            string  `json:"city_name"`
+	TimeZone            string  `json:"time_zone"`
+	IsInEuropeanUnion   bool    `json:"is_in_european_union"`
+	PostalCode          string  `json:"postal_code"`
+	Latitude            float64 `json:"latitude"`
+	Longitude           float64 `json:"longitude"`
+	AccuracyRadius      int     `json:"accuracy_radius"`
+
+	Organization
+
+	// coordinates 是否设置了经纬度，赤道及本初子午线上的坐标同样有效
+	coordinates bool
+}
+
+// HasLocation 是否设置了地域字段
+func (overlay *Overlay) HasLocation() bool {
+	return overlay.GeonameID != 0 || overlay.ContinentCode != "" || overlay.CountryISOCode != "" ||
+		overlay.CityName != "" || overlay.coordinates
+}
+
+// HasCoordinates 是否设置了经纬度（latitude 或 longitude），未设置时 Latitude 与 Longitude 为 0
+func (overlay *Overlay) HasCoordinates() bool {
+	return overlay.coordinates
+}
+
+// SetCoordinates 设置覆盖地址段的经纬度，用于在代码中构造 Overlay
+func (overlay *Overlay) SetCoordinates(latitude, longitude float64) {
+	overlay.Latitude, overlay.Longitude, overlay.coordinates = latitude, longitude, true
+}
+
+// HasASN 是否设置了 ASN 字段
+func (overlay *Overlay) HasASN() bool {
+	return overlay.AutonomousSystemNumber != 0 || overlay.AutonomousSystemOrganization != ""
+}
+
+// ASNBlock 返回由 Overlay 构造的 ASN 地址段
+func (overlay *Overlay) ASNBlock() *ASNBlock {
+	return &ASNBlock{Network: overlay.Network, Organization: overlay.Organization}
+}
+
+// CityBlock 返回由 Overlay 构造的城市地址段，location 为按 GeonameID 查到的地域，Overlay 中非空的名称覆盖 location
+func (overlay *Overlay) CityBlock(location *CityLocation) *CityBlock {
+	l := CityLocation{GeonameID: overlay.GeonameID}
+	if location != nil {
+		l = *location
+	}
+	override(&l.ContinentCode, overlay.ContinentCode)
+	override(&l.ContinentName, overlay.ContinentName)
+	override(&l.CountryISOCode, overlay.CountryISOCode)
+	override(&l.CountryName, overlay.CountryName)
+	override(&l.Subdivision1ISOCode, overlay.Subdivision1ISOCode)
+	override(&l.Subdivision1Name, overlay.Subdivision1Name)
+	override(&l.CityName, overlay.CityName)
+	override(&l.TimeZone, overlay.TimeZone)
+	if location == nil || overlay.IsInEuropeanUnion {
+		l.IsInEuropeanUnion = boolFlag(overlay.IsInEuropeanUnion)
+	}
+
+	return &CityBlock{Network: overlay.Network, GeonameID: overlay.GeonameID, PostalCode: overlay.PostalCode,
+		Latitude: overlay.Latitude, Longitude: overlay.Longitude, AccuracyRadius: overlay.AccuracyRadius,
+		coordinates: overlay.coordinates, location: &l}
+}
+
+// CountryBlock 返回由 Overlay 构造的国家地址段，location 为按 GeonameID 查到的地域，Overlay 中非空的名称覆盖 location
+func (overlay *Overlay) CountryBlock(location *CountryLocation) *CountryBlock {
+	l := CountryLocation{GeonameID: overlay.GeonameID}
+	if location != nil {
+		l = *location
+	}
+	override(&l.ContinentCode, overlay.ContinentCode)
+	override(&l.ContinentName, overlay.ContinentName)
+	override(&l.CountryISOCode, overlay.CountryISOCode)
+	override(&l.CountryName, overlay.CountryName)
+	if location == nil || overlay.IsInEuropeanUnion {
+		l.IsInEuropeanUnion = boolFlag(overlay.IsInEuropeanUnion)
+	}
+
+	return &CountryBlock{Network: overlay.Network, GeonameID: overlay.GeonameID, IsAnonymousProxy: "0",
+		IsSatelliteProvider: "0", location: &l}
+}
+
+func override(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+// overlayMatcher 预先解析地址段，用于对大量 IP 逐个匹配
+type overlayMatcher struct {
+	overlays []Overlay
+	networks []*net.IPNet
+}
+
+func newOverlayMatcher(overlays []Overlay) overlayMatcher {
+	matcher := overlayMatcher{overlays: overlays, networks: make([]*net.IPNet, len(overlays))}
+	for i := range overlays {
+		_, matcher.networks[i], _ = net.ParseCIDR(overlays[i].Network)
+	}
+	return matcher
+}
+
+func (matcher overlayMatcher) match(ip net.IP) *Overlay {
+	match, bits := -1, -1
+	for i, network := range matcher.networks {
+		if network == nil || !network.Contains(ip) {
+			continue
+		}
+		if ones, _ := network.Mask.Size(); ones >= bits {
+			match, bits = i, ones
+		}
+	}
+	if match < 0 {
+		return nil
+	}
+	return &matcher.overlays[match]
+}
+
+// MatchOverlay 返回 overlays 中包含 ip 且前缀最长的 Overlay，前缀相同时取靠后的一个，没有时返回 nil
+func MatchOverlay(overlays []Overlay, ip net.IP) *Overlay {
+	return newOverlayMatcher(overlays).match(ip)
+}
+
+var overlayColumns = map[string]func(overlay *Overlay, value string) error{
+	"network": func(overlay *Overlay, value string) error {
+		ipNet, err := parseNetwork(value)
+		if err != nil {
+			return err
+		}
+		overlay.Network = ipNet.String()
+		return nil
+	},
+	"label":                  func(o *Overlay, v string) error { o.Label = v; return nil },
+	"geoname_id":             func(o *Overlay, v string) (err error) { o.GeonameID, err = parseInt64(v); return },
+	"continent_code":         func(o *Overlay, v string) error { o.ContinentCode = v; return nil },
+	"continent_name":         func(o *Overlay, v string) error { o.ContinentName = v; return nil },
+	"country_iso_code":       func(o *Overlay, v string) error { o.CountryISOCode = v; return nil },
+	"country_name":           func(o *Overlay, v string) error { o.CountryName = v; return nil },
+	"subdivision_1_iso_code": func(o *Overlay, v string) error { o.Subdivision1ISOCode = v; return nil },
+	"subdivision_1_name":     func(o *Overlay, v string) error { o.Subdivision1Name = v; return nil },
+	"city_name":              func(o *Overlay, v string) error { o.CityName = v; return nil },
+	"time_zone":              func(o *Overlay, v string) error { o.TimeZone = v; return nil },
+	"is_in_european_union": func(o *Overlay, v string) (err error) {
+		o.IsInEuropeanUnion, err = parseBool(v)
+		return
+	},
+	"postal_code":     func(o *Overlay, v string) error { o.PostalCode = v; return nil },
+	"latitude":        func(o *Overlay, v string) error { return o.setCoordinate(&o.Latitude, v) },
+	"longitude":       func(o *Overlay, v string) error { return o.setCoordinate(&o.Longitude, v) },
+	"accuracy_radius": func(o *Overlay, v string) (err error) { o.AccuracyRadius, err = parseInt(v); return },
+	"autonomous_system_number": func(o *Overlay, v string) (err error) {
+		o.AutonomousSystemNumber, err = parseInt(v)
+		return
+	},
+	"autonomous_system_organization": func(o *Overlay, v string) error {
+		o.AutonomousSystemOrganization = v
+		return nil
+	},
+}
+
+// parseNetwork 解析 CIDR 或单个 IP，单个 IP 视为 /32 或 /128 地址段
+func parseNetwork(value string) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, err
+		}
+		bits := net.IPv6len * 8
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), net.IPv4len*8
+		}
+		ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	return ipNet, nil
+}
+
+// overlayAliases 覆盖文件中可以使用的简写字段名
+var overlayAliases = map[string]string{
+	"country":      "country_iso_code",
+	"city":         "city_name",
+	"eu":           "is_in_european_union",
+	"asn":          "autonomous_system_number",
+	"organization": "autonomous_system_organization",
+}
+
+func (overlay *Overlay) set(key, value string) error {
+	if alias, ok := overlayAliases[key]; ok {
+		key = alias
+	}
+	set, ok := overlayColumns[key]
+	if !ok {
+		return errors.New("未知的字段：" + key)
+	}
+	if err := set(overlay, strings.TrimSpace(value)); err != nil {
+		return fmt.Errorf("字段 %s：%w", key, err)
+	}
+	return nil
+}
+
+// setCoordinate 解析纬度或经度，非空时记录设置了经纬度
+func (overlay *Overlay) setCoordinate(field *float64, value string) (err error) {
+	if value == "" {
+		return nil
+	}
+	overlay.coordinates = true
+	*field, err = strconv.ParseFloat(value, 64)
+	return err
+}
+
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func parseInt64(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "0", "false", "no":
+		return false, nil
+	case "1", "true", "yes":
+		return true, nil
+	}
+	return false, errors.New("无效的布尔值：" + value)
+}
+
+// ParseOverlayCSV 解析覆盖文件的 CSV 格式，首行为表头，字段名与 Overlay 的 json 标签或简写相同，network 必填
+func ParseOverlayCSV(r io.Reader) ([]Overlay, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var overlays []Overlay
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		var overlay Overlay
+		for i, value := range record {
+			if i >= len(header) {
+				return nil, fmt.Errorf("第 %d 行：字段数多于表头", line)
+			}
+			if err := overlay.set(strings.TrimSpace(header[i]), value); err != nil {
+				return nil, fmt.Errorf("第 %d 行：%w", line, err)
+			}
+		}
+		if overlay.Network == "" {
+			return nil, fmt.Errorf("第 %d 行：缺少 network", line)
+		}
+		overlays = append(overlays, overlay)
+	}
+	return overlays, nil
+}
+
+// ParseOverlayYAML 解析覆盖文件的 YAML 格式。只支持由扁平映射组成的列表，可以放在顶层的 overlays 键下，
+// 值为单行标量，字符串可以使用单引号或双引号：
+//
+//	overlays:
+//	  - network: 10.8.0.0/16
+//	    label: vpn
+//	    country: DE
+//	    city: Frankfurt am Main
+//	    asn: 64512
+//	    organization: "Corp VPN"
+func ParseOverlayYAML(r io.Reader) ([]Overlay, error) {
+	var overlays []Overlay
+	var current *Overlay
+	finish := func(line int) error {
+		if current != nil && current.Network == "" {
+			return fmt.Errorf("第 %d 行之前的条目缺少 network", line)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := stripYAMLComment(scanner.Text())
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || trimmed == "---" || (trimmed == "overlays:" && text == trimmed) {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "-") {
+			if err := finish(line); err != nil {
+				return nil, err
+			}
+			overlays = append(overlays, Overlay{})
+			current = &overlays[len(overlays)-1]
+			if trimmed = strings.TrimSpace(trimmed[1:]); trimmed == "" {
+				continue
+			}
+		}
+		if current == nil {
+			return nil, fmt.Errorf("第 %d 行：条目须以 - 开始", line)
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("第 %d 行：应为 key: value", line)
+		}
+		value, err := unquoteYAML(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行：%w", line, err)
+		}
+		if err := current.set(strings.TrimSpace(key), value); err != nil {
+			return nil, fmt.Errorf("第 %d 行：%w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := finish(0); err != nil {
+		return nil, err
+	}
+	return overlays, nil
+}
+
+// stripYAMLComment 去掉引号以外的 # 注释
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteYAML(value string) (string, error) {
+	switch {
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		return strconv.Unquote(value)
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	case strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "'"):
+		return "", errors.New("引号不匹配：" + value)
+	}
+	return value, nil
+}
+
+// ReadOverlayFile 按扩展名读取 .yaml、.yml 或 .csv 覆盖文件
+func ReadOverlayFile(path string) ([]Overlay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseOverlayYAML(file)
+	case ".csv":
+		return ParseOverlayCSV(file)
+	}
+	return nil, errors.New("不支持的覆盖文件格式：" + path)
+}
+
+// OverlayLoader 管理覆盖地址段表。覆盖数据与 GeoLite2 数据分表保存，重新加载 GeoLite2 时不受影响
+type OverlayLoader struct {
+	db *sql.DB
+}
+
+func NewOverlayLoader(db *sql.DB) *OverlayLoader {
+	return &OverlayLoader{db: db}
+}
+
+// Load 在一个事务中以 overlays 替换全部覆盖地址段
+func (loader *OverlayLoader) Load(overlays []Overlay) (err error) {
+	tx, err := loader.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(overlaySql.CreateTable); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM " + overlaySql.Table); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(overlaySql.Insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, overlay := range overlays {
+		_, ipNet, err := net.ParseCIDR(overlay.Network)
+		if err != nil {
+			return fmt.Errorf("无效的覆盖地址段 %s：%w", overlay.Network, err)
+		}
+		version, start, end := overlayRange(ipNet)
+		ones, _ := ipNet.Mask.Size()
+		// 未设置经纬度时写入 NULL，与 (0, 0) 区分
+		var latitude, longitude interface{}
+		if overlay.coordinates {
+			latitude, longitude = overlay.Latitude, overlay.Longitude
+		}
+		if _, err = stmt.Exec(ipNet.String(), version, start, end, ones, overlay.Label,
+			overlay.GeonameID, overlay.ContinentCode, overlay.ContinentName, overlay.CountryISOCode,
+			overlay.CountryName, overlay.Subdivision1ISOCode, overlay.Subdivision1Name, overlay.CityName,
+			overlay.TimeZone, boolFlag(overlay.IsInEuropeanUnion), overlay.PostalCode, latitude,
+			longitude, overlay.AccuracyRadius, overlay.AutonomousSystemNumber,
+			overlay.AutonomousSystemOrganization); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	schemaChanged()
+	log.Debug().Msgf("已加载 %d 个覆盖地址段", len(overlays))
+	return nil
+}
+
+// LoadFile 读取覆盖文件并替换全部覆盖地址段，返回加载的条数
+func (loader *OverlayLoader) LoadFile(path string) (int, error) {
+	overlays, err := ReadOverlayFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return len(overlays), loader.Load(overlays)
+}
+
+// overlayRange 返回地址段的协议及起止地址，与 GeoLite2 地址段表相同，IPv4 为整数，IPv6 为 16 字节
+func overlayRange(ipNet *net.IPNet) (string, interface{}, interface{}) {
+	if ip4 := ipNet.IP.To4(); ip4 != nil {
+		start := IP2Int(ip4)
+		ones, _ := ipNet.Mask.Size()
+		return "IPv4", start, start | uint32(1<<(32-ones)-1)
+	}
+	start := ipNet.IP.To16()
+	end := make([]byte, net.IPv6len)
+	for i := range end {
+		end[i] = start[i] | ^ipNet.Mask[i]
+	}
+	return "IPv6", []byte(start), end
+}
+
+// overlayKey 返回 IP 在覆盖表中的查询参数。与 blockKey 不同，特殊用途地址同样可以覆盖，如内网及 VPN 地址段
+func overlayKey(ip net.IP) (string, interface{}, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "IPv4", IP2Int(ip4), true
+	}
+	if len(ip) == net.IPv6len {
+		return "IPv6", []byte(ip), true
+	}
+	return "", nil, false
+}
+
+const overlayQuery = "SELECT id, network, label, geoname_id, continent_code, continent_name, country_iso_code, " +
+	"country_name, subdivision_1_iso_code, subdivision_1_name, city_name, time_zone, is_in_european_union, " +
+	"postal_code, latitude IS NOT NULL, IFNULL(latitude, 0), IFNULL(longitude, 0), accuracy_radius, " +
+	"autonomous_system_number, autonomous_system_organization " +
+	"FROM GeoipOverlay"
+
+func scanOverlay(row interface{ Scan(...interface{}) error }) (*Overlay, error) {
+	var overlay Overlay
+	var eu string
+	if err := row.Scan(&overlay.ID, &overlay.Network, &overlay.Label, &overlay.GeonameID, &overlay.ContinentCode,
+		&overlay.ContinentName, &overlay.CountryISOCode, &overlay.CountryName, &overlay.Subdivision1ISOCode,
+		&overlay.Subdivision1Name, &overlay.CityName, &overlay.TimeZone, &eu, &overlay.PostalCode,
+		&overlay.coordinates, &overlay.Latitude, &overlay.Longitude, &overlay.AccuracyRadius, &overlay.AutonomousSystemNumber,
+		&overlay.AutonomousSystemOrganization); err != nil {
+		return nil, err
+	}
+	overlay.IsInEuropeanUnion = eu == "1"
+	return &overlay, nil
+}
+
+// Overlay 返回包含 IP 且前缀最长的覆盖地址段，没有时返回 sql.ErrNoRows
+func (geo Geolite2) Overlay(ip net.IP) (*Overlay, error) {
+	version, key, ok := overlayKey(ip)
+	if !ok {
+		return nil, errors.New("无效的 IP 地址：" + ip.String())
+	}
+	exists, err := geo.tableExists(overlaySql.Table)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+	return scanOverlay(geo.db.QueryRow(overlayQuery+" WHERE version = ? AND ? BETWEEN start_ip AND end_ip "+
+		"ORDER BY prefix_len DESC, id DESC LIMIT 1", version, key))
+}
+
+// overlay 返回包含 IP 的覆盖地址段，没有时返回 nil
+func (geo Geolite2) overlay(ip net.IP) (*Overlay, error) {
+	overlay, err := geo.Overlay(ip)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return overlay, err
+}
+
+// Overlays 返回全部覆盖地址段
+func (geo Geolite2) Overlays() ([]Overlay, error) {
+	exists, err := geo.tableExists(overlaySql.Table)
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := geo.db.Query(overlayQuery + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overlays []Overlay
+	for rows.Next() {
+		overlay, err := scanOverlay(rows)
+		if err != nil {
+			return nil, err
+		}
+		overlays = append(overlays, *overlay)
+	}
+	return overlays, rows.Err()
+}
+
+// overlayCityLocation 按 Overlay 的 GeonameID 查询地域，与 CityBlock 相同取第一个语言，未关联或查不到时返回 nil
+func (geo Geolite2) overlayCityLocation(overlay *Overlay, language string) (*CityLocation, error) {
+	if overlay.GeonameID == 0 {
+		return nil, nil
+	}
+	block := &CityBlock{GeonameID: overlay.GeonameID}
+	if err := geo.cityLocations([]*CityBlock{block}, language); err != nil {
+		return nil, err
+	}
+	return block.location, nil
+}
+
+func (geo Geolite2) overlayCountryLocation(overlay *Overlay, language string) (*CountryLocation, error) {
+	if overlay.GeonameID == 0 {
+		return nil, nil
+	}
+	block := &CountryBlock{GeonameID: overlay.GeonameID}
+	if err := geo.countryLocations([]*CountryBlock{block}, language); err != nil {
+		return nil, err
+	}
+	return block.location, nil
+}
@@ -0,0 +1,255 @@
+package geoip_test
+
+import (
+	"database/sql"
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const overlayYAML = `# 公司网络
+overlays:
+  - network: 10.8.0.0/16   # VPN
+    label: vpn
+    geoname_id: 2925533
+    city: "Frankfurt HQ"
+    asn: 64512
+    organization: 'Corp''s VPN'
+
+  - network: 8.8.8.0/25
+    label: corp-dns
+    country: NL
+    country_name: Netherlands
+    eu: true
+    latitude: 52.37
+    longitude: 4.89
+  -
+    network: 8.8.8.0/24
+    label: google
+  - network: 14.0.0.0/16
+    label: "watch # list"
+  - network: 10.10.0.0/24
+    label: equator
+    latitude: 0
+    longitude: 6.73
+`
+
+func TestParseOverlayYAML(t *testing.T) {
+	overlays, err := geoip.ParseOverlayYAML(strings.NewReader(overlayYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overlays) != 5 {
+		t.Fatalf("got %d overlays", len(overlays))
+	}
+	want := geoip.Overlay{Network: "10.8.0.0/16", Label: "vpn", GeonameID: 2925533, CityName: "Frankfurt HQ",
+		Organization: geoip.Organization{AutonomousSystemNumber: 64512, AutonomousSystemOrganization: "Corp's VPN"}}
+	if !reflect.DeepEqual(overlays[0], want) {
+		t.Errorf("got %+v", overlays[0])
+	}
+	if !overlays[1].IsInEuropeanUnion || overlays[2].Network != "8.8.8.0/24" || overlays[3].Label != "watch # list" {
+		t.Errorf("unexpected overlays %+v", overlays[1:])
+	}
+	// 赤道上的坐标同样是设置了经纬度
+	if !overlays[1].HasCoordinates() || overlays[2].HasCoordinates() || !overlays[4].HasCoordinates() ||
+		!overlays[4].HasLocation() {
+		t.Errorf("unexpected coordinates %+v", overlays)
+	}
+
+	for _, invalid := range []string{"- network: 10.0.0.0/8\n  planet: mars\n", "network: 10.0.0.0/8\n",
+		"- label: no network\n", "- network: 10.0.0.0/33\n", "- network: 10.0.0.0/8\n  eu: maybe\n"} {
+		if _, err := geoip.ParseOverlayYAML(strings.NewReader(invalid)); err == nil {
+			t.Errorf("%q should fail", invalid)
+		}
+	}
+}
+
+func TestParseOverlayCSV(t *testing.T) {
+	overlays, err := geoip.ParseOverlayCSV(strings.NewReader("network,label,country,asn\n" +
+		"# comment\n" +
+		"10.8.0.0/16,vpn,DE,64512\n" +
+		"192.0.2.7,host,,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overlays) != 2 || overlays[0].CountryISOCode != "DE" || overlays[0].AutonomousSystemNumber != 64512 ||
+		overlays[1].Network != "192.0.2.7/32" {
+		t.Errorf("unexpected overlays %+v", overlays)
+	}
+
+	if _, err := geoip.ParseOverlayCSV(strings.NewReader("network,asn\n10.0.0.0/8,AS1\n")); err == nil ||
+		!strings.Contains(err.Error(), "第 2 行") {
+		t.Errorf("want line number in error, got %v", err)
+	}
+}
+
+func TestGeolite2_Overlay(t *testing.T) {
+	dataset := geoiptest.Default()
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "geoip2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	editions, err := dataset.WriteCSV(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := geoip.NewGeoLite2Loader(db)
+	loader.SetIPVersions(geoip.IPv4AndIPv6)
+	if err := loader.Local(editions.ASN, editions.City, editions.Country); err != nil {
+		t.Fatal(err)
+	}
+
+	// 加载覆盖地址段前创建的 Geolite2 在加载后同样使用覆盖地址段
+	geo := geoip.NewGeolite2(db)
+	if overlays, err := geo.Overlays(); err != nil || overlays != nil {
+		t.Fatalf("unexpected overlays %+v %v", overlays, err)
+	}
+	path := filepath.Join(dir, "overlay.yaml")
+	if err := os.WriteFile(path, []byte(overlayYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := geoip.NewOverlayLoader(db).LoadFile(path); err != nil || n != 5 {
+		t.Fatalf("loaded %d overlays: %v", n, err)
+	}
+	// 重新加载 GeoLite2 数据不影响覆盖地址段
+	if err := loader.Local(editions.ASN, editions.City, editions.Country); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := geoiptest.NewFake(dataset)
+	overlays, err := geo.Overlays()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.SetOverlays(overlays)
+
+	vpn := net.ParseIP("10.8.1.1")
+	city, err := geo.CityBlock(vpn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location := city.Location(); location.CityName != "Frankfurt HQ" || location.CountryISOCode != "DE" ||
+		location.IsInEuropeanUnion != "1" || city.Network != "10.8.0.0/16" {
+		t.Errorf("unexpected vpn block %+v %+v", city, location)
+	}
+	if asn, err := geo.AsnBlock(vpn); err != nil || asn.AutonomousSystemNumber != 64512 {
+		t.Errorf("unexpected vpn asn %+v %v", asn, err)
+	}
+
+	country, err := geo.CountryBlock(net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if country.Location().CountryISOCode != "NL" || country.Location().IsInEuropeanUnion != "1" {
+		t.Errorf("unexpected country %+v", country.Location())
+	}
+	if asn, err := geo.AsnBlock(net.ParseIP("8.8.8.8")); err != nil || asn.AutonomousSystemNumber != 15169 {
+		t.Errorf("overlay without asn should keep GeoLite2 asn, got %+v %v", asn, err)
+	}
+	if overlay, err := geo.Overlay(net.ParseIP("8.8.8.200")); err != nil || overlay.Label != "google" {
+		t.Errorf("unexpected overlay %+v %v", overlay, err)
+	}
+	if city, err := geo.CityBlock(net.ParseIP("14.0.200.1")); err != nil || city.Location().CityName != "Beijing" {
+		t.Errorf("label-only overlay should keep GeoLite2 data, got %+v %v", city, err)
+	}
+	if city, err := geo.CityBlock(net.ParseIP("10.10.0.1")); err != nil || !city.HasCoordinates() ||
+		city.Latitude != 0 || city.Longitude != 6.73 {
+		t.Errorf("overlay on the equator should keep its coordinates, got %+v %v", city, err)
+	}
+	if city.HasCoordinates() {
+		t.Errorf("overlay without coordinates should not report (0, 0), got %+v", city)
+	}
+	if _, err := geo.Overlay(net.ParseIP("1.0.0.1")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("want sql.ErrNoRows, got %v", err)
+	}
+	if _, err := geo.CityBlock(net.ParseIP("10.9.0.1")); !errors.Is(err, geoip.ErrReserved) {
+		t.Errorf("private address outside overlays should stay reserved, got %v", err)
+	}
+
+	ips := []net.IP{vpn, net.ParseIP("8.8.8.8"), net.ParseIP("8.8.8.200"), net.ParseIP("14.0.200.1"),
+		net.ParseIP("10.9.0.1"), net.ParseIP("5.0.0.1"), net.ParseIP("10.10.0.1")}
+	results, err := geo.LookupMany(ips, geoip.LookupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := fake.LookupMany(ips, geoip.LookupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("sqlite %+v\nfake %+v", results, want)
+	}
+	if results[0].Err != nil || results[0].Overlay.Label != "vpn" || results[4].Err == nil {
+		t.Errorf("unexpected results %+v", results)
+	}
+	for i, ip := range ips {
+		city, err := geo.CityBlock(ip)
+		if err == nil && !reflect.DeepEqual(city, results[i].City) {
+			t.Errorf("%s: CityBlock %+v, LookupMany %+v", ip, city, results[i].City)
+		}
+	}
+}
+
+func TestGeoLite2Loader_UpdateKeepsOverlays(t *testing.T) {
+	server, err := geoiptest.NewServer(geoiptest.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "geoip2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	loader := geoip.NewGeoLite2Loader(db)
+	loader.SetIPVersions(geoip.IPv4AndIPv6)
+	loader.SetDownloadURL(server.DownloadURL())
+	loader.SetDownloadDir(dir)
+	if err := loader.Update(); err != nil {
+		t.Fatal(err)
+	}
+	overlays, err := geoip.ParseOverlayYAML(strings.NewReader(overlayYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := geoip.NewOverlayLoader(db).Load(overlays); err != nil {
+		t.Fatal(err)
+	}
+
+	// 完整重新加载经暂存表替换正式表，覆盖地址段仍优先于 GeoLite2 数据
+	geo := geoip.NewGeolite2(db)
+	if err := loader.Update(); err != nil {
+		t.Fatal(err)
+	}
+	var staging int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name LIKE 'staging\_%' ESCAPE '\'`).
+		Scan(&staging); err != nil || staging != 0 {
+		t.Errorf("expected staging tables to be swapped, got %d %v", staging, err)
+	}
+	dns := net.ParseIP("8.8.8.1")
+	city, err := geo.CityBlock(dns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if city.Location().CountryISOCode != "NL" || city.Network != "8.8.8.0/25" {
+		t.Errorf("unexpected city block %+v %+v", city, city.Location())
+	}
+	results, err := geo.LookupMany([]net.IP{dns}, geoip.LookupOptions{Fields: geoip.LookupCity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].City == nil || results[0].City.Location().CountryISOCode != "NL" {
+		t.Errorf("unexpected lookup result %+v", results[0])
+	}
+}
@@ -0,0 +1,59 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+	"strconv"
+)
+
+// IPv6IDOffset 多地址段查询同时返回 IPv4 与 IPv6 地址段，IPv6 地址段的 ID 为其在表中的 ID 加上该偏移，
+// 因此 ID 互不重复，按 ID 排序即为先 IPv4 后 IPv6
+const IPv6IDOffset int64 = 1 << 32
+
+// Page 分页参数，零值表示返回全部记录
+type Page struct {
+	// After 游标，只返回游标之后的记录。取上一页最后一条记录的 ID，Organizations 为 ASN 编号；
+	// BlocksByFilter 不使用该字段，见 AfterIP
+	After int64 `json:"after"`
+	// AfterIP BlocksByFilter 的游标，只返回起始地址大于 AfterIP 的记录，IPv4 排在 IPv6 之前。
+	// 取上一页最后一条记录的 StartIP
+	AfterIP net.IP `json:"after_ip,omitempty"`
+	// Offset 跳过的记录数
+	Offset int `json:"offset"`
+	// Limit 每页记录数，0 表示不限制
+	Limit int `json:"limit"`
+}
+
+// cursor 返回游标条件及追加后的参数，未设置游标时条件为空
+func (page Page) cursor(column string, args ...interface{}) (string, []interface{}) {
+	if page.After == 0 {
+		return "", args
+	}
+	return " AND " + column + " > ?", append(args, page.After)
+}
+
+// afterKey 返回 AfterIP 对应的 start_ip 比较值：IPv4 为整数，IPv6 为 16 字节 BLOB。
+// SQLite 中整数小于 BLOB，因此 IPv4 游标之后包含全部 IPv6 记录。未设置 AfterIP 时返回 nil，
+// 设置了 After 时返回错误，避免调用方误用 ID 游标
+func (page Page) afterKey() (interface{}, error) {
+	if page.After != 0 {
+		return nil, errors.New("BlocksByFilter 以 AfterIP 作为游标")
+	}
+	if page.AfterIP == nil {
+		return nil, nil
+	}
+	_, key, ok := overlayKey(page.AfterIP)
+	if !ok {
+		return nil, errors.New("无效的 IP 地址：" + page.AfterIP.String())
+	}
+	return key, nil
+}
+
+// limit 返回排序与分页子句及追加后的参数
+func (page Page) limit(column string, args ...interface{}) (string, []interface{}) {
+	limit := -1
+	if page.Limit > 0 {
+		limit = page.Limit
+	}
+	return " ORDER BY " + column + " LIMIT " + strconv.Itoa(limit) + " OFFSET ?", append(args, page.Offset)
+}
@@ -0,0 +1,90 @@
+package geoip_test
+
+import (
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"testing"
+)
+
+func TestGeolite2_RangePagination(t *testing.T) {
+	geo := newGeolite2(t, geoiptest.Default())
+
+	var page = geoip.Page{Limit: 3}
+	var starts []string
+	for {
+		var n int
+		if err := geo.RangeBlocksByFilter(geoip.NewFilter("en"), page, func(block geoip.CompositeBlock) bool {
+			starts = append(starts, block.StartIP.String())
+			page.AfterIP = block.StartIP
+			n++
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if n < page.Limit {
+			break
+		}
+	}
+	if len(starts) != 9 || starts[4] != "14.0.128.0" || starts[8] != "2003::" {
+		t.Errorf("unexpected pages %v", starts)
+	}
+
+	var orgs []geoip.Organization
+	if err := geo.RangeOrganizations(geoip.Page{After: 3320, Limit: 1}, func(org geoip.Organization) bool {
+		orgs = append(orgs, org)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(orgs) != 1 || orgs[0].AutonomousSystemNumber != 4134 {
+		t.Errorf("unexpected organizations %v", orgs)
+	}
+
+	var count int
+	if err := geo.RangeBlocksByAsnName("CHINANET-BACKBONE", geoip.Page{}, func(block geoip.ASNBlock) bool {
+		count++
+		return false
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected range to stop after first block, got %d", count)
+	}
+}
+
+func TestGeolite2_RangePaginationLongIPv6(t *testing.T) {
+	// 同一个 /64 中的两个 /96 地址段，游标须保留完整的起始地址才不会跳过第二个
+	dataset := geoiptest.Default()
+	dataset.ASNBlocks = append(dataset.ASNBlocks,
+		geoiptest.ASNBlock{Network: "2a00:1450::/96", Number: 3209, Organization: "Vodafone GmbH"},
+		geoiptest.ASNBlock{Network: "2a00:1450::1:0:0/96", Number: 3209, Organization: "Vodafone GmbH"})
+	dataset.CityBlocks = append(dataset.CityBlocks,
+		geoiptest.Block{Network: "2a00:1450::/96", GeonameID: 2921044, RegisteredCountryGeonameID: 2921044},
+		geoiptest.Block{Network: "2a00:1450::1:0:0/96", GeonameID: 2921044, RegisteredCountryGeonameID: 2921044})
+	geo := geoip.NewGeolite2(loadDataset(t, dataset))
+	fake := geoiptest.NewFake(dataset)
+
+	for _, g := range []geoip.Geoip2{geo, fake} {
+		var starts []string
+		for page := (geoip.Page{Limit: 1}); ; {
+			n := len(starts)
+			if err := g.RangeBlocksByFilter(geoip.NewFilter("en").Asn(3209), page, func(block geoip.CompositeBlock) bool {
+				starts = append(starts, block.StartIP.String())
+				page.AfterIP = block.StartIP
+				return true
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if len(starts) == n {
+				break
+			}
+		}
+		if len(starts) != 2 || starts[0] != "2a00:1450::" || starts[1] != "2a00:1450::1:0:0" {
+			t.Errorf("%T: unexpected pages %v", g, starts)
+		}
+		if err := g.RangeBlocksByFilter(geoip.NewFilter("en"), geoip.Page{After: 1},
+			func(geoip.CompositeBlock) bool { return true }); err == nil {
+			t.Errorf("%T: ID cursor should be rejected", g)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package geoip
+
+import "time"
+
+const (
+	StageDownload = "download"
+	StageLoad     = "load"
+)
+
+// Progress 下载及加载进度
+type Progress struct {
+	// Stage 当前阶段，StageDownload 或 StageLoad
+	Stage string `json:"stage"`
+	// Edition 下载阶段的版本，如 GeoLite2-City-CSV
+	Edition string `json:"edition,omitempty"`
+	// Table 加载阶段的数据表，如 GeoLite2CityBlocksIPv4
+	Table string `json:"table,omitempty"`
+	// File 加载阶段正在读取的 CSV 文件
+	File string `json:"file,omitempty"`
+	// Bytes 已下载或已解析的字节数
+	Bytes int64 `json:"bytes"`
+	// TotalBytes 文件总字节数，未知时为 0
+	TotalBytes int64 `json:"total_bytes"`
+	// Rows 加载阶段当前文件已写入数据库的行数
+	Rows int64 `json:"rows"`
+	// ETA 按当前速度估算的剩余时间，未知时为 0
+	ETA time.Duration `json:"eta"`
+	// Done 当前文件是否已完成
+	Done bool `json:"done"`
+}
+
+// ProgressFunc 进度回调，下载时可能被多个 goroutine 同时调用
+type ProgressFunc func(Progress)
+
+// ProgressChannel 将进度发送到 ch，ch 已满时丢弃该条进度，避免阻塞下载和加载
+func ProgressChannel(ch chan<- Progress) ProgressFunc {
+	return func(progress Progress) {
+		select {
+		case ch <- progress:
+		default:
+		}
+	}
+}
+
+// estimate 根据已用时间估算剩余时间
+func estimate(start time.Time, done, total int64) time.Duration {
+	if done <= 0 || total <= done {
+		return 0
+	}
+	elapsed := time.Since(start)
+	return time.Duration(float64(elapsed) * float64(total-done) / float64(done))
+}
@@ -0,0 +1,168 @@
+package geoip
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sort"
+)
+
+// earthRadius 地球平均半径，单位公里
+const earthRadius = 6371.0088
+
+// NearbyBlock 按经纬度查询到的城市地址段，Distance 为与查询点的距离，单位公里
+type NearbyBlock struct {
+	CityBlock CityBlock    `json:"city_block"`
+	Location  CityLocation `json:"location"`
+	Distance  float64      `json:"distance"`
+}
+
+// nearbyColumns nearbyQuery 除地址段 ID 以外的 SELECT 列
+const nearbyColumns = "c.network, CAST(c.geoname_id AS INTEGER), c.registered_country_geoname_id, c.represented_country_geoname_id, " +
+	"CAST(c.is_anonymous_proxy AS INTEGER), CAST(c.is_satellite_provider AS INTEGER), c.postal_code, " +
+	coordinateColumns + ", " +
+	"IFNULL(l.geoname_id, 0), IFNULL(l.locale_code, ''), IFNULL(l.continent_code, ''), IFNULL(l.continent_name, ''), " +
+	"IFNULL(l.country_iso_code, ''), IFNULL(l.country_name, ''), IFNULL(l.subdivision_1_iso_code, ''), " +
+	"IFNULL(l.subdivision_1_name, ''), IFNULL(l.subdivision_2_iso_code, ''), IFNULL(l.subdivision_2_name, ''), " +
+	"IFNULL(l.city_name, ''), IFNULL(l.metro_code, ''), IFNULL(l.time_zone, ''), IFNULL(l.is_in_european_union, ''), " +
+	countryColumns + " "
+
+// nearbyQuery 返回 version 的空间索引中经纬度在矩形范围内的城市地址段的查询
+func nearbyQuery(version string) string {
+	return "SELECT " + versionID("c.id", version) + ", " + nearbyColumns +
+		"FROM GeoLite2CityBlocks" + version + "Rtree r " +
+		"JOIN GeoLite2CityBlocks" + version + " c ON c.id = r.id " +
+		"LEFT JOIN GeoLite2CityLocations l ON c.geoname_id = l.geoname_id AND l.locale_code = ?" +
+		countryJoins("c", "?") + " " +
+		"WHERE r.min_latitude >= ? AND r.max_latitude <= ? AND r.min_longitude >= ? AND r.max_longitude <= ?"
+}
+
+// BlocksNear 查询距离经纬度 radius 公里以内的 IPv4 与 IPv6 城市地址段，按距离由近到远排序，距离相同时先 IPv4
+func (geo Geolite2) BlocksNear(language string, latitude, longitude, radius float64) ([]NearbyBlock, error) {
+	if radius <= 0 {
+		return nil, errors.New("查询半径必须大于 0")
+	}
+
+	minLatitude, minLongitude, maxLatitude, maxLongitude := boundingBox(latitude, longitude, radius)
+	blocks, err := geo.blocksInBox(language, minLatitude, minLongitude, maxLatitude, maxLongitude)
+	if err != nil {
+		return nil, err
+	}
+
+	var nearby []NearbyBlock
+	for _, block := range blocks {
+		block.Distance = Haversine(latitude, longitude, block.CityBlock.Latitude, block.CityBlock.Longitude)
+		if block.Distance <= radius {
+			nearby = append(nearby, block)
+		}
+	}
+	sort.SliceStable(nearby, func(i, j int) bool {
+		return nearby[i].Distance < nearby[j].Distance
+	})
+
+	return nearby, nil
+}
+
+// boundingBox 计算包含以经纬度为圆心、radius 公里为半径的圆的矩形范围
+func boundingBox(latitude, longitude, radius float64) (minLatitude, minLongitude, maxLatitude, maxLongitude float64) {
+	deltaLatitude := radius / earthRadius * 180 / math.Pi
+	minLatitude, maxLatitude = latitude-deltaLatitude, latitude+deltaLatitude
+	minLongitude, maxLongitude = -180.0, 180.0
+	// 查询范围未覆盖极点时按纬度换算经度范围，跨越 180 度经线时退化为全部经度
+	if ratio := math.Sin(radius/earthRadius) / math.Cos(latitude*math.Pi/180); minLatitude > -90 && maxLatitude < 90 && ratio < 1 {
+		deltaLongitude := math.Asin(ratio) * 180 / math.Pi
+		if longitude-deltaLongitude >= -180 && longitude+deltaLongitude <= 180 {
+			minLongitude, maxLongitude = longitude-deltaLongitude, longitude+deltaLongitude
+		}
+	}
+	return
+}
+
+// BlocksInBox 查询经纬度矩形范围内的城市地址段，先 IPv4 后 IPv6 按 ID 排序，Distance 为与矩形中心的距离
+func (geo Geolite2) BlocksInBox(language string, minLatitude, minLongitude, maxLatitude, maxLongitude float64) ([]NearbyBlock, error) {
+	if minLatitude > maxLatitude || minLongitude > maxLongitude {
+		return nil, errors.New("经纬度范围错误，最小值大于最大值")
+	}
+
+	blocks, err := geo.blocksInBox(language, minLatitude, minLongitude, maxLatitude, maxLongitude)
+	if err != nil {
+		return nil, err
+	}
+
+	latitude, longitude := (minLatitude+maxLatitude)/2, (minLongitude+maxLongitude)/2
+	for i := range blocks {
+		blocks[i].Distance = Haversine(latitude, longitude, blocks[i].CityBlock.Latitude, blocks[i].CityBlock.Longitude)
+	}
+
+	return blocks, nil
+}
+
+func (geo Geolite2) blocksInBox(language string, minLatitude, minLongitude, maxLatitude, maxLongitude float64) ([]NearbyBlock, error) {
+	query, args, err := geo.versionUnion([]string{"GeoLite2CityBlocks", "GeoLite2CityBlocks%sRtree"}, nearbyQuery,
+		language, language, language, minLatitude, maxLatitude, minLongitude, maxLongitude)
+	if err != nil || query == "" {
+		return nil, err
+	}
+	rows, err := geo.db.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []NearbyBlock
+
+	for rows.Next() {
+		var block NearbyBlock
+		var countries countryScan
+		if err := rows.Scan(append(append(append([]interface{}{&block.CityBlock.ID, &block.CityBlock.Network, &block.CityBlock.GeonameID,
+			&block.CityBlock.RegisteredCountryGeonameID, &block.CityBlock.RepresentedCountryGeonameID,
+			&block.CityBlock.IsAnonymousProxy, &block.CityBlock.IsSatelliteProvider, &block.CityBlock.PostalCode},
+			block.CityBlock.coordinateDest()...), &block.Location.GeonameID, &block.Location.LocaleCode, &block.Location.ContinentCode,
+			&block.Location.ContinentName, &block.Location.CountryISOCode, &block.Location.CountryName,
+			&block.Location.Subdivision1ISOCode, &block.Location.Subdivision1Name, &block.Location.Subdivision2ISOCode,
+			&block.Location.Subdivision2Name, &block.Location.CityName, &block.Location.MetroCode,
+			&block.Location.TimeZone, &block.Location.IsInEuropeanUnion), countries.dest()...)...); err != nil {
+			return nil, err
+		}
+		block.CityBlock.SetCountries(countries.countries())
+		blocks = append(blocks, block)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// Distance 计算两个IP所在位置之间的距离，单位公里，任一地址段没有经纬度时返回错误
+func (geo Geolite2) Distance(a, b net.IP) (float64, error) {
+	blockA, err := geo.CityBlock(a)
+	if err != nil {
+		return 0, err
+	}
+	blockB, err := geo.CityBlock(b)
+	if err != nil {
+		return 0, err
+	}
+	if !blockA.HasCoordinates() {
+		return 0, errors.New("地址段没有经纬度：" + a.String())
+	}
+	if !blockB.HasCoordinates() {
+		return 0, errors.New("地址段没有经纬度：" + b.String())
+	}
+
+	return Haversine(blockA.Latitude, blockA.Longitude, blockB.Latitude, blockB.Longitude), nil
+}
+
+// Haversine 计算两个经纬度之间的大圆距离，单位公里
+func Haversine(latitude1, longitude1, latitude2, longitude2 float64) float64 {
+	phi1, phi2 := latitude1*math.Pi/180, latitude2*math.Pi/180
+	deltaPhi := (latitude2 - latitude1) * math.Pi / 180
+	deltaLambda := (longitude2 - longitude1) * math.Pi / 180
+
+	h := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
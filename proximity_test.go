@@ -0,0 +1,79 @@
+package geoip_test
+
+import (
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"math"
+	"net"
+	"testing"
+)
+
+func TestHaversine(t *testing.T) {
+	// 法兰克福到柏林约 424 公里
+	if d := geoip.Haversine(50.1109, 8.6821, 52.5200, 13.4050); math.Abs(d-424) > 2 {
+		t.Errorf("unexpected distance %f", d)
+	}
+	if d := geoip.Haversine(10, 20, 10, 20); d != 0 {
+		t.Errorf("expected 0, got %f", d)
+	}
+}
+
+func TestGeolite2_BlocksNear(t *testing.T) {
+	geo := newGeolite2(t, geoiptest.Default())
+
+	blocks, err := geo.BlocksNear("en", 50.1109, 8.6821, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IPv6 地址段同样在空间索引中，距离相同时先 IPv4
+	if len(blocks) != 2 || blocks[0].Location.CityName != "Frankfurt am Main" || blocks[0].Distance > 5 ||
+		blocks[1].CityBlock.Network != "2003::/19" || blocks[1].CityBlock.ID != geoip.IPv6IDOffset+2 {
+		t.Errorf("unexpected blocks %+v", blocks)
+	}
+
+	blocks, err = geo.BlocksInBox("en", 20, 110, 45, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 {
+		t.Errorf("expected 2 blocks, got %d", len(blocks))
+	}
+
+	d, err := geo.Distance(net.ParseIP("14.0.0.1"), net.ParseIP("14.0.200.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d < 1800 || d > 2000 {
+		t.Errorf("unexpected distance between Guangzhou and Beijing %f", d)
+	}
+	// 匿名代理地址段没有经纬度，不能按 (0, 0) 计算
+	if d, err := geo.Distance(net.ParseIP("14.0.0.1"), net.ParseIP("185.220.100.7")); err == nil {
+		t.Errorf("block without coordinates should fail, got %f", d)
+	}
+	if _, err := geoiptest.NewFake(geoiptest.Default()).Distance(net.ParseIP("185.220.100.7"),
+		net.ParseIP("14.0.0.1")); err == nil {
+		t.Error("fake: block without coordinates should fail")
+	}
+}
+
+func TestGeolite2_ReverseGeocode(t *testing.T) {
+	geo := newGeolite2(t, geoiptest.Default())
+
+	// 深圳，最近的城市为广州
+	location, err := geo.ReverseGeocode("zh-CN", 22.5431, 114.0579)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Location.CityName != "Guangzhou" || location.Location.TimeZone != "Asia/Shanghai" ||
+		location.Location.LocaleCode != "zh-CN" {
+		t.Errorf("unexpected location %+v", location)
+	}
+	if location.Distance < 90 || location.Distance > 120 {
+		t.Errorf("unexpected distance %f", location.Distance)
+	}
+
+	// 南极附近也应该能找到最近的城市
+	if _, err := geo.ReverseGeocode("en", -89, 0); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,384 @@
+package geoip
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Filter ASN 与地域组合查询条件，通过链式调用组合，多个条件之间为 AND 关系，同一条件的多个取值之间为 OR 关系
+type Filter struct {
+	language          string
+	asnNumbers        []int64
+	organizations     []string
+	countryCodes      []string
+	registered        []string
+	represented       []string
+	continentCodes    []string
+	subdivisions      []string
+	cities            []string
+	europeanUnion     *bool
+	anonymousProxy    *bool
+	satelliteProvider *bool
+	accuracyRadius    int
+}
+
+// NewFilter 创建组合查询条件，language 为地域名称使用的语言，如 en、zh-CN
+func NewFilter(language string) *Filter {
+	return &Filter{language: language}
+}
+
+// Asn 按 ASN 编号过滤
+func (filter *Filter) Asn(numbers ...int64) *Filter {
+	filter.asnNumbers = append(filter.asnNumbers, numbers...)
+	return filter
+}
+
+// Organization 按 ASN 组织名称过滤
+func (filter *Filter) Organization(names ...string) *Filter {
+	filter.organizations = append(filter.organizations, names...)
+	return filter
+}
+
+// Country 按国家 ISO 编码过滤
+func (filter *Filter) Country(codes ...string) *Filter {
+	filter.countryCodes = append(filter.countryCodes, codes...)
+	return filter
+}
+
+// RegisteredCountry 按注册国家 ISO 编码过滤，见 CityBlock.RegisteredCountry
+func (filter *Filter) RegisteredCountry(codes ...string) *Filter {
+	filter.registered = append(filter.registered, codes...)
+	return filter
+}
+
+// RepresentedCountry 按代表国家 ISO 编码过滤，见 CityBlock.RepresentedCountry
+func (filter *Filter) RepresentedCountry(codes ...string) *Filter {
+	filter.represented = append(filter.represented, codes...)
+	return filter
+}
+
+// Continent 按洲编码过滤
+func (filter *Filter) Continent(codes ...string) *Filter {
+	filter.continentCodes = append(filter.continentCodes, codes...)
+	return filter
+}
+
+// Subdivision 按一级行政区过滤，可以是 ISO 编码（如 GD）或当前语言下的名称
+func (filter *Filter) Subdivision(subdivisions ...string) *Filter {
+	filter.subdivisions = append(filter.subdivisions, subdivisions...)
+	return filter
+}
+
+// City 按当前语言下的城市名称过滤
+func (filter *Filter) City(names ...string) *Filter {
+	filter.cities = append(filter.cities, names...)
+	return filter
+}
+
+// EuropeanUnion 按是否位于欧盟过滤
+func (filter *Filter) EuropeanUnion(in bool) *Filter {
+	filter.europeanUnion = &in
+	return filter
+}
+
+// AnonymousProxy 按是否为匿名代理过滤
+func (filter *Filter) AnonymousProxy(is bool) *Filter {
+	filter.anonymousProxy = &is
+	return filter
+}
+
+// SatelliteProvider 按是否为卫星网络提供商过滤
+func (filter *Filter) SatelliteProvider(is bool) *Filter {
+	filter.satelliteProvider = &is
+	return filter
+}
+
+// AccuracyRadius 只保留精度半径（公里）不大于 radius 的地址段
+func (filter *Filter) AccuracyRadius(radius int) *Filter {
+	filter.accuracyRadius = radius
+	return filter
+}
+
+// where 生成 WHERE 子句及其参数，没有任何条件时返回空字符串
+func (filter *Filter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	in := func(column string, n int) string {
+		return column + " IN (" + strings.TrimSuffix(strings.Repeat("?,", n), ",") + ")"
+	}
+
+	if len(filter.asnNumbers) > 0 {
+		conditions = append(conditions, in("a.autonomous_system_number", len(filter.asnNumbers)))
+		for _, number := range filter.asnNumbers {
+			args = append(args, number)
+		}
+	}
+	if len(filter.organizations) > 0 {
+		conditions = append(conditions, in("a.autonomous_system_organization", len(filter.organizations)))
+		for _, name := range filter.organizations {
+			args = append(args, name)
+		}
+	}
+	if len(filter.countryCodes) > 0 {
+		conditions = append(conditions, in("l.country_iso_code", len(filter.countryCodes)))
+		for _, code := range filter.countryCodes {
+			args = append(args, code)
+		}
+	}
+	if len(filter.registered) > 0 {
+		conditions = append(conditions, in("rc.country_iso_code", len(filter.registered)))
+		for _, code := range filter.registered {
+			args = append(args, code)
+		}
+	}
+	if len(filter.represented) > 0 {
+		conditions = append(conditions, in("pc.country_iso_code", len(filter.represented)))
+		for _, code := range filter.represented {
+			args = append(args, code)
+		}
+	}
+	if len(filter.continentCodes) > 0 {
+		conditions = append(conditions, in("l.continent_code", len(filter.continentCodes)))
+		for _, code := range filter.continentCodes {
+			args = append(args, code)
+		}
+	}
+	if len(filter.subdivisions) > 0 {
+		conditions = append(conditions, "("+in("l.subdivision_1_iso_code", len(filter.subdivisions))+
+			" OR "+in("l.subdivision_1_name", len(filter.subdivisions))+")")
+		for _, subdivision := range filter.subdivisions {
+			args = append(args, subdivision)
+		}
+		for _, subdivision := range filter.subdivisions {
+			args = append(args, subdivision)
+		}
+	}
+	if len(filter.cities) > 0 {
+		conditions = append(conditions, in("l.city_name", len(filter.cities)))
+		for _, name := range filter.cities {
+			args = append(args, name)
+		}
+	}
+	if filter.europeanUnion != nil {
+		conditions = append(conditions, "l.is_in_european_union=?")
+		args = append(args, boolFlag(*filter.europeanUnion))
+	}
+	if filter.anonymousProxy != nil {
+		conditions = append(conditions, "c.is_anonymous_proxy=?")
+		args = append(args, boolFlag(*filter.anonymousProxy))
+	}
+	if filter.satelliteProvider != nil {
+		conditions = append(conditions, "c.is_satellite_provider=?")
+		args = append(args, boolFlag(*filter.satelliteProvider))
+	}
+	if filter.accuracyRadius > 0 {
+		conditions = append(conditions, "CAST(c.accuracy_radius AS INTEGER) BETWEEN 1 AND ?")
+		args = append(args, filter.accuracyRadius)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Language 返回地域名称使用的语言
+func (filter *Filter) Language() string {
+	return filter.language
+}
+
+// Match 判断 block 是否满足全部条件，与数据库查询的语义一致，用于自定义 Geoip2 实现
+func (filter *Filter) Match(block CompositeBlock) bool {
+	if len(filter.asnNumbers) > 0 && !containsInt64(filter.asnNumbers, int64(block.ASNBlock.AutonomousSystemNumber)) {
+		return false
+	}
+	if len(filter.organizations) > 0 && !containsString(filter.organizations, block.ASNBlock.AutonomousSystemOrganization) {
+		return false
+	}
+	if len(filter.countryCodes) > 0 && !containsString(filter.countryCodes, block.Location.CountryISOCode) {
+		return false
+	}
+	if len(filter.registered) > 0 && !matchCountry(filter.registered, block.CityBlock.RegisteredCountry()) {
+		return false
+	}
+	if len(filter.represented) > 0 && !matchCountry(filter.represented, block.CityBlock.RepresentedCountry()) {
+		return false
+	}
+	if len(filter.continentCodes) > 0 && !containsString(filter.continentCodes, block.Location.ContinentCode) {
+		return false
+	}
+	if len(filter.subdivisions) > 0 && !containsString(filter.subdivisions, block.Location.Subdivision1ISOCode) &&
+		!containsString(filter.subdivisions, block.Location.Subdivision1Name) {
+		return false
+	}
+	if len(filter.cities) > 0 && !containsString(filter.cities, block.Location.CityName) {
+		return false
+	}
+	if filter.europeanUnion != nil && block.Location.IsInEuropeanUnion != boolFlag(*filter.europeanUnion) {
+		return false
+	}
+	if filter.anonymousProxy != nil && strconv.Itoa(block.CityBlock.IsAnonymousProxy) != boolFlag(*filter.anonymousProxy) {
+		return false
+	}
+	if filter.satelliteProvider != nil && strconv.Itoa(block.CityBlock.IsSatelliteProvider) != boolFlag(*filter.satelliteProvider) {
+		return false
+	}
+	if filter.accuracyRadius > 0 && (block.CityBlock.AccuracyRadius < 1 || block.CityBlock.AccuracyRadius > filter.accuracyRadius) {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCountry(codes []string, country *Country) bool {
+	return country != nil && containsString(codes, country.CountryISOCode)
+}
+
+func containsInt64(values []int64, value int64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// boolFlag GeoLite2 CSV 中布尔值以 0/1 存储
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// CompositeBlock ASN 地址段与城市地址段的交叠部分，同时携带 ASN 与地域信息
+type CompositeBlock struct {
+	StartIP   net.IP       `json:"start_ip"`
+	EndIP     net.IP       `json:"end_ip"`
+	ASNBlock  ASNBlock     `json:"asn_block"`
+	CityBlock CityBlock    `json:"city_block"`
+	Location  CityLocation `json:"location"`
+}
+
+// keyIP 将地址段表中的地址转换为 IP，IPv4 为整数，IPv6 为 16 字节 BLOB
+func keyIP(key interface{}) net.IP {
+	if key, ok := key.([]byte); ok {
+		return net.IP(key)
+	}
+	return Int2IP(uint32(key.(int64)))
+}
+
+// compositeColumns compositeQuery 的 SELECT 列，start_ip、end_ip 为交叠部分的起止地址
+const compositeColumns = "SELECT MAX(a.start_ip, c.start_ip) AS start_ip, MIN(a.end_ip, c.end_ip) AS end_ip, " +
+	"a.id, a.network, a.autonomous_system_number, a.autonomous_system_organization, " +
+	"c.id, c.network, CAST(c.geoname_id AS INTEGER), c.registered_country_geoname_id, c.represented_country_geoname_id, " +
+	"CAST(c.is_anonymous_proxy AS INTEGER), CAST(c.is_satellite_provider AS INTEGER), c.postal_code, " +
+	coordinateColumns + ", " +
+	"IFNULL(l.geoname_id, 0), IFNULL(l.locale_code, ''), IFNULL(l.continent_code, ''), IFNULL(l.continent_name, ''), " +
+	"IFNULL(l.country_iso_code, ''), IFNULL(l.country_name, ''), IFNULL(l.subdivision_1_iso_code, ''), " +
+	"IFNULL(l.subdivision_1_name, ''), IFNULL(l.subdivision_2_iso_code, ''), IFNULL(l.subdivision_2_name, ''), " +
+	"IFNULL(l.city_name, ''), IFNULL(l.metro_code, ''), IFNULL(l.time_zone, ''), IFNULL(l.is_in_european_union, ''), " +
+	countryColumns + " "
+
+// overlapJoin 返回 table（别名 alias）中与 outer 地址段交叠的地址段的关联条件。同一张表的地址段互不重叠，
+// 交叠的地址段从包含 outer.start_ip 的地址段开始、起始地址不超过 outer.end_ip，
+// 因此以 start_ip 索引的范围查找关联，而不是逐行比较
+func overlapJoin(table, alias, outer string) string {
+	return alias + ".start_ip BETWEEN IFNULL((SELECT MAX(start_ip) FROM " + table + " WHERE start_ip <= " +
+		outer + ".start_ip), " + outer + ".start_ip) AND " + outer + ".end_ip AND " + alias + ".end_ip >= " + outer + ".start_ip"
+}
+
+// overlapQuery 在 query 后加上 table 中与 [first, last] 交叠的地址段的条件，按起始地址排序，
+// 参数依次为 first、first、last、first。与 overlapJoin 相同，以 start_ip 索引从包含 first 的地址段查找到 last
+func overlapQuery(table, query string) string {
+	return query + " WHERE start_ip BETWEEN IFNULL((SELECT MAX(start_ip) FROM " + table +
+		" WHERE start_ip <= ?), ?) AND ? AND end_ip >= ? ORDER BY start_ip"
+}
+
+// compositeQuery 返回 version 的 ASN 与城市地址段的交叠查询
+func compositeQuery(version string) string {
+	return compositeColumns + "FROM GeoLite2ASNBlocks" + version + " a " +
+		"JOIN GeoLite2CityBlocks" + version + " c ON " + overlapJoin("GeoLite2CityBlocks"+version, "c", "a") +
+		" LEFT JOIN GeoLite2CityLocations l ON c.geoname_id = l.geoname_id AND l.locale_code = ?"
+}
+
+// BlocksByFilter 按 ASN 与地域组合条件查询，ASN 与城市地址段按范围交叠关联，返回 CompositeBlock 数组
+func (geo Geolite2) BlocksByFilter(filter *Filter) ([]CompositeBlock, error) {
+	var blocks []CompositeBlock
+	if err := geo.RangeBlocksByFilter(filter, Page{}, func(block CompositeBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// RangeBlocksByFilter 按组合条件逐条回调查询结果，先 IPv4 后 IPv6 按起始地址排序，fn 返回 false 时停止。
+// 交叠部分的起始地址可以是任意 IPv6 地址，因此游标为 Page.AfterIP 而不是 Page.After
+func (geo Geolite2) RangeBlocksByFilter(filter *Filter, page Page, fn func(CompositeBlock) bool) error {
+	after, err := page.afterKey()
+	if err != nil {
+		return err
+	}
+	where, args := filter.where()
+	if where == "" {
+		where = " WHERE 1=1"
+	}
+	query, args, err := geo.versionUnion([]string{"GeoLite2ASNBlocks", "GeoLite2CityBlocks"}, func(version string) string {
+		return compositeQuery(version) + countryJoins("c", "?") + where
+	}, append([]interface{}{filter.language, filter.language, filter.language}, args...)...)
+	if err != nil || query == "" {
+		return err
+	}
+	if after != nil {
+		query += " AND start_ip > ?"
+		args = append(args, after)
+	}
+	limit, args := page.limit("start_ip", args...)
+	rows, err := geo.db.Query(query+limit, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var block CompositeBlock
+		var start, end interface{}
+		var countries countryScan
+		if err := rows.Scan(append(append(append([]interface{}{&start, &end, &block.ASNBlock.ID, &block.ASNBlock.Network, &block.ASNBlock.AutonomousSystemNumber,
+			&block.ASNBlock.AutonomousSystemOrganization, &block.CityBlock.ID, &block.CityBlock.Network, &block.CityBlock.GeonameID,
+			&block.CityBlock.RegisteredCountryGeonameID, &block.CityBlock.RepresentedCountryGeonameID,
+			&block.CityBlock.IsAnonymousProxy, &block.CityBlock.IsSatelliteProvider, &block.CityBlock.PostalCode},
+			block.CityBlock.coordinateDest()...), &block.Location.GeonameID, &block.Location.LocaleCode, &block.Location.ContinentCode,
+			&block.Location.ContinentName, &block.Location.CountryISOCode, &block.Location.CountryName,
+			&block.Location.Subdivision1ISOCode, &block.Location.Subdivision1Name, &block.Location.Subdivision2ISOCode,
+			&block.Location.Subdivision2Name, &block.Location.CityName, &block.Location.MetroCode,
+			&block.Location.TimeZone, &block.Location.IsInEuropeanUnion), countries.dest()...)...); err != nil {
+			return err
+		}
+		block.CityBlock.SetCountries(countries.countries())
+		block.StartIP = keyIP(start)
+		block.EndIP = keyIP(end)
+		if _, ok := start.([]byte); ok {
+			block.ASNBlock.ID += IPv6IDOffset
+			block.CityBlock.ID += IPv6IDOffset
+		}
+		if !fn(block) {
+			break
+		}
+	}
+
+	return rows.Err()
+}
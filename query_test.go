@@ -0,0 +1,55 @@
+package geoip_test
+
+import (
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"strings"
+	"testing"
+)
+
+func TestGeolite2_BlocksByFilter(t *testing.T) {
+	geo := newGeolite2(t, geoiptest.Default())
+
+	blocks, err := geo.BlocksByFilter(geoip.NewFilter("en").Asn(4134).Subdivision("Guangdong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("expected 1 block, got %d", len(blocks))
+	}
+	block := blocks[0]
+	if block.StartIP.String() != "14.0.0.0" || block.EndIP.String() != "14.0.127.255" {
+		t.Errorf("unexpected range %s-%s", block.StartIP, block.EndIP)
+	}
+	if block.ASNBlock.AutonomousSystemOrganization != "CHINANET-BACKBONE" || block.Location.CityName != "Guangzhou" {
+		t.Errorf("unexpected block %+v", block)
+	}
+
+	blocks, err = geo.BlocksByFilter(geoip.NewFilter("en").EuropeanUnion(true).AccuracyRadius(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IPv4 与 IPv6 地址段各一个，IPv6 在后
+	if len(blocks) != 2 || blocks[0].Location.CountryISOCode != "DE" || blocks[1].Location.CountryISOCode != "DE" ||
+		blocks[1].StartIP.To4() != nil {
+		t.Errorf("unexpected blocks %+v", blocks)
+	}
+
+	blocks, err = geo.BlocksByFilter(geoip.NewFilter("en").Continent("AS").AnonymousProxy(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 0 {
+		t.Errorf("expected no blocks, got %d", len(blocks))
+	}
+}
+
+func TestGeolite2_BlocksByFilterQueryPlan(t *testing.T) {
+	db := loadDataset(t, geoiptest.Default())
+
+	// ASN 与城市地址段按 start_ip 索引范围关联，不是逐行比较的笛卡尔积
+	if plan := geoip.QueryPlan(t, db, geoip.CompositeQuery("IPv4")+geoip.CountryJoins("c", "?"), "en", "en",
+		"en"); !strings.Contains(plan, "SEARCH c USING INDEX GeoLite2CityBlocksIPv4Start (start_ip>? AND start_ip<?)") {
+		t.Errorf("composite query should use the start_ip index: %s", plan)
+	}
+}
@@ -0,0 +1,243 @@
+// Package report 统计 IP 列表或访问日志的地域分布，按国家、ASN、组织、欧盟及匿名代理汇总，
+// 输出为文本、JSON、CSV 或独立的 HTML 报告
+package report
+
+import (
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/enrich"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// 汇总表名称
+const (
+	TableCountries     = "countries"
+	TableASNs          = "asns"
+	TableOrganizations = "organizations"
+	TableEU            = "eu"
+	TableAnonymous     = "anonymous"
+)
+
+// 汇总表中的特殊行
+const (
+	KeyUnknown  = "unknown"
+	KeyReserved = "reserved"
+	KeyOther    = "other"
+)
+
+// Row 汇总表中的一行，Share 为请求数占全部请求的比例
+type Row struct {
+	Key       string  `json:"key"`
+	Name      string  `json:"name"`
+	Requests  int64   `json:"requests"`
+	UniqueIPs int64   `json:"unique_ips"`
+	Share     float64 `json:"share"`
+}
+
+// Table 汇总表，各行请求数之和等于全部请求数
+type Table struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Rows  []Row  `json:"rows"`
+}
+
+// Report 统计报告
+type Report struct {
+	// Requests 解析出 IP 的请求数
+	Requests  int64 `json:"requests"`
+	UniqueIPs int64 `json:"unique_ips"`
+	// Unparsed 未能解析出 IP 的行数，不计入各汇总表
+	Unparsed int64   `json:"unparsed"`
+	Tables   []Table `json:"tables"`
+}
+
+// Table 返回名称为 name 的汇总表，不存在时返回 nil
+func (report *Report) Table(name string) *Table {
+	for i := range report.Tables {
+		if report.Tables[i].Name == name {
+			return &report.Tables[i]
+		}
+	}
+	return nil
+}
+
+// Options 统计选项
+type Options struct {
+	// Format 与 IPField 为日志格式及 IP 所在字段，见 enrich.Scan，IP 列表使用 enrich.Combined
+	Format  enrich.Format
+	IPField string
+	// Top 国家、ASN 及组织表保留的行数，其余合并为 other，默认为 10
+	Top int
+	// Language 国家名称使用的语言，为空时使用数据库中的第一个语言
+	Language string
+	// Workers 查询的并行数，见 geoip.LookupOptions
+	Workers int
+}
+
+// Counter 按 IP 累计请求数，相同的 IP 只查询一次
+type Counter struct {
+	requests map[string]int64
+	unparsed int64
+}
+
+func NewCounter() *Counter {
+	return &Counter{requests: make(map[string]int64)}
+}
+
+// Add 累计一次请求，ip 为 nil 或无效时计为未解析
+func (counter *Counter) Add(ip net.IP) {
+	if ip = ip.To16(); ip == nil {
+		counter.unparsed++
+		return
+	}
+	counter.requests[string(ip)]++
+}
+
+// Build 读取日志并统计
+func Build(geo geoip.Geoip2, r io.Reader, options Options) (*Report, error) {
+	counter := NewCounter()
+	if err := enrich.Scan(r, options.Format, options.IPField, counter.Add); err != nil {
+		return nil, err
+	}
+	return counter.Report(geo, options)
+}
+
+// tally 按 key 累计请求数及独立 IP 数
+type tally struct {
+	rows  map[string]*Row
+	order []string
+}
+
+// newTally 创建 tally，keys 为预先列出的 key 及名称，没有请求时同样出现在汇总表中
+func newTally(keys ...[2]string) *tally {
+	t := &tally{rows: make(map[string]*Row)}
+	for _, key := range keys {
+		t.row(key[0], key[1])
+	}
+	return t
+}
+
+func (t *tally) row(key, name string) *Row {
+	row, ok := t.rows[key]
+	if !ok {
+		row = &Row{Key: key, Name: name}
+		t.rows[key] = row
+		t.order = append(t.order, key)
+	}
+	return row
+}
+
+func (t *tally) add(key, name string, requests int64) {
+	row := t.row(key, name)
+	row.Requests += requests
+	row.UniqueIPs++
+}
+
+// table 返回汇总表，top 大于 0 时按请求数排序并将 top 之后的行合并为 other
+func (t *tally) table(name, title string, total int64, top int) Table {
+	rows := make([]Row, 0, len(t.order))
+	for _, key := range t.order {
+		rows = append(rows, *t.rows[key])
+	}
+	if top > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			if rows[i].Requests != rows[j].Requests {
+				return rows[i].Requests > rows[j].Requests
+			}
+			return rows[i].Key < rows[j].Key
+		})
+		if len(rows) > top {
+			other := Row{Key: KeyOther, Name: "其他"}
+			for _, row := range rows[top:] {
+				other.Requests += row.Requests
+				other.UniqueIPs += row.UniqueIPs
+			}
+			rows = append(rows[:top], other)
+		}
+	}
+	for i := range rows {
+		if total > 0 {
+			rows[i].Share = float64(rows[i].Requests) / float64(total)
+		}
+	}
+	return Table{Name: name, Title: title, Rows: rows}
+}
+
+// Report 查询累计的 IP 并生成报告
+func (counter *Counter) Report(geo geoip.Geoip2, options Options) (*Report, error) {
+	if options.Top < 1 {
+		options.Top = 10
+	}
+
+	ips := make([]net.IP, 0, len(counter.requests))
+	for ip := range counter.requests {
+		ips = append(ips, net.IP(ip))
+	}
+	results, err := geo.LookupMany(ips, geoip.LookupOptions{Fields: geoip.LookupASN | geoip.LookupCountry,
+		Language: options.Language, Workers: options.Workers})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{UniqueIPs: int64(len(ips)), Unparsed: counter.unparsed}
+	countries, asns, organizations := newTally(), newTally(), newTally()
+	eu := newTally([2]string{"eu", "欧盟"}, [2]string{"non_eu", "非欧盟"}, [2]string{KeyUnknown, "未知"})
+	anonymous := newTally([2]string{"anonymous_proxy", "匿名代理"}, [2]string{"satellite_provider", "卫星网络"},
+		[2]string{"none", "非代理"})
+
+	for _, result := range results {
+		requests := counter.requests[string(result.IP)]
+		report.Requests += requests
+
+		if result.Err != nil {
+			var reserved *geoip.ReservedError
+			if !errors.As(result.Err, &reserved) {
+				return nil, result.Err
+			}
+			countries.add(KeyReserved, "特殊用途地址", requests)
+		} else if result.Country != nil && result.Country.Location() != nil {
+			location := result.Country.Location()
+			countries.add(location.CountryISOCode, location.CountryName, requests)
+		} else {
+			countries.add(KeyUnknown, "未知", requests)
+		}
+
+		if result.ASN != nil {
+			asns.add(strconv.Itoa(result.ASN.AutonomousSystemNumber), result.ASN.AutonomousSystemOrganization, requests)
+			organizations.add(result.ASN.AutonomousSystemOrganization, result.ASN.AutonomousSystemOrganization, requests)
+		} else {
+			asns.add(KeyUnknown, "未知", requests)
+			organizations.add(KeyUnknown, "未知", requests)
+		}
+
+		switch {
+		case result.Country == nil || result.Country.Location() == nil:
+			eu.add(KeyUnknown, "未知", requests)
+		case result.Country.Location().IsInEuropeanUnion == "1":
+			eu.add("eu", "欧盟", requests)
+		default:
+			eu.add("non_eu", "非欧盟", requests)
+		}
+
+		switch {
+		case result.Country != nil && result.Country.IsAnonymousProxy == "1":
+			anonymous.add("anonymous_proxy", "匿名代理", requests)
+		case result.Country != nil && result.Country.IsSatelliteProvider == "1":
+			anonymous.add("satellite_provider", "卫星网络", requests)
+		default:
+			anonymous.add("none", "非代理", requests)
+		}
+	}
+
+	report.Tables = []Table{
+		countries.table(TableCountries, "国家", report.Requests, options.Top),
+		asns.table(TableASNs, "ASN", report.Requests, options.Top),
+		organizations.table(TableOrganizations, "组织", report.Requests, options.Top),
+		eu.table(TableEU, "欧盟", report.Requests, 0),
+		anonymous.table(TableAnonymous, "匿名代理", report.Requests, 0),
+	}
+	return report, nil
+}
@@ -0,0 +1,113 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sechelper/geoip2/enrich"
+	"github.com/sechelper/geoip2/geoiptest"
+	"github.com/sechelper/geoip2/report"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const ips = `8.8.8.8
+8.8.8.8
+8.8.8.9
+5.0.1.2
+2003::1
+185.220.100.7
+10.0.0.1
+9.9.9.9
+not-an-ip
+`
+
+func build(t *testing.T) *report.Report {
+	t.Helper()
+	r, err := report.Build(geoiptest.NewFake(geoiptest.Default()), strings.NewReader(ips),
+		report.Options{Format: enrich.Combined, Top: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestBuild(t *testing.T) {
+	r := build(t)
+	if r.Requests != 8 || r.UniqueIPs != 7 || r.Unparsed != 1 {
+		t.Errorf("unexpected summary %+v", r)
+	}
+
+	countries := r.Table(report.TableCountries)
+	want := []report.Row{
+		{Key: "US", Name: "United States", Requests: 3, UniqueIPs: 2, Share: 3.0 / 8},
+		{Key: "DE", Name: "Germany", Requests: 2, UniqueIPs: 2, Share: 2.0 / 8},
+		{Key: report.KeyOther, Name: "其他", Requests: 3, UniqueIPs: 3, Share: 3.0 / 8},
+	}
+	if !reflect.DeepEqual(countries.Rows, want) {
+		t.Errorf("unexpected countries %+v", countries.Rows)
+	}
+
+	asns := r.Table(report.TableASNs)
+	if asns.Rows[0].Key != "15169" || asns.Rows[0].Requests != 3 {
+		t.Errorf("unexpected asns %+v", asns.Rows)
+	}
+
+	eu := r.Table(report.TableEU)
+	if eu.Rows[0].Key != "eu" || eu.Rows[0].Requests != 2 || eu.Rows[1].Requests != 3 {
+		t.Errorf("unexpected eu %+v", eu.Rows)
+	}
+
+	anonymous := r.Table(report.TableAnonymous)
+	if anonymous.Rows[0].Requests != 1 || anonymous.Rows[1].Requests != 0 || anonymous.Rows[2].Requests != 7 {
+		t.Errorf("unexpected anonymous %+v", anonymous.Rows)
+	}
+
+	for _, table := range r.Tables {
+		var requests int64
+		for _, row := range table.Rows {
+			requests += row.Requests
+		}
+		if requests != r.Requests {
+			t.Errorf("%s: rows sum to %d, want %d", table.Name, requests, r.Requests)
+		}
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	r := build(t)
+
+	for _, output := range []report.Output{report.Text, report.JSON, report.CSV, report.HTML} {
+		buf := new(bytes.Buffer)
+		if err := r.Write(buf, output); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "United States") {
+			t.Errorf("%s output misses country name:\n%s", output, buf)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := r.Write(buf, report.JSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded report.Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, r) {
+		t.Errorf("json round trip mismatch: %+v", decoded)
+	}
+
+	buf.Reset()
+	if err := r.Write(buf, report.HTML); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `style="width: 37.50%"`) {
+		t.Errorf("html output misses bar width:\n%s", buf)
+	}
+
+	if _, err := report.ParseOutput("pdf"); err == nil {
+		t.Error("unsupported output should fail")
+	}
+}
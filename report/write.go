@@ -0,0 +1,129 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output 报告的输出格式
+type Output string
+
+const (
+	Text Output = "text"
+	JSON Output = "json"
+	CSV  Output = "csv"
+	// HTML 不依赖外部资源的单个 HTML 文件
+	HTML Output = "html"
+)
+
+// ParseOutput 解析输出格式名称
+func ParseOutput(name string) (Output, error) {
+	switch output := Output(strings.ToLower(name)); output {
+	case Text, JSON, CSV, HTML:
+		return output, nil
+	}
+	return "", errors.New("不支持的输出格式：" + name)
+}
+
+// Write 将报告按 output 格式写入 w
+func (report *Report) Write(w io.Writer, output Output) error {
+	switch output {
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case CSV:
+		return report.writeCSV(w)
+	case HTML:
+		return htmlTemplate.Execute(w, report)
+	case Text, "":
+		return report.writeText(w)
+	}
+	return errors.New("不支持的输出格式：" + string(output))
+}
+
+func percent(share float64) string {
+	return strconv.FormatFloat(share*100, 'f', 2, 64) + "%"
+}
+
+func (report *Report) writeText(w io.Writer) error {
+	writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(writer, "请求数\t%d\t\n独立 IP\t%d\t\n未解析\t%d\t\n", report.Requests, report.UniqueIPs, report.Unparsed)
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	for _, table := range report.Tables {
+		fmt.Fprintf(w, "\n%s\n", table.Title)
+		writer := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "  key\tname\trequests\tshare\tunique_ips\t")
+		for _, row := range table.Rows {
+			fmt.Fprintf(writer, "  %s\t%s\t%d\t%s\t%d\t\n", row.Key, row.Name, row.Requests, percent(row.Share),
+				row.UniqueIPs)
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV 所有汇总表写入同一个 CSV，第一列为表名
+func (report *Report) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"table", "key", "name", "requests", "unique_ips", "share"}); err != nil {
+		return err
+	}
+	for _, table := range report.Tables {
+		for _, row := range table.Rows {
+			if err := writer.Write([]string{table.Name, row.Key, row.Name, strconv.FormatInt(row.Requests, 10),
+				strconv.FormatInt(row.UniqueIPs, 10), strconv.FormatFloat(row.Share, 'f', 6, 64)}); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"percent": percent}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>流量统计报告</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.15em; margin-top: 2em; }
+table { border-collapse: collapse; min-width: 40em; }
+th, td { padding: .3em .8em; border-bottom: 1px solid #ddd; text-align: left; }
+td.number { text-align: right; font-variant-numeric: tabular-nums; }
+.bar { background: #e8eef7; width: 12em; }
+.bar div { background: #4a7bd0; height: .8em; }
+.summary td { border: none; }
+</style>
+</head>
+<body>
+<h1>流量统计报告</h1>
+<table class="summary">
+<tr><td>请求数</td><td class="number">{{.Requests}}</td></tr>
+<tr><td>独立 IP</td><td class="number">{{.UniqueIPs}}</td></tr>
+<tr><td>未解析</td><td class="number">{{.Unparsed}}</td></tr>
+</table>
+{{range .Tables}}
+<h2>{{.Title}}</h2>
+<table>
+<tr><th>key</th><th>name</th><th>requests</th><th>share</th><th></th><th>unique_ips</th></tr>
+{{range .Rows}}<tr><td>{{.Key}}</td><td>{{.Name}}</td><td class="number">{{.Requests}}</td><td class="number">{{percent .Share}}</td><td class="bar"><div style="width: {{percent .Share}}"></div></td><td class="number">{{.UniqueIPs}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
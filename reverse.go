@@ -0,0 +1,78 @@
+package geoip
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ReverseLocation 逆地理编码结果，Latitude、Longitude 为该城市精度半径最小的地址段的坐标（不取平均值，
+// 避免跨越 ±180° 经线的城市落到地球另一侧），Distance 为与查询点的距离，单位公里
+type ReverseLocation struct {
+	Location  CityLocation `json:"location"`
+	Latitude  float64      `json:"latitude"`
+	Longitude float64      `json:"longitude"`
+	Distance  float64      `json:"distance"`
+}
+
+// reverseRadii 逆地理编码逐级扩大的搜索半径，单位公里，最后一级覆盖半个地球周长
+var reverseRadii = []float64{25, 100, 400, 1600, 6400, 20016}
+
+// ReverseGeocode 查询距离经纬度最近的城市，返回与IP查询相同的 GeoLite2CityLocations 记录，没有数据时返回 sql.ErrNoRows
+func (geo Geolite2) ReverseGeocode(language string, latitude, longitude float64) (*ReverseLocation, error) {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil, errors.New("经纬度超出范围")
+	}
+
+	for _, radius := range reverseRadii {
+		location, err := geo.nearestLocation(language, latitude, longitude, radius)
+		if err != nil {
+			return nil, err
+		}
+		if location != nil {
+			return location, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// nearestLocation 在 radius 公里范围内查询最近的城市，范围内没有城市时返回 nil
+func (geo Geolite2) nearestLocation(language string, latitude, longitude, radius float64) (*ReverseLocation, error) {
+	minLatitude, minLongitude, maxLatitude, maxLongitude := boundingBox(latitude, longitude, radius)
+	rows, err := geo.db.Query("SELECT r.latitude, r.longitude, l.geoname_id, l.locale_code, l.continent_code, l.continent_name, "+
+		"l.country_iso_code, l.country_name, l.subdivision_1_iso_code, l.subdivision_1_name, l.subdivision_2_iso_code, "+
+		"l.subdivision_2_name, l.city_name, l.metro_code, l.time_zone, l.is_in_european_union "+
+		"FROM GeoLite2CityLocationsRtree r "+
+		"JOIN GeoLite2CityLocations l ON l.geoname_id = r.id AND l.locale_code = ? "+
+		"WHERE r.min_latitude >= ? AND r.max_latitude <= ? AND r.min_longitude >= ? AND r.max_longitude <= ? "+
+		"AND l.city_name != ''", language, minLatitude, maxLatitude, minLongitude, maxLongitude)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nearest *ReverseLocation
+
+	for rows.Next() {
+		var location ReverseLocation
+		if err := rows.Scan(&location.Latitude, &location.Longitude, &location.Location.GeonameID,
+			&location.Location.LocaleCode, &location.Location.ContinentCode, &location.Location.ContinentName,
+			&location.Location.CountryISOCode, &location.Location.CountryName, &location.Location.Subdivision1ISOCode,
+			&location.Location.Subdivision1Name, &location.Location.Subdivision2ISOCode, &location.Location.Subdivision2Name,
+			&location.Location.CityName, &location.Location.MetroCode, &location.Location.TimeZone,
+			&location.Location.IsInEuropeanUnion); err != nil {
+			return nil, err
+		}
+		location.Distance = Haversine(latitude, longitude, location.Latitude, location.Longitude)
+		// 矩形四角的点可能比范围外的点更远，只有圆内的点才能确定是最近的
+		if location.Distance <= radius && (nearest == nil || location.Distance < nearest.Distance) {
+			nearest = &location
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return nearest, nil
+}
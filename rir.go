@@ -0,0 +1,375 @@
+package geoip
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RIRBlock 五个地区互联网注册机构（RIR）delegated 统计文件中已分配的地址段。
+// IPv4 记录的起始地址与数量不一定构成一个 CIDR，导入时拆分为多个 RIRBlock
+type RIRBlock struct {
+	ID      int64  `json:"id"`
+	Network string `json:"network"`
+	// Registry 注册机构：afrinic、apnic、arin、lacnic、ripencc
+	Registry string `json:"registry"`
+	// CountryISOCode 登记的国家代码，可能为 EU、AP 等不在 GeoLite2 中的代码
+	CountryISOCode string `json:"country_iso_code"`
+	// Date 分配日期，格式为 YYYYMMDD
+	Date string `json:"date"`
+	// Status allocated 或 assigned
+	Status string `json:"status"`
+	// OpaqueID extended 格式中持有者的匿名标识，同一持有者的记录相同
+	OpaqueID string `json:"opaque_id"`
+	location *CountryLocation
+}
+
+// Location 返回登记国家在 GeoLite2 中的地域信息，GeoLite2 中没有该国家时返回 nil
+func (block *RIRBlock) Location() *CountryLocation {
+	return block.location
+}
+
+// SetLocation 设置登记国家的地域信息，用于自定义 Geoip2 实现
+func (block *RIRBlock) SetLocation(location *CountryLocation) {
+	block.location = location
+}
+
+// Registration IP 在 RIR 中的登记国家与 GeoLite2 registered_country_geoname_id 的比较结果
+type Registration struct {
+	// RIR 包含 IP 的 RIR 地址段，没有时为 nil
+	RIR *RIRBlock `json:"rir"`
+	// RegisteredCountryGeonameID GeoLite2 国家地址段的 registered_country_geoname_id，没有时为空
+	RegisteredCountryGeonameID string `json:"registered_country_geoname_id"`
+	// RegisteredCountryISOCode registered_country_geoname_id 对应的国家代码
+	RegisteredCountryISOCode string `json:"registered_country_iso_code"`
+	// Match RIR 登记国家与 GeoLite2 注册国家都存在且相同
+	Match bool `json:"match"`
+}
+
+// ParseDelegated 解析 RIR delegated-*-extended 文件，也兼容不带 opaque-id 的 delegated-* 文件。
+// 只返回状态为 allocated 或 assigned 的 IPv4 与 IPv6 记录，跳过版本行、汇总行、ASN 及 available、reserved 记录
+func ParseDelegated(r io.Reader) ([]RIRBlock, error) {
+	var blocks []RIRBlock
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		// registry|cc|type|start|value|date|status[|opaque-id|...]
+		fields := strings.Split(text, "|")
+		if len(fields) < 7 || (fields[2] != "ipv4" && fields[2] != "ipv6") ||
+			(fields[6] != "allocated" && fields[6] != "assigned") {
+			continue
+		}
+		block := RIRBlock{Registry: fields[0], CountryISOCode: strings.ToUpper(fields[1]), Date: fields[5],
+			Status: fields[6]}
+		if len(fields) > 7 {
+			block.OpaqueID = fields[7]
+		}
+
+		networks, err := delegatedNetworks(fields[2], fields[3], fields[4])
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行：%w", line, err)
+		}
+		for _, network := range networks {
+			block.Network = network.String()
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, scanner.Err()
+}
+
+// delegatedNetworks 将 IPv4 起始地址与地址数量或 IPv6 起始地址与前缀长度转换为 CIDR
+func delegatedNetworks(kind, start, value string) ([]*net.IPNet, error) {
+	ip := net.ParseIP(start)
+	if ip == nil {
+		return nil, errors.New("无效的起始地址：" + start)
+	}
+	if kind == "ipv6" {
+		ones, err := strconv.Atoi(value)
+		if err != nil || ones < 0 || ones > 128 || ip.To4() != nil {
+			return nil, fmt.Errorf("无效的 IPv6 地址段：%s/%s", start, value)
+		}
+		return []*net.IPNet{{IP: ip.Mask(net.CIDRMask(ones, 128)), Mask: net.CIDRMask(ones, 128)}}, nil
+	}
+
+	count, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || ip.To4() == nil || count == 0 || uint64(IP2Int(ip))+count > 1<<32 {
+		return nil, fmt.Errorf("无效的 IPv4 地址数量：%s %s", start, value)
+	}
+	first := IP2Int(ip)
+	return RangeNetworks(Int2IP(first), Int2IP(first+uint32(count-1)))
+}
+
+// RIRLoader 管理 RIR 地址段表。RIR 数据与 GeoLite2 数据分表保存，重新加载 GeoLite2 时不受影响
+type RIRLoader struct {
+	db *sql.DB
+}
+
+func NewRIRLoader(db *sql.DB) *RIRLoader {
+	return &RIRLoader{db: db}
+}
+
+// Load 在一个事务中以 blocks 替换其中出现的注册机构的全部地址段，其他注册机构的数据不受影响
+func (loader *RIRLoader) Load(blocks []RIRBlock) (err error) {
+	tx, err := loader.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(rirSql.CreateTable); err != nil {
+		return err
+	}
+	registries := make(map[string]bool)
+	for _, block := range blocks {
+		if !registries[block.Registry] {
+			registries[block.Registry] = true
+			if _, err = tx.Exec("DELETE FROM "+rirSql.Table+" WHERE registry = ?", block.Registry); err != nil {
+				return err
+			}
+		}
+	}
+	stmt, err := tx.Prepare(rirSql.Insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, block := range blocks {
+		_, ipNet, err := net.ParseCIDR(block.Network)
+		if err != nil {
+			return fmt.Errorf("无效的 RIR 地址段 %s：%w", block.Network, err)
+		}
+		version, start, end := overlayRange(ipNet)
+		ones, _ := ipNet.Mask.Size()
+		if _, err = stmt.Exec(ipNet.String(), version, start, end, ones, block.Registry, block.CountryISOCode,
+			block.Date, block.Status, block.OpaqueID); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	schemaChanged()
+	log.Debug().Msgf("已加载 %d 个 RIR 地址段", len(blocks))
+	return nil
+}
+
+// LoadFile 读取一个或多个 delegated 文件并替换其中注册机构的地址段，返回加载的条数
+func (loader *RIRLoader) LoadFile(paths ...string) (int, error) {
+	var blocks []RIRBlock
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		parsed, err := ParseDelegated(file)
+		file.Close()
+		if err != nil {
+			return 0, fmt.Errorf("%s：%w", path, err)
+		}
+		blocks = append(blocks, parsed...)
+	}
+	return len(blocks), loader.Load(blocks)
+}
+
+const rirQuery = "SELECT id, network, registry, country_iso_code, date, status, opaque_id FROM GeoipRIRBlocks"
+
+func scanRIRBlock(row interface{ Scan(...interface{}) error }) (*RIRBlock, error) {
+	var block RIRBlock
+	if err := row.Scan(&block.ID, &block.Network, &block.Registry, &block.CountryISOCode, &block.Date,
+		&block.Status, &block.OpaqueID); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// RIRBlock 查询包含 IP 的 RIR 地址段，与 CountryBlock 相同先经过 Normalize，地域使用数据库中的第一个语言
+func (geo Geolite2) RIRBlock(ip net.IP) (*RIRBlock, error) {
+	version, key, err := blockKey(ip)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := geo.tableExists(rirSql.Table)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+	block, err := scanRIRBlock(geo.db.QueryRow(rirQuery+" WHERE version = ? AND ? BETWEEN start_ip AND end_ip "+
+		"ORDER BY prefix_len DESC, id DESC LIMIT 1", version, key))
+	if err != nil {
+		return nil, err
+	}
+	if err := geo.rirLocations([]*RIRBlock{block}, ""); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// BlocksByRIRCountryCode 查询登记在某国家的 RIR 地址段，包括 IPv4 与 IPv6
+func (geo Geolite2) BlocksByRIRCountryCode(language, code string) ([]RIRBlock, error) {
+	var blocks []RIRBlock
+	if err := geo.RangeBlocksByRIRCountryCode(language, code, Page{}, func(block RIRBlock) bool {
+		blocks = append(blocks, block)
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// RangeBlocksByRIRCountryCode 按页逐条回调登记在某国家的 RIR 地址段，游标为 id
+func (geo Geolite2) RangeBlocksByRIRCountryCode(language, code string, page Page, fn func(RIRBlock) bool) error {
+	cursor, args := page.cursor("id", code)
+	limit, args := page.limit("id", args...)
+	exists, err := geo.tableExists(rirSql.Table)
+	if err != nil || !exists {
+		return err
+	}
+	rows, err := geo.db.Query(rirQuery+" WHERE country_iso_code = ?"+cursor+limit, args...)
+	if err != nil {
+		return err
+	}
+	var blocks []*RIRBlock
+	for rows.Next() {
+		block, err := scanRIRBlock(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		blocks = append(blocks, block)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := geo.rirLocations(blocks, language); err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if !fn(*block) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// rirLocations 按登记国家代码查询国家地域，每个国家代码取第一条记录，language 为空时不限语言
+func (geo Geolite2) rirLocations(blocks []*RIRBlock, language string) error {
+	var codes []interface{}
+	seen := make(map[string]bool)
+	for _, block := range blocks {
+		if block.CountryISOCode != "" && !seen[block.CountryISOCode] {
+			seen[block.CountryISOCode] = true
+			codes = append(codes, block.CountryISOCode)
+		}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	where := "country_iso_code IN (?" + strings.Repeat(", ?", len(codes)-1) + ")"
+	if language != "" {
+		where += " AND locale_code = ?"
+		codes = append(codes, language)
+	}
+
+	exists, err := geo.tableExists(countryLocationsSql.Table)
+	if err != nil || !exists {
+		return err
+	}
+	rows, err := geo.db.Query("SELECT geoname_id, locale_code, continent_code, continent_name, country_iso_code, "+
+		"country_name, is_in_european_union FROM GeoLite2CountryLocations WHERE "+where+" ORDER BY id", codes...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	locations := make(map[string]*CountryLocation)
+	for rows.Next() {
+		var l CountryLocation
+		if err := rows.Scan(&l.GeonameID, &l.LocaleCode, &l.ContinentCode, &l.ContinentName, &l.CountryISOCode,
+			&l.CountryName, &l.IsInEuropeanUnion); err != nil {
+			return err
+		}
+		if _, ok := locations[l.CountryISOCode]; !ok {
+			locations[l.CountryISOCode] = &l
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, block := range blocks {
+		if location, ok := locations[block.CountryISOCode]; ok {
+			l := *location
+			block.location = &l
+		}
+	}
+	return nil
+}
+
+// CompareRegistration 比较 IP 在 RIR 中的登记国家与 GeoLite2 国家地址段的 registered_country_geoname_id，
+// 两者都没有数据时返回 sql.ErrNoRows
+func (geo Geolite2) CompareRegistration(ip net.IP) (*Registration, error) {
+	var registration Registration
+	rir, err := geo.RIRBlock(ip)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	registration.RIR = rir
+
+	// 只比较 GeoLite2 数据，不经过覆盖地址段
+	version, key, err := blockKey(ip)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := geo.tableExists("GeoLite2CountryBlocks" + version)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		err = geo.db.QueryRow("SELECT registered_country_geoname_id FROM GeoLite2CountryBlocks"+version+
+			" WHERE ? BETWEEN start_ip AND end_ip", key).Scan(&registration.RegisteredCountryGeonameID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+	if registration.RegisteredCountryGeonameID != "" {
+		id, err := strconv.ParseInt(registration.RegisteredCountryGeonameID, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		block := &CountryBlock{GeonameID: id}
+		if err := geo.countryLocations([]*CountryBlock{block}, ""); err != nil {
+			return nil, err
+		}
+		if block.location != nil {
+			registration.RegisteredCountryISOCode = block.location.CountryISOCode
+		}
+	}
+
+	if registration.RIR == nil && registration.RegisteredCountryGeonameID == "" {
+		return nil, sql.ErrNoRows
+	}
+	registration.Match = registration.RIR != nil && registration.RegisteredCountryISOCode != "" &&
+		registration.RIR.CountryISOCode == registration.RegisteredCountryISOCode
+	return &registration, nil
+}
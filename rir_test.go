@@ -0,0 +1,164 @@
+package geoip_test
+
+import (
+	"database/sql"
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const delegatedRIPE = `2|ripencc|1697000000|6|19830705|20231010|+0000
+ripencc|*|ipv4|*|3|summary
+ripencc|*|ipv6|*|1|summary
+ripencc|*|asn|*|1|summary
+ripencc|DE|ipv4|5.0.0.0|65536|20100712|allocated|a1b2c3
+ripencc|NL|ipv4|185.220.100.0|768|20150101|allocated|d4e5f6
+ripencc||ipv4|185.0.0.0|256||available|
+ripencc|DE|ipv6|2003::|19|19990101|allocated|a1b2c3
+ripencc|DE|asn|3320|1|19930901|allocated|a1b2c3
+`
+
+// delegatedAPNIC 不带 opaque-id 的 delegated 格式
+const delegatedAPNIC = `# APNIC delegated
+2|apnic|20231010|2|19850701|20231009|+1000
+apnic|CN|ipv4|14.0.0.0|65536|20100413|allocated
+apnic|AU|ipv4|1.0.0.0|256|20110811|assigned
+`
+
+func TestParseDelegated(t *testing.T) {
+	blocks, err := geoip.ParseDelegated(strings.NewReader(delegatedRIPE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var networks []string
+	for _, block := range blocks {
+		networks = append(networks, block.Network)
+	}
+	if strings.Join(networks, " ") != "5.0.0.0/16 185.220.100.0/23 185.220.102.0/24 2003::/19" {
+		t.Errorf("unexpected networks %v", networks)
+	}
+	want := geoip.RIRBlock{Network: "185.220.102.0/24", Registry: "ripencc", CountryISOCode: "NL", Date: "20150101",
+		Status: "allocated", OpaqueID: "d4e5f6"}
+	if !reflect.DeepEqual(blocks[2], want) {
+		t.Errorf("got %+v", blocks[2])
+	}
+
+	if blocks, err = geoip.ParseDelegated(strings.NewReader(delegatedAPNIC)); err != nil || len(blocks) != 2 ||
+		blocks[1].Status != "assigned" || blocks[1].OpaqueID != "" {
+		t.Errorf("unexpected apnic blocks %+v %v", blocks, err)
+	}
+
+	for _, invalid := range []string{"ripencc|DE|ipv4|5.0.0.0|0|20100712|allocated\n",
+		"ripencc|DE|ipv4|255.255.255.0|512|20100712|allocated\n", "ripencc|DE|ipv6|2003::|129|19990101|allocated\n",
+		"ripencc|DE|ipv4|5.0.0|256|20100712|allocated\n"} {
+		if _, err := geoip.ParseDelegated(strings.NewReader(invalid)); err == nil ||
+			!strings.Contains(err.Error(), "第 1 行") {
+			t.Errorf("%q: want line number in error, got %v", invalid, err)
+		}
+	}
+}
+
+func TestGeolite2_RIRBlock(t *testing.T) {
+	dataset := geoiptest.Default()
+	db := loadDataset(t, dataset)
+	dir := t.TempDir()
+	ripe, apnic := filepath.Join(dir, "delegated-ripencc-extended-latest"), filepath.Join(dir, "delegated-apnic-latest")
+	if err := os.WriteFile(ripe, []byte(delegatedRIPE), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(apnic, []byte(delegatedAPNIC), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := geoip.NewRIRLoader(db)
+	if n, err := loader.LoadFile(ripe, apnic); err != nil || n != 6 {
+		t.Fatalf("loaded %d blocks: %v", n, err)
+	}
+	// 重新加载 RIPE 数据不影响 APNIC 数据
+	if n, err := loader.LoadFile(ripe); err != nil || n != 4 {
+		t.Fatalf("loaded %d blocks: %v", n, err)
+	}
+
+	fake := geoiptest.NewFake(dataset)
+	for _, content := range []string{delegatedRIPE, delegatedAPNIC, delegatedRIPE} {
+		blocks, err := geoip.ParseDelegated(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fake.SetRIRBlocks(blocks)
+	}
+
+	geo := geoip.NewGeolite2(db)
+	block, err := geo.RIRBlock(net.ParseIP("5.0.1.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Network != "5.0.0.0/16" || block.CountryISOCode != "DE" || block.Location() == nil ||
+		block.Location().GeonameID != 2921044 {
+		t.Errorf("unexpected block %+v %+v", block, block.Location())
+	}
+	if block, err := geo.RIRBlock(net.ParseIP("14.0.1.1")); err != nil || block.Registry != "apnic" {
+		t.Errorf("unexpected apnic block %+v %v", block, err)
+	}
+	if _, err := geo.RIRBlock(net.ParseIP("10.0.0.1")); !errors.Is(err, geoip.ErrReserved) {
+		t.Errorf("want reserved error, got %v", err)
+	}
+
+	registration, err := geo.CompareRegistration(net.ParseIP("185.220.101.7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registration.Match || registration.RIR.CountryISOCode != "NL" || registration.RegisteredCountryISOCode != "DE" ||
+		registration.RegisteredCountryGeonameID != "2921044" {
+		t.Errorf("unexpected registration %+v", registration)
+	}
+	if registration, err := geo.CompareRegistration(net.ParseIP("2003::1")); err != nil || !registration.Match {
+		t.Errorf("unexpected registration %+v %v", registration, err)
+	}
+	if _, err := geo.CompareRegistration(net.ParseIP("196.201.1.1")); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("want sql.ErrNoRows, got %v", err)
+	}
+
+	for _, s := range []string{"5.0.1.1", "14.0.1.1", "1.0.0.1", "185.220.100.7", "185.220.102.7", "2003::1",
+		"2002:500::1", "8.8.8.8", "196.201.1.1", "9.9.9.9"} {
+		ip := net.ParseIP(s)
+		got, gotErr := geo.RIRBlock(ip)
+		want, wantErr := fake.RIRBlock(ip)
+		if !reflect.DeepEqual(got, want) || !errors.Is(gotErr, wantErr) {
+			t.Errorf("%s: sqlite %+v %v, fake %+v %v", s, got, gotErr, want, wantErr)
+		}
+		gotRegistration, gotErr := geo.CompareRegistration(ip)
+		wantRegistration, wantErr := fake.CompareRegistration(ip)
+		if !reflect.DeepEqual(gotRegistration, wantRegistration) || !errors.Is(gotErr, wantErr) {
+			t.Errorf("%s: sqlite %+v %v, fake %+v %v", s, gotRegistration, gotErr, wantRegistration, wantErr)
+		}
+	}
+
+	for _, language := range []string{"en", "zh-CN", "xx"} {
+		got, err := geo.BlocksByRIRCountryCode(language, "DE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := fake.BlocksByRIRCountryCode(language, "DE")
+		if len(got) != 2 || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: sqlite %+v, fake %+v", language, got, want)
+		}
+	}
+	var paged []geoip.RIRBlock
+	if err := geo.RangeBlocksByRIRCountryCode("en", "DE", geoip.Page{Offset: 1, Limit: 1},
+		func(block geoip.RIRBlock) bool {
+			paged = append(paged, block)
+			return true
+		}); err != nil {
+		t.Fatal(err)
+	}
+	if len(paged) != 1 || paged[0].Network != "2003::/19" {
+		t.Errorf("unexpected page %+v", paged)
+	}
+}
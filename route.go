@@ -0,0 +1,304 @@
+package geoip
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"net"
+	"strings"
+)
+
+// Route BGP 路由表中的前缀及其起源 AS
+type Route struct {
+	Network string `json:"network"`
+	// Origins 起源 AS，按观察到的对等体数由多到少排序，相同时按 ASN 排序
+	Origins []RouteOrigin `json:"origins"`
+	// MOAS 前缀由多个 AS 发起（Multiple Origin AS），可能是任播、多归属或路由劫持
+	MOAS bool `json:"moas"`
+}
+
+// RouteOrigin 前缀的一个起源 AS
+type RouteOrigin struct {
+	AutonomousSystemNumber int `json:"autonomous_system_number"`
+	// Peers 观察到该起源的对等体数，合并多个 RIB 文件时累加
+	Peers int `json:"peers"`
+}
+
+// ASNSource AsnBlock、BlocksByAsnNumber 及批量查询 ASN 信息的数据来源
+type ASNSource string
+
+const (
+	// ASNSourceGeoLite2 GeoLite2 ASN 数据，默认
+	ASNSourceGeoLite2 ASNSource = ""
+	// ASNSourceBGP RouteLoader 加载的 BGP 路由表，按最长前缀匹配，组织名称取自 GeoLite2 ASN 数据。
+	// MOAS 前缀取对等体数最多的起源 AS，BlocksByAsnNumber 返回该 AS 发起的全部 IPv4 与 IPv6 前缀
+	ASNSourceBGP ASNSource = "bgp"
+)
+
+// WithASNSource 返回使用 source 作为 ASN 数据来源的 Geolite2，覆盖地址段仍然优先。
+// BlocksByAsnName、Organizations 等按组织查询的方法不受影响
+//
+//	geo := geoip.NewGeolite2(db).(geoip.Geolite2).WithASNSource(geoip.ASNSourceBGP)
+func (geo Geolite2) WithASNSource(source ASNSource) Geolite2 {
+	geo.asnSource = source
+	return geo
+}
+
+// RouteLoader 管理 BGP 路由表。路由数据与 GeoLite2 数据分表保存，重新加载 GeoLite2 时不受影响
+type RouteLoader struct {
+	db *sql.DB
+}
+
+func NewRouteLoader(db *sql.DB) *RouteLoader {
+	return &RouteLoader{db: db}
+}
+
+// Load 在一个事务中以 routes 替换全部路由，每个起源 AS 保存为一行
+func (loader *RouteLoader) Load(routes []Route) (err error) {
+	tx, err := loader.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(routeSql.CreateTable); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM " + routeSql.Table); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(routeSql.Insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, route := range routes {
+		_, ipNet, err := net.ParseCIDR(route.Network)
+		if err != nil {
+			return fmt.Errorf("无效的路由前缀 %s：%w", route.Network, err)
+		}
+		version, start, end := overlayRange(ipNet)
+		ones, _ := ipNet.Mask.Size()
+		for _, origin := range route.Origins {
+			if _, err = stmt.Exec(ipNet.String(), version, start, end, ones, origin.AutonomousSystemNumber,
+				origin.Peers, boolFlag(route.MOAS)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	schemaChanged()
+	log.Debug().Msgf("已加载 %d 个路由前缀", len(routes))
+	return nil
+}
+
+// LoadFile 读取一个或多个 MRT RIB 文件，合并后替换全部路由，返回前缀数。
+// 同一前缀在多个文件中出现时起源 AS 合并，对等体数累加，如同时加载 IPv4 与 IPv6 的 RIB 文件
+func (loader *RouteLoader) LoadFile(paths ...string) (int, error) {
+	table := make(routeTable)
+	for _, path := range paths {
+		if err := table.readFile(path); err != nil {
+			return 0, err
+		}
+	}
+	routes := table.routes()
+	return len(routes), loader.Load(routes)
+}
+
+// routeRow 路由表中的一行，即前缀的一个起源 AS
+type routeRow struct {
+	network string
+	bits    int
+	origin  RouteOrigin
+	moas    string
+}
+
+// routeCandidates 返回包含 key 的各长度前缀的起始地址，用于在 (version, start_ip) 索引上做最长前缀匹配
+func routeCandidates(key interface{}) []interface{} {
+	var candidates []interface{}
+	switch key := key.(type) {
+	case uint32:
+		for bits := 0; bits <= 32; bits++ {
+			start := int64(uint64(key) &^ (uint64(1)<<(32-bits) - 1))
+			if len(candidates) == 0 || candidates[len(candidates)-1] != start {
+				candidates = append(candidates, start)
+			}
+		}
+	case int64:
+		return routeCandidates(uint32(key))
+	case []byte:
+		for bits := 0; bits <= 128; bits++ {
+			start := net.IP(key).Mask(net.CIDRMask(bits, 128))
+			if len(candidates) == 0 || !net.IP(candidates[len(candidates)-1].([]byte)).Equal(start) {
+				candidates = append(candidates, []byte(start))
+			}
+		}
+	}
+	return candidates
+}
+
+// matchRoute 返回包含 key 的最长前缀的全部起源 AS，按对等体数由多到少排序
+func (geo Geolite2) matchRoute(version string, key interface{}) ([]routeRow, error) {
+	exists, err := geo.tableExists(routeSql.Table)
+	if err != nil || !exists {
+		return nil, err
+	}
+	candidates := routeCandidates(key)
+	args := append([]interface{}{version}, candidates...)
+	rows, err := geo.db.Query("SELECT network, prefix_len, autonomous_system_number, peers, moas "+
+		"FROM GeoipBGPRoutes WHERE version = ? AND start_ip IN (?"+strings.Repeat(", ?", len(candidates)-1)+
+		") AND end_ip >= ? ORDER BY prefix_len DESC, peers DESC, autonomous_system_number", append(args, key)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matched []routeRow
+	for rows.Next() {
+		var r routeRow
+		if err := rows.Scan(&r.network, &r.bits, &r.origin.AutonomousSystemNumber, &r.origin.Peers,
+			&r.moas); err != nil {
+			return nil, err
+		}
+		if len(matched) > 0 && r.bits != matched[0].bits {
+			break
+		}
+		matched = append(matched, r)
+	}
+	return matched, rows.Err()
+}
+
+// Route 查询包含 IP 的最长前缀路由，与 AsnBlock 相同先经过 Normalize，没有时返回 sql.ErrNoRows
+func (geo Geolite2) Route(ip net.IP) (*Route, error) {
+	version, key, err := blockKey(ip)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := geo.matchRoute(version, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(matched) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	route := &Route{Network: matched[0].network, MOAS: matched[0].moas == "1"}
+	for _, r := range matched {
+		route.Origins = append(route.Origins, r.origin)
+	}
+	return route, nil
+}
+
+// MOASRoutes 返回全部 MOAS 前缀，按地址排序
+func (geo Geolite2) MOASRoutes() ([]Route, error) {
+	exists, err := geo.tableExists(routeSql.Table)
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := geo.db.Query("SELECT network, autonomous_system_number, peers FROM GeoipBGPRoutes " +
+		"WHERE moas = '1' ORDER BY version, start_ip, prefix_len, peers DESC, autonomous_system_number")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var routes []Route
+	for rows.Next() {
+		var network string
+		var origin RouteOrigin
+		if err := rows.Scan(&network, &origin.AutonomousSystemNumber, &origin.Peers); err != nil {
+			return nil, err
+		}
+		if len(routes) == 0 || routes[len(routes)-1].Network != network {
+			routes = append(routes, Route{Network: network, MOAS: true})
+		}
+		routes[len(routes)-1].Origins = append(routes[len(routes)-1].Origins, origin)
+	}
+	return routes, rows.Err()
+}
+
+// organizationName 按 autonomous_system_number 索引从 GeoLite2 ASN 数据中查询 AS 的组织名称，
+// 先查 IPv4 再查 IPv6，没有时返回空字符串
+func (geo Geolite2) organizationName(number int) (string, error) {
+	for _, version := range []string{"IPv4", "IPv6"} {
+		exists, err := geo.tableExists("GeoLite2ASNBlocks" + version)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			continue
+		}
+		var name string
+		err = geo.db.QueryRow("SELECT autonomous_system_organization FROM GeoLite2ASNBlocks"+version+
+			" WHERE autonomous_system_number = ? LIMIT 1", number).Scan(&name)
+		if err == nil {
+			return name, nil
+		}
+		if err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// bgpASNBlock 以最长前缀路由中对等体数最多的起源 AS 作为 ASNBlock，
+// names 缓存已查到的组织名称，批量查询时复用，为 nil 时不缓存
+func (geo Geolite2) bgpASNBlock(version string, key interface{}, names map[int]string) (*ASNBlock, error) {
+	matched, err := geo.matchRoute(version, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(matched) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	number := matched[0].origin.AutonomousSystemNumber
+	name, ok := names[number]
+	if !ok {
+		if name, err = geo.organizationName(number); err != nil {
+			return nil, err
+		}
+		if names != nil {
+			names[number] = name
+		}
+	}
+	return &ASNBlock{Network: matched[0].network, Organization: Organization{
+		AutonomousSystemNumber: number, AutonomousSystemOrganization: name}}, nil
+}
+
+// rangeBGPBlocks 按页逐条回调 AS 发起的前缀，游标为 id，MOAS 前缀在每个起源 AS 中都会出现
+func (geo Geolite2) rangeBGPBlocks(number int64, page Page, fn func(ASNBlock) bool) error {
+	name, err := geo.organizationName(int(number))
+	if err != nil {
+		return err
+	}
+	cursor, args := page.cursor("id", number)
+	limit, args := page.limit("id", args...)
+	exists, err := geo.tableExists(routeSql.Table)
+	if err != nil || !exists {
+		return err
+	}
+	rows, err := geo.db.Query("SELECT id, network, autonomous_system_number FROM GeoipBGPRoutes "+
+		"WHERE autonomous_system_number = ?"+cursor+limit, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		block := ASNBlock{Organization: Organization{AutonomousSystemOrganization: name}}
+		if err := rows.Scan(&block.ID, &block.Network, &block.AutonomousSystemNumber); err != nil {
+			return err
+		}
+		if !fn(block) {
+			break
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,344 @@
+package geoip
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// columnKind CSV 列的取值类型
+type columnKind int
+
+const (
+	colText columnKind = iota
+	colInt
+	colFloat
+	colBool
+	colNetworkIPv4
+	colNetworkIPv6
+)
+
+// csvColumn CSV 列定义，按表头名称匹配，与实际列顺序无关
+type csvColumn struct {
+	name     string
+	kind     columnKind
+	required bool
+}
+
+func (column csvColumn) validate(value string) error {
+	if value == "" {
+		if column.required {
+			return errors.New("不能为空")
+		}
+		return nil
+	}
+
+	switch column.kind {
+	case colInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%q 不是整数", value)
+		}
+	case colFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("%q 不是数字", value)
+		}
+	case colBool:
+		if value != "0" && value != "1" {
+			return fmt.Errorf("%q 不是 0 或 1", value)
+		}
+	case colNetworkIPv4, colNetworkIPv6:
+		ip, _, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("%q 不是有效的地址段", value)
+		}
+		if (ip.To4() != nil) != (column.kind == colNetworkIPv4) {
+			return fmt.Errorf("%q 与数据表的 IP 协议不一致", value)
+		}
+	}
+
+	return nil
+}
+
+func networkColumn(version IPVersion) csvColumn {
+	if version == IPv6 {
+		return csvColumn{"network", colNetworkIPv6, true}
+	}
+	return csvColumn{"network", colNetworkIPv4, true}
+}
+
+func asnBlocksColumns(version IPVersion) []csvColumn {
+	return []csvColumn{
+		networkColumn(version),
+		{"autonomous_system_number", colInt, true},
+		{"autonomous_system_organization", colText, false},
+	}
+}
+
+func cityBlocksColumns(version IPVersion) []csvColumn {
+	return []csvColumn{
+		networkColumn(version),
+		{"geoname_id", colInt, false},
+		{"registered_country_geoname_id", colInt, false},
+		{"represented_country_geoname_id", colInt, false},
+		{"is_anonymous_proxy", colBool, false},
+		{"is_satellite_provider", colBool, false},
+		{"postal_code", colText, false},
+		{"latitude", colFloat, false},
+		{"longitude", colFloat, false},
+		{"accuracy_radius", colInt, false},
+	}
+}
+
+var cityLocationsColumns = []csvColumn{
+	{"geoname_id", colInt, true},
+	{"locale_code", colText, true},
+	{"continent_code", colText, false},
+	{"continent_name", colText, false},
+	{"country_iso_code", colText, false},
+	{"country_name", colText, false},
+	{"subdivision_1_iso_code", colText, false},
+	{"subdivision_1_name", colText, false},
+	{"subdivision_2_iso_code", colText, false},
+	{"subdivision_2_name", colText, false},
+	{"city_name", colText, false},
+	{"metro_code", colText, false},
+	{"time_zone", colText, false},
+	{"is_in_european_union", colBool, false},
+}
+
+func countryBlocksColumns(version IPVersion) []csvColumn {
+	return []csvColumn{
+		networkColumn(version),
+		{"geoname_id", colInt, false},
+		{"registered_country_geoname_id", colInt, false},
+		{"represented_country_geoname_id", colInt, false},
+		{"is_anonymous_proxy", colBool, false},
+		{"is_satellite_provider", colBool, false},
+	}
+}
+
+var countryLocationsColumns = []csvColumn{
+	{"geoname_id", colInt, true},
+	{"locale_code", colText, true},
+	{"continent_code", colText, false},
+	{"continent_name", colText, false},
+	{"country_iso_code", colText, false},
+	{"country_name", colText, false},
+	{"is_in_european_union", colBool, false},
+}
+
+// RowError CSV 中某一行的错误，Line 为 0 表示文件级错误（如文件无法打开）
+type RowError struct {
+	File   string
+	Line   int
+	Column string
+	Err    error
+}
+
+func (e *RowError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.File)
+	if e.Line > 0 {
+		b.WriteString(":" + strconv.Itoa(e.Line))
+	}
+	if e.Column != "" {
+		b.WriteString(": " + e.Column)
+	}
+	b.WriteString(": " + e.Err.Error())
+	return b.String()
+}
+
+func (e *RowError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File    string `json:"file"`
+		Line    int    `json:"line"`
+		Column  string `json:"column,omitempty"`
+		Message string `json:"message"`
+	}{e.File, e.Line, e.Column, e.Err.Error()})
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// readCsv 按表头名称映射列并逐行校验，合法的行转换为插入参数后回调 fn，fn 返回 false 时停止；
+// 行错误回调 onError，onError 返回 false 时停止。文件级错误直接返回
+func readCsv(table csvTable, fn func(args []interface{}, offset int64) bool, onError func(*RowError) bool) error {
+	file, err := os.Open(table.path)
+	if err != nil {
+		return &RowError{File: table.path, Err: err}
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("文件为空")
+		}
+		return &RowError{File: table.path, Line: 1, Err: err}
+	}
+	positions := make(map[string]int)
+	for i, name := range header {
+		// 表头可能带有 UTF-8 BOM
+		positions[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	index := make([]int, len(table.columns))
+	var missing []string
+	for i, column := range table.columns {
+		position, ok := positions[column.name]
+		if !ok {
+			missing = append(missing, column.name)
+		}
+		index[i] = position
+	}
+	if len(missing) > 0 {
+		return &RowError{File: table.path, Line: 1, Err: errors.New("缺少列 " + strings.Join(missing, ", "))}
+	}
+
+	values := make([]string, len(table.columns))
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				if !onError(&RowError{File: table.path, Line: parseErr.Line, Err: parseErr.Err}) {
+					return nil
+				}
+				continue
+			}
+			return &RowError{File: table.path, Err: err}
+		}
+
+		line, _ := reader.FieldPos(0)
+		if valid, next := mapRecord(table, record, index, values, line, onError); !next {
+			return nil
+		} else if !valid {
+			continue
+		}
+
+		args, err := table.convert(values)
+		if err != nil {
+			if !onError(&RowError{File: table.path, Line: line, Err: err}) {
+				return nil
+			}
+			continue
+		}
+		if !fn(args, reader.InputOffset()) {
+			return nil
+		}
+	}
+}
+
+// mapRecord 将一行按列定义的顺序写入 values 并校验，返回该行是否合法及是否继续读取
+func mapRecord(table csvTable, record []string, index []int, values []string, line int,
+	onError func(*RowError) bool) (bool, bool) {
+	valid := true
+	for i, column := range table.columns {
+		if index[i] >= len(record) {
+			valid = false
+			if !onError(&RowError{File: table.path, Line: line, Column: column.name,
+				Err: fmt.Errorf("列数 %d 不足", len(record))}) {
+				return false, false
+			}
+			break
+		}
+		values[i] = record[index[i]]
+		if err := column.validate(values[i]); err != nil {
+			valid = false
+			if !onError(&RowError{File: table.path, Line: line, Column: column.name, Err: err}) {
+				return false, false
+			}
+		}
+	}
+	return valid, true
+}
+
+// maxReportErrors 校验报告中每个文件最多记录的行错误数
+const maxReportErrors = 100
+
+// FileReport 单个 CSV 文件的校验结果
+type FileReport struct {
+	Table string `json:"table"`
+	File  string `json:"file"`
+	// Rows 合法的数据行数
+	Rows int64 `json:"rows"`
+	// Invalid 不合法的数据行数
+	Invalid int64 `json:"invalid"`
+	// Errors 错误明细，最多记录 maxReportErrors 条
+	Errors []*RowError `json:"errors"`
+}
+
+// ValidationReport 校验报告
+type ValidationReport struct {
+	Files []FileReport `json:"files"`
+}
+
+// Valid 全部文件均没有错误时返回 true
+func (report *ValidationReport) Valid() bool {
+	for _, file := range report.Files {
+		if len(file.Errors) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Err 返回第一个错误，没有错误时返回 nil
+func (report *ValidationReport) Err() error {
+	for _, file := range report.Files {
+		if len(file.Errors) > 0 {
+			return file.Errors[0]
+		}
+	}
+	return nil
+}
+
+// Validate 按当前加载选项解析并校验 CSV 目录，不读写数据库，用于加载前的试运行
+func (loader *GeoLite2Loader) Validate(asnPath, cityPath, countryPath string) (*ValidationReport, error) {
+	tables := loader.tables(asnPath, cityPath, countryPath)
+	if len(tables) == 0 {
+		return nil, errors.New("没有需要加载的数据，请检查加载的版本及地址段协议")
+	}
+
+	report := new(ValidationReport)
+	for _, table := range tables {
+		file := FileReport{Table: table.name, File: table.path}
+		lines := make(map[int]bool)
+		err := readCsv(table, func(args []interface{}, offset int64) bool {
+			file.Rows++
+			return true
+		}, func(rowErr *RowError) bool {
+			if !lines[rowErr.Line] {
+				lines[rowErr.Line] = true
+				file.Invalid++
+			}
+			if len(file.Errors) < maxReportErrors {
+				file.Errors = append(file.Errors, rowErr)
+			}
+			return true
+		})
+		if err != nil {
+			var rowErr *RowError
+			if !errors.As(err, &rowErr) {
+				return nil, err
+			}
+			file.Errors = append(file.Errors, rowErr)
+		}
+		report.Files = append(report.Files, file)
+	}
+
+	return report, nil
+}
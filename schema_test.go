@@ -0,0 +1,78 @@
+package geoip_test
+
+import (
+	"database/sql"
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeoLite2Loader_Validate(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "geoip2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	loader := geoip.NewGeoLite2Loader(db)
+
+	editions, err := geoiptest.Default().WriteCSV(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := loader.Validate(editions.ASN, editions.City, editions.Country)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() || len(report.Files) != 3+2*len(geoip.Languages) || report.Files[1].Rows != 8 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	// 列顺序变化及新增列按表头映射
+	cityBlocks := "is_anycast,latitude,longitude,network,geoname_id,registered_country_geoname_id,represented_country_geoname_id,is_anonymous_proxy,is_satellite_provider,postal_code,accuracy_radius\n" +
+		",50.1155,8.6842,5.0.0.0/16,2925533,2921044,,0,0,60311,20\n" +
+		",north,8.6842,5.1.0.0/16,2925533,2921044,,0,0,60311,20\n" +
+		",50.1155,8.6842,2003::/19,2925533,2921044,,0,0,60311,20\n" +
+		",50.1155\n"
+	if err := os.WriteFile(filepath.Join(editions.City, "GeoLite2-City-Blocks-IPv4.csv"), []byte(cityBlocks), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(editions.ASN, "GeoLite2-ASN-Blocks-IPv4.csv"),
+		[]byte("network,autonomous_system_organization\n1.0.0.0/24,CLOUDFLARENET\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = loader.Validate(editions.ASN, editions.City, editions.Country)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() {
+		t.Fatal("expected invalid report")
+	}
+	if errs := report.Files[0].Errors; len(errs) != 1 || errs[0].Line != 1 {
+		t.Errorf("expected missing column error, got %v", errs)
+	}
+	file := report.Files[1]
+	if file.Rows != 1 || file.Invalid != 3 || len(file.Errors) != 3 {
+		t.Fatalf("unexpected city blocks report %+v", file)
+	}
+	if file.Errors[0].Line != 3 || file.Errors[0].Column != "latitude" || file.Errors[1].Line != 4 ||
+		file.Errors[2].Line != 5 {
+		t.Errorf("unexpected errors %v", file.Errors)
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&n); err != nil || n != 0 {
+		t.Errorf("validate should not touch the database, got %d tables, %v", n, err)
+	}
+
+	loader.SetEditions(geoip.EditionCity)
+	err = loader.Local(editions.ASN, editions.City, editions.Country)
+	var rowErr *geoip.RowError
+	if !errors.As(err, &rowErr) || rowErr.Line != 3 {
+		t.Errorf("expected row error at line 3, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+)
+
+// ReservedKind 特殊用途地址的类别
+type ReservedKind string
+
+const (
+	ReservedUnspecified   ReservedKind = "unspecified"
+	ReservedPrivate       ReservedKind = "private"
+	ReservedSharedAddress ReservedKind = "shared_address"
+	ReservedLoopback      ReservedKind = "loopback"
+	ReservedLinkLocal     ReservedKind = "link_local"
+	ReservedProtocol      ReservedKind = "protocol_assignments"
+	ReservedDocumentation ReservedKind = "documentation"
+	ReservedBenchmarking  ReservedKind = "benchmarking"
+	ReservedRelay         ReservedKind = "relay"
+	ReservedMulticast     ReservedKind = "multicast"
+	ReservedFuture        ReservedKind = "future_use"
+	ReservedBroadcast     ReservedKind = "broadcast"
+	ReservedDiscard       ReservedKind = "discard"
+	ReservedTranslation   ReservedKind = "translation"
+	ReservedSegmentRoute  ReservedKind = "segment_routing"
+	ReservedUniqueLocal   ReservedKind = "unique_local"
+)
+
+// Reserved IANA 特殊用途地址段，不会出现在 GeoLite2 数据中
+type Reserved struct {
+	Network string       `json:"network"`
+	Name    string       `json:"name"`
+	RFC     string       `json:"rfc"`
+	Kind    ReservedKind `json:"kind"`
+
+	ipNet *net.IPNet
+}
+
+// reservedRanges IANA IPv4/IPv6 Special-Purpose Address Registry 中不可全局路由的地址段，以及组播地址段。
+// 6to4、Teredo 与 NAT64 地址段不在其中，查询时提取其中嵌入的 IPv4 地址
+var reservedRanges = []Reserved{
+	{Network: "0.0.0.0/8", Name: "This network", RFC: "RFC791", Kind: ReservedUnspecified},
+	{Network: "10.0.0.0/8", Name: "Private-Use", RFC: "RFC1918", Kind: ReservedPrivate},
+	{Network: "100.64.0.0/10", Name: "Shared Address Space", RFC: "RFC6598", Kind: ReservedSharedAddress},
+	{Network: "127.0.0.0/8", Name: "Loopback", RFC: "RFC1122", Kind: ReservedLoopback},
+	{Network: "169.254.0.0/16", Name: "Link Local", RFC: "RFC3927", Kind: ReservedLinkLocal},
+	{Network: "172.16.0.0/12", Name: "Private-Use", RFC: "RFC1918", Kind: ReservedPrivate},
+	{Network: "192.0.0.0/24", Name: "IETF Protocol Assignments", RFC: "RFC6890", Kind: ReservedProtocol},
+	{Network: "192.0.2.0/24", Name: "Documentation (TEST-NET-1)", RFC: "RFC5737", Kind: ReservedDocumentation},
+	{Network: "192.88.99.0/24", Name: "Deprecated 6to4 Relay Anycast", RFC: "RFC7526", Kind: ReservedRelay},
+	{Network: "192.168.0.0/16", Name: "Private-Use", RFC: "RFC1918", Kind: ReservedPrivate},
+	{Network: "198.18.0.0/15", Name: "Benchmarking", RFC: "RFC2544", Kind: ReservedBenchmarking},
+	{Network: "198.51.100.0/24", Name: "Documentation (TEST-NET-2)", RFC: "RFC5737", Kind: ReservedDocumentation},
+	{Network: "203.0.113.0/24", Name: "Documentation (TEST-NET-3)", RFC: "RFC5737", Kind: ReservedDocumentation},
+	{Network: "224.0.0.0/4", Name: "Multicast", RFC: "RFC5771", Kind: ReservedMulticast},
+	{Network: "255.255.255.255/32", Name: "Limited Broadcast", RFC: "RFC919", Kind: ReservedBroadcast},
+	{Network: "240.0.0.0/4", Name: "Reserved", RFC: "RFC1112", Kind: ReservedFuture},
+
+	{Network: "::/128", Name: "Unspecified Address", RFC: "RFC4291", Kind: ReservedUnspecified},
+	{Network: "::1/128", Name: "Loopback Address", RFC: "RFC4291", Kind: ReservedLoopback},
+	{Network: "64:ff9b:1::/48", Name: "IPv4-IPv6 Translat.", RFC: "RFC8215", Kind: ReservedTranslation},
+	{Network: "100::/64", Name: "Discard-Only Address Block", RFC: "RFC6666", Kind: ReservedDiscard},
+	{Network: "2001:db8::/32", Name: "Documentation", RFC: "RFC3849", Kind: ReservedDocumentation},
+	{Network: "3fff::/20", Name: "Documentation", RFC: "RFC9637", Kind: ReservedDocumentation},
+	{Network: "5f00::/16", Name: "Segment Routing (SRv6) SIDs", RFC: "RFC9602", Kind: ReservedSegmentRoute},
+	{Network: "fc00::/7", Name: "Unique-Local", RFC: "RFC4193", Kind: ReservedUniqueLocal},
+	{Network: "fe80::/10", Name: "Link-Local Unicast", RFC: "RFC4291", Kind: ReservedLinkLocal},
+	{Network: "ff00::/8", Name: "Multicast", RFC: "RFC4291", Kind: ReservedMulticast},
+	// 2001::/23 中除 Teredo 以外的部分
+	{Network: "2001::/23", Name: "IETF Protocol Assignments", RFC: "RFC2928", Kind: ReservedProtocol},
+}
+
+var (
+	teredoNetwork = mustParseCIDR("2001::/32")
+	sixToFour     = mustParseCIDR("2002::/16")
+	nat64Network  = mustParseCIDR("64:ff9b::/96")
+)
+
+func init() {
+	for i := range reservedRanges {
+		reservedRanges[i].ipNet = mustParseCIDR(reservedRanges[i].Network)
+	}
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// ErrReserved 查询的是特殊用途地址，可以通过 errors.Is 判断，errors.As 取得 *ReservedError
+var ErrReserved = errors.New("特殊用途地址")
+
+// ReservedError 查询特殊用途地址时返回的错误
+type ReservedError struct {
+	IP       net.IP   `json:"ip"`
+	Reserved Reserved `json:"reserved"`
+}
+
+func (e *ReservedError) Error() string {
+	return "特殊用途地址 " + e.IP.String() + "：" + e.Reserved.Name + "（" + e.Reserved.RFC + "）"
+}
+
+func (e *ReservedError) Is(target error) bool {
+	return target == ErrReserved
+}
+
+// Classify 返回 IP 所属的特殊用途地址段，可全局路由的地址返回 nil。嵌入 IPv4 的地址按 IPv6 地址段判断，
+// 需要判断嵌入的 IPv4 时先调用 EmbeddedIPv4
+func Classify(ip net.IP) *Reserved {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for i := range reservedRanges {
+		if reservedRanges[i].ipNet.Contains(ip) {
+			// Teredo 属于 2001::/23，但可以全局路由
+			if teredoNetwork.Contains(ip) {
+				return nil
+			}
+			reserved := reservedRanges[i]
+			return &reserved
+		}
+	}
+	return nil
+}
+
+// EmbeddedIPv4 提取 6to4（2002::/16）、Teredo（2001::/32，客户端地址）与 NAT64（64:ff9b::/96）地址中嵌入的 IPv4 地址
+func EmbeddedIPv4(ip net.IP) (net.IP, bool) {
+	if ip.To4() != nil || len(ip) != net.IPv6len {
+		return nil, false
+	}
+	switch {
+	case sixToFour.Contains(ip):
+		return net.IPv4(ip[2], ip[3], ip[4], ip[5]).To4(), true
+	case teredoNetwork.Contains(ip):
+		return net.IPv4(^ip[12], ^ip[13], ^ip[14], ^ip[15]).To4(), true
+	case nat64Network.Contains(ip):
+		return net.IPv4(ip[12], ip[13], ip[14], ip[15]).To4(), true
+	}
+	return nil, false
+}
+
+// Normalize 返回实际用于查询数据库的地址：嵌入 IPv4 的地址返回其中的 IPv4，特殊用途地址返回 *ReservedError
+func Normalize(ip net.IP) (net.IP, error) {
+	if embedded, ok := EmbeddedIPv4(ip); ok {
+		ip = embedded
+	}
+	if reserved := Classify(ip); reserved != nil {
+		return nil, &ReservedError{IP: ip, Reserved: *reserved}
+	}
+	return ip, nil
+}
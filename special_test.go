@@ -0,0 +1,90 @@
+package geoip_test
+
+import (
+	"errors"
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"net"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		ip   string
+		kind geoip.ReservedKind
+	}{
+		{"10.1.2.3", geoip.ReservedPrivate},
+		{"172.31.255.255", geoip.ReservedPrivate},
+		{"192.168.1.1", geoip.ReservedPrivate},
+		{"127.0.0.1", geoip.ReservedLoopback},
+		{"169.254.10.1", geoip.ReservedLinkLocal},
+		{"100.100.0.1", geoip.ReservedSharedAddress},
+		{"192.0.2.10", geoip.ReservedDocumentation},
+		{"198.19.0.1", geoip.ReservedBenchmarking},
+		{"224.0.0.251", geoip.ReservedMulticast},
+		{"255.255.255.255", geoip.ReservedBroadcast},
+		{"250.0.0.1", geoip.ReservedFuture},
+		{"::ffff:10.0.0.1", geoip.ReservedPrivate},
+		{"::1", geoip.ReservedLoopback},
+		{"::", geoip.ReservedUnspecified},
+		{"fe80::1", geoip.ReservedLinkLocal},
+		{"fd12:3456::1", geoip.ReservedUniqueLocal},
+		{"ff02::1", geoip.ReservedMulticast},
+		{"2001:db8::1", geoip.ReservedDocumentation},
+		{"2001:2::1", geoip.ReservedProtocol},
+		{"8.8.8.8", ""},
+		{"172.32.0.1", ""},
+		{"2001:4860::1", ""},
+		{"2001:0:4136:e378:8000:63bf:3fff:fdd2", ""},
+	}
+	for _, tt := range tests {
+		reserved := geoip.Classify(net.ParseIP(tt.ip))
+		switch {
+		case tt.kind == "" && reserved != nil:
+			t.Errorf("%s: expected global address, got %+v", tt.ip, reserved)
+		case tt.kind != "" && (reserved == nil || reserved.Kind != tt.kind):
+			t.Errorf("%s: expected %s, got %+v", tt.ip, tt.kind, reserved)
+		}
+	}
+}
+
+func TestEmbeddedIPv4(t *testing.T) {
+	tests := map[string]string{
+		"2002:c000:0204::1":                    "192.0.2.4",
+		"2001:0:4136:e378:8000:63bf:3fff:fdd2": "192.0.2.45",
+		"64:ff9b::1.0.0.1":                     "1.0.0.1",
+	}
+	for ip, want := range tests {
+		got, ok := geoip.EmbeddedIPv4(net.ParseIP(ip))
+		if !ok || !got.Equal(net.ParseIP(want)) {
+			t.Errorf("%s: expected %s, got %s", ip, want, got)
+		}
+	}
+	if _, ok := geoip.EmbeddedIPv4(net.ParseIP("2003::1")); ok {
+		t.Error("2003::1 has no embedded IPv4")
+	}
+}
+
+func TestGeolite2_Reserved(t *testing.T) {
+	geo := newGeolite2(t, geoiptest.Default())
+
+	_, err := geo.CityBlock(net.ParseIP("10.0.0.1"))
+	var reserved *geoip.ReservedError
+	if !errors.Is(err, geoip.ErrReserved) || !errors.As(err, &reserved) || reserved.Reserved.Kind != geoip.ReservedPrivate {
+		t.Fatalf("expected private address error, got %v", err)
+	}
+
+	// 6to4 与 NAT64 地址按嵌入的 IPv4 查询
+	for _, ip := range []string{"2002:0e00:0001::1", "64:ff9b::14.0.0.1"} {
+		block, err := geo.CityBlock(net.ParseIP(ip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Location().CityName != "Guangzhou" {
+			t.Errorf("%s: unexpected location %+v", ip, block.Location())
+		}
+	}
+	if _, err := geo.AsnBlock(net.ParseIP("2002:0a00:0001::1")); !errors.Is(err, geoip.ErrReserved) {
+		t.Errorf("6to4 address embedding a private IPv4 should be reserved, got %v", err)
+	}
+}
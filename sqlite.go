@@ -1,7 +1,8 @@
 package geoip
 
 var asnBlocksIPv4Sql = GeoipSql{
-	CreateTable: `CREATE TABLE GeoLite2ASNBlocksIPv4 (
+	Table: "GeoLite2ASNBlocksIPv4",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoLite2ASNBlocksIPv4 (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     network TEXT,
     start_ip INTEGER,
@@ -10,10 +11,28 @@ var asnBlocksIPv4Sql = GeoipSql{
     autonomous_system_organization TEXT
 );`,
 	Insert: `INSERT INTO GeoLite2ASNBlocksIPv4 (network, start_ip, end_ip, autonomous_system_number, autonomous_system_organization) VALUES(?, ?, ?, ?, ?)`,
+	Index: `CREATE INDEX IF NOT EXISTS GeoLite2ASNBlocksIPv4Start ON GeoLite2ASNBlocksIPv4 (start_ip);
+CREATE INDEX IF NOT EXISTS GeoLite2ASNBlocksIPv4Number ON GeoLite2ASNBlocksIPv4 (autonomous_system_number);`,
+}
+
+var asnBlocksIPv6Sql = GeoipSql{
+	Table: "GeoLite2ASNBlocksIPv6",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoLite2ASNBlocksIPv6 (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    network TEXT,
+    start_ip BLOB,
+    end_ip BLOB,
+    autonomous_system_number TEXT,
+    autonomous_system_organization TEXT
+);`,
+	Insert: `INSERT INTO GeoLite2ASNBlocksIPv6 (network, start_ip, end_ip, autonomous_system_number, autonomous_system_organization) VALUES(?, ?, ?, ?, ?)`,
+	Index: `CREATE INDEX IF NOT EXISTS GeoLite2ASNBlocksIPv6Start ON GeoLite2ASNBlocksIPv6 (start_ip);
+CREATE INDEX IF NOT EXISTS GeoLite2ASNBlocksIPv6Number ON GeoLite2ASNBlocksIPv6 (autonomous_system_number);`,
 }
 
 var cityBlocksIPv4Sql = GeoipSql{
-	CreateTable: `CREATE TABLE GeoLite2CityBlocksIPv4 (
+	Table: "GeoLite2CityBlocksIPv4",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoLite2CityBlocksIPv4 (
       id INTEGER PRIMARY KEY AUTOINCREMENT,
       network TEXT,
       start_ip INTEGER,
@@ -31,9 +50,34 @@ var cityBlocksIPv4Sql = GeoipSql{
 	Insert: `INSERT INTO GeoLite2CityBlocksIPv4 (network, start_ip, end_ip, geoname_id, registered_country_geoname_id, represented_country_geoname_id, 
             is_anonymous_proxy, is_satellite_provider, postal_code, latitude, longitude, accuracy_radius)
             VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+	Index: `CREATE INDEX IF NOT EXISTS GeoLite2CityBlocksIPv4Start ON GeoLite2CityBlocksIPv4 (start_ip);`,
+}
+
+var cityBlocksIPv6Sql = GeoipSql{
+	Table: "GeoLite2CityBlocksIPv6",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoLite2CityBlocksIPv6 (
+      id INTEGER PRIMARY KEY AUTOINCREMENT,
+      network TEXT,
+      start_ip BLOB,
+      end_ip BLOB,
+      geoname_id INTEGER,
+      registered_country_geoname_id TEXT,
+      represented_country_geoname_id TEXT,
+      is_anonymous_proxy INTEGER,
+      is_satellite_provider INTEGER,
+      postal_code TEXT,
+      latitude REAL,
+      longitude REAL,
+      accuracy_radius INTEGER
+);`,
+	Insert: `INSERT INTO GeoLite2CityBlocksIPv6 (network, start_ip, end_ip, geoname_id, registered_country_geoname_id, represented_country_geoname_id, 
+            is_anonymous_proxy, is_satellite_provider, postal_code, latitude, longitude, accuracy_radius)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+	Index: `CREATE INDEX IF NOT EXISTS GeoLite2CityBlocksIPv6Start ON GeoLite2CityBlocksIPv6 (start_ip);`,
 }
 
 var cityLocationsSql = GeoipSql{
+	Table: "GeoLite2CityLocations",
 	CreateTable: `CREATE TABLE IF NOT EXISTS GeoLite2CityLocations (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     geoname_id INTEGER,
@@ -53,10 +97,12 @@ var cityLocationsSql = GeoipSql{
     language TEXT                    
 );`,
 	Insert: `INSERT INTO GeoLite2CityLocations(geoname_id, locale_code, continent_code, continent_name, country_iso_code, country_name, subdivision_1_iso_code, subdivision_1_name, subdivision_2_iso_code, subdivision_2_name, city_name, metro_code, time_zone, is_in_european_union) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	Index:  `CREATE INDEX IF NOT EXISTS GeoLite2CityLocationsGeoname ON GeoLite2CityLocations (geoname_id, locale_code);`,
 }
 
 var countryBlocksIPv4Sql = GeoipSql{
-	CreateTable: `CREATE TABLE GeoLite2CountryBlocksIPv4 (
+	Table: "GeoLite2CountryBlocksIPv4",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoLite2CountryBlocksIPv4 (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     network TEXT,
     start_ip INTEGER,
@@ -68,9 +114,28 @@ var countryBlocksIPv4Sql = GeoipSql{
     is_satellite_provider TEXT
 );`,
 	Insert: `INSERT INTO GeoLite2CountryBlocksIPv4 (network, start_ip, end_ip, geoname_id, registered_country_geoname_id, represented_country_geoname_id, is_anonymous_proxy, is_satellite_provider) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+	Index:  `CREATE INDEX IF NOT EXISTS GeoLite2CountryBlocksIPv4Start ON GeoLite2CountryBlocksIPv4 (start_ip);`,
+}
+
+var countryBlocksIPv6Sql = GeoipSql{
+	Table: "GeoLite2CountryBlocksIPv6",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoLite2CountryBlocksIPv6 (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    network TEXT,
+    start_ip BLOB,
+    end_ip BLOB,
+    geoname_id INTEGER,
+    registered_country_geoname_id TEXT,
+    represented_country_geoname_id TEXT,
+    is_anonymous_proxy TEXT,
+    is_satellite_provider TEXT
+);`,
+	Insert: `INSERT INTO GeoLite2CountryBlocksIPv6 (network, start_ip, end_ip, geoname_id, registered_country_geoname_id, represented_country_geoname_id, is_anonymous_proxy, is_satellite_provider) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+	Index:  `CREATE INDEX IF NOT EXISTS GeoLite2CountryBlocksIPv6Start ON GeoLite2CountryBlocksIPv6 (start_ip);`,
 }
 
 var countryLocationsSql = GeoipSql{
+	Table: "GeoLite2CountryLocations",
 	CreateTable: `CREATE TABLE IF NOT EXISTS GeoLite2CountryLocations (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
   geoname_id INTEGER,
@@ -83,4 +148,135 @@ var countryLocationsSql = GeoipSql{
   language TEXT
 );`,
 	Insert: `INSERT INTO GeoLite2CountryLocations (geoname_id, locale_code, continent_code, continent_name, country_iso_code, country_name, is_in_european_union) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	Index:  `CREATE INDEX IF NOT EXISTS GeoLite2CountryLocationsGeoname ON GeoLite2CountryLocations (geoname_id, locale_code);`,
+}
+
+var cityBlocksIPv4RtreeSql = GeoipSql{
+	Table: "GeoLite2CityBlocksIPv4Rtree",
+	CreateTable: `CREATE VIRTUAL TABLE IF NOT EXISTS GeoLite2CityBlocksIPv4Rtree USING rtree(
+    id,
+    min_latitude, max_latitude,
+    min_longitude, max_longitude
+);`,
+	Insert: `INSERT OR REPLACE INTO GeoLite2CityBlocksIPv4Rtree (id, min_latitude, max_latitude, min_longitude, max_longitude)
+            SELECT id, latitude, latitude, longitude, longitude FROM GeoLite2CityBlocksIPv4
+            WHERE typeof(latitude) = 'real' AND typeof(longitude) = 'real';`,
+}
+
+var cityBlocksIPv6RtreeSql = GeoipSql{
+	Table: "GeoLite2CityBlocksIPv6Rtree",
+	CreateTable: `CREATE VIRTUAL TABLE IF NOT EXISTS GeoLite2CityBlocksIPv6Rtree USING rtree(
+    id,
+    min_latitude, max_latitude,
+    min_longitude, max_longitude
+);`,
+	Insert: `INSERT OR REPLACE INTO GeoLite2CityBlocksIPv6Rtree (id, min_latitude, max_latitude, min_longitude, max_longitude)
+            SELECT id, latitude, latitude, longitude, longitude FROM GeoLite2CityBlocksIPv6
+            WHERE typeof(latitude) = 'real' AND typeof(longitude) = 'real';`,
+}
+
+// cityLocationsRtreeSql 的 Insert 为 fmt 格式，%s 为已加载版本的城市地址段的 UNION ALL 子查询，见 createSpatialIndex
+var cityLocationsRtreeSql = GeoipSql{
+	Table: "GeoLite2CityLocationsRtree",
+	CreateTable: `CREATE VIRTUAL TABLE IF NOT EXISTS GeoLite2CityLocationsRtree USING rtree(
+    id,
+    min_latitude, max_latitude,
+    min_longitude, max_longitude,
+    +latitude REAL,
+    +longitude REAL
+);`,
+	Insert: `INSERT OR REPLACE INTO GeoLite2CityLocationsRtree (id, min_latitude, max_latitude, min_longitude, max_longitude, latitude, longitude)
+            SELECT geoname_id, latitude, latitude, longitude, longitude, latitude, longitude FROM (
+                SELECT geoname_id, latitude, longitude, ROW_NUMBER() OVER (PARTITION BY geoname_id
+                    ORDER BY typeof(accuracy_radius) != 'integer', accuracy_radius, id) AS n
+                FROM (%s)
+                WHERE typeof(geoname_id) = 'integer' AND typeof(latitude) = 'real' AND typeof(longitude) = 'real'
+            ) WHERE n = 1;`,
+}
+
+var overlaySql = GeoipSql{
+	Table: "GeoipOverlay",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoipOverlay (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    network TEXT,
+    version TEXT,
+    start_ip,
+    end_ip,
+    prefix_len INTEGER,
+    label TEXT,
+    geoname_id INTEGER,
+    continent_code TEXT,
+    continent_name TEXT,
+    country_iso_code TEXT,
+    country_name TEXT,
+    subdivision_1_iso_code TEXT,
+    subdivision_1_name TEXT,
+    city_name TEXT,
+    time_zone TEXT,
+    is_in_european_union TEXT,
+    postal_code TEXT,
+    latitude REAL,
+    longitude REAL,
+    accuracy_radius INTEGER,
+    autonomous_system_number INTEGER,
+    autonomous_system_organization TEXT
+);`,
+	Insert: `INSERT INTO GeoipOverlay (network, version, start_ip, end_ip, prefix_len, label, geoname_id, continent_code, continent_name, country_iso_code, country_name, subdivision_1_iso_code, subdivision_1_name, city_name, time_zone, is_in_european_union, postal_code, latitude, longitude, accuracy_radius, autonomous_system_number, autonomous_system_organization) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+}
+
+var tagSql = GeoipSql{
+	Table: "GeoipTags",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoipTags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    network TEXT,
+    version TEXT,
+    start_ip,
+    end_ip,
+    prefix_len INTEGER,
+    name TEXT,
+    service TEXT,
+    region TEXT
+);
+CREATE INDEX IF NOT EXISTS GeoipTagsName ON GeoipTags (name);
+CREATE INDEX IF NOT EXISTS GeoipTagsStart ON GeoipTags (version, start_ip);
+CREATE INDEX IF NOT EXISTS GeoipTagsPrefix ON GeoipTags (version, prefix_len);`,
+	Insert: `INSERT INTO GeoipTags (network, version, start_ip, end_ip, prefix_len, name, service, region) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+}
+
+var rirSql = GeoipSql{
+	Table: "GeoipRIRBlocks",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoipRIRBlocks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    network TEXT,
+    version TEXT,
+    start_ip,
+    end_ip,
+    prefix_len INTEGER,
+    registry TEXT,
+    country_iso_code TEXT,
+    date TEXT,
+    status TEXT,
+    opaque_id TEXT
+);
+CREATE INDEX IF NOT EXISTS GeoipRIRBlocksCountry ON GeoipRIRBlocks (country_iso_code);
+CREATE INDEX IF NOT EXISTS GeoipRIRBlocksStart ON GeoipRIRBlocks (version, start_ip);`,
+	Insert: `INSERT INTO GeoipRIRBlocks (network, version, start_ip, end_ip, prefix_len, registry, country_iso_code, date, status, opaque_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+}
+
+var routeSql = GeoipSql{
+	Table: "GeoipBGPRoutes",
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoipBGPRoutes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    network TEXT,
+    version TEXT,
+    start_ip,
+    end_ip,
+    prefix_len INTEGER,
+    autonomous_system_number INTEGER,
+    peers INTEGER,
+    moas TEXT
+);
+CREATE INDEX IF NOT EXISTS GeoipBGPRoutesStart ON GeoipBGPRoutes (version, start_ip);
+CREATE INDEX IF NOT EXISTS GeoipBGPRoutesASN ON GeoipBGPRoutes (autonomous_system_number);`,
+	Insert: `INSERT INTO GeoipBGPRoutes (network, version, start_ip, end_ip, prefix_len, autonomous_system_number, peers, moas) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
 }
@@ -0,0 +1,177 @@
+package geoip
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os"
+)
+
+// checkpointRows 写入暂存表时每提交一次事务的行数，每次提交同时记录断点
+var checkpointRows int64 = 100000
+
+const checkpointTable = "GeoLite2LoadCheckpoint"
+
+var checkpointSql = GeoipSql{
+	Table: checkpointTable,
+	CreateTable: `CREATE TABLE IF NOT EXISTS GeoLite2LoadCheckpoint (
+    path TEXT PRIMARY KEY,
+    fingerprint TEXT,
+    rows INTEGER,
+    done INTEGER
+);`,
+	Insert: `INSERT OR REPLACE INTO GeoLite2LoadCheckpoint (path, fingerprint, rows, done) VALUES (?, ?, ?, ?);`,
+}
+
+// execer *sql.DB 与 *sql.Tx 共有的执行方法
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// checkpoint 一个 CSV 文件的加载断点，rows 为已提交到暂存表的行数
+type checkpoint struct {
+	fingerprint string
+	rows        int64
+	done        bool
+}
+
+// fingerprint 以表名、文件大小及修改时间标识 CSV 文件，文件变化后断点失效
+func fingerprint(table csvTable) string {
+	info, err := os.Stat(table.path)
+	if err != nil {
+		return table.sql.Table
+	}
+	return fmt.Sprintf("%s:%d:%d", table.sql.Table, info.Size(), info.ModTime().UnixNano())
+}
+
+// checkpoints 读取上次未完成加载的断点。断点与本次加载的文件不一致时清空暂存表，从头加载
+func (loader *GeoLite2Loader) checkpoints(tables []csvTable) (map[string]checkpoint, error) {
+	if _, err := loader.db.Exec(checkpointSql.CreateTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := loader.db.Query("SELECT path, fingerprint, rows, done FROM " + checkpointTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make(map[string]checkpoint)
+	for rows.Next() {
+		var path string
+		var point checkpoint
+		if err := rows.Scan(&path, &point.fingerprint, &point.rows, &point.done); err != nil {
+			return nil, err
+		}
+		points[path] = point
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	files := make(map[string]string)
+	for _, table := range tables {
+		files[table.path] = fingerprint(table)
+	}
+	resume := len(points) > 0
+	for path, point := range points {
+		if files[path] != point.fingerprint {
+			resume = false
+			break
+		}
+	}
+	if resume {
+		log.Debug().Msg(fmt.Sprintf("从断点继续加载，已记录 %d 个文件", len(points)))
+		return points, nil
+	}
+
+	return nil, loader.resetStaging()
+}
+
+// resetStaging 删除全部暂存表及断点
+func (loader *GeoLite2Loader) resetStaging() error {
+	rows, err := loader.db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE ? ESCAPE '\'`,
+		"staging\\_%")
+	if err != nil {
+		return err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, err := loader.db.Exec("DROP TABLE IF EXISTS " + name); err != nil {
+			return err
+		}
+	}
+	_, err = loader.db.Exec("DELETE FROM " + checkpointTable)
+	return err
+}
+
+// saveCheckpoint 在写入数据的同一事务中记录断点
+func saveCheckpoint(tx execer, table csvTable, rows int64, done bool) error {
+	_, err := tx.Exec(checkpointSql.Insert, table.path, fingerprint(table), rows, done)
+	return err
+}
+
+// swap 在一个事务中用暂存表替换正式表并重建索引与空间索引，未加载的表（如其他版本或自定义表）保持不变
+func (loader *GeoLite2Loader) swap(tables []csvTable) (err error) {
+	tx, err := loader.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	swapped := make(map[string]bool)
+	for _, table := range tables {
+		if swapped[table.sql.Table] {
+			continue
+		}
+		swapped[table.sql.Table] = true
+		if _, err = tx.Exec("DROP TABLE IF EXISTS " + table.sql.Table); err != nil {
+			return err
+		}
+		if _, err = tx.Exec("ALTER TABLE " + table.sql.staging().Table + " RENAME TO " + table.sql.Table); err != nil {
+			return err
+		}
+		if table.sql.Index != "" {
+			log.Debug().Msg("开始创建 [" + table.sql.Table + "] 索引")
+			if _, err = tx.Exec(table.sql.Index); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 空间索引中的 id 对应城市地址段的 id，替换任一版本的城市地址段后需要重建
+	if swapped[cityBlocksIPv4Sql.Table] || swapped[cityBlocksIPv6Sql.Table] {
+		log.Debug().Msg("开始创建 [CityBlocksRtree] 空间索引")
+		if err = createSpatialIndex(tx); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec("DELETE FROM " + checkpointTable); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	schemaChanged()
+	return nil
+}
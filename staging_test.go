@@ -0,0 +1,65 @@
+package geoip
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeoLite2Loader_Resume(t *testing.T) {
+	defer func(rows int64) { checkpointRows = rows }(checkpointRows)
+	checkpointRows = 1
+
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "geoip2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	asn := filepath.Join(dir, "GeoLite2-ASN-CSV")
+	if err := os.MkdirAll(asn, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(asn, asnBlocksIPv4FilePrefix+".csv"),
+		[]byte("network,autonomous_system_number,autonomous_system_organization\n"+
+			"1.0.0.0/24,13335,CLOUDFLARENET\n5.0.0.0/16,3320,Deutsche Telekom AG\n14.0.0.0/16,4134,CHINANET-BACKBONE\n"),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+	loader := NewGeoLite2Loader(db)
+	loader.SetEditions(EditionASN)
+	tables := loader.tables(asn, "", "")
+	if _, err := loader.checkpoints(tables); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟中断：前两行已提交并记录断点
+	staging := tables[0].sql.staging()
+	if _, err := db.Exec(staging.CreateTable); err != nil {
+		t.Fatal(err)
+	}
+	for _, network := range []string{"1.0.0.0/24", "5.0.0.0/16"} {
+		args, _ := convertBlock([]string{network, "0", "resumed"})
+		if _, err := db.Exec(staging.Insert, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := saveCheckpoint(db, tables[0], 2, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loader.Local(asn, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, db, "GeoLite2ASNBlocksIPv4"); n != 3 {
+		t.Errorf("expected 3 rows, got %d", n)
+	}
+	if n := countRows(t, db, "GeoLite2ASNBlocksIPv4 WHERE autonomous_system_organization = 'resumed'"); n != 2 {
+		t.Errorf("rows before the checkpoint should not be reloaded, got %d", n)
+	}
+	if n := countRows(t, db, checkpointTable); n != 0 {
+		t.Errorf("checkpoints should be cleared, got %d", n)
+	}
+}
@@ -0,0 +1,561 @@
+package geoip
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Tag 带标签的地址段，如云服务商地址段、Tor 出口节点及黑名单。
+// Name 为标签名，同一标签的地址段整体导入及替换；Service、Region 为云服务商提供的服务及区域，其他来源为空
+type Tag struct {
+	ID      int64  `json:"id"`
+	Network string `json:"network"`
+	Name    string `json:"name"`
+	Service string `json:"service,omitempty"`
+	Region  string `json:"region,omitempty"`
+}
+
+// TagFormat 标签地址段文件的格式
+type TagFormat string
+
+const (
+	// TagFormatAWS AWS ip-ranges.json
+	TagFormatAWS TagFormat = "aws"
+	// TagFormatGCP GCP cloud.json 或 goog.json
+	TagFormatGCP TagFormat = "gcp"
+	// TagFormatAzure Azure ServiceTags_*.json
+	TagFormatAzure TagFormat = "azure"
+	// TagFormatTor Tor exit-addresses 或每行一个 IP 的出口节点列表
+	TagFormatTor TagFormat = "tor"
+	// TagFormatList 每行一个 IP 或 CIDR 的通用列表，# 及 ; 之后为注释
+	TagFormatList TagFormat = "list"
+)
+
+// 各格式导入时默认使用的标签名
+const (
+	TagAWS     = "aws"
+	TagGCP     = "gcp"
+	TagAzure   = "azure"
+	TagTorExit = "tor-exit"
+)
+
+// ParseTagFormat 解析标签文件格式名称
+func ParseTagFormat(name string) (TagFormat, error) {
+	switch format := TagFormat(strings.ToLower(name)); format {
+	case TagFormatAWS, TagFormatGCP, TagFormatAzure, TagFormatTor, TagFormatList:
+		return format, nil
+	}
+	return "", errors.New("不支持的标签文件格式：" + name)
+}
+
+// defaultName 格式对应的默认标签名，通用列表没有默认标签名
+func (format TagFormat) defaultName() string {
+	switch format {
+	case TagFormatAWS:
+		return TagAWS
+	case TagFormatGCP:
+		return TagGCP
+	case TagFormatAzure:
+		return TagAzure
+	case TagFormatTor:
+		return TagTorExit
+	}
+	return ""
+}
+
+// ParseTags 按 format 解析标签文件，返回的 Tag 使用该格式的默认标签名，通用列表的标签名为空
+func ParseTags(format TagFormat, r io.Reader) ([]Tag, error) {
+	switch format {
+	case TagFormatAWS:
+		return ParseAWSRanges(r)
+	case TagFormatGCP:
+		return ParseGCPRanges(r)
+	case TagFormatAzure:
+		return ParseAzureServiceTags(r)
+	case TagFormatTor:
+		return ParseTorExits(r)
+	case TagFormatList:
+		return ParseCIDRList("", r)
+	}
+	return nil, errors.New("不支持的标签文件格式：" + string(format))
+}
+
+// newTag 以规范的 CIDR 创建 Tag
+func newTag(name, network, service, region string) (Tag, error) {
+	ipNet, err := parseNetwork(network)
+	if err != nil {
+		return Tag{}, fmt.Errorf("无效的地址段 %s：%w", network, err)
+	}
+	return Tag{Network: ipNet.String(), Name: name, Service: service, Region: region}, nil
+}
+
+// ParseAWSRanges 解析 AWS ip-ranges.json，同一地址段按 service 分别返回，如 AMAZON 与 EC2
+func ParseAWSRanges(r io.Reader) ([]Tag, error) {
+	var ranges struct {
+		Prefixes []struct {
+			IPPrefix string `json:"ip_prefix"`
+			Region   string `json:"region"`
+			Service  string `json:"service"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix string `json:"ipv6_prefix"`
+			Region     string `json:"region"`
+			Service    string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&ranges); err != nil {
+		return nil, err
+	}
+
+	tags := make([]Tag, 0, len(ranges.Prefixes)+len(ranges.IPv6Prefixes))
+	for _, prefix := range ranges.Prefixes {
+		tag, err := newTag(TagAWS, prefix.IPPrefix, prefix.Service, prefix.Region)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	for _, prefix := range ranges.IPv6Prefixes {
+		tag, err := newTag(TagAWS, prefix.IPv6Prefix, prefix.Service, prefix.Region)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// ParseGCPRanges 解析 GCP cloud.json 或 goog.json，scope 作为 Region
+func ParseGCPRanges(r io.Reader) ([]Tag, error) {
+	var ranges struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&ranges); err != nil {
+		return nil, err
+	}
+
+	tags := make([]Tag, 0, len(ranges.Prefixes))
+	for _, prefix := range ranges.Prefixes {
+		network := prefix.IPv4Prefix
+		if network == "" {
+			network = prefix.IPv6Prefix
+		}
+		tag, err := newTag(TagGCP, network, prefix.Service, prefix.Scope)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// ParseAzureServiceTags 解析 Azure ServiceTags_*.json，服务标签名（如 AzureCloud.eastus）作为 Service。
+// Azure 的服务标签相互包含，同一地址段通常属于多个 Service
+func ParseAzureServiceTags(r io.Reader) ([]Tag, error) {
+	var serviceTags struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := json.NewDecoder(r).Decode(&serviceTags); err != nil {
+		return nil, err
+	}
+
+	var tags []Tag
+	for _, value := range serviceTags.Values {
+		for _, prefix := range value.Properties.AddressPrefixes {
+			tag, err := newTag(TagAzure, prefix, value.Name, value.Properties.Region)
+			if err != nil {
+				return nil, err
+			}
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// ParseTorExits 解析 Tor exit-addresses（取 ExitAddress 行）或每行一个 IP 的出口节点列表，重复的地址只返回一次
+func ParseTorExits(r io.Reader) ([]Tag, error) {
+	seen := make(map[string]bool)
+	var tags []Tag
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		var address string
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "#"):
+			continue
+		case fields[0] == "ExitAddress" && len(fields) > 1:
+			address = fields[1]
+		case len(fields) == 1 && net.ParseIP(fields[0]) != nil:
+			address = fields[0]
+		default:
+			// ExitNode、Published 等其他行
+			continue
+		}
+		tag, err := newTag(TagTorExit, address, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行：%w", line, err)
+		}
+		if !seen[tag.Network] {
+			seen[tag.Network] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, scanner.Err()
+}
+
+// ParseCIDRList 解析每行一个 IP 或 CIDR 的列表，# 及 ; 之后为注释，行内第一个字段之后的内容忽略，
+// 兼容 Spamhaus DROP（1.10.16.0/20 ; SBL256894）及 FireHOL 等常见格式
+func ParseCIDRList(name string, r io.Reader) ([]Tag, error) {
+	var tags []Tag
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexAny(text, "#;"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(fields) == 0 {
+			continue
+		}
+		tag, err := newTag(name, fields[0], "", "")
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行：%w", line, err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, scanner.Err()
+}
+
+// TagLoader 管理标签地址段表。标签数据与 GeoLite2 数据分表保存，重新加载 GeoLite2 时不受影响
+type TagLoader struct {
+	db *sql.DB
+}
+
+func NewTagLoader(db *sql.DB) *TagLoader {
+	return &TagLoader{db: db}
+}
+
+// Load 在一个事务中以 tags 替换标签 name 的全部地址段，tags 的 Name 统一设为 name
+func (loader *TagLoader) Load(name string, tags []Tag) (err error) {
+	if name == "" {
+		return errors.New("标签名不能为空")
+	}
+	tx, err := loader.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(tagSql.CreateTable); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM "+tagSql.Table+" WHERE name = ?", name); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(tagSql.Insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, tag := range tags {
+		_, ipNet, err := net.ParseCIDR(tag.Network)
+		if err != nil {
+			return fmt.Errorf("无效的标签地址段 %s：%w", tag.Network, err)
+		}
+		version, start, end := overlayRange(ipNet)
+		ones, _ := ipNet.Mask.Size()
+		if _, err = stmt.Exec(ipNet.String(), version, start, end, ones, name, tag.Service, tag.Region); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	schemaChanged()
+	log.Debug().Msgf("标签 %s 已加载 %d 个地址段", name, len(tags))
+	return nil
+}
+
+// Import 按 format 读取标签文件并替换标签 name 的全部地址段，name 为空时使用该格式的默认标签名，返回加载的条数
+func (loader *TagLoader) Import(format TagFormat, name, path string) (int, error) {
+	if name == "" {
+		name = format.defaultName()
+	}
+	if name == "" {
+		return 0, errors.New("通用列表需要指定标签名")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	tags, err := ParseTags(format, file)
+	if err != nil {
+		return 0, fmt.Errorf("%s：%w", path, err)
+	}
+	return len(tags), loader.Load(name, tags)
+}
+
+// Delete 删除标签 name 的全部地址段
+func (loader *TagLoader) Delete(name string) error {
+	exists, err := tableExists(loader.db, tagSql.Table)
+	if err != nil || !exists {
+		return err
+	}
+	_, err = loader.db.Exec("DELETE FROM "+tagSql.Table+" WHERE name = ?", name)
+	return err
+}
+
+const tagQuery = "SELECT id, network, name, service, region FROM GeoipTags"
+
+// tagOrder 同一 IP 的多个标签按起始地址、前缀长度（由大到小的地址段）、标签名排序，LookupMany 与 Tags 一致
+const tagOrder = " ORDER BY start_ip, prefix_len, name, id"
+
+func scanTag(row interface{ Scan(...interface{}) error }) (Tag, error) {
+	var tag Tag
+	err := row.Scan(&tag.ID, &tag.Network, &tag.Name, &tag.Service, &tag.Region)
+	return tag, err
+}
+
+func (geo Geolite2) queryTags(query string, args ...interface{}) ([]Tag, error) {
+	exists, err := geo.tableExists(tagSql.Table)
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := geo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// Tags 返回包含 IP 的全部标签地址段，没有时返回空数组。与覆盖地址段相同，特殊用途地址同样可以打标签
+func (geo Geolite2) Tags(ip net.IP) ([]Tag, error) {
+	version, key, ok := overlayKey(ip)
+	if !ok {
+		return nil, errors.New("无效的 IP 地址：" + ip.String())
+	}
+	return geo.queryTags(tagQuery+" WHERE version = ? AND ? BETWEEN start_ip AND end_ip"+tagOrder, version, key)
+}
+
+// TagNames 返回数据库中的全部标签名
+func (geo Geolite2) TagNames() ([]string, error) {
+	exists, err := geo.tableExists(tagSql.Table)
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := geo.db.Query("SELECT DISTINCT name FROM GeoipTags ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// BlocksByTag 返回标签 name 的全部地址段
+func (geo Geolite2) BlocksByTag(name string) ([]Tag, error) {
+	return geo.queryTags(tagQuery+" WHERE name = ? ORDER BY id", name)
+}
+
+// RangeBlocksByTag 按页逐条回调标签 name 的地址段，游标为 id
+func (geo Geolite2) RangeBlocksByTag(name string, page Page, fn func(Tag) bool) error {
+	cursor, args := page.cursor("id", name)
+	limit, args := page.limit("id", args...)
+	exists, err := geo.tableExists(tagSql.Table)
+	if err != nil || !exists {
+		return err
+	}
+	rows, err := geo.db.Query(tagQuery+" WHERE name = ?"+cursor+limit, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return err
+		}
+		if !fn(tag) {
+			return nil
+		}
+	}
+	return rows.Err()
+}
+
+// tagKey 批量查询标签时去重后的地址
+type tagKey struct {
+	version string
+	value   interface{}
+	tags    []Tag
+}
+
+// lookupTags 为批量查询结果填充标签。标签地址段可以相互包含，地址排序后分批范围查询，
+// 按起始地址扫描时维护包含当前地址的地址段集合
+func (geo Geolite2) lookupTags(results []LookupResult, batchSize int) error {
+	exists, err := geo.tableExists(tagSql.Table)
+	if err != nil || !exists {
+		return err
+	}
+	unique := make(map[string]*tagKey)
+	var keys []*tagKey
+	for _, result := range results {
+		version, value, ok := overlayKey(result.IP)
+		if !ok {
+			continue
+		}
+		if n, ok := value.(uint32); ok {
+			value = int64(n)
+		}
+		id := version + string(IP2Bytes(result.IP))
+		if _, ok := unique[id]; !ok {
+			unique[id] = &tagKey{version: version, value: value}
+			keys = append(keys, unique[id])
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].version != keys[j].version {
+			return keys[i].version == "IPv4"
+		}
+		return compareKey(keys[i].value, keys[j].value) < 0
+	})
+
+	prefixes := make(map[string]sql.NullInt64)
+	for start := 0; start < len(keys); {
+		end := start + 1
+		for end < len(keys) && end-start < batchSize && keys[end].version == keys[start].version {
+			end++
+		}
+		version := keys[start].version
+		prefix, ok := prefixes[version]
+		if !ok {
+			if err := geo.db.QueryRow("SELECT MIN(prefix_len) FROM GeoipTags WHERE version = ?",
+				version).Scan(&prefix); err != nil {
+				return err
+			}
+			prefixes[version] = prefix
+		}
+		if prefix.Valid {
+			if err := geo.sweepTags(keys[start:end], int(prefix.Int64)); err != nil {
+				return err
+			}
+		}
+		start = end
+	}
+
+	for i := range results {
+		if version, _, ok := overlayKey(results[i].IP); ok {
+			results[i].Tags = unique[version+string(IP2Bytes(results[i].IP))].tags
+		}
+	}
+	return nil
+}
+
+// tagSweepQuery sweepTags 的查询，参数为协议、起始地址的下界与上界及第一个地址
+const tagSweepQuery = "SELECT start_ip, end_ip, id, network, name, service, region FROM GeoipTags " +
+	"WHERE version = ? AND start_ip BETWEEN ? AND ? AND end_ip >= ?" + tagOrder
+
+// sweepTags 查询一批已排序且协议相同的地址的标签。标签地址段可以相互包含，不能像 overlapQuery 那样
+// 从包含第一个地址的地址段开始查找；prefix 为该协议最短的前缀长度，包含第一个地址的标签地址段
+// 起始地址不小于第一个地址按 prefix 取的网络地址，以此作为 start_ip 索引查找的下界
+func (geo Geolite2) sweepTags(keys []*tagKey, prefix int) error {
+	first, last := keys[0].value, keys[len(keys)-1].value
+	rows, err := geo.db.Query(tagSweepQuery, keys[0].version, maskKey(first, prefix), last, first)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type tagRange struct {
+		start, end interface{}
+		tag        Tag
+	}
+	next := func() (*tagRange, error) {
+		if !rows.Next() {
+			return nil, rows.Err()
+		}
+		var r tagRange
+		err := rows.Scan(&r.start, &r.end, &r.tag.ID, &r.tag.Network, &r.tag.Name, &r.tag.Service, &r.tag.Region)
+		return &r, err
+	}
+
+	pending, err := next()
+	if err != nil {
+		return err
+	}
+	var active []*tagRange
+	for _, key := range keys {
+		for pending != nil && compareKey(pending.start, key.value) <= 0 {
+			active = append(active, pending)
+			if pending, err = next(); err != nil {
+				return err
+			}
+		}
+		n := 0
+		for _, r := range active {
+			if compareKey(r.end, key.value) >= 0 {
+				active[n] = r
+				n++
+			}
+		}
+		active = active[:n]
+		for _, r := range active {
+			key.tags = append(key.tags, r.tag)
+		}
+	}
+	return nil
+}
+
+// maskKey 返回查询参数 value 按前缀长度 bits 取的网络地址，IPv4 为整数，IPv6 为 16 字节 BLOB
+func maskKey(value interface{}, bits int) interface{} {
+	if key, ok := value.([]byte); ok {
+		return []byte(net.IP(key).Mask(net.CIDRMask(bits, 8*net.IPv6len)))
+	}
+	return value.(int64) &^ (1<<(32-bits) - 1)
+}
@@ -0,0 +1,230 @@
+package geoip_test
+
+import (
+	geoip "github.com/sechelper/geoip2"
+	"github.com/sechelper/geoip2/geoiptest"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const awsRanges = `{
+  "syncToken": "1697000000",
+  "createDate": "2023-10-11-05-13-07",
+  "prefixes": [
+    {"ip_prefix": "8.8.0.0/16", "region": "us-east-1", "service": "AMAZON", "network_border_group": "us-east-1"},
+    {"ip_prefix": "8.8.8.0/24", "region": "us-east-1", "service": "EC2", "network_border_group": "us-east-1"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2001:4860::/32", "region": "GLOBAL", "service": "AMAZON", "network_border_group": "GLOBAL"}
+  ]
+}`
+
+const gcpRanges = `{"syncToken": "1697000000", "creationTime": "2023-10-11T05:13:07",
+  "prefixes": [{"ipv4Prefix": "14.0.0.0/17", "service": "Google Cloud", "scope": "asia-east2"},
+    {"ipv6Prefix": "2003::/19", "service": "Google Cloud", "scope": "europe-west3"}]}`
+
+const azureServiceTags = `{"changeNumber": 1, "cloud": "Public", "values": [
+  {"name": "AzureCloud", "id": "AzureCloud", "properties": {"region": "", "addressPrefixes": ["5.0.0.0/8"]}},
+  {"name": "AzureCloud.germanywestcentral", "id": "AzureCloud.germanywestcentral",
+    "properties": {"region": "germanywestcentral", "addressPrefixes": ["5.0.0.0/16", "2a01:111::/32"]}}]}`
+
+const torExits = `ExitNode 0011BD2485AD45D984EC4159C88FC066E5E3300E
+Published 2023-10-11 03:03:53
+LastStatus 2023-10-11 04:00:00
+ExitAddress 185.220.100.7 2023-10-11 04:09:35
+ExitNode 0111BA9B604669E636FFD5B503F382A4B7AD6E80
+ExitAddress 185.220.100.7 2023-10-11 05:09:35
+192.0.2.15
+`
+
+const blocklist = `; Spamhaus DROP List 2023/10/11
+10.0.0.0/8 ; SBL000001
+8.8.8.8
+# comment
+
+185.220.100.0/24,tor
+`
+
+func TestParseTags(t *testing.T) {
+	tags, err := geoip.ParseAWSRanges(strings.NewReader(awsRanges))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := geoip.Tag{Network: "8.8.8.0/24", Name: geoip.TagAWS, Service: "EC2", Region: "us-east-1"}
+	if len(tags) != 3 || tags[1] != want || tags[2].Network != "2001:4860::/32" {
+		t.Errorf("unexpected aws tags %+v", tags)
+	}
+
+	if tags, err = geoip.ParseGCPRanges(strings.NewReader(gcpRanges)); err != nil || len(tags) != 2 ||
+		tags[1].Network != "2003::/19" || tags[1].Region != "europe-west3" {
+		t.Errorf("unexpected gcp tags %+v %v", tags, err)
+	}
+
+	if tags, err = geoip.ParseAzureServiceTags(strings.NewReader(azureServiceTags)); err != nil || len(tags) != 3 ||
+		tags[2].Service != "AzureCloud.germanywestcentral" || tags[2].Region != "germanywestcentral" {
+		t.Errorf("unexpected azure tags %+v %v", tags, err)
+	}
+
+	if tags, err = geoip.ParseTorExits(strings.NewReader(torExits)); err != nil || len(tags) != 2 ||
+		tags[0].Network != "185.220.100.7/32" || tags[1].Network != "192.0.2.15/32" {
+		t.Errorf("unexpected tor tags %+v %v", tags, err)
+	}
+
+	if tags, err = geoip.ParseCIDRList("drop", strings.NewReader(blocklist)); err != nil || len(tags) != 3 ||
+		tags[0].Network != "10.0.0.0/8" || tags[2].Network != "185.220.100.0/24" || tags[2].Name != "drop" {
+		t.Errorf("unexpected list tags %+v %v", tags, err)
+	}
+	if _, err := geoip.ParseCIDRList("drop", strings.NewReader("10.0.0.0/8\nexample.com\n")); err == nil ||
+		!strings.Contains(err.Error(), "第 2 行") {
+		t.Errorf("want line number in error, got %v", err)
+	}
+	if _, err := geoip.ParseTagFormat("ovh"); err == nil {
+		t.Error("unsupported format should fail")
+	}
+}
+
+func TestGeolite2_Tags(t *testing.T) {
+	dataset := geoiptest.Default()
+	db := loadDataset(t, dataset)
+	dir := t.TempDir()
+	loader := geoip.NewTagLoader(db)
+	fake := geoiptest.NewFake(dataset)
+
+	for _, file := range []struct {
+		format  geoip.TagFormat
+		name    string
+		content string
+	}{
+		{geoip.TagFormatAWS, "", awsRanges},
+		{geoip.TagFormatGCP, "", gcpRanges},
+		{geoip.TagFormatAzure, "", azureServiceTags},
+		{geoip.TagFormatTor, "", torExits},
+		{geoip.TagFormatList, "drop", blocklist},
+		// 重新导入替换同名标签的全部地址段
+		{geoip.TagFormatAWS, "", awsRanges},
+	} {
+		path := filepath.Join(dir, string(file.format))
+		if err := os.WriteFile(path, []byte(file.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loader.Import(file.format, file.name, path); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, err := geoip.ParseTags(file.format, f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := file.name
+		if name == "" {
+			name = tags[0].Name
+		}
+		fake.SetTags(name, tags)
+	}
+	if _, err := loader.Import(geoip.TagFormatList, "", filepath.Join(dir, "list")); err == nil {
+		t.Error("list without tag name should fail")
+	}
+
+	geo := geoip.NewGeolite2(db)
+	tags, err := geo.Tags(net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name+"/"+tag.Service)
+	}
+	if strings.Join(names, " ") != "aws/AMAZON aws/EC2 drop/" {
+		t.Errorf("unexpected tags %v", names)
+	}
+	if tags, err := geo.Tags(net.ParseIP("10.1.2.3")); err != nil || len(tags) != 1 || tags[0].Name != "drop" {
+		t.Errorf("special-purpose addresses should be tagged, got %+v %v", tags, err)
+	}
+	if tags, err := geo.Tags(net.ParseIP("1.0.0.1")); err != nil || tags != nil {
+		t.Errorf("want no tags, got %+v %v", tags, err)
+	}
+
+	names, err = geo.TagNames()
+	if err != nil || strings.Join(names, ",") != "aws,azure,drop,gcp,tor-exit" {
+		t.Errorf("unexpected tag names %v %v", names, err)
+	}
+	aws, err := geo.BlocksByTag(geoip.TagAWS)
+	if err != nil || len(aws) != 3 {
+		t.Fatalf("unexpected aws blocks %+v %v", aws, err)
+	}
+	var paged []geoip.Tag
+	for page := (geoip.Page{Limit: 2}); ; {
+		n := 0
+		if err := geo.RangeBlocksByTag(geoip.TagAWS, page, func(tag geoip.Tag) bool {
+			paged = append(paged, tag)
+			page.After = tag.ID
+			n++
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if n < page.Limit {
+			break
+		}
+	}
+	if !reflect.DeepEqual(paged, aws) {
+		t.Errorf("paged %+v, want %+v", paged, aws)
+	}
+
+	for _, name := range names {
+		got, err := geo.BlocksByTag(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := fake.BlocksByTag(name)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: sqlite %+v, fake %+v", name, got, want)
+		}
+	}
+
+	ips := append(lookupIPs(), net.ParseIP("185.220.100.7"), net.ParseIP("5.0.200.1"), net.ParseIP("2a01:111::1"))
+	options := geoip.LookupOptions{BatchSize: 3}
+	results, err := geo.LookupMany(ips, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := fake.LookupMany(ips, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if !reflect.DeepEqual(result, want[i]) {
+			t.Errorf("%s: sqlite %+v, fake %+v", ips[i], result, want[i])
+		}
+		tags, err := geo.Tags(ips[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tags, result.Tags) {
+			t.Errorf("%s: Tags %+v, LookupMany %+v", ips[i], tags, result.Tags)
+		}
+	}
+	// 相互包含的标签地址段按最短前缀限定 start_ip 索引查找的下界
+	if plan := geoip.QueryPlan(t, db, geoip.TagSweepQuery, "IPv4", 0, 1, 1); !strings.Contains(plan,
+		"SEARCH GeoipTags USING INDEX GeoipTagsStart (version=? AND start_ip>? AND start_ip<?)") {
+		t.Errorf("tag sweep should bound the start_ip index on both sides: %s", plan)
+	}
+	if tor := results[len(ips)-3].Tags; len(tor) != 2 || tor[0].Name != "drop" || tor[1].Name != "tor-exit" {
+		t.Errorf("185.220.100.7 should be tagged drop and tor-exit, got %+v", results[len(ips)-3].Tags)
+	}
+
+	if err := loader.Delete("drop"); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := geo.Tags(net.ParseIP("10.1.2.3")); err != nil || tags != nil {
+		t.Errorf("deleted tag should not match, got %+v %v", tags, err)
+	}
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Limits 解压限制，用于防御压缩炸弹，字段为 0 表示不限制
+type Limits struct {
+	// MaxFileSize 单个文件解压后的最大字节数
+	MaxFileSize int64
+	// MaxTotalSize 全部文件解压后的最大字节数
+	MaxTotalSize int64
+	// MaxFiles 最多解压的文件数
+	MaxFiles int
+}
+
+// DefaultLimits 默认解压限制，足以容纳 GeoLite2 各版本数据
+var DefaultLimits = Limits{
+	MaxFileSize:  4 << 30,
+	MaxTotalSize: 16 << 30,
+	MaxFiles:     1024,
+}
+
+var ErrLimitExceeded = errors.New("解压内容超出限制")
+
+// Extract 按文件后缀解压 zip 或 tar.gz 压缩包到 des 目录
+func Extract(src string, des string) error {
+	switch {
+	case strings.HasSuffix(src, ".zip"):
+		return Unzip(src, des)
+	case strings.HasSuffix(src, ".tar.gz"), strings.HasSuffix(src, ".tgz"):
+		return Untar(src, des)
+	default:
+		return fmt.Errorf("不支持的压缩格式：%s", filepath.Base(src))
+	}
+}
+
+// TrimArchiveSuffix 去除压缩包后缀，GeoLite2 压缩包解压后的目录名与去除后缀的文件名相同
+func TrimArchiveSuffix(name string) string {
+	for _, suffix := range []string{".zip", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// safeJoin 拼接解压路径，拒绝绝对路径及跳出 des 目录的路径
+func safeJoin(des string, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("非法的压缩包路径：%q", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("非法的压缩包路径：%q", name)
+		}
+	}
+
+	path := filepath.Join(des, filepath.FromSlash(name))
+	rel, err := filepath.Rel(des, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("非法的压缩包路径：%q", name)
+	}
+
+	return path, nil
+}
+
+// extractor 记录解压进度，检查是否超出限制
+type extractor struct {
+	des    string
+	limits Limits
+	files  int
+	total  int64
+}
+
+// writeFile 将 reader 中的内容写入 name，每个文件写完立即关闭
+func (e *extractor) writeFile(name string, mode os.FileMode, reader io.Reader) error {
+	path, err := safeJoin(e.des, name)
+	if err != nil {
+		return err
+	}
+
+	e.files++
+	if e.limits.MaxFiles > 0 && e.files > e.limits.MaxFiles {
+		return ErrLimitExceeded
+	}
+	// 总大小已用尽时 limit 为 0，不能再按不限制处理
+	if e.limits.MaxTotalSize > 0 && e.limits.MaxTotalSize-e.total <= 0 {
+		return ErrLimitExceeded
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	targetFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer targetFile.Close()
+
+	limit := e.limits.MaxFileSize
+	if e.limits.MaxTotalSize > 0 && (limit <= 0 || e.limits.MaxTotalSize-e.total < limit) {
+		limit = e.limits.MaxTotalSize - e.total
+	}
+	if limit > 0 {
+		reader = io.LimitReader(reader, limit+1)
+	}
+
+	n, err := io.Copy(targetFile, reader)
+	e.total += n
+	if err != nil {
+		return err
+	}
+	if limit > 0 && n > limit {
+		return ErrLimitExceeded
+	}
+
+	return targetFile.Close()
+}
+
+// mkdir 创建压缩包中的目录
+func (e *extractor) mkdir(name string) error {
+	path, err := safeJoin(e.des, name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, os.ModePerm)
+}
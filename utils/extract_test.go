@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	buf := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(buf)
+	writer := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)),
+			Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"GeoLite2-City_20230815/GeoLite2-City.mmdb": "mmdb"}
+
+	writeZip(t, filepath.Join(dir, "a.zip"), files)
+	writeTarGz(t, filepath.Join(dir, "a.tar.gz"), files)
+
+	for _, name := range []string{"a.zip", "a.tar.gz"} {
+		des := filepath.Join(dir, TrimArchiveSuffix(name))
+		if err := Extract(filepath.Join(dir, name), des); err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(filepath.Join(des, "GeoLite2-City_20230815", "GeoLite2-City.mmdb"))
+		if err != nil || string(content) != "mmdb" {
+			t.Errorf("%s: unexpected content %q, %v", name, content, err)
+		}
+	}
+}
+
+func TestExtract_Unsafe(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"../evil.csv", "a/../../evil.csv", "/etc/evil.csv"} {
+		writeZip(t, filepath.Join(dir, "evil.zip"), map[string]string{name: "evil"})
+		if err := Unzip(filepath.Join(dir, "evil.zip"), filepath.Join(dir, "out")); err == nil {
+			t.Errorf("zip entry %q should be rejected", name)
+		}
+		writeTarGz(t, filepath.Join(dir, "evil.tar.gz"), map[string]string{name: "evil"})
+		if err := Untar(filepath.Join(dir, "evil.tar.gz"), filepath.Join(dir, "out")); err == nil {
+			t.Errorf("tar entry %q should be rejected", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.csv")); !os.IsNotExist(err) {
+		t.Error("file escaped the destination directory")
+	}
+
+	writeZip(t, filepath.Join(dir, "bomb.zip"), map[string]string{"bomb": string(make([]byte, 1024))})
+	err := UnzipWithLimits(filepath.Join(dir, "bomb.zip"), filepath.Join(dir, "bomb"), Limits{MaxFileSize: 512})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+
+	// 前一个文件恰好用尽总大小后，后续文件不能绕过限制
+	buf := new(bytes.Buffer)
+	writer := zip.NewWriter(buf)
+	for _, size := range []int{100, 10000} {
+		w, err := writer.Create(fmt.Sprintf("%d.csv", size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "total.zip"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = UnzipWithLimits(filepath.Join(dir, "total.zip"), filepath.Join(dir, "total"), Limits{MaxTotalSize: 100})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "total", "10000.csv")); err == nil && info.Size() > 0 {
+		t.Errorf("file written beyond total limit: %d bytes", info.Size())
+	}
+}
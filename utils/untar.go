@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+func Untar(src string, des string) error {
+	return UntarWithLimits(src, des, DefaultLimits)
+}
+
+// UntarWithLimits 解压 tar.gz 压缩包到 des 目录，拒绝跳出 des 的路径及链接文件
+func UntarWithLimits(src string, des string, limits Limits) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	e := &extractor{des: des, limits: limits}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := e.mkdir(header.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := e.writeFile(header.Name, os.FileMode(header.Mode)&os.ModePerm, tarReader); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+		default:
+			return fmt.Errorf("不支持的压缩包文件类型：%q", header.Name)
+		}
+	}
+}
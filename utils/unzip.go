@@ -2,45 +2,48 @@ package utils
 
 import (
 	"archive/zip"
-	"io"
+	"fmt"
 	"os"
-	"path/filepath"
 )
 
 func Unzip(src string, des string) error {
+	return UnzipWithLimits(src, des, DefaultLimits)
+}
+
+// UnzipWithLimits 解压 zip 压缩包到 des 目录，拒绝跳出 des 的路径及符号链接
+func UnzipWithLimits(src string, des string, limits Limits) error {
 	zipFile, err := zip.OpenReader(src)
 	if err != nil {
 		return err
 	}
 	defer zipFile.Close()
 
+	e := &extractor{des: des, limits: limits}
 	for _, file := range zipFile.File {
-		path := filepath.Join(des, file.Name)
 		if file.FileInfo().IsDir() {
-			os.MkdirAll(path, os.ModePerm)
+			if err := e.mkdir(file.Name); err != nil {
+				return err
+			}
 			continue
 		}
-
-		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
-			return err
+		if !file.Mode().IsRegular() {
+			return fmt.Errorf("不支持的压缩包文件类型：%q", file.Name)
 		}
 
-		fileReader, err := file.Open()
-		if err != nil {
+		if err := unzipFile(e, file); err != nil {
 			return err
 		}
-		defer fileReader.Close()
+	}
 
-		targetFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
-			return err
-		}
-		defer targetFile.Close()
+	return nil
+}
 
-		if _, err = io.Copy(targetFile, fileReader); err != nil {
-			return err
-		}
+func unzipFile(e *extractor, file *zip.File) error {
+	fileReader, err := file.Open()
+	if err != nil {
+		return err
 	}
+	defer fileReader.Close()
 
-	return nil
+	return e.writeFile(file.Name, file.Mode()&os.ModePerm, fileReader)
 }